@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"devicecapture/internal/app"
+	"devicecapture/internal/blob"
 	"devicecapture/internal/camera"
 	"devicecapture/internal/config"
 	"devicecapture/internal/domain"
 	"devicecapture/internal/domain/detection"
 	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/logger"
+	"devicecapture/internal/outbox"
 	"devicecapture/internal/postgres"
 	"devicecapture/internal/postgres/repos"
 	"devicecapture/internal/pubsub"
@@ -22,38 +24,64 @@ import (
 
 func main() {
 	conf := config.NewConfig()
-	client, cerr := pubsub.BrokerHelper("go-server-"+uuid.New().String(), conf.MqttHost, conf.MqttUser, conf.MqttPassword)
-	if cerr != nil {
-		logger.Fatal().Err(cerr).Msgf("Error creating MQTT client: %v", cerr)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(conf, os.Args[2:]))
 	}
-	if !client.Valid() {
-		logger.Fatal().Msgf("Failed to connect to a client")
+	// The embedded broker only runs in deviceserver, devicecapture always connects to MQTT_HOST
+	bus, cerr := pubsub.NewBusFromConfig(context.Background(), "go-server-"+uuid.New().String(), conf)
+	if cerr != nil {
+		logger.Fatal().Err(cerr).Msgf("Error connecting to the %s bus: %v", conf.Transport, cerr)
 	}
-	defer func(client *pubsub.MqttClient) {
-		_ = client.Close()
-	}(&client)
+	defer func(bus pubsub.Bus) {
+		_ = bus.Close()
+	}(bus)
 	db := postgres.NewAppDb()
 	dberr := db.Connect(conf.DbUrl)
 	if dberr != nil {
 		logger.Fatal().Msgf("Error connecting to database: %v", dberr)
 	}
+	if conf.AutoMigrate {
+		if mErr := db.Migrate(context.Background()); mErr != nil {
+			logger.Fatal().Err(mErr).Msgf("Error migrating database: %v", mErr)
+		}
+	}
 
 	defer db.Db.Close()
+	blobs, blobErr := blob.NewStoreFromConfig(conf)
+	if blobErr != nil {
+		logger.Fatal().Err(blobErr).Msgf("Error configuring blob store: %v", blobErr)
+	}
+
 	//-- Repos
 	queries := db.GetQueries()
 	deps := domain.NewDeps(
 		repos.NewPgDeviceRepo(queries),
 		repos.NewPgHeartbeatRepo(queries),
-		repos.NewPgDetectionRepo(queries),
+		repos.NewPgDetectionRepo(queries, db.Db),
 		repos.NewPgImageRepo(queries),
-		pubsub.NewMqttReceiver(&client, conf),
+		pubsub.NewMqttReceiver(bus, conf, blobs),
+		repos.NewPgDetectionFilterRepo(queries),
+		blobs,
+		repos.NewPgDiscoveryRepo(queries),
+		repos.NewPgDeviceConfigRepo(queries),
+		repos.NewPgOutboxRepo(queries),
+		repos.NewPgUserRepo(queries),
+		repos.NewPgAuditRepo(queries),
+		repos.NewPgCaptureSessionRepo(queries),
 	)
 
 	//-- App
 	appCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	a := app.NewApp(conf, &client, db, deps)
+	a := app.NewApp(conf, bus, db, deps)
+	detector, detErr := detection.NewDetectorFromConfig(conf)
+	if detErr != nil {
+		logger.Fatal().Err(detErr).Msgf("Error configuring object detectors: %v", detErr)
+	}
+	detector = detection.NewFilteringDetector(detector, deps.FilterRepo)
+	// Detections are published from the outbox, so they're only sent once they're stored
+	go outbox.NewRelay(deps, bus).Run(appCtx)
 	sigChan := make(chan os.Signal, 1)
 	defer close(sigChan)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -70,7 +98,7 @@ func main() {
 			case <-appCtx.Done():
 				return
 			default:
-				err := loop(appCtx, a)
+				err := loop(appCtx, a, detector)
 				if err != nil {
 					return
 				}
@@ -90,7 +118,7 @@ func main() {
 	}
 }
 
-func loop(ctx context.Context, a *app.App) error {
+func loop(ctx context.Context, a *app.App, detector detection.ObjectDetector) error {
 	logger.Debug().Str("fn", "main.loop").Msg("begin...")
 	deviceRepo := a.AppDeps.DeviceRepo
 	deviceList, rErr := deviceRepo.ListDevices(ctx)
@@ -100,12 +128,14 @@ func loop(ctx context.Context, a *app.App) error {
 	cs := camera.NewCameraService(
 		a.Conf,
 		a.AppDeps,
-		detection.NewObjectDetectionService(a.Conf),
-		a.MqttClient,
+		detector,
 	)
 	var wg sync.WaitGroup
 	// Call "Snapshot" for each device
 	for _, device := range deviceList {
+		if !device.Enabled || !device.HasCapability(devices.CapabilitySnapshot) {
+			continue
+		}
 		wg.Add(1)
 		go func(d devices.Device) {
 			defer wg.Done()
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"devicecapture/internal/config"
+	"devicecapture/internal/postgres"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: devicecapture migrate <command>
+  up              apply all pending migrations
+  down [steps]    revert the last <steps> migrations (default 1)
+  status          list migrations & when they were applied
+  to <version>    migrate up or down to <version>, 0 reverts everything`
+
+// runMigrate the "migrate" subcommand. Returns the exit code
+func runMigrate(conf *config.Config, args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	db := postgres.NewAppDb()
+	if err := db.Connect(conf.DbUrl); err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to database: %v\n", err)
+		return 1
+	}
+	defer db.Db.Close()
+	m, err := postgres.NewMigrator(db.Db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading migrations: %v\n", err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var changed []postgres.Migration
+	switch args[0] {
+	case "up":
+		changed, err = m.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of steps %q\n", args[1])
+				return 2
+			}
+		}
+		changed, err = m.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		version, pErr := strconv.ParseInt(args[1], 10, 64)
+		if pErr != nil {
+			fmt.Fprintf(os.Stderr, "invalid version %q\n", args[1])
+			return 2
+		}
+		changed, err = m.To(ctx, version)
+	case "status":
+		return printMigrationStatus(ctx, m)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	for _, mig := range changed {
+		fmt.Printf("%06d_%s\n", mig.Version, mig.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
+		return 1
+	}
+	version, err := m.Version(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading schema version: %v\n", err)
+		return 1
+	}
+	fmt.Printf("schema version %d\n", version)
+	return 0
+}
+
+func printMigrationStatus(ctx context.Context, m *postgres.Migrator) int {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading migration status: %v\n", err)
+		return 1
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%06d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	_ = w.Flush()
+	return 0
+}
@@ -1,18 +1,59 @@
 // http Starts an http server that listens on port 4000
 // API routes:
-// /api/domain - List all devices
-// /api/domain/<int:id> - Device detail
+// /api/devices - List (GET) & create (POST) devices
+// /api/devices/<int:id> - Device detail (GET, PUT, DELETE)
+// /api/groups - List (GET) & create (POST) device groups
+// /api/groups/<int:id> - Group detail (GET, PUT, DELETE), /api/groups/<int:id>/devices - Group devices (GET)
+// /api/groups/<int:id>/devices/<int:DeviceID> - Add (PUT) & remove (DELETE) group devices
+// /api/groups/<int:id>/actions/<snapshot|stream|settings|mute|unmute> - Run an action on every device in the group (POST)
+// /api/discovery?status=pending|approved|rejected - Devices that announced themselves on announce/<mac> (GET)
+// /api/discovery/<int:id>/approve - Create & provision an announced device (POST), /api/discovery/<int:id>/reject (POST)
+// /api/devices/<int:id>/config - Desired & reported camera config (GET), set & push the desired config (PUT)
+// /api/configs?drift=true - Every device's config status, optionally only devices that haven't applied theirs (GET)
+// /api/filters - Detection filters (GET), /api/filters/<global|int:DeviceID> (GET, PUT, DELETE)
+// /api/images/<int:ImageID>?size=thumb|medium&annotated=1 - Stored frames (GET, DELETE)
+// /blobs/<key>?size=thumb|medium&annotated=1 - Stored frames by blob key, redirects to a signed URL for S3
+// /api/devices/<int:id>/live.m3u8 - HLS playlist of a streaming device's latest frames (GET)
+// /api/recordings/<DeviceID-StartedAt>/index.m3u8 - HLS playlist of a capture session's frames (GET), its segments
+// are /api/recordings/<DeviceID-StartedAt>/segments/<int:n>.ts, encoded with HLS_FFMPEG, see package hls
+// /api/sessions?device_id=&after=&before=&limit= - Capture sessions, a stream's or snapshot's frames (GET), with
+// their recording_id & HLS playlist_url
+// /api/sessions/<int:id>/frames - A session's frames (GET), /api/sessions/<int:id>/mjpeg?speed= - Replays them as an
+// MJPEG stream at the speed they were captured (GET)
+// /healthz - Health check, the only route besides logging in that doesn't need auth
+// /login - Login page, /api/auth/login (POST) & /api/auth/logout (POST) - Session cookie, /api/auth/me (GET)
+// /api/users - List (GET) & create (POST) users, /api/users/<int:id>/role - Change a user's role (PUT)
+// /api/users/<int:id>/grants - A viewer's or operator's device & group grants (GET, POST), /api/users/<int:id>/grants/<int:GrantID> (DELETE)
+// /api/tokens - List (GET) & create (POST) API tokens
+// /api/tokens/<int:id> - Revoke an API token (DELETE)
+// /api/audit?actor=&action=&target_type=&target_id=&after=&before=&limit=&format=csv - Audit log of device, stream,
+// config, filter & image changes, as JSON or a CSV export (GET)
 // Camera/media routes
-// /camera/<int:DeviceID>/stream - MJPEG stream
-// /camera/<int:DeviceID>/snapshot - JPEG snapshot
+// /image-stream/<int:DeviceID> - MJPEG stream proxied from the device
+// /camera/<int:DeviceID>/snapshot?size=thumb|medium&annotated=1 - The device's latest stored frame (GET)
+// /detection-stream?group=<int:GroupID> - Detection websocket, optionally limited to a group's devices. Clients
+// subscribe to event types, devices, labels & a minimum confidence, see server.WsClientMsg
+// /event-stream?types=&devices=&labels=&min_confidence=&group=<int:GroupID> - The same events as Server-Sent Events,
+// detections missed since Last-Event-ID are replayed from the detections table, see server.EventStreamHandler
 package main
 
 import (
 	"context"
 	"devicecapture/internal/app"
+	"devicecapture/internal/audit"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/blob"
+	"devicecapture/internal/camera"
 	"devicecapture/internal/config"
+	"devicecapture/internal/deviceconfig"
+	"devicecapture/internal/discovery"
 	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/detection"
+	"devicecapture/internal/hls"
+	"devicecapture/internal/homeassistant"
+	"devicecapture/internal/live"
 	"devicecapture/internal/logger"
+	"devicecapture/internal/outbox"
 	"devicecapture/internal/postgres"
 	"devicecapture/internal/postgres/repos"
 	"devicecapture/internal/pubsub"
@@ -28,50 +69,187 @@ import (
 
 func main() {
 	conf := config.NewConfig()
-	client, cerr := pubsub.BrokerHelper("go-deviceserver", conf.MqttHost, conf.MqttUser, conf.MqttPassword)
-	if cerr != nil {
-		logger.Fatal().Msgf("Error creating MQTT client: %v", cerr)
+	if conf.Broker.Embedded {
+		broker, bErr := pubsub.StartBroker(conf.Broker, conf.MqttUser, conf.MqttPassword)
+		if bErr != nil {
+			logger.Fatal().Err(bErr).Msgf("Error starting embedded MQTT broker: %v", bErr)
+		}
+		defer func() {
+			_ = broker.Close()
+		}()
+		conf.MqttHost = broker.Url()
 	}
-	defer func(client *pubsub.MqttClient) {
-		_ = client.Close()
-	}(&client)
-	if !client.Valid() {
-		logger.Fatal().Msgf("Failed to connect to a client")
+	bus, cerr := pubsub.NewBusFromConfig(context.Background(), "go-deviceserver", conf)
+	if cerr != nil {
+		logger.Fatal().Msgf("Error connecting to the %s bus: %v", conf.Transport, cerr)
 	}
+	defer func(bus pubsub.Bus) {
+		_ = bus.Close()
+	}(bus)
 	db := postgres.NewAppDb()
 	dberr := db.Connect(conf.DbUrl)
 	defer db.Db.Close()
 	if dberr != nil {
 		logger.Fatal().Msgf("Error connecting to database: %v", dberr)
 	}
+	if conf.AutoMigrate {
+		if mErr := db.Migrate(context.Background()); mErr != nil {
+			logger.Fatal().Err(mErr).Msgf("Error migrating database: %v", mErr)
+		}
+	}
+
+	blobs, blobErr := blob.NewStoreFromConfig(conf)
+	if blobErr != nil {
+		logger.Fatal().Err(blobErr).Msgf("Error configuring blob store: %v", blobErr)
+	}
 
 	//-- Repos
 	queries := db.GetQueries()
 	deps := domain.NewDeps(
 		repos.NewPgDeviceRepo(queries),
 		repos.NewPgHeartbeatRepo(queries),
-		repos.NewPgDetectionRepo(queries),
+		repos.NewPgDetectionRepo(queries, db.Db),
 		repos.NewPgImageRepo(queries),
-		pubsub.NewMqttReceiver(&client, conf),
+		pubsub.NewMqttReceiver(bus, conf, blobs),
+		repos.NewPgDetectionFilterRepo(queries),
+		blobs,
+		repos.NewPgDiscoveryRepo(queries),
+		repos.NewPgDeviceConfigRepo(queries),
+		repos.NewPgOutboxRepo(queries),
+		repos.NewPgUserRepo(queries),
+		repos.NewPgAuditRepo(queries),
+		repos.NewPgCaptureSessionRepo(queries),
 	)
+	if conf.HomeAssistant.Enabled {
+		publisher, ok := bus.(homeassistant.Publisher)
+		if !ok {
+			logger.Fatal().Msgf("Home Assistant discovery needs retained messages, which the %s bus doesn't support", conf.Transport)
+		}
+		ha := homeassistant.NewService(conf, deps, publisher)
+		// Devices created, updated & deleted through the API update their Home Assistant entities
+		deps.DeviceRepo = homeassistant.NewDeviceRepo(deps.DeviceRepo, ha)
+		haCtx, stopHa := context.WithCancel(context.Background())
+		defer stopHa()
+		if hErr := ha.Run(haCtx, bus); hErr != nil {
+			logger.Fatal().Err(hErr).Msgf("Error subscribing to %s: %v", homeassistant.DetectionTopic, hErr)
+		}
+	}
+	// Streaming clients share one detection subscription, device audit entries are streamed as events
+	hub := live.NewHub(bus)
+	defer func() {
+		_ = hub.Close()
+	}()
+	deps.AuditRepo = live.NewAuditRepo(deps.AuditRepo, hub)
+	// Device creates, updates, deletes & mutes are written to the audit log
+	deps.DeviceRepo = audit.NewDeviceRepo(deps.DeviceRepo, deps.AuditRepo)
 
 	//-- App
-	a := app.NewApp(conf, &client, db, deps)
+	a := app.NewApp(conf, bus, db, deps)
+	// Group actions snapshot & stream from here, so they need a detector like devicecapture's
+	detector, detErr := detection.NewDetectorFromConfig(conf)
+	if detErr != nil {
+		logger.Fatal().Err(detErr).Msgf("Error configuring object detectors: %v", detErr)
+	}
+	detector = detection.NewFilteringDetector(detector, deps.FilterRepo)
+	cameras := camera.NewCameraService(conf, deps, detector)
+	recordings := hls.NewService(conf, deps, hls.NewFfmpegEncoder(conf.Hls.Ffmpeg))
+	disc := discovery.NewService(deps, bus)
+	if lErr := disc.Listen(bus); lErr != nil {
+		logger.Fatal().Err(lErr).Msgf("Error subscribing to %s: %v", discovery.AnnounceTopic, lErr)
+	}
+	configs := deviceconfig.NewService(deps, bus)
+	configCtx, stopConfigs := context.WithCancel(context.Background())
+	defer stopConfigs()
+	if rErr := configs.Run(configCtx, bus); rErr != nil {
+		logger.Fatal().Err(rErr).Msgf("Error subscribing to %s: %v", deviceconfig.AckTopic, rErr)
+	}
+	// Detections are published from the outbox, so they're only sent once they're stored
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	go outbox.NewRelay(deps, bus).Run(relayCtx)
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go live.NewHealthMonitor(deps, hub).Run(healthCtx)
+	authSvc := auth.NewService(conf, deps)
+	if conf.Auth.Enabled {
+		if bErr := authSvc.Bootstrap(context.Background()); bErr != nil {
+			logger.Fatal().Err(bErr).Msgf("Error creating the first user: %v", bErr)
+		}
+		authCtx, stopAuth := context.WithCancel(context.Background())
+		defer stopAuth()
+		go authSvc.Run(authCtx)
+		if conf.Auth.UrlSigningKey == "" {
+			logger.Warn().Msgf("AUTH_URL_SIGNING_KEY isn't set, the frame & stream URLs in MQTT messages & Home Assistant need a login")
+		}
+	} else {
+		logger.Error().Msgf("AUTH_ENABLED=false, anyone who can reach deviceserver can see every camera")
+	}
 
 	// Register HTTP endpoints
+	http.HandleFunc("GET /healthz", server.HealthHandler(a))
+	http.HandleFunc("GET /login", server.LoginPageHandler())
+	http.HandleFunc("POST /api/auth/login", server.LoginHandler(a, authSvc))
+	http.HandleFunc("POST /api/auth/logout", server.LogoutHandler(authSvc))
+	http.HandleFunc("GET /api/auth/me", server.MeHandler())
+	http.HandleFunc("GET /api/users", server.UserListHandler(a))
+	http.HandleFunc("POST /api/users", server.UserCreateHandler(authSvc))
+	http.HandleFunc("PUT /api/users/{id}/role", server.UserRoleUpdateHandler(a))
+	http.HandleFunc("GET /api/users/{id}/grants", server.GrantListHandler(a))
+	http.HandleFunc("POST /api/users/{id}/grants", server.GrantCreateHandler(a))
+	http.HandleFunc("DELETE /api/users/{id}/grants/{grantId}", server.GrantDeleteHandler(a))
+	http.HandleFunc("GET /api/tokens", server.TokenListHandler(a))
+	http.HandleFunc("POST /api/tokens", server.TokenCreateHandler(authSvc))
+	http.HandleFunc("DELETE /api/tokens/{id}", server.TokenDeleteHandler(a))
+	http.HandleFunc("GET /api/audit", server.AuditListHandler(a))
 	http.HandleFunc("/", server.HomePageHandler())
 	http.HandleFunc("/device", server.DeviceListHandler(a))
 	http.HandleFunc("/image-stream/{id}", server.StreamProxyHandler(a))
+	http.HandleFunc("GET /camera/{id}/snapshot", server.CameraSnapshotHandler(a))
 	http.HandleFunc("/heartbeat", server.HeartBeatListHandler(a))
-	http.HandleFunc("/detection-stream", server.DetectionStreamHandler(a))
+	http.HandleFunc("/detection-stream", server.DetectionStreamHandler(a, hub))
+	http.HandleFunc("GET /event-stream", server.EventStreamHandler(a, hub))
+	http.HandleFunc("GET /api/devices", server.DeviceApiListHandler(a))
+	http.HandleFunc("POST /api/devices", server.DeviceCreateHandler(a))
+	http.HandleFunc("GET /api/devices/{id}", server.DeviceHandler(a))
+	http.HandleFunc("PUT /api/devices/{id}", server.DeviceUpdateHandler(a))
+	http.HandleFunc("DELETE /api/devices/{id}", server.DeviceDeleteHandler(a))
+	http.HandleFunc("GET /api/devices/{id}/config", server.DeviceConfigHandler(a))
+	http.HandleFunc("GET /api/devices/{id}/live.m3u8", server.LivePlaylistHandler(a, recordings))
+	http.HandleFunc("GET /api/recordings/{id}/index.m3u8", server.RecordingPlaylistHandler(a, recordings))
+	http.HandleFunc("GET /api/recordings/{id}/segments/{segment}", server.RecordingSegmentHandler(a, recordings))
+	http.HandleFunc("GET /api/sessions", server.CaptureSessionListHandler(a))
+	http.HandleFunc("GET /api/sessions/{id}/frames", server.CaptureSessionFramesHandler(a))
+	http.HandleFunc("GET /api/sessions/{id}/mjpeg", server.CaptureSessionMjpegHandler(a))
+	http.HandleFunc("PUT /api/devices/{id}/config", server.DeviceConfigUpdateHandler(a, configs))
+	http.HandleFunc("GET /api/configs", server.DeviceConfigListHandler(a))
+	http.HandleFunc("GET /api/groups", server.GroupListHandler(a))
+	http.HandleFunc("POST /api/groups", server.GroupCreateHandler(a))
+	http.HandleFunc("GET /api/groups/{id}", server.GroupHandler(a))
+	http.HandleFunc("PUT /api/groups/{id}", server.GroupUpdateHandler(a))
+	http.HandleFunc("DELETE /api/groups/{id}", server.GroupDeleteHandler(a))
+	http.HandleFunc("GET /api/groups/{id}/devices", server.GroupDevicesHandler(a))
+	http.HandleFunc("PUT /api/groups/{id}/devices/{deviceId}", server.GroupDeviceAddHandler(a))
+	http.HandleFunc("DELETE /api/groups/{id}/devices/{deviceId}", server.GroupDeviceRemoveHandler(a))
+	http.HandleFunc("POST /api/groups/{id}/actions/{action}", server.GroupActionHandler(a, cameras))
+	http.HandleFunc("GET /api/discovery", server.DiscoveryListHandler(a))
+	http.HandleFunc("POST /api/discovery/{id}/approve", server.DiscoveryApproveHandler(a, disc))
+	http.HandleFunc("POST /api/discovery/{id}/reject", server.DiscoveryRejectHandler(a, disc))
+	http.HandleFunc("GET /api/filters", server.DetectionFilterListHandler(a))
+	http.HandleFunc("GET /api/filters/{scope}", server.DetectionFilterHandler(a))
+	http.HandleFunc("PUT /api/filters/{scope}", server.DetectionFilterUpdateHandler(a))
+	http.HandleFunc("DELETE /api/filters/{scope}", server.DetectionFilterDeleteHandler(a))
+	http.HandleFunc("GET /api/images/{id}", server.ImageHandler(a))
+	http.HandleFunc("DELETE /api/images/{id}", server.ImageDeleteHandler(a))
+	http.HandleFunc("GET /blobs/{key...}", server.BlobHandler(a))
 
-	fs := http.FileServer(http.Dir("./static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+	http.Handle("/static/", server.StaticHandler("./static"))
 
 	//lis, nErr := net.Listen("tcp", ":")
 
 	appServer := &http.Server{
 		Addr: ":4000",
+		// Every route needs a login or an API token, except /healthz & logging in
+		Handler: authSvc.Middleware(audit.Middleware(http.DefaultServeMux)),
 	}
 	shutdownChan := make(chan bool, 1)
 
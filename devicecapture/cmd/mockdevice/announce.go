@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"devicecapture/internal/config"
+	"devicecapture/internal/discovery"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// announceInterval how often an unprovisioned device re-announces itself
+const announceInterval = 5 * time.Second
+
+// announce simulates an unprovisioned ESP32: it publishes to announce/<mac> every announceInterval
+// until the server pushes its Provisioning to provision/<mac>
+func announce(ctx context.Context, client *pubsub.MqttClient, a devices.Announcement) (discovery.Provisioning, error) {
+	provisioned := make(chan discovery.Provisioning, 1)
+	_, err := client.Subscribe(discovery.ProvisionTopic(a.Mac), func(msg pubsub.Message) {
+		var p discovery.Provisioning
+		if err := json.Unmarshal(msg.Payload, &p); err != nil {
+			log.Printf("mockdevice -> invalid provisioning message: %v", err)
+			return
+		}
+		select {
+		case provisioned <- p:
+		default:
+		}
+	})
+	if err != nil {
+		return discovery.Provisioning{}, err
+	}
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return discovery.Provisioning{}, err
+	}
+	ticker := time.NewTicker(announceInterval)
+	defer ticker.Stop()
+	for {
+		if err := client.Publish("announce/"+a.Mac, payload); err != nil {
+			log.Printf("mockdevice -> error announcing %s: %v", a.Mac, err)
+		} else {
+			log.Printf("mockdevice -> announced %s, waiting for approval", a.Mac)
+		}
+		select {
+		case <-ctx.Done():
+			return discovery.Provisioning{}, ctx.Err()
+		case p := <-provisioned:
+			return p, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// startAnnouncing announces the mock device when MOCK_DEVICE_ANNOUNCE=true, see announce. Once it's
+// provisioned, or straight away when MOCK_DEVICE_ID is set, it listens for config pushes
+func startAnnouncing(ctx context.Context) {
+	deviceId, _ := strconv.ParseInt(os.Getenv("MOCK_DEVICE_ID"), 10, 64)
+	if os.Getenv("MOCK_DEVICE_ANNOUNCE") != "true" && deviceId == 0 {
+		return
+	}
+	mac := os.Getenv("MOCK_DEVICE_MAC")
+	if mac == "" {
+		mac = "de:ad:be:ef:00:01"
+	}
+	deviceUrl := os.Getenv("MOCK_DEVICE_URL")
+	if deviceUrl == "" {
+		deviceUrl = "http://localhost:8080"
+	}
+	tlsConf, err := pubsub.NewTLSConfig(config.NewMqttTLSConfig())
+	if err != nil {
+		log.Printf("mockdevice -> not announcing, error loading MQTT TLS config: %v", err)
+		return
+	}
+	client, err := pubsub.BrokerHelper("mockdevice-"+mac, os.Getenv("MQTT_HOST"), os.Getenv("MQTT_USER"), os.Getenv("MQTT_PASSWORD"), tlsConf)
+	if err != nil || !client.Valid() {
+		log.Printf("mockdevice -> not announcing, error connecting to MQTT: %v", err)
+		return
+	}
+	go func() {
+		defer func() {
+			_ = client.Close()
+		}()
+		if deviceId == 0 {
+			p, err := announce(ctx, &client, devices.Announcement{
+				Mac:             mac,
+				Name:            "mockdevice",
+				DeviceUrl:       deviceUrl,
+				FirmwareVersion: "mock-1.0.0",
+				Resolution:      "VGA",
+				Capabilities:    devices.DefaultCapabilities,
+			})
+			if err != nil {
+				log.Printf("mockdevice -> stopped announcing: %v", err)
+				return
+			}
+			log.Printf("mockdevice -> provisioned as device %d (%s), publishing to %s", p.DeviceID, p.Name, p.ImageTopic)
+			deviceId = p.DeviceID
+		}
+		if err := listenForConfig(&client, deviceId); err != nil {
+			log.Printf("mockdevice -> not listening for config: %v", err)
+			return
+		}
+		<-ctx.Done()
+	}()
+}
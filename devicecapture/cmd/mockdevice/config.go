@@ -0,0 +1,72 @@
+package main
+
+import (
+	"devicecapture/internal/deviceconfig"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// cameraConfig the config the mock camera is running, pushed by the server to config/<device_id>
+var cameraConfig = struct {
+	devices.CameraConfig
+	mu sync.RWMutex
+}{
+	// 250x250 at 4fps until the server pushes something else
+	CameraConfig: devices.CameraConfig{JpegQuality: 12, StreamFps: 4},
+}
+
+// frameSettings the image size, Go JPEG quality & delay between MJPEG frames for the current config
+func frameSettings() (width, height, quality int, delay time.Duration) {
+	cameraConfig.mu.RLock()
+	defer cameraConfig.mu.RUnlock()
+	width, height, ok := devices.FrameSizeDimensions(cameraConfig.FrameSize)
+	if !ok {
+		width, height = 250, 250
+	}
+	// The ESP32 takes 0-63, lower is better. Go takes 1-100, higher is better
+	quality = 100 - int(cameraConfig.JpegQuality)*99/63
+	delay = time.Second / time.Duration(max(cameraConfig.StreamFps, 1))
+	return width, height, quality, delay
+}
+
+// listenForConfig applies configs pushed to the device's config topic & acknowledges them. It starts by
+// acknowledging version 0, like a device that just booted, so the server pushes the desired config
+func listenForConfig(client *pubsub.MqttClient, deviceId int64) error {
+	topic := deviceconfig.ConfigTopic(deviceId)
+	ack := func(version int64, errMsg string) {
+		cameraConfig.mu.RLock()
+		payload, err := json.Marshal(devices.ConfigAck{Version: version, Config: cameraConfig.CameraConfig, Error: errMsg})
+		cameraConfig.mu.RUnlock()
+		if err == nil {
+			err = client.Publish(topic+"/ack", payload)
+		}
+		if err != nil {
+			log.Printf("mockdevice -> error acknowledging config version %d: %v", version, err)
+		}
+	}
+	_, err := client.Subscribe(topic, func(msg pubsub.Message) {
+		var m devices.ConfigMsg
+		if err := json.Unmarshal(msg.Payload, &m); err != nil {
+			log.Printf("mockdevice -> invalid config message: %v", err)
+			return
+		}
+		if err := m.Config.Validate(); err != nil {
+			ack(m.Version, err.Error())
+			return
+		}
+		cameraConfig.mu.Lock()
+		cameraConfig.CameraConfig = m.Config
+		cameraConfig.mu.Unlock()
+		log.Printf("mockdevice -> applied config version %d: %+v", m.Version, m.Config)
+		ack(m.Version, "")
+	})
+	if err != nil {
+		return err
+	}
+	ack(0, "")
+	return nil
+}
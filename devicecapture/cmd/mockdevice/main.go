@@ -2,16 +2,24 @@
 // routes:
 // /ping - Returns 200 Response
 // /stream - MJPEG streaming response
+// With MOCK_DEVICE_ANNOUNCE=true it also announces itself over MQTT like an unprovisioned ESP32,
+// see announce.go. MOCK_DEVICE_MAC & MOCK_DEVICE_URL set what it announces.
+// Once it's provisioned, or straight away when MOCK_DEVICE_ID is set, it applies the camera config pushed
+// to config/<device_id>, see config.go
 package main
 
 import (
 	"bytes"
+	"context"
 	"image"
 	"image/color"
 	"image/jpeg"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"golang.org/x/image/font"
@@ -19,12 +27,12 @@ import (
 	"golang.org/x/image/math/fixed"
 )
 
-func getTestImage() []byte {
-	img := image.NewRGBA(image.Rect(0, 0, 250, 250))
+func getTestImage(width, height, quality int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
 	timestring := time.Now().Format("15:04:05")
 	addLabel(img, 10, 10, timestring)
 	var buf bytes.Buffer
-	err := jpeg.Encode(&buf, img, nil)
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
 	if err != nil {
 		log.Printf("getTestImage -> err: %v", err)
 		return nil
@@ -57,7 +65,8 @@ func mjpegHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("mockdevice -> Error writing boundary: %v", err)
 			return
 		}
-		img := getTestImage()
+		width, height, quality, delay := frameSettings()
+		img := getTestImage(width, height, quality)
 		_, err = w.Write(img)
 		if err != nil {
 			log.Printf("mockdevice -> client disconnected, error writing image: %v, ", err)
@@ -71,12 +80,15 @@ func mjpegHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			log.Printf("mockdevice -> successfully sent frame")
 		}
-		time.Sleep(250 * time.Millisecond)
+		time.Sleep(delay)
 		log.Printf("mockdevice -> sleeping before we continue the loop...")
 	}
 }
 
 func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	startAnnouncing(ctx)
 	http.HandleFunc("/stream", mjpegHandler)
 	http.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -20,7 +20,11 @@ const (
 
 func main() {
 	conf := config.NewConfig()
-	client, cerr := pubsub.BrokerHelper(clientID, conf.MqttHost, conf.MqttUser, conf.MqttPassword)
+	tlsConf, terr := pubsub.NewTLSConfig(conf.MqttTLS)
+	if terr != nil {
+		log.Fatalf("Error loading MQTT TLS config: %v", terr)
+	}
+	client, cerr := pubsub.BrokerHelper(clientID, conf.MqttHost, conf.MqttUser, conf.MqttPassword, tlsConf)
 	if cerr != nil {
 		log.Fatalf("Error creating MQTT client: %v", cerr)
 	}
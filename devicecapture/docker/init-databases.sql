@@ -6,10 +6,5 @@ CREATE DATABASE openblink;
 -- Create the test_openblink database
 CREATE DATABASE test_openblink;
 
--- Connect to openblink database and create schema
-\c openblink;
-\i /docker-entrypoint-initdb.d/01-schema.sql
-
--- Connect to test_openblink database and create schema
-\c test_openblink;
-\i /docker-entrypoint-initdb.d/01-schema.sql
\ No newline at end of file
+-- Tables are created by the migrations in internal/postgres/sql/migrations,
+-- which devicecapture & deviceserver apply on startup (or run `devicecapture migrate up`)
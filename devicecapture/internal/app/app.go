@@ -12,18 +12,18 @@ type StartStreamMessage struct {
 }
 
 type App struct {
-	Conf       *config.Config
-	MqttClient *pubsub.MqttClient
-	Db         *postgres.AppDb
-	AppDeps    *domain.Deps
+	Conf    *config.Config
+	Bus     pubsub.Bus
+	Db      *postgres.AppDb
+	AppDeps *domain.Deps
 }
 
-// NewApp create an App, under the assumption that the MqttClient & AppDb are initialized/connected
-func NewApp(conf *config.Config, mqttClient *pubsub.MqttClient, db *postgres.AppDb, deps *domain.Deps) *App {
+// NewApp create an App, under the assumption that the Bus & AppDb are initialized/connected
+func NewApp(conf *config.Config, bus pubsub.Bus, db *postgres.AppDb, deps *domain.Deps) *App {
 	return &App{
-		Conf:       conf,
-		MqttClient: mqttClient,
-		Db:         db,
-		AppDeps:    deps,
+		Conf:    conf,
+		Bus:     bus,
+		Db:      db,
+		AppDeps: deps,
 	}
 }
@@ -0,0 +1,130 @@
+// Package audit records who started a stream, changed a device, config or detection filter, or deleted an
+// image & its detections. Entries are written with devices.AuditRepo & the audit_log table is append-only.
+// The actor is the request's auth.Principal & the source IP comes from Middleware
+package audit
+
+import (
+	"context"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"net"
+	"net/http"
+	"reflect"
+)
+
+const (
+	// ActorAnonymous requests when auth is disabled
+	ActorAnonymous = "anonymous"
+	// ActorSystem actions taken outside a request
+	ActorSystem = "system"
+)
+
+type sourceKey struct{}
+
+// WithSource marks ctx as a request from ip
+func WithSource(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, ip)
+}
+
+// SourceFrom the IP WithSource set, false outside a request
+func SourceFrom(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(sourceKey{}).(string)
+	return ip, ok
+}
+
+// SourceIP the request's remote IP. X-Forwarded-For isn't trusted, anyone can set it
+func SourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware adds the request's source IP to its context, see WithSource
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithSource(r.Context(), SourceIP(r))))
+	})
+}
+
+// Actor the principal's username & user ID. ActorAnonymous for requests without one & ActorSystem outside requests
+func Actor(ctx context.Context) (string, *int64) {
+	if p, ok := auth.PrincipalFrom(ctx); ok {
+		id := p.User.ID
+		return p.User.Username, &id
+	}
+	if _, ok := SourceFrom(ctx); ok {
+		return ActorAnonymous, nil
+	}
+	return ActorSystem, nil
+}
+
+// Diff the fields of before & after's JSON that differ, ex: {"before": {"device_url": "a"}, "after": {"device_url": "b"}}.
+// Either can be nil, creates only have "after" & deletes only "before". Fields tagged `json:"-"` like passwords
+// are left out
+func Diff(before any, after any) (json.RawMessage, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range b {
+		if av, ok := a[k]; ok && reflect.DeepEqual(v, av) {
+			delete(b, k)
+			delete(a, k)
+		}
+	}
+	return json.Marshal(struct {
+		Before map[string]any `json:"before,omitempty"`
+		After  map[string]any `json:"after,omitempty"`
+	}{Before: b, After: a})
+}
+
+// fields v's JSON object, nil for nil
+func fields(v any) (map[string]any, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil() {
+		return nil, nil
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Record writes an entry for the action ctx's actor took on the target, see Actor & Diff.
+// Errors are logged, they don't fail the action
+func Record(ctx context.Context, repo devices.AuditRepo, action string, targetType string, targetId string, before any, after any) {
+	if repo == nil {
+		return
+	}
+	diff, err := Diff(before, after)
+	if err != nil {
+		logger.Error().Msgf("audit.Record -> %s %s %s: %v", action, targetType, targetId, err)
+		return
+	}
+	actor, actorId := Actor(ctx)
+	ip, _ := SourceFrom(ctx)
+	_, err = repo.CreateAuditEntry(context.WithoutCancel(ctx), devices.CreateAuditParams{
+		Actor:      actor,
+		ActorID:    actorId,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetId,
+		Diff:       diff,
+		SourceIP:   ip,
+	})
+	if err != nil {
+		logger.Error().Msgf("audit.Record -> %s %s %s: %v", action, targetType, targetId, err)
+	}
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	before := devices.Device{ID: 1, Name: "porch", DeviceUrl: "http://10.0.0.2:80", Password: "hunter2"}
+	after := before
+	after.DeviceUrl = "http://10.0.0.3:80"
+	after.Password = "hunter3"
+	tests := []struct {
+		name   string
+		before any
+		after  any
+		want   string
+	}{
+		{name: "update", before: before, after: after, want: `{"before":{"device_url":"http://10.0.0.2:80"},"after":{"device_url":"http://10.0.0.3:80"}}`},
+		{name: "unchanged", before: before, after: before, want: `{}`},
+		{name: "create", before: nil, after: devices.CameraConfig{FrameSize: "VGA", StreamFps: 5}, want: `{"after":{"flash_led":false,"framesize":"VGA","jpeg_quality":0,"stream_fps":5}}`},
+		{name: "nil pointer", before: (*devices.CameraConfig)(nil), after: devices.CameraConfig{FrameSize: "VGA"}, want: `{"after":{"flash_led":false,"framesize":"VGA","jpeg_quality":0,"stream_fps":0}}`},
+		{name: "delete", before: devices.CameraConfig{FrameSize: "VGA"}, after: nil, want: `{"before":{"flash_led":false,"framesize":"VGA","jpeg_quality":0,"stream_fps":0}}`},
+		{name: "nothing", before: nil, after: nil, want: `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := Diff(tt.before, tt.after)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(diff))
+			assert.NotContains(t, string(diff), "hunter", "passwords aren't audited")
+		})
+	}
+}
+
+func TestActor(t *testing.T) {
+	a := assert.New(t)
+	actor, id := Actor(t.Context())
+	a.Equal(ActorSystem, actor)
+	a.Nil(id)
+
+	var ctx = t.Context()
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+	r.RemoteAddr = "192.0.2.10:51234"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	ip, ok := SourceFrom(ctx)
+	a.True(ok)
+	a.Equal("192.0.2.10", ip)
+	actor, id = Actor(ctx)
+	a.Equal(ActorAnonymous, actor, "requests without a principal when auth is disabled")
+	a.Nil(id)
+
+	actor, id = Actor(auth.WithPrincipal(ctx, auth.Principal{User: devices.User{ID: 7, Username: "alice"}}))
+	a.Equal("alice", actor)
+	if a.NotNil(id) {
+		a.Equal(int64(7), *id)
+	}
+}
+
+func TestDeviceRepo(t *testing.T) {
+	a := assert.New(t)
+	audits := devices.NewMockAudit()
+	repo := NewDeviceRepo(devices.NewMockRepo(), audits)
+	ctx := WithSource(auth.WithPrincipal(t.Context(), auth.Principal{User: devices.User{ID: 1, Username: "admin"}}), "192.0.2.10")
+
+	d, err := repo.CreateDevice(ctx, devices.CreateDeviceParams{Name: "porch", DeviceUrl: "http://10.0.0.2:80"})
+	a.NoError(err)
+	_, err = repo.UpdateDevice(ctx, devices.UpdateDeviceParams{ID: d.ID, Name: "porch", DeviceUrl: "http://10.0.0.3:80"})
+	a.NoError(err)
+	_, err = repo.MuteDevice(ctx, d.ID, time.Now().Add(time.Hour))
+	a.NoError(err)
+	a.NoError(repo.DeleteDevice(ctx, d.ID))
+	a.Error(repo.DeleteDevice(ctx, d.ID), "missing devices aren't audited")
+
+	entries, err := audits.ListAuditEntries(ctx, devices.AuditQuery{})
+	a.NoError(err)
+	if !a.Len(entries, 4) {
+		return
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+		a.Equal("admin", e.Actor)
+		a.Equal("192.0.2.10", e.SourceIP)
+		a.Equal(devices.AuditTargetDevice, e.TargetType)
+		a.Equal(d.StringId(), e.TargetID)
+	}
+	a.Equal([]string{devices.AuditDeviceDelete, devices.AuditDeviceMute, devices.AuditDeviceUpdate, devices.AuditDeviceCreate}, actions, "newest first")
+	a.Contains(string(entries[2].Diff), `"before":{"device_url":"http://10.0.0.2:80"`)
+}
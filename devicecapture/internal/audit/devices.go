@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"time"
+)
+
+// DeviceRepo wraps a devices.DeviceRepository, recording device creates, updates, deletes & mutes with the
+// device's before & after state
+type DeviceRepo struct {
+	devices.DeviceRepository
+	audits devices.AuditRepo
+}
+
+func NewDeviceRepo(repo devices.DeviceRepository, audits devices.AuditRepo) *DeviceRepo {
+	return &DeviceRepo{DeviceRepository: repo, audits: audits}
+}
+
+func (r *DeviceRepo) CreateDevice(ctx context.Context, params devices.CreateDeviceParams) (devices.Device, error) {
+	d, err := r.DeviceRepository.CreateDevice(ctx, params)
+	if err != nil {
+		return d, err
+	}
+	Record(ctx, r.audits, devices.AuditDeviceCreate, devices.AuditTargetDevice, d.StringId(), nil, d)
+	return d, nil
+}
+
+func (r *DeviceRepo) UpdateDevice(ctx context.Context, params devices.UpdateDeviceParams) (devices.Device, error) {
+	before, err := r.DeviceRepository.GetDevice(ctx, params.ID)
+	if err != nil {
+		return devices.Device{}, err
+	}
+	d, err := r.DeviceRepository.UpdateDevice(ctx, params)
+	if err != nil {
+		return d, err
+	}
+	Record(ctx, r.audits, devices.AuditDeviceUpdate, devices.AuditTargetDevice, d.StringId(), before, d)
+	return d, nil
+}
+
+func (r *DeviceRepo) DeleteDevice(ctx context.Context, id int64) error {
+	before, err := r.DeviceRepository.GetDevice(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.DeviceRepository.DeleteDevice(ctx, id); err != nil {
+		return err
+	}
+	Record(ctx, r.audits, devices.AuditDeviceDelete, devices.AuditTargetDevice, before.StringId(), before, nil)
+	return nil
+}
+
+func (r *DeviceRepo) MuteDevice(ctx context.Context, deviceId int64, until time.Time) (devices.Device, error) {
+	before, err := r.DeviceRepository.GetDevice(ctx, deviceId)
+	if err != nil {
+		return devices.Device{}, err
+	}
+	d, err := r.DeviceRepository.MuteDevice(ctx, deviceId, until)
+	if err != nil {
+		return d, err
+	}
+	Record(ctx, r.audits, devices.AuditDeviceMute, devices.AuditTargetDevice, d.StringId(), before, d)
+	return d, nil
+}
@@ -0,0 +1,262 @@
+// Package auth logs users in to deviceserver & authenticates API tokens.
+//
+// Browsers log in with a username & password & get a session cookie. Machine clients send
+// "Authorization: Bearer <token>" with a token created through /api/tokens, limited to its scopes.
+// Only SHA-256s of session cookies & tokens are stored, passwords are bcrypt hashes
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"devicecapture/internal/signedurl"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	SessionCookie = "openblink_session"
+	// TokenPrefix API tokens start with this so they're easy to spot, ex: by secret scanners
+	TokenPrefix = "obt_"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrInvalidLogin    = errors.New("invalid username or password")
+)
+
+// dummyHash compared against when a username doesn't exist, so a login takes as long either way
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("open-blink"), bcrypt.DefaultCost)
+
+// Principal who a request is from
+type Principal struct {
+	User devices.User
+	// Token the API token the request was authenticated with, nil for sessions
+	Token *devices.ApiToken
+	// DeviceIDs the devices a viewer or operator was granted, directly or through a group. Nil for admins
+	DeviceIDs map[int64]bool
+}
+
+// Can whether the principal has the scope. Sessions have every scope, tokens only the ones they were created with
+func (p Principal) Can(scope string) bool {
+	if p.Token == nil {
+		return true
+	}
+	return p.Token.HasScope(scope)
+}
+
+type Service struct {
+	UserRepo devices.UserRepo
+	Conf     config.AuthConfig
+	// Signer checks the signed URLs Middleware lets through without a login, nil when they aren't signed
+	Signer *signedurl.Signer
+}
+
+func NewService(conf *config.Config, deps *domain.Deps) *Service {
+	return &Service{
+		UserRepo: deps.UserRepo,
+		Conf:     conf.Auth,
+		Signer:   signedurl.New(conf.Auth.UrlSigningKey, conf.Blob.SignedUrlTTL),
+	}
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func CheckPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// CreateUser validates the username, password & role, storing a hash of the password
+func (s *Service) CreateUser(ctx context.Context, username string, password string, role string) (devices.User, error) {
+	if err := devices.ValidateUser(username, password, role); err != nil {
+		return devices.User{}, err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return devices.User{}, err
+	}
+	return s.UserRepo.CreateUser(ctx, devices.CreateUserParams{Username: username, PasswordHash: hash, Role: role})
+}
+
+// Bootstrap creates Conf.AdminUser as an admin when there aren't any users yet, so a fresh install can log in
+func (s *Service) Bootstrap(ctx context.Context) error {
+	users, err := s.UserRepo.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return nil
+	}
+	if s.Conf.AdminUser == "" {
+		logger.Error().Msgf("auth.Bootstrap -> there aren't any users, set AUTH_ADMIN_USER & AUTH_ADMIN_PASSWORD to create one")
+		return nil
+	}
+	_, err = s.CreateUser(ctx, s.Conf.AdminUser, s.Conf.AdminPassword, devices.RoleAdmin)
+	return err
+}
+
+// Login checks the password & starts a session, returns the session token for the cookie
+func (s *Service) Login(ctx context.Context, username string, password string) (string, devices.Session, error) {
+	user, err := s.UserRepo.GetUserByUsername(ctx, username)
+	if err != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return "", devices.Session{}, ErrInvalidLogin
+	}
+	if !CheckPassword(user.PasswordHash, password) {
+		return "", devices.Session{}, ErrInvalidLogin
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", devices.Session{}, err
+	}
+	session, err := s.UserRepo.CreateSession(ctx, devices.CreateSessionParams{
+		TokenHash: HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(s.Conf.SessionTTL),
+	})
+	if err != nil {
+		return "", devices.Session{}, err
+	}
+	return token, session, nil
+}
+
+// Logout ends the session
+func (s *Service) Logout(ctx context.Context, token string) error {
+	return s.UserRepo.DeleteSession(ctx, HashToken(token))
+}
+
+// CreateToken creates an API token for the user. The token is only returned here, it can't be looked up later
+func (s *Service) CreateToken(ctx context.Context, userId int64, name string, scopes []string, expiresAt time.Time) (string, devices.ApiToken, error) {
+	if err := devices.ValidateApiToken(name, scopes); err != nil {
+		return "", devices.ApiToken{}, err
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", devices.ApiToken{}, err
+	}
+	token = TokenPrefix + token
+	t, err := s.UserRepo.CreateApiToken(ctx, devices.CreateApiTokenParams{
+		UserID:    userId,
+		Name:      name,
+		TokenHash: HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", devices.ApiToken{}, err
+	}
+	return token, t, nil
+}
+
+// Authenticate the request's bearer token or session cookie
+func (s *Service) Authenticate(r *http.Request) (Principal, error) {
+	ctx := r.Context()
+	var p Principal
+	var userId int64
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		t, err := s.UserRepo.GetApiToken(ctx, HashToken(strings.TrimSpace(bearer)))
+		if err != nil {
+			return Principal{}, ErrUnauthenticated
+		}
+		p.Token = &t
+		userId = t.UserID
+	} else {
+		cookie, err := r.Cookie(SessionCookie)
+		if err != nil || cookie.Value == "" {
+			return Principal{}, ErrUnauthenticated
+		}
+		session, err := s.UserRepo.GetSession(ctx, HashToken(cookie.Value))
+		if err != nil {
+			return Principal{}, ErrUnauthenticated
+		}
+		userId = session.UserID
+	}
+	user, err := s.UserRepo.GetUser(ctx, userId)
+	if err != nil {
+		return Principal{}, ErrUnauthenticated
+	}
+	p.User = user
+	if user.Role != devices.RoleAdmin {
+		ids, err := s.UserRepo.ListGrantedDeviceIds(ctx, user.ID)
+		if err != nil {
+			return Principal{}, err
+		}
+		p.DeviceIDs = make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			p.DeviceIDs[id] = true
+		}
+	}
+	return p, nil
+}
+
+// SetSessionCookie HttpOnly & SameSite=Lax, Secure per Conf.SecureCookies
+func (s *Service) SetSessionCookie(w http.ResponseWriter, token string, session devices.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   s.Conf.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Service) ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.Conf.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Run deletes expired sessions every hour until ctx is done
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := s.UserRepo.DeleteExpiredSessions(ctx, now); err != nil {
+				logger.Error().Msgf("auth.Run -> %v", err)
+			}
+		}
+	}
+}
+
+// HashToken the SHA-256 session cookies & API tokens are stored as. They're random, so they don't need a salt
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken 256 random bits
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(t *testing.T) (*Service, devices.User) {
+	svc := NewService(&config.Config{Auth: config.AuthConfig{
+		Enabled:        true,
+		SessionTTL:     time.Hour,
+		AllowedOrigins: []string{"dashboard.example.com"},
+	}}, domain.NewMockDeps())
+	user, err := svc.CreateUser(t.Context(), "admin", "correct horse", devices.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, user
+}
+
+func TestService_Login(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	svc, user := newTestService(t)
+	a.NotEqual("correct horse", user.PasswordHash, "passwords are hashed")
+
+	_, _, err := svc.Login(ctx, "admin", "wrong horse")
+	a.ErrorIs(err, ErrInvalidLogin)
+	_, _, err = svc.Login(ctx, "nobody", "correct horse")
+	a.ErrorIs(err, ErrInvalidLogin, "unknown users get the same error")
+
+	token, session, err := svc.Login(ctx, "admin", "correct horse")
+	a.NoError(err)
+	a.Equal(user.ID, session.UserID)
+	a.Equal(HashToken(token), session.TokenHash, "only the token's hash is stored")
+
+	r := httptest.NewRequest(http.MethodGet, "/api/devices", nil)
+	r.AddCookie(&http.Cookie{Name: SessionCookie, Value: token})
+	p, err := svc.Authenticate(r)
+	a.NoError(err)
+	a.Equal("admin", p.User.Username)
+	a.Nil(p.Token)
+
+	a.NoError(svc.Logout(ctx, token))
+	_, err = svc.Authenticate(r)
+	a.ErrorIs(err, ErrUnauthenticated, "sessions end on logout")
+}
+
+func TestService_CreateUser(t *testing.T) {
+	a := assert.New(t)
+	svc, _ := newTestService(t)
+	_, err := svc.CreateUser(t.Context(), "viewer", "short", devices.RoleViewer)
+	a.ErrorIs(err, devices.ErrInvalidUser)
+	_, err = svc.CreateUser(t.Context(), "", "long enough", devices.RoleViewer)
+	a.ErrorIs(err, devices.ErrInvalidUser)
+	_, err = svc.CreateUser(t.Context(), "viewer", "long enough", "root")
+	a.ErrorIs(err, devices.ErrInvalidUser)
+}
+
+func TestService_Bootstrap(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	svc := NewService(&config.Config{Auth: config.AuthConfig{AdminUser: "admin", AdminPassword: "correct horse"}}, deps)
+	a.NoError(svc.Bootstrap(ctx))
+	a.NoError(svc.Bootstrap(ctx), "the admin is only created when there aren't any users")
+	users, _ := deps.UserRepo.ListUsers(ctx)
+	a.Len(users, 1)
+	a.Equal(devices.RoleAdmin, users[0].Role)
+	_, _, err := svc.Login(ctx, "admin", "correct horse")
+	a.NoError(err)
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := t.Context()
+	svc, user := newTestService(t)
+	session, _, err := svc.Login(ctx, "admin", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := func(scopes ...string) string {
+		tok, _, err := svc.CreateToken(ctx, user.ID, "test", scopes, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	read, write, admin := token(devices.ScopeRead), token(devices.ScopeWrite), token(devices.ScopeAdmin)
+	expired, _, err := svc.CreateToken(ctx, user.ID, "expired", []string{devices.ScopeRead}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		session string
+		bearer  string
+		headers map[string]string
+		want    int
+	}{
+		{name: "health checks are public", method: "GET", path: "/healthz", want: http.StatusOK},
+		{name: "logging in is public", method: "POST", path: "/api/auth/login", want: http.StatusOK},
+		{name: "api needs auth", method: "GET", path: "/api/devices", want: http.StatusUnauthorized},
+		{name: "websocket needs auth", method: "GET", path: "/detection-stream", want: http.StatusUnauthorized},
+		{name: "mjpeg needs auth", method: "GET", path: "/image-stream/1", want: http.StatusUnauthorized},
+		{name: "camera stream needs auth", method: "GET", path: "/camera/1/stream", want: http.StatusUnauthorized},
+		{name: "frames need auth", method: "GET", path: "/static/videos/1/frame.jpeg", want: http.StatusUnauthorized},
+		{name: "browsers are sent to the login page", method: "GET", path: "/", headers: map[string]string{"Accept": "text/html"}, want: http.StatusSeeOther},
+		{name: "unknown token", method: "GET", path: "/api/devices", bearer: "obt_nope", want: http.StatusUnauthorized},
+		{name: "expired token", method: "GET", path: "/api/devices", bearer: expired, want: http.StatusUnauthorized},
+		{name: "unknown session", method: "GET", path: "/api/devices", session: "nope", want: http.StatusUnauthorized},
+		{name: "session", method: "GET", path: "/api/devices", session: session, want: http.StatusOK},
+		{name: "session websocket", method: "GET", path: "/detection-stream", session: session, want: http.StatusOK},
+		{name: "session write", method: "POST", path: "/api/devices", session: session, want: http.StatusOK},
+		{name: "session write from the dashboard", method: "POST", path: "/api/devices", session: session, headers: map[string]string{"Origin": "http://example.com"}, want: http.StatusOK},
+		{name: "session write from an allowed origin", method: "POST", path: "/api/devices", session: session, headers: map[string]string{"Origin": "https://dashboard.example.com"}, want: http.StatusOK},
+		{name: "session write from another site", method: "POST", path: "/api/devices", session: session, headers: map[string]string{"Origin": "https://evil.example.net"}, want: http.StatusForbidden},
+		{name: "session user management", method: "POST", path: "/api/users", session: session, want: http.StatusOK},
+		{name: "read token GET", method: "GET", path: "/api/devices", bearer: read, want: http.StatusOK},
+		{name: "read token mjpeg", method: "GET", path: "/image-stream/1", bearer: read, want: http.StatusOK},
+		{name: "read token POST", method: "POST", path: "/api/devices", bearer: read, want: http.StatusForbidden},
+		{name: "write token POST", method: "POST", path: "/api/devices", bearer: write, want: http.StatusOK},
+		{name: "write token DELETE", method: "DELETE", path: "/api/devices/1", bearer: write, want: http.StatusOK},
+		{name: "write token GET", method: "GET", path: "/api/devices", bearer: write, want: http.StatusForbidden},
+		{name: "write token can't mint tokens", method: "POST", path: "/api/tokens", bearer: write, want: http.StatusForbidden},
+		{name: "write token can't create users", method: "POST", path: "/api/users", bearer: write, want: http.StatusForbidden},
+		{name: "admin token", method: "POST", path: "/api/tokens", bearer: admin, want: http.StatusOK},
+		{name: "tokens skip the origin check", method: "POST", path: "/api/devices", bearer: write, headers: map[string]string{"Origin": "https://evil.example.net"}, want: http.StatusOK},
+	}
+	handler := svc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isPublic(r.URL.Path) {
+			if _, ok := PrincipalFrom(r.Context()); !ok {
+				t.Errorf("%s %s: expected the principal in the request context", r.Method, r.URL.Path)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, strings.NewReader("{}"))
+			if test.session != "" {
+				r.AddCookie(&http.Cookie{Name: SessionCookie, Value: test.session})
+			}
+			if test.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+test.bearer)
+			}
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, test.want, w.Code)
+		})
+	}
+}
+
+func TestMiddleware_Disabled(t *testing.T) {
+	svc, _ := newTestService(t)
+	svc.Conf.Enabled = false
+	handler := svc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/devices", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPrincipal_AllowsDevice(t *testing.T) {
+	granted := map[int64]bool{1: true}
+	tests := []struct {
+		role     string
+		action   string
+		deviceId int64
+		want     bool
+	}{
+		{role: devices.RoleViewer, action: ActionView, deviceId: 1, want: true},
+		{role: devices.RoleViewer, action: ActionView, deviceId: 2, want: false},
+		{role: devices.RoleViewer, action: ActionOperate, deviceId: 1, want: false},
+		{role: devices.RoleOperator, action: ActionOperate, deviceId: 1, want: true},
+		{role: devices.RoleOperator, action: ActionOperate, deviceId: 2, want: false},
+		{role: devices.RoleOperator, action: ActionManage, deviceId: 1, want: false},
+		{role: devices.RoleAdmin, action: ActionManage, deviceId: 2, want: true},
+		{role: "", action: ActionView, deviceId: 1, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role+"/"+tt.action, func(t *testing.T) {
+			p := Principal{User: devices.User{Role: tt.role}, DeviceIDs: granted}
+			assert.Equal(t, tt.want, p.AllowsDevice(tt.action, tt.deviceId))
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/logger"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// publicRoutes don't need a login: the health check & the login page & endpoint
+var publicRoutes = []string{"/healthz", "/login", "/api/auth/login"}
+
+// signedRoutes can be read without a login with a signed URL, see signedurl: the frames in MQTT detection & frame
+// messages and the MJPEG streams & snapshots Home Assistant shows
+var signedRoutes = []string{receiver.BlobRoute, "/image-stream/", "/camera/"}
+
+// adminRoutes can create users & tokens, so API tokens need ScopeAdmin for them or a write token could mint an
+// admin token. The audit log shows what everyone did, so it's admin only too
+var adminRoutes = []string{"/api/users", "/api/tokens", "/api/audit"}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom the principal Middleware authenticated, false when auth is disabled or the route is public
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// RequiredScope the scope an API token needs for the request: ScopeAdmin for adminRoutes, ScopeRead for
+// GETs & ScopeWrite for everything else
+func RequiredScope(r *http.Request) string {
+	for _, route := range adminRoutes {
+		if r.URL.Path == route || strings.HasPrefix(r.URL.Path, route+"/") {
+			return devices.ScopeAdmin
+		}
+	}
+	if safeMethod(r.Method) {
+		return devices.ScopeRead
+	}
+	return devices.ScopeWrite
+}
+
+// Middleware authenticates every request except publicRoutes & GETs of signedRoutes with a valid signature, and checks
+// its scope, see RequiredScope. That covers the websocket & MJPEG streams, browsers send the session cookie with both.
+// Unsafe requests from logged-in browsers must come from deviceserver or Conf.AllowedOrigins.
+// Roles & grants are up to the handlers, see Allowed & AllowedDevice
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Conf.Enabled || isPublic(r.URL.Path) || s.signed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err := s.Authenticate(r)
+		if err != nil && !errors.Is(err, ErrUnauthenticated) {
+			logger.Error().Msgf("auth.Middleware -> %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="openblink"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !p.Can(RequiredScope(r)) {
+			http.Error(w, "Forbidden: the token doesn't have the "+RequiredScope(r)+" scope", http.StatusForbidden)
+			return
+		}
+		if p.Token == nil && !safeMethod(r.Method) && !s.AllowedOrigin(r) {
+			http.Error(w, "Forbidden: cross-origin request", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// AllowedOrigin whether the request's Origin is deviceserver itself or one of Conf.AllowedOrigins.
+// Requests without an Origin aren't from a cross-origin page
+func (s *Service) AllowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, pattern := range s.Conf.AllowedOrigins {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(u.Host)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isPublic(p string) bool {
+	for _, route := range publicRoutes {
+		if p == route {
+			return true
+		}
+	}
+	return false
+}
+
+// signed whether r reads one of the signedRoutes with a valid signature, unsigned or invalid ones need a login
+func (s *Service) signed(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, route := range signedRoutes {
+		if strings.HasPrefix(r.URL.Path, route) {
+			return s.Signer.Valid(r.URL)
+		}
+	}
+	return false
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
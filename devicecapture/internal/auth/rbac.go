@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"slices"
+)
+
+// Actions a role can take on a device
+const (
+	// ActionView see a device, its streams, images, detections, filter & config
+	ActionView = "view"
+	// ActionOperate snapshot, stream, mute & change a device's settings, filter & config
+	ActionOperate = "operate"
+	// ActionManage create, update & delete devices & groups, approve discovered devices, change the global filter &
+	// manage users. Only admins can, so it isn't limited to granted devices
+	ActionManage = "manage"
+)
+
+var roleActions = map[string][]string{
+	devices.RoleViewer:   {ActionView},
+	devices.RoleOperator: {ActionView, ActionOperate},
+	devices.RoleAdmin:    {ActionView, ActionOperate, ActionManage},
+}
+
+// Allows whether the principal's role can take the action, on the devices they can access
+func (p Principal) Allows(action string) bool {
+	return slices.Contains(roleActions[p.User.Role], action)
+}
+
+// CanAccess admins can access every device, viewers & operators the ones they were granted
+func (p Principal) CanAccess(deviceId int64) bool {
+	return p.User.Role == devices.RoleAdmin || p.DeviceIDs[deviceId]
+}
+
+// AllowsDevice whether the principal can take the action on the device
+func (p Principal) AllowsDevice(action string, deviceId int64) bool {
+	return p.Allows(action) && p.CanAccess(deviceId)
+}
+
+// Allowed whether the request's principal can take the action, see Principal.Allows.
+// Everything is allowed when auth is disabled
+func Allowed(ctx context.Context, action string) bool {
+	p, ok := PrincipalFrom(ctx)
+	return !ok || p.Allows(action)
+}
+
+// AllowedDevice whether the request's principal can take the action on the device.
+// Everything is allowed when auth is disabled
+func AllowedDevice(ctx context.Context, action string, deviceId int64) bool {
+	p, ok := PrincipalFrom(ctx)
+	return !ok || p.AllowsDevice(action, deviceId)
+}
+
+// DeviceFilter AllowedDevice for filtering lists & streams, ex: a websocket's detections
+func DeviceFilter(ctx context.Context, action string) func(deviceId int64) bool {
+	p, ok := PrincipalFrom(ctx)
+	return func(deviceId int64) bool {
+		return !ok || p.AllowsDevice(action, deviceId)
+	}
+}
+
+// VisibleDevices the devices the request's principal can view
+func VisibleDevices(ctx context.Context, ds []devices.Device) []devices.Device {
+	visible := DeviceFilter(ctx, ActionView)
+	result := []devices.Device{}
+	for _, d := range ds {
+		if visible(d.ID) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// VisibleGroup the group with only the devices the request's principal can view, false if they can't view any
+// of them. Admins can view every group, even empty ones
+func VisibleGroup(ctx context.Context, g devices.Group) (devices.Group, bool) {
+	if Allowed(ctx, ActionManage) {
+		return g, true
+	}
+	visible := DeviceFilter(ctx, ActionView)
+	ids := []int64{}
+	for _, id := range g.DeviceIDs {
+		if visible(id) {
+			ids = append(ids, id)
+		}
+	}
+	g.DeviceIDs = ids
+	return g, len(ids) > 0
+}
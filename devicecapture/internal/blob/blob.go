@@ -0,0 +1,70 @@
+// Package blob stores frames & other images by key, ex: "videos/1-123/output-1-456.jpeg".
+// Keys are what we store in device_images, so the capture host & deviceserver don't need to share a disk
+package blob
+
+import (
+	"context"
+	"devicecapture/internal/config"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Info describes a stored blob
+type Info struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+	ETag        string
+}
+
+// Store reads & writes blobs by key
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get the caller must close the reader. Returns ErrNotFound if the key doesn't exist
+	Get(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	// Stat returns ErrNotFound if the key doesn't exist
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete is a no-op for keys that don't exist
+	Delete(ctx context.Context, key string) error
+}
+
+// Signer is implemented by stores that can hand out time-limited URLs, so clients fetch blobs directly
+type Signer interface {
+	SignedUrl(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// CleanKey normalizes a key & rejects keys that escape the store, ex: "../etc/passwd"
+func CleanKey(key string) (string, error) {
+	k := strings.TrimPrefix(key, "/")
+	if strings.Contains(k, "\\") || slices.Contains(strings.Split(k, "/"), "..") {
+		return "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	k = path.Clean(k)
+	if k == "." {
+		return "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	return k, nil
+}
+
+// NewStoreFromConfig builds the Store selected by BLOB_STORE
+func NewStoreFromConfig(conf *config.Config) (Store, error) {
+	switch conf.Blob.Backend {
+	case "", config.BlobBackendLocal:
+		return NewLocalStore(conf.Blob.Dir), nil
+	case config.BlobBackendS3:
+		return NewS3Store(conf.Blob.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", conf.Blob.Backend)
+	}
+}
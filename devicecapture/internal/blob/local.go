@@ -0,0 +1,133 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps blobs as files under Root
+type LocalStore struct {
+	Root string
+}
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{Root: root}
+}
+
+// Path the file a key is stored at
+func (s *LocalStore) Path(key string) (string, error) {
+	key = s.legacyKey(key)
+	k, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(k)), nil
+}
+
+// legacyKey device_images used to store absolute paths, ex: /static/videos/1-123/output-1-456.jpeg.
+// Paths under Root are mapped back to their key
+func (s *LocalStore) legacyKey(key string) string {
+	if !filepath.IsAbs(key) {
+		return key
+	}
+	root, err := filepath.Abs(s.Root)
+	if err != nil {
+		return key
+	}
+	rel, err := filepath.Rel(root, key)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return key
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Put writes to a temp file & renames it, so readers never see a partial file
+func (s *LocalStore) Put(_ context.Context, key string, data []byte, _ string) error {
+	fp, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fp), ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fp)
+}
+
+// Get the returned reader is an *os.File, so it can be seeked
+func (s *LocalStore) Get(_ context.Context, key string) (io.ReadCloser, Info, error) {
+	fp, err := s.Path(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, Info{}, notFound(key, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, Info{}, err
+	}
+	return f, fileInfo(key, stat), nil
+}
+
+func (s *LocalStore) Stat(_ context.Context, key string) (Info, error) {
+	fp, err := s.Path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	stat, err := os.Stat(fp)
+	if err != nil {
+		return Info{}, notFound(key, err)
+	}
+	return fileInfo(key, stat), nil
+}
+
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	fp, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func fileInfo(key string, stat os.FileInfo) Info {
+	return Info{
+		Key:         key,
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		ETag:        fmt.Sprintf(`"%s-%x"`, filepath.Base(key), stat.ModTime().UnixNano()),
+	}
+}
+
+func notFound(key string, err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package blob
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "videos/1-123/output-1-456.jpeg", want: "videos/1-123/output-1-456.jpeg"},
+		{key: "/videos//1-123/./output.jpeg", want: "videos/1-123/output.jpeg"},
+		{key: "../etc/passwd", wantErr: true},
+		{key: "videos/../../etc/passwd", wantErr: true},
+		{key: "videos\\..\\x", wantErr: true},
+		{key: "", wantErr: true},
+		{key: "/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := CleanKey(tt.key)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidKey)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	dir := t.TempDir()
+	store := NewLocalStore(dir)
+	key := "videos/1-123/output-1-456.jpeg"
+
+	a.NoError(store.Put(ctx, key, []byte("jpeg"), "image/jpeg"))
+	written, err := os.ReadFile(filepath.Join(dir, "videos", "1-123", "output-1-456.jpeg"))
+	a.NoError(err)
+	a.Equal("jpeg", string(written))
+
+	r, info, err := store.Get(ctx, key)
+	a.NoError(err)
+	body, err := io.ReadAll(r)
+	a.NoError(r.Close())
+	a.NoError(err)
+	a.Equal("jpeg", string(body))
+	a.Equal(int64(4), info.Size)
+	a.Equal("image/jpeg", info.ContentType)
+
+	// Rows written before keys were stored hold absolute paths under the store's root
+	legacy, err := store.Stat(ctx, filepath.Join(dir, key))
+	a.NoError(err)
+	a.Equal(info.Size, legacy.Size)
+
+	a.NoError(store.Delete(ctx, key))
+	_, err = store.Stat(ctx, key)
+	a.ErrorIs(err, ErrNotFound)
+	_, _, err = store.Get(ctx, key)
+	a.ErrorIs(err, ErrNotFound)
+	a.NoError(store.Delete(ctx, key), "deleting a missing key is a no-op")
+
+	a.ErrorIs(store.Put(ctx, "../escape.jpeg", []byte("x"), ""), ErrInvalidKey)
+}
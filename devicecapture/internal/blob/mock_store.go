@@ -0,0 +1,108 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MockStore an in-memory Store
+type MockStore struct {
+	blobs map[string]mockBlob
+	mu    sync.Mutex
+}
+
+type mockBlob struct {
+	data []byte
+	info Info
+}
+
+func NewMockStore() *MockStore {
+	return &MockStore{
+		blobs: map[string]mockBlob{},
+	}
+}
+
+func (m *MockStore) Put(_ context.Context, key string, data []byte, contentType string) error {
+	k, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.blobs[k] = mockBlob{
+		data: slices.Clone(data),
+		info: Info{
+			Key:         k,
+			Size:        int64(len(data)),
+			ModTime:     now,
+			ContentType: contentType,
+			ETag:        fmt.Sprintf(`"%x"`, now.UnixNano()),
+		},
+	}
+	return nil
+}
+
+func (m *MockStore) Get(_ context.Context, key string) (io.ReadCloser, Info, error) {
+	b, err := m.get(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	return mockReader{bytes.NewReader(b.data)}, b.info, nil
+}
+
+func (m *MockStore) Stat(_ context.Context, key string) (Info, error) {
+	b, err := m.get(key)
+	return b.info, err
+}
+
+func (m *MockStore) Delete(_ context.Context, key string) error {
+	k, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, k)
+	return nil
+}
+
+// Keys every stored key, sorted
+func (m *MockStore) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.blobs))
+	for k := range m.blobs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (m *MockStore) get(key string) (mockBlob, error) {
+	k, err := CleanKey(key)
+	if err != nil {
+		return mockBlob{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blobs[k]
+	if !ok {
+		return mockBlob{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return b, nil
+}
+
+// mockReader a seekable ReadCloser, like the *os.File LocalStore returns
+type mockReader struct {
+	*bytes.Reader
+}
+
+func (mockReader) Close() error {
+	return nil
+}
@@ -0,0 +1,295 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"devicecapture/internal/config"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3Service        = "s3"
+	s3TimeFormat     = "20060102T150405Z"
+	s3DateFormat     = "20060102"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	maxSignedExpires = 7 * 24 * time.Hour
+)
+
+// S3Store keeps blobs in an S3-compatible bucket (AWS, MinIO, Garage, etc.).
+// Requests are signed w/ AWS Signature V4
+type S3Store struct {
+	conf     config.S3Config
+	endpoint *url.URL
+	Client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3Store(conf config.S3Config) (*S3Store, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, errors.New("s3 blob store requires an endpoint & bucket")
+	}
+	endpoint, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", conf.Endpoint)
+	}
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+	return &S3Store{
+		conf:     conf,
+		endpoint: endpoint,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	u, err := s.objectUrl(key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := s.do(req, sha256Hex(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s.checkResponse(key, res)
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	res, err := s.object(ctx, http.MethodGet, key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	if err := s.checkResponse(key, res); err != nil {
+		_ = res.Body.Close()
+		return nil, Info{}, err
+	}
+	return res.Body, responseInfo(key, res), nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (Info, error) {
+	res, err := s.object(ctx, http.MethodHead, key)
+	if err != nil {
+		return Info{}, err
+	}
+	defer res.Body.Close()
+	if err := s.checkResponse(key, res); err != nil {
+		return Info{}, err
+	}
+	return responseInfo(key, res), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	res, err := s.object(ctx, http.MethodDelete, key)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := s.checkResponse(key, res); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// SignedUrl a presigned GET URL for key, valid for expires (max 7 days)
+func (s *S3Store) SignedUrl(_ context.Context, key string, expires time.Duration) (string, error) {
+	u, err := s.objectUrl(key)
+	if err != nil {
+		return "", err
+	}
+	if expires <= 0 || expires > maxSignedExpires {
+		return "", fmt.Errorf("signed url expiry must be between 1s and %v", maxSignedExpires)
+	}
+	now := s.now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.conf.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+	return u.String(), nil
+}
+
+func (s *S3Store) object(ctx context.Context, method string, key string) (*http.Response, error) {
+	u, err := s.objectUrl(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req, sha256Hex(nil))
+}
+
+// objectUrl path-style: <endpoint>/<bucket>/<key>, otherwise <scheme>://<bucket>.<host>/<key>
+func (s *S3Store) objectUrl(key string) (*url.URL, error) {
+	k, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.conf.PathStyle {
+		base += "/" + s.conf.Bucket
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+	}
+	u.Path = base + "/" + k
+	u.RawPath = base + "/" + uriEncode(k, false)
+	return &u, nil
+}
+
+// do signs req w/ the Authorization header & sends it
+func (s *S3Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	now := s.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQueryString(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.conf.AccessKey, s.scope(now), signedHeaders, s.signature(now, canonicalRequest),
+	))
+	return s.Client.Do(req)
+}
+
+func (s *S3Store) scope(t time.Time) string {
+	return strings.Join([]string{t.Format(s3DateFormat), s.conf.Region, s3Service, "aws4_request"}, "/")
+}
+
+func (s *S3Store) signature(t time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3TimeFormat),
+		s.scope(t),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSha256([]byte("AWS4"+s.conf.SecretKey), t.Format(s3DateFormat))
+	key = hmacSha256(key, s.conf.Region)
+	key = hmacSha256(key, s3Service)
+	key = hmacSha256(key, "aws4_request")
+	return hex.EncodeToString(hmacSha256(key, stringToSign))
+}
+
+func (s *S3Store) checkResponse(key string, res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s %s", res.Request.Method, key, res.Status, strings.TrimSpace(string(body)))
+}
+
+func responseInfo(key string, res *http.Response) Info {
+	modTime, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return Info{
+		Key:         key,
+		Size:        res.ContentLength,
+		ModTime:     modTime,
+		ContentType: res.Header.Get("Content-Type"),
+		ETag:        res.Header.Get("ETag"),
+	}
+}
+
+// canonicalQueryString query params sorted by key, w/ keys & values URI encoded
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode encodes everything except RFC 3986 unreserved characters, as SigV4 requires
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -1,59 +1,33 @@
 package camera
 
 import (
-	"bytes"
 	"context"
+	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/domain/receiver"
 	"devicecapture/internal/logger"
 	"errors"
 	"fmt"
 	"github.com/mattn/go-mjpeg"
-	"image"
-	"image/jpeg"
 	"io"
 	"net/http"
 	"sync"
 	"time"
 )
 
+// maxSnapshotBytes upper bound on a snapshot, ESP32 UXGA JPEGs are well under this
+const maxSnapshotBytes = 8 << 20
+
 type Api struct {
 	DeviceId string
 	Url      string
+	// Username & Password optional HTTP basic auth credentials, sent w/ every request
+	Username string
+	Password string
 }
 
+// NewFrame wraps a JPEG from the device in a Frame, the JPEG is only decoded if something needs its pixels
 func NewFrame(b []byte) receiver.Frame {
-	img, _, err := image.Decode(bytes.NewReader(b))
-	if err != nil {
-		logger.Error().Msgf("Error decoding image: %v", err)
-		return receiver.Frame{
-			Buf:       []byte{},
-			Image:     nil,
-			Timestamp: time.Now().UnixMilli(),
-		}
-	}
-	return receiver.Frame{
-		Buf:       b,
-		Image:     img,
-		Timestamp: time.Now().UnixMilli(),
-	}
-}
-
-func NewFrameFromImage(img image.Image) receiver.Frame {
-	var buf bytes.Buffer
-	err := jpeg.Encode(&buf, img, nil)
-	if err != nil {
-		logger.Error().Msgf("Error decoding image: %v", err)
-		return receiver.Frame{
-			Buf:       []byte{},
-			Image:     nil,
-			Timestamp: time.Now().UnixMilli(),
-		}
-	}
-	return receiver.Frame{
-		Buf:       buf.Bytes(),
-		Image:     img,
-		Timestamp: time.Now().UnixMilli(),
-	}
+	return receiver.NewFrame(b, time.Now().UnixMilli())
 }
 
 func NewApi(deviceId string, deviceUrl string) Api {
@@ -63,12 +37,38 @@ func NewApi(deviceId string, deviceUrl string) Api {
 	}
 }
 
+// NewDeviceApi an Api for the device, using its credentials
+func NewDeviceApi(d devices.Device) Api {
+	return Api{
+		DeviceId: d.StringId(),
+		Url:      d.DeviceUrl,
+		Username: d.Username,
+		Password: d.Password,
+	}
+}
+
+// newRequest a GET request to the device, w/ basic auth if the device has credentials
+func (a *Api) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if a.Username != "" || a.Password != "" {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	return req, nil
+}
+
 func (a *Api) Ping() bool {
 	pingUrl := a.Url + "/ping"
 	client := &http.Client{
 		Timeout: 1 * time.Second,
 	}
-	resp, err := client.Get(pingUrl)
+	req, err := a.newRequest(context.Background(), pingUrl)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return false
 	}
@@ -81,7 +81,7 @@ func (a *Api) Snapshot(ctx context.Context) (receiver.Frame, error) {
 		Timeout: 2 * time.Second,
 	}
 	url := a.Url + "/snapshot"
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := a.newRequest(ctx, url)
 	empty := receiver.Frame{}
 	if err != nil {
 		return empty, err
@@ -100,11 +100,14 @@ func (a *Api) Snapshot(ctx context.Context) (receiver.Frame, error) {
 	if resp.StatusCode != http.StatusOK {
 		return empty, fmt.Errorf("received %d StatusCode", resp.StatusCode)
 	}
-	img, _, err := image.Decode(resp.Body)
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, maxSnapshotBytes))
 	if err != nil {
 		return empty, err
 	}
-	return NewFrameFromImage(img), nil
+	if !receiver.IsJpeg(buf) {
+		return empty, errors.New("snapshot is not a JPEG")
+	}
+	return NewFrame(buf), nil
 }
 
 // Create a channel to handle decoder results
@@ -117,7 +120,7 @@ func (a *Api) Stream(ctx context.Context, stream *mjpeg.Stream) error {
 	client := &http.Client{}
 	streamUrl := a.Url + "/stream"
 	logger.Debug().Msgf("camera.api -> stream -> Starting stream from %s", streamUrl)
-	req, err := http.NewRequestWithContext(ctx, "GET", streamUrl, nil)
+	req, err := a.newRequest(ctx, streamUrl)
 	if err != nil {
 		return err
 	}
@@ -187,7 +190,7 @@ func (a *Api) StreamFrames(ctx context.Context, imgChan chan<- receiver.Frame) e
 			select {
 			case <-ticker.C:
 				data := stream.Current()
-				if len(data) > 0 {
+				if receiver.IsJpeg(data) {
 					imgChan <- NewFrame(data)
 				}
 			case <-ctx.Done():
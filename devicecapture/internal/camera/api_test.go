@@ -2,6 +2,7 @@ package camera
 
 import (
 	"bytes"
+	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/domain/receiver"
 	"devicecapture/internal/logger"
 	"github.com/mattn/go-mjpeg"
@@ -14,6 +15,7 @@ import (
 	"image"
 	"image/color"
 	"image/jpeg"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -60,8 +62,8 @@ func TestApi_StreamFrames_Success(t *testing.T) {
 	// Wait for at least one frame or timeout
 	select {
 	case frame := <-imgChan:
-		if frame.Image == nil {
-			t.Error("Expected frame to contain an image")
+		if _, err := frame.Image(); err != nil {
+			t.Errorf("Expected frame to contain a decodable image, got: %v", err)
 		}
 		if frame.Timestamp == 0 {
 			t.Error("Expected frame to have a timestamp")
@@ -129,6 +131,33 @@ func TestApi_Stream_ContextCancellation(t *testing.T) {
 	}
 }
 
+func TestApi_SendsCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = w.Write(getTestImage())
+	}))
+	defer server.Close()
+
+	device := devices.Device{ID: 3, DeviceUrl: server.URL, Username: "admin", Password: "hunter2"}
+	api := NewDeviceApi(device)
+	if !api.Ping() {
+		t.Error("Expected Ping() to authenticate w/ the device's credentials")
+	}
+	if _, err := api.Snapshot(t.Context()); err != nil {
+		t.Errorf("Expected Snapshot() to authenticate w/ the device's credentials, got: %v", err)
+	}
+
+	anonymous := NewApi("3", server.URL)
+	if _, err := anonymous.Snapshot(t.Context()); err == nil {
+		t.Error("Expected Snapshot() without credentials to fail")
+	}
+}
+
 func newTestServer(ctx context.Context) *httptest.Server {
 
 	testProxy := func(stream *mjpeg.Stream) {
@@ -194,13 +223,81 @@ func addLabel(img *image.RGBA, x, y int, label string) {
 	d.DrawString(label)
 }
 
+// getVgaTestImage a 640x480 JPEG, the ESP32-CAM's default framesize
+func getVgaTestImage() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x ^ y), G: uint8(x * y), B: uint8(y), A: 255})
+		}
+	}
+	addLabel(img, 10, 10, "benchmark")
+	var buf bytes.Buffer
+	_ = jpeg.Encode(&buf, img, nil)
+	return buf.Bytes()
+}
+
 // Benchmark tests
 func BenchmarkNewFrame(b *testing.B) {
-	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	data := getVgaTestImage()
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		NewFrame(img.Pix)
+		NewFrame(data)
+	}
+}
+
+// BenchmarkFramePipeline_Reencode the previous frame pipeline, for comparison:
+// Snapshot/NewFrame decoded each JPEG, NewFrameFromImage re-encoded it & MqttReceiver.ReceiveFrame encoded it again
+func BenchmarkFramePipeline_Reencode(b *testing.B) {
+	data := getVgaTestImage()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			b.Fatal(err)
+		}
+		if err := jpeg.Encode(io.Discard, img, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFramePipeline_Passthrough frames keep the device's JPEG bytes & write them as-is
+func BenchmarkFramePipeline_Passthrough(b *testing.B) {
+	data := getVgaTestImage()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frame := NewFrame(data)
+		if _, err := io.Discard.Write(frame.Buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFramePipeline_LazyDecode passthrough + a single decode, ex: when a frame is annotated
+func BenchmarkFramePipeline_LazyDecode(b *testing.B) {
+	data := getVgaTestImage()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frame := NewFrame(data)
+		if _, err := io.Discard.Write(frame.Buf); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := frame.Image(); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
 
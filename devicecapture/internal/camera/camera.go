@@ -2,20 +2,41 @@ package camera
 
 import (
 	"context"
+	"devicecapture/internal/audit"
+	"devicecapture/internal/blob"
 	"devicecapture/internal/config"
 	"devicecapture/internal/domain"
 	"devicecapture/internal/domain/detection"
 	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/domain/receiver"
 	"devicecapture/internal/logger"
-	"devicecapture/internal/pubsub"
+	"devicecapture/internal/signedurl"
+	"devicecapture/internal/variants"
 	"errors"
+	"fmt"
 	"slices"
 	"strconv"
 	"sync"
 	"time"
 )
 
+var (
+	ErrDeviceDisabled = errors.New("device is disabled")
+	ErrNotSupported   = errors.New("device does not support this capability")
+	ErrMultiplexing   = errors.New("multiplexing is not supported")
+)
+
+// checkDevice makes sure the device is enabled & has the capability we're about to use
+func checkDevice(d devices.Device, capability string) error {
+	if !d.Enabled {
+		return ErrDeviceDisabled
+	}
+	if !d.HasCapability(capability) {
+		return fmt.Errorf("%w: %s", ErrNotSupported, capability)
+	}
+	return nil
+}
+
 // CameraService provides high-level methods for interacting with camera devices
 type CameraService struct {
 	Config        *config.Config
@@ -24,12 +45,16 @@ type CameraService struct {
 	DetectionRepo devices.DetectionRepo
 	Detector      detection.ObjectDetector
 	ImageRepo     devices.ImageRepo
-	mqttClient    *pubsub.MqttClient
-	connectedIds  []string
-	mu            sync.Mutex
+	BlobStore     blob.Store
+	AuditRepo     devices.AuditRepo
+	SessionRepo   devices.CaptureSessionRepo
+	// UrlSigner signs the frame URLs in detection messages, nil leaves them unsigned
+	UrlSigner    *signedurl.Signer
+	connectedIds []string
+	mu           sync.Mutex
 }
 
-func NewCameraService(conf *config.Config, deps *domain.Deps, detector detection.ObjectDetector, qtClient *pubsub.MqttClient) *CameraService {
+func NewCameraService(conf *config.Config, deps *domain.Deps, detector detection.ObjectDetector) *CameraService {
 	ids := make([]string, 10)
 	cs := &CameraService{
 		Config:        conf,
@@ -37,9 +62,12 @@ func NewCameraService(conf *config.Config, deps *domain.Deps, detector detection
 		FrameRepo:     deps.FrameRepo,
 		DetectionRepo: deps.DetectionRepo,
 		ImageRepo:     deps.ImageRepo,
+		BlobStore:     deps.BlobStore,
+		AuditRepo:     deps.AuditRepo,
+		SessionRepo:   deps.CaptureSessionRepo,
+		UrlSigner:     signedurl.New(conf.Auth.UrlSigningKey, conf.Blob.SignedUrlTTL),
 		connectedIds:  ids,
 		Detector:      detector,
-		mqttClient:    qtClient,
 		mu:            sync.Mutex{},
 	}
 	return cs
@@ -65,28 +93,41 @@ func (s *CameraService) IsStreaming(deviceId string) bool {
 }
 
 func (s *CameraService) Snapshot(ctx context.Context, d devices.Device) error {
+	if err := checkDevice(d, devices.CapabilitySnapshot); err != nil {
+		return err
+	}
 	stringId := d.StringId()
-	api := NewApi(stringId, d.DeviceUrl)
+	api := NewDeviceApi(d)
 	session, sErr := s.FrameRepo.StartSession(stringId)
 	if sErr != nil {
 		return sErr
 	}
 	defer func(FrameRepo receiver.FrameRepository) {
-		_ = FrameRepo.EndSession()
+		_ = FrameRepo.EndSession(session)
 	}(s.FrameRepo)
 
 	frame, err := api.Snapshot(ctx)
 	if err != nil {
 		return err
 	}
+	sessionId := s.startCaptureSession(ctx, d.ID, session)
+	defer s.endCaptureSession(ctx, sessionId)
 	fp := receiver.FramePath(s.Config.VideoPath, session, frame)
-	return s.receiveFrame(ctx, d.ID, fp, frame, true)
+	return s.receiveFrame(ctx, session, sessionId, d.ID, fp, frame, true)
 }
 
-func (s *CameraService) StartStream(ctx context.Context, deviceId string) (*receiver.CaptureSession, error) {
-	if s.IsStreaming(deviceId) {
-		return &receiver.CaptureSession{}, errors.New("multiplexing is not supported")
+// CanStream the error StartStream would return for d before connecting, nil if it can stream
+func (s *CameraService) CanStream(d devices.Device) error {
+	if err := checkDevice(d, devices.CapabilityStream); err != nil {
+		return err
 	}
+	if s.IsStreaming(d.StringId()) {
+		return ErrMultiplexing
+	}
+	return nil
+}
+
+func (s *CameraService) StartStream(ctx context.Context, deviceId string) (*receiver.CaptureSession, error) {
 	// cast the id and grab the device record from the repo
 	id, err := strconv.ParseInt(deviceId, 10, 64)
 	if err != nil {
@@ -98,15 +139,50 @@ func (s *CameraService) StartStream(ctx context.Context, deviceId string) (*rece
 		// invalid id, exit early
 		return &receiver.CaptureSession{}, deviceErr
 	}
-	if device.DeviceUrl == "" {
-		return &receiver.CaptureSession{}, errors.New("invalid Device URL for device ID")
-	} else {
-		logger.Debug().Str("service", "camera.StartStream").
-			Msgf("starting stream for device %s @ %s", deviceId, device.DeviceUrl)
+	if err := s.reserveStream(device); err != nil {
+		return &receiver.CaptureSession{}, err
 	}
-	// Add id string to our list of streaming IDs
-	s.addId(deviceId)
 	defer s.removeId(deviceId)
+	return s.stream(ctx, device)
+}
+
+// TryStartStream starts streaming from d in the background, returning once its stream is reserved, so the device
+// can't be streamed twice. The stream outlives ctx, it has its own timeout
+func (s *CameraService) TryStartStream(ctx context.Context, d devices.Device) error {
+	if err := s.reserveStream(d); err != nil {
+		return err
+	}
+	go func() {
+		defer s.removeId(d.StringId())
+		if _, err := s.stream(context.WithoutCancel(ctx), d); err != nil {
+			logger.Error().Str("service", "camera.TryStartStream").Msgf("error streaming device %d: %v", d.ID, err)
+		}
+	}()
+	return nil
+}
+
+// reserveStream checks d can stream & adds it to the streaming IDs, ErrMultiplexing if it's already streaming.
+// Callers remove the ID when the stream ends
+func (s *CameraService) reserveStream(d devices.Device) error {
+	if err := checkDevice(d, devices.CapabilityStream); err != nil {
+		return err
+	}
+	if d.DeviceUrl == "" {
+		return errors.New("invalid Device URL for device ID")
+	}
+	if !s.tryAddId(d.StringId()) {
+		return ErrMultiplexing
+	}
+	return nil
+}
+
+// stream captures frames from the reserved device until the stream times out
+func (s *CameraService) stream(ctx context.Context, device devices.Device) (*receiver.CaptureSession, error) {
+	id := device.ID
+	deviceId := device.StringId()
+	logger.Debug().Str("service", "camera.StartStream").
+		Msgf("starting stream for device %s @ %s", deviceId, device.DeviceUrl)
+	audit.Record(ctx, s.AuditRepo, devices.AuditStreamStart, devices.AuditTargetDevice, deviceId, nil, nil)
 	// Tell the frame repo that we're starting a session
 	session, sessErr := s.FrameRepo.StartSession(deviceId)
 	if sessErr != nil || session == nil {
@@ -114,8 +190,10 @@ func (s *CameraService) StartStream(ctx context.Context, deviceId string) (*rece
 	}
 	defer func(FrameRepo receiver.FrameRepository) {
 		// make sure we close it out
-		_ = FrameRepo.EndSession()
+		_ = FrameRepo.EndSession(session)
 	}(s.FrameRepo)
+	sessionId := s.startCaptureSession(ctx, id, session)
+	defer s.endCaptureSession(ctx, sessionId)
 
 	// wg ends when the stream is complete
 	var wg sync.WaitGroup
@@ -130,7 +208,7 @@ func (s *CameraService) StartStream(ctx context.Context, deviceId string) (*rece
 	// api goroutine receives JPEGs from the API & passes them to imageChan
 	go func() {
 		defer wg.Done()
-		api := NewApi(deviceId, device.DeviceUrl)
+		api := NewDeviceApi(device)
 		apiErr := api.StreamFrames(streamCtx, imgChan)
 		if apiErr != nil {
 			logger.Error().Str("service", "camera.StartStream").
@@ -161,7 +239,7 @@ func (s *CameraService) StartStream(ctx context.Context, deviceId string) (*rece
 				fp := receiver.FramePath(s.Config.VideoPath, session, img)
 				// Only run inference on 1/2 frames
 				doDetect := session.GetFrameCount()%2 == 0
-				e := s.receiveFrame(streamCtx, id, fp, img, doDetect)
+				e := s.receiveFrame(streamCtx, session, sessionId, id, fp, img, doDetect)
 				if e != nil {
 					logger.Error().Str("service", "camera.StartStream").
 						Msgf("receiveFrame threw %v", e)
@@ -177,7 +255,33 @@ func (s *CameraService) StartStream(ctx context.Context, deviceId string) (*rece
 	return session, nil
 }
 
-func (s *CameraService) receiveFrame(ctx context.Context, deviceId int64, framePath string, frame receiver.Frame, detect bool) error {
+// startCaptureSession records the session so its frames can be browsed later, returning its ID. Capturing carries
+// on without a record, its frames just aren't indexed by session
+func (s *CameraService) startCaptureSession(ctx context.Context, deviceId int64, session *receiver.CaptureSession) *int64 {
+	record, err := s.SessionRepo.CreateCaptureSession(ctx, devices.CreateCaptureSessionParams{
+		DeviceID:    deviceId,
+		SessionPath: receiver.SessionPath(s.Config.VideoPath, session),
+		StartedAt:   time.UnixMilli(session.StartedAt),
+	})
+	if err != nil {
+		logger.Error().Msgf("error recording device %d's capture session: %v", deviceId, err)
+		return nil
+	}
+	return &record.ID
+}
+
+// endCaptureSession once the session's frames are stored, even when ctx is done
+func (s *CameraService) endCaptureSession(ctx context.Context, sessionId *int64) {
+	if sessionId == nil {
+		return
+	}
+	if _, err := s.SessionRepo.EndCaptureSession(context.WithoutCancel(ctx), *sessionId, time.Now()); err != nil {
+		logger.Error().Msgf("error ending capture session %d: %v", *sessionId, err)
+	}
+}
+
+// receiveFrame stores the frame & its detections, indexed by sessionId unless it's nil
+func (s *CameraService) receiveFrame(ctx context.Context, session *receiver.CaptureSession, sessionId *int64, deviceId int64, framePath string, frame receiver.Frame, detect bool) error {
 	var wg sync.WaitGroup
 	if cErr := ctx.Err(); cErr != nil {
 		return nil
@@ -186,70 +290,86 @@ func (s *CameraService) receiveFrame(ctx context.Context, deviceId int64, frameP
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		imageRecord, err := s.ImageRepo.CreateImage(ctx, devices.CreateImageParams{DeviceID: deviceId, ImagePath: framePath})
-		if err != nil {
-			logger.Error().Err(err).
-				Msgf("failed to save image to %s ", framePath)
-			return
-		}
-		if !detect {
-			return
-		}
-		req := detection.Req{
-			DeviceId: deviceId,
-			Frame:    frame,
-		}
-		detections, dErr := s.Detector.DetectObjectsForImage(ctx, req)
-		if dErr != nil {
-			logger.Error().Msgf("\n\ndetection err: %v", dErr)
-			return
+		imageParams := devices.CreateImageParams{DeviceID: deviceId, ImagePath: framePath, SessionID: sessionId}
+		var detections []detection.Detection
+		if detect {
+			var dErr error
+			detections, dErr = s.Detector.DetectObjectsForImage(ctx, detection.Req{
+				DeviceId: deviceId,
+				Frame:    frame,
+			})
+			if dErr != nil {
+				// Keep the frame even though we couldn't run inference on it
+				logger.Error().Msgf("\n\ndetection err: %v", dErr)
+			}
 		}
 		if len(detections) < 1 {
+			if _, err := s.ImageRepo.CreateImage(ctx, imageParams); err != nil {
+				logger.Error().Err(err).
+					Msgf("failed to save image to %s ", framePath)
+			}
 			return
 		}
-		// We have >= 1 detection, store them in the DB & broadcast to MQTT
+		// We have >= 1 detection, annotate the frame so the messages can link to the annotated copy
+		annotated := false
+		if s.Config.AnnotateDetections {
+			annotatedPath, annErr := s.annotateFrame(ctx, framePath, frame, detections)
+			if annErr != nil {
+				logger.Error().Msgf("error annotating %s: %v", framePath, annErr)
+			} else {
+				annotated = true
+				imageParams.AnnotatedPath = annotatedPath
+			}
+		}
 		logger.Debug().Msgf("\n\nCameraService: writing detections: %v", detections)
-		// Loop, transpose items, and write to the repo
-		topic := "detection/" + strconv.Itoa(int(deviceId))
 		var pgDetections []devices.CreateDetectionParams
-		// Set up the slice of DB params
+		// Set up the slice of DB params, CreateImageDetections sets their ImageID
 		for _, d := range detections {
-			pgDetections = append(pgDetections, detectionServiceToPg(deviceId, &imageRecord.ID, d))
-		}
-		// Write to the DB
-		toPublish, err := s.DetectionRepo.CreateDetections(ctx, pgDetections)
-		if err != nil {
-			logger.Error().Msgf("error writing detections to detection repo %v", err)
-			return
+			pgDetections = append(pgDetections, detectionServiceToPg(deviceId, nil, d))
 		}
-		// Loop through, publish each detection
-		thisIp := s.Config.ThisIp
-		for _, d := range toPublish {
-			payload, jsonErr := receiver.DetectionToMsg(thisIp, framePath, d)
-			//payload, jsonErr := json.Marshal(d)
-			if jsonErr != nil {
-				logger.Error().Msgf("error marshalling %v to JSON: %v", d, jsonErr)
-				return
-			}
-			// publish successful detections
-			qtErr := s.mqttClient.Publish(topic, payload)
-			if qtErr != nil {
-				logger.Error().Msgf("error publishing %v: %v", payload, qtErr)
-				return
-			} else {
-				logger.Info().Msgf("published %v to %s", payload, topic)
+		// The image, its detections & their messages are written together, outbox.Relay publishes the messages
+		// to detection/<deviceId>. Muted devices' detections are stored without messages
+		var toMessage devices.OutboxMessageFunc
+		if s.isMuted(ctx, deviceId) {
+			logger.Debug().Msgf("device %d is muted, not publishing %d detections", deviceId, len(pgDetections))
+		} else {
+			topic := "detection/" + strconv.Itoa(int(deviceId))
+			thisIp := s.Config.ThisIp
+			toMessage = func(d devices.Detection) (devices.CreateOutboxParams, error) {
+				payload, jsonErr := receiver.DetectionToMsg(thisIp, s.UrlSigner, framePath, annotated, d)
+				if jsonErr != nil {
+					return devices.CreateOutboxParams{}, fmt.Errorf("error marshalling %v to JSON: %w", d, jsonErr)
+				}
+				return devices.CreateOutboxParams{
+					MessageID: receiver.DetectionMessageID(d),
+					Topic:     topic,
+					Payload:   []byte(payload),
+				}, nil
 			}
 		}
-		return
+		if _, _, err := s.DetectionRepo.CreateImageDetections(ctx, imageParams, pgDetections, toMessage); err != nil {
+			logger.Error().Msgf("error writing %s & its detections: %v", framePath, err)
+		}
 	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		// Update FrameRepo
-		repoErr := s.FrameRepo.ReceiveFrame(frame, framePath)
+		repoErr := s.FrameRepo.ReceiveFrame(session, frame, framePath)
 		if repoErr != nil {
 			logger.Error().Msgf("CameraService.startStream.FrameRepo.ReceiveFrame threw an error %v", repoErr)
+			return
+		}
+		if s.Config.EagerImageVariants {
+			img, imgErr := frame.Image()
+			if imgErr != nil {
+				logger.Error().Msgf("error decoding %s for image variants: %v", framePath, imgErr)
+				return
+			}
+			if vErr := variants.GenerateAll(ctx, s.BlobStore, img, framePath); vErr != nil {
+				logger.Error().Msgf("error generating image variants for %s: %v", framePath, vErr)
+			}
 		}
 		return
 	}()
@@ -258,6 +378,42 @@ func (s *CameraService) receiveFrame(ctx context.Context, deviceId int64, frameP
 	return nil
 }
 
+// annotateFrame draws detections on the frame & stores the copy alongside the original, returns its key
+func (s *CameraService) annotateFrame(ctx context.Context, framePath string, frame receiver.Frame, detections []detection.Detection) (string, error) {
+	img, err := frame.Image()
+	if err != nil {
+		return "", err
+	}
+	buf, err := detection.AnnotateJpeg(img, detections)
+	if err != nil {
+		return "", err
+	}
+	annotatedPath := receiver.AnnotatedFramePath(framePath)
+	if err := s.BlobStore.Put(ctx, annotatedPath, buf, "image/jpeg"); err != nil {
+		return "", err
+	}
+	return annotatedPath, nil
+}
+
+func (s *CameraService) isMuted(ctx context.Context, deviceId int64) bool {
+	d, err := s.DeviceRepo.GetDevice(ctx, deviceId)
+	if err != nil {
+		return false
+	}
+	return d.IsMuted(time.Now())
+}
+
+// tryAddId adds deviceId to the streaming IDs unless it's already streaming, false if it is
+func (s *CameraService) tryAddId(deviceId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.Contains(s.connectedIds, deviceId) {
+		return false
+	}
+	s.connectedIds = append(s.connectedIds, deviceId)
+	return true
+}
+
 func (s *CameraService) addId(deviceId string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
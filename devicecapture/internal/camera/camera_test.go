@@ -5,7 +5,9 @@ import (
 	"devicecapture/internal/config"
 	"devicecapture/internal/domain"
 	"devicecapture/internal/domain/detection"
-	"devicecapture/internal/pubsub"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"errors"
 	"testing"
 	"time"
 )
@@ -23,8 +25,7 @@ func TestCameraService_Start(t *testing.T) {
 		VideoPath:           "",
 		DetectionServiceUrl: "",
 	}
-	client := &pubsub.MqttClient{}
-	svc := NewCameraService(&conf, deps, detect, client)
+	svc := NewCameraService(&conf, deps, detect)
 
 	tests := []struct {
 		deviceId string
@@ -60,4 +61,122 @@ func TestCameraService_Start(t *testing.T) {
 			}
 		})
 	}
+	entries, _ := deps.AuditRepo.ListAuditEntries(t.Context(), devices.AuditQuery{Action: devices.AuditStreamStart})
+	if len(entries) != 1 || entries[0].TargetID != "1" {
+		t.Errorf("expected device 1's stream start to be audited, got %v", entries)
+	}
+	sessions, _ := deps.CaptureSessionRepo.ListCaptureSessions(t.Context(), devices.CaptureSessionQuery{DeviceIDs: []int64{1}})
+	if len(sessions) != 1 || sessions[0].EndedAt.IsZero() {
+		t.Errorf("expected device 1's stream to be recorded as an ended capture session, got %v", sessions)
+	}
+}
+
+func TestCameraService_DisabledDevices(t *testing.T) {
+	deps := domain.NewMockDeps()
+	svc := NewCameraService(&config.Config{}, deps, detection.MockDetectionService{})
+	device := devices.GetMockDevice()
+
+	device.Enabled = false
+	if err := svc.Snapshot(t.Context(), device); !errors.Is(err, ErrDeviceDisabled) {
+		t.Errorf("Expected ErrDeviceDisabled for a disabled device, got: %v", err)
+	}
+
+	device.Enabled = true
+	device.Capabilities = []string{devices.CapabilityStream}
+	if err := svc.Snapshot(t.Context(), device); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported for a device without snapshots, got: %v", err)
+	}
+}
+
+func TestCameraService_CanStream(t *testing.T) {
+	deps := domain.NewMockDeps()
+	svc := NewCameraService(&config.Config{}, deps, detection.MockDetectionService{})
+	device := devices.GetMockDevice()
+
+	if err := svc.CanStream(device); err != nil {
+		t.Errorf("Expected the mock device to be able to stream, got: %v", err)
+	}
+	device.Capabilities = []string{devices.CapabilitySnapshot}
+	if err := svc.CanStream(device); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported for a device without streams, got: %v", err)
+	}
+	device.Capabilities = devices.DefaultCapabilities
+	svc.addId(device.StringId())
+	if err := svc.CanStream(device); !errors.Is(err, ErrMultiplexing) {
+		t.Errorf("Expected ErrMultiplexing for a device that's already streaming, got: %v", err)
+	}
+}
+
+func TestCameraService_TryStartStream(t *testing.T) {
+	deps := domain.NewMockDeps()
+	svc := NewCameraService(&config.Config{VideoPath: "videos"}, deps, detection.MockDetectionService{})
+	device := devices.GetMockDevice()
+	// Nothing listens, the stream ends after its timeout
+	device.DeviceUrl = "http://127.0.0.1:1"
+
+	if err := svc.TryStartStream(t.Context(), device); err != nil {
+		t.Fatalf("Expected the stream to start, got: %v", err)
+	}
+	if !svc.IsStreaming(device.StringId()) {
+		t.Error("Expected the stream to be reserved before TryStartStream returns")
+	}
+	if err := svc.TryStartStream(t.Context(), device); !errors.Is(err, ErrMultiplexing) {
+		t.Errorf("Expected ErrMultiplexing for a device that's already streaming, got: %v", err)
+	}
+	other := devices.GetTestFailDevice()
+	other.Enabled = false
+	if err := svc.TryStartStream(t.Context(), other); !errors.Is(err, ErrDeviceDisabled) {
+		t.Errorf("Expected ErrDeviceDisabled for a disabled device, got: %v", err)
+	}
+}
+
+func TestCameraService_ReceiveFrame(t *testing.T) {
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	svc := NewCameraService(&config.Config{VideoPath: "videos"}, deps, detection.MockDetectionService{})
+	frame := NewFrame(getTestImage())
+	session := receiver.NewCaptureSession("1")
+	sessionId := int64(7)
+
+	if err := svc.receiveFrame(ctx, session, nil, 1, "videos/1/a.jpeg", frame, false); err != nil {
+		t.Fatalf("receiveFrame failed: %v", err)
+	}
+	if err := svc.receiveFrame(ctx, session, &sessionId, 1, "videos/1/b.jpeg", frame, true); err != nil {
+		t.Fatalf("receiveFrame failed: %v", err)
+	}
+	images, _ := deps.ImageRepo.GetImages(ctx, 1)
+	if len(images) != 2 {
+		t.Fatalf("Expected an image record for every frame, got %d", len(images))
+	}
+	if frames, _ := deps.ImageRepo.GetSessionImages(ctx, sessionId); len(frames) != 1 || frames[0].ImagePath != "videos/1/b.jpeg" {
+		t.Errorf("Expected frames to be indexed by their session, got %v", frames)
+	}
+	ds, _ := deps.DetectionRepo.GetDeviceDetectionsAfter(ctx, devices.QueryParams{DeviceID: 1})
+	if len(ds) == 0 {
+		t.Fatal("Expected the mock detector's detections to be stored")
+	}
+	for _, d := range ds {
+		if d.ImageID == nil || *d.ImageID != images[1].ID {
+			t.Errorf("Expected detections to link to the frame they were found in, got %v", d.ImageID)
+		}
+	}
+	outbox := deps.OutboxRepo.(*devices.MockOutbox)
+	if len(outbox.Messages()) != len(ds) {
+		t.Errorf("Expected a message for every detection, got %d", len(outbox.Messages()))
+	}
+
+	if _, err := deps.DeviceRepo.MuteDevice(ctx, 1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("MuteDevice failed: %v", err)
+	}
+	published := len(outbox.Messages())
+	if err := svc.receiveFrame(ctx, session, nil, 1, "videos/1/c.jpeg", frame, true); err != nil {
+		t.Fatalf("receiveFrame failed: %v", err)
+	}
+	after, _ := deps.DetectionRepo.GetDeviceDetectionsAfter(ctx, devices.QueryParams{DeviceID: 1})
+	if len(after) <= len(ds) {
+		t.Error("Expected muted devices' detections to be stored")
+	}
+	if len(outbox.Messages()) != published {
+		t.Error("Expected muted devices' detections not to be published")
+	}
 }
@@ -0,0 +1,95 @@
+package camera
+
+import (
+	"devicecapture/internal/blob"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/detection"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/outbox"
+	"devicecapture/internal/pubsub"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCapture_EndToEnd snapshots a fake device through an embedded broker & checks the frame, detection
+// & end-stream messages a subscriber would see
+func TestCapture_EndToEnd(t *testing.T) {
+	broker, err := pubsub.StartBroker(config.BrokerConfig{Embedded: true, Addr: "127.0.0.1:0"}, "", "")
+	if err != nil {
+		t.Fatalf("StartBroker failed: %v", err)
+	}
+	defer func() {
+		_ = broker.Close()
+	}()
+	client, err := pubsub.NewMqttClient("capture", broker.Url(), "", "")
+	if err != nil {
+		t.Fatalf("NewMqttClient failed: %v", err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	listener, err := pubsub.NewMqttClient("listener", broker.Url(), "", "")
+	if err != nil {
+		t.Fatalf("NewMqttClient failed: %v", err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	messages := make(chan pubsub.Message, 16)
+	for _, topic := range []string{"image/1", "detection/1", "end-stream/1"} {
+		_, err := listener.Subscribe(topic, func(msg pubsub.Message) {
+			messages <- msg
+		})
+		if err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+	}
+
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/snapshot" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = w.Write(getTestImage())
+	}))
+	defer device.Close()
+
+	conf := &config.Config{VideoPath: "videos", ThisIp: "http://0.0.0.0:4000"}
+	deps := domain.NewMockDeps()
+	deps.FrameRepo = pubsub.NewMqttReceiver(&client, conf, blob.NewMockStore())
+	svc := NewCameraService(conf, deps, detection.MockDetectionService{})
+	relay := outbox.NewRelay(deps, &client)
+	d := devices.GetMockDevice()
+	d.DeviceUrl = device.URL
+	if err := svc.Snapshot(t.Context(), d); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if sent, err := relay.RelayPending(t.Context()); err != nil || sent != 1 {
+		t.Fatalf("Expected the detection to be relayed, sent %d: %v", sent, err)
+	}
+
+	seen := map[string]string{}
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 3 {
+		select {
+		case msg := <-messages:
+			seen[msg.Topic] = string(msg.Payload)
+		case <-timeout:
+			t.Fatalf("timed out waiting for messages, got %v", seen)
+		}
+	}
+	if !strings.Contains(seen["image/1"], "videos/1-") {
+		t.Errorf("Expected the frame message to reference its blob key: %s", seen["image/1"])
+	}
+	if !strings.Contains(seen["detection/1"], "train") {
+		t.Errorf("Expected the mock detector's detection: %s", seen["detection/1"])
+	}
+	if !strings.HasPrefix(seen["end-stream/1"], "videos/1-") {
+		t.Errorf("Expected the session path: %s", seen["end-stream/1"])
+	}
+}
@@ -0,0 +1,191 @@
+// Package deviceconfig pushes camera settings to devices & tracks whether they were applied.
+//
+// The desired config is published to config/<device_id> as a devices.ConfigMsg. Devices reply on
+// config/<device_id>/ack with a devices.ConfigAck holding the version & config they're running.
+// Pushes that aren't acknowledged within RetryAfter are published again, up to MaxAttempts times.
+// Devices that restart can publish an ack for version 0 to be sent their config again
+package deviceconfig
+
+import (
+	"context"
+	"devicecapture/internal/audit"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AckTopic devices acknowledge pushes on config/<device_id>/ack
+const AckTopic = "config/+/ack"
+
+const (
+	DefaultRetryAfter  = 30 * time.Second
+	DefaultMaxAttempts = 10
+)
+
+// ackTimeout how long we spend recording a single ack
+const ackTimeout = 10 * time.Second
+
+// ConfigTopic where a device's config is pushed
+func ConfigTopic(deviceId int64) string {
+	return "config/" + strconv.FormatInt(deviceId, 10)
+}
+
+// Publisher publishes messages, ex: a pubsub.Bus
+type Publisher interface {
+	Publish(topic string, payload interface{}) error
+}
+
+// Status a DeviceConfig & how far the device has drifted from it
+type Status struct {
+	devices.DeviceConfig
+	Acked bool `json:"acked"`
+	// Drift the fields where the reported config differs from the desired config
+	Drift []string `json:"drift"`
+}
+
+func NewStatus(c devices.DeviceConfig) Status {
+	return Status{
+		DeviceConfig: c,
+		Acked:        c.Acked(),
+		Drift:        c.Desired.Drift(c.Reported),
+	}
+}
+
+// Drifted whether the device hasn't acknowledged the desired config or is running something else
+func (s Status) Drifted() bool {
+	return !s.Acked || len(s.Drift) > 0
+}
+
+type Service struct {
+	ConfigRepo devices.DeviceConfigRepo
+	AuditRepo  devices.AuditRepo
+	// RetryAfter how long to wait for an ack before pushing again
+	RetryAfter  time.Duration
+	MaxAttempts int32
+	publisher   Publisher
+}
+
+func NewService(deps *domain.Deps, publisher Publisher) *Service {
+	return &Service{
+		ConfigRepo:  deps.ConfigRepo,
+		AuditRepo:   deps.AuditRepo,
+		RetryAfter:  DefaultRetryAfter,
+		MaxAttempts: DefaultMaxAttempts,
+		publisher:   publisher,
+	}
+}
+
+// SetDesired validates & stores the device's config, then pushes it. The change is audited, retries aren't
+func (s *Service) SetDesired(ctx context.Context, deviceId int64, config devices.CameraConfig) (devices.DeviceConfig, error) {
+	if err := config.Validate(); err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	var before *devices.CameraConfig
+	if existing, err := s.ConfigRepo.GetDeviceConfig(ctx, deviceId); err == nil {
+		before = &existing.Desired
+	}
+	c, err := s.ConfigRepo.SetDesiredConfig(ctx, deviceId, config)
+	if err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	audit.Record(ctx, s.AuditRepo, devices.AuditConfigPush, devices.AuditTargetDevice, strconv.FormatInt(deviceId, 10), before, config)
+	if err := s.push(ctx, c); err != nil {
+		// RetryUnacked will have another go
+		logger.Error().Msgf("deviceconfig.SetDesired -> %v", err)
+	}
+	return s.ConfigRepo.GetDeviceConfig(ctx, deviceId)
+}
+
+// HandleAck records an ack published to topic (config/<device_id>/ack)
+func (s *Service) HandleAck(ctx context.Context, topic string, payload []byte) (devices.DeviceConfig, error) {
+	idString, ok := strings.CutSuffix(strings.TrimPrefix(topic, "config/"), "/ack")
+	deviceId, err := strconv.ParseInt(idString, 10, 64)
+	if !ok || err != nil {
+		return devices.DeviceConfig{}, fmt.Errorf("invalid config ack topic %s", topic)
+	}
+	var ack devices.ConfigAck
+	if err := json.Unmarshal(payload, &ack); err != nil {
+		return devices.DeviceConfig{}, fmt.Errorf("invalid config ack: %w", err)
+	}
+	c, err := s.ConfigRepo.RecordConfigAck(ctx, deviceId, ack)
+	if err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	if ack.Error != "" {
+		logger.Error().Msgf("device %d couldn't apply config version %d: %s", deviceId, ack.Version, ack.Error)
+	}
+	return c, nil
+}
+
+// RetryUnacked pushes configs again that weren't acknowledged within RetryAfter, returns how many were pushed
+func (s *Service) RetryUnacked(ctx context.Context) (int, error) {
+	unacked, err := s.ConfigRepo.ListUnackedConfigs(ctx, time.Now().Add(-s.RetryAfter), s.MaxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	pushed := 0
+	for _, c := range unacked {
+		if err := s.push(ctx, c); err != nil {
+			logger.Error().Msgf("deviceconfig.RetryUnacked -> %v", err)
+			continue
+		}
+		pushed++
+	}
+	return pushed, nil
+}
+
+// Run subscribes to AckTopic & retries unacknowledged pushes every RetryAfter until ctx is done
+func (s *Service) Run(ctx context.Context, bus pubsub.Bus) error {
+	sub, err := bus.Subscribe(AckTopic, func(msg pubsub.Message) {
+		ackCtx, cancel := context.WithTimeout(ctx, ackTimeout)
+		defer cancel()
+		if _, err := s.HandleAck(ackCtx, msg.Topic, msg.Payload); err != nil {
+			logger.Error().Msgf("deviceconfig.Run -> %s: %v", msg.Topic, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer func() {
+			_ = sub.Unsubscribe()
+		}()
+		ticker := time.NewTicker(s.RetryAfter)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.RetryUnacked(ctx); err != nil {
+					logger.Error().Msgf("deviceconfig.Run -> %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// push publishes the desired config, recording the attempt even if it fails so a broken device
+// isn't retried forever
+func (s *Service) push(ctx context.Context, c devices.DeviceConfig) error {
+	payload, err := json.Marshal(devices.ConfigMsg{Version: c.DesiredVersion, Config: c.Desired})
+	if err != nil {
+		return err
+	}
+	pubErr := s.publisher.Publish(ConfigTopic(c.DeviceID), payload)
+	if err := s.ConfigRepo.RecordConfigPush(ctx, c.DeviceID); err != nil {
+		return err
+	}
+	if pubErr != nil {
+		return fmt.Errorf("error pushing config version %d to device %d: %w", c.DesiredVersion, c.DeviceID, pubErr)
+	}
+	logger.Debug().Msgf("pushed config version %d to device %d", c.DesiredVersion, c.DeviceID)
+	return nil
+}
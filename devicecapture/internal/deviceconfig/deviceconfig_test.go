@@ -0,0 +1,116 @@
+package deviceconfig
+
+import (
+	"devicecapture/internal/audit"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePublisher records what would've been published, failing while err is set
+type fakePublisher struct {
+	topics   []string
+	payloads [][]byte
+	err      error
+	mu       sync.Mutex
+}
+
+func (f *fakePublisher) Publish(topic string, payload interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.topics = append(f.topics, topic)
+	f.payloads = append(f.payloads, payload.([]byte))
+	return nil
+}
+
+var testConfig = devices.CameraConfig{FrameSize: "UXGA", JpegQuality: 10, FlashLed: true, StreamFps: 4}
+
+func TestService_PushAndAck(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	pub := &fakePublisher{}
+	deps := domain.NewMockDeps()
+	svc := NewService(deps, pub)
+
+	_, err := svc.SetDesired(ctx, 1, devices.CameraConfig{FrameSize: "HUGE"})
+	a.ErrorIs(err, devices.ErrInvalidConfig)
+
+	c, err := svc.SetDesired(ctx, 1, testConfig)
+	a.NoError(err)
+	a.Equal(int32(1), c.PushAttempts)
+	if a.Len(pub.payloads, 1) {
+		a.Equal("config/1", pub.topics[0])
+		var msg devices.ConfigMsg
+		a.NoError(json.Unmarshal(pub.payloads[0], &msg))
+		a.Equal(devices.ConfigMsg{Version: 1, Config: testConfig}, msg)
+	}
+	status := NewStatus(c)
+	a.False(status.Acked)
+	a.True(status.Drifted())
+	entries, err := deps.AuditRepo.ListAuditEntries(ctx, devices.AuditQuery{Action: devices.AuditConfigPush})
+	a.NoError(err)
+	if a.Len(entries, 1, "invalid configs aren't audited") {
+		a.Equal(devices.AuditTargetDevice, entries[0].TargetType)
+		a.Equal("1", entries[0].TargetID)
+		a.Equal(audit.ActorSystem, entries[0].Actor)
+	}
+
+	c, err = svc.HandleAck(ctx, "config/1/ack", []byte(`{"version": 1, "config": {"framesize": "UXGA", "jpeg_quality": 10, "flash_led": true, "stream_fps": 4}}`))
+	a.NoError(err)
+	status = NewStatus(c)
+	a.True(status.Acked)
+	a.Empty(status.Drift)
+	a.False(status.Drifted())
+
+	_, err = svc.HandleAck(ctx, "config/x/ack", []byte(`{}`))
+	a.Error(err)
+	_, err = svc.HandleAck(ctx, "config/1/ack", []byte(`{"version": `))
+	a.Error(err)
+}
+
+func TestService_RetryUnacked(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	pub := &fakePublisher{err: errors.New("broker unavailable")}
+	svc := NewService(domain.NewMockDeps(), pub)
+	svc.RetryAfter = 0
+	svc.MaxAttempts = 3
+
+	c, err := svc.SetDesired(ctx, 1, testConfig)
+	a.NoError(err, "failed pushes are retried later")
+	a.Equal(int32(1), c.PushAttempts)
+
+	pub.err = nil
+	pushed, err := svc.RetryUnacked(ctx)
+	a.NoError(err)
+	a.Equal(1, pushed)
+	pushed, err = svc.RetryUnacked(ctx)
+	a.NoError(err)
+	a.Equal(1, pushed)
+	pushed, err = svc.RetryUnacked(ctx)
+	a.NoError(err)
+	a.Equal(0, pushed, "pushes stop after MaxAttempts")
+
+	// A device that restarted reports version 0 & is sent its config again
+	_, err = svc.HandleAck(ctx, "config/1/ack", []byte(`{"version": 1, "config": {"framesize": "UXGA", "jpeg_quality": 10, "flash_led": true, "stream_fps": 4}}`))
+	a.NoError(err)
+	pushed, err = svc.RetryUnacked(ctx)
+	a.NoError(err)
+	a.Equal(0, pushed, "acknowledged configs aren't pushed")
+	time.Sleep(time.Millisecond)
+	c, err = svc.HandleAck(ctx, "config/1/ack", []byte(`{"version": 0, "config": {"framesize": "VGA", "stream_fps": 4}}`))
+	a.NoError(err)
+	a.Equal([]string{"framesize", "jpeg_quality", "flash_led"}, NewStatus(c).Drift)
+	pushed, err = svc.RetryUnacked(ctx)
+	a.NoError(err)
+	a.Equal(1, pushed)
+}
@@ -0,0 +1,206 @@
+// Package discovery provisions devices that announce themselves over MQTT.
+//
+// An unprovisioned device publishes an Announcement to announce/<mac> until it hears back on provision/<mac>.
+// Announcements are recorded as pending devices, once an operator approves one the device is created &
+// its Provisioning is pushed to provision/<mac>. Approved devices that announce again (ex: after a reboot)
+// are sent their Provisioning again
+package discovery
+
+import (
+	"context"
+	"devicecapture/internal/deviceconfig"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnnounceTopic devices announce themselves on announce/<mac>
+const AnnounceTopic = "announce/+"
+
+// ProvisionTopic where the server pushes a device's Provisioning once it's approved
+func ProvisionTopic(mac string) string {
+	return "provision/" + mac
+}
+
+// announceTimeout how long we spend recording a single announcement
+const announceTimeout = 10 * time.Second
+
+var (
+	ErrNotPending      = errors.New("discovered device is not pending")
+	ErrAlreadyApproved = errors.New("discovered device is already approved")
+)
+
+// Provisioning the assigned device ID & config, pushed to ProvisionTopic
+type Provisioning struct {
+	DeviceID     int64    `json:"device_id"`
+	Name         string   `json:"name"`
+	Enabled      bool     `json:"enabled"`
+	Timezone     string   `json:"timezone"`
+	Resolution   string   `json:"resolution"`
+	Capabilities []string `json:"capabilities"`
+	// ImageTopic where the device publishes frames
+	ImageTopic string `json:"image_topic"`
+	// ConfigTopic where the device's camera config is pushed, see deviceconfig
+	ConfigTopic string `json:"config_topic"`
+}
+
+func NewProvisioning(d devices.Device) Provisioning {
+	return Provisioning{
+		DeviceID:     d.ID,
+		Name:         d.Name,
+		Enabled:      d.Enabled,
+		Timezone:     d.Timezone,
+		Resolution:   d.Resolution,
+		Capabilities: d.Capabilities,
+		ImageTopic:   "image/" + d.StringId(),
+		ConfigTopic:  deviceconfig.ConfigTopic(d.ID),
+	}
+}
+
+// ApproveParams the operator-supplied details for an approved device. The URL, firmware version,
+// resolution & capabilities come from the announcement, the name does too when it's omitted
+type ApproveParams struct {
+	Name     string   `json:"name"`
+	Location string   `json:"location"`
+	Tags     []string `json:"tags"`
+	Timezone string   `json:"timezone"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+}
+
+// Publisher publishes messages, ex: a pubsub.Bus
+type Publisher interface {
+	Publish(topic string, payload interface{}) error
+}
+
+type Service struct {
+	DeviceRepo    devices.DeviceRepository
+	DiscoveryRepo devices.DiscoveryRepo
+	publisher     Publisher
+}
+
+func NewService(deps *domain.Deps, publisher Publisher) *Service {
+	return &Service{
+		DeviceRepo:    deps.DeviceRepo,
+		DiscoveryRepo: deps.DiscoveryRepo,
+		publisher:     publisher,
+	}
+}
+
+// Listen subscribes to AnnounceTopic & records announcements until the bus is closed
+func (s *Service) Listen(bus pubsub.Bus) error {
+	_, err := bus.Subscribe(AnnounceTopic, func(msg pubsub.Message) {
+		ctx, cancel := context.WithTimeout(context.Background(), announceTimeout)
+		defer cancel()
+		if _, err := s.Announce(ctx, msg.Topic, msg.Payload); err != nil {
+			logger.Error().Msgf("discovery.Listen -> %s: %v", msg.Topic, err)
+		}
+	})
+	return err
+}
+
+// Announce records an announcement published to topic (announce/<mac>), re-provisioning approved devices
+func (s *Service) Announce(ctx context.Context, topic string, payload []byte) (devices.DiscoveredDevice, error) {
+	var a devices.Announcement
+	if err := json.Unmarshal(payload, &a); err != nil {
+		return devices.DiscoveredDevice{}, fmt.Errorf("invalid announcement: %w", err)
+	}
+	mac, err := devices.NormalizeMac(strings.TrimPrefix(topic, "announce/"))
+	if err != nil {
+		return devices.DiscoveredDevice{}, err
+	}
+	a.Mac = mac
+	if err := a.Validate(); err != nil {
+		return devices.DiscoveredDevice{}, err
+	}
+	dd, err := s.DiscoveryRepo.UpsertDiscoveredDevice(ctx, a)
+	if err != nil {
+		return devices.DiscoveredDevice{}, err
+	}
+	logger.Debug().Msgf("discovery.Announce -> %s is %s", dd.Mac, dd.Status)
+	if dd.Status == devices.DiscoveryApproved && dd.DeviceID != nil {
+		d, err := s.DeviceRepo.GetDevice(ctx, *dd.DeviceID)
+		if err != nil {
+			return dd, err
+		}
+		return dd, s.provision(dd.Mac, d)
+	}
+	return dd, nil
+}
+
+// Approve creates a device from a pending or rejected announcement & pushes its Provisioning.
+// Devices approved earlier can be approved again if their device record was deleted
+func (s *Service) Approve(ctx context.Context, id int64, params ApproveParams) (devices.Device, error) {
+	dd, err := s.DiscoveryRepo.GetDiscoveredDevice(ctx, id)
+	if err != nil {
+		return devices.Device{}, err
+	}
+	if dd.Status == devices.DiscoveryApproved && dd.DeviceID != nil {
+		return devices.Device{}, fmt.Errorf("%w: %s is device %d", ErrAlreadyApproved, dd.Mac, *dd.DeviceID)
+	}
+	create := devices.CreateDeviceParams{
+		Name:            params.Name,
+		DeviceUrl:       dd.DeviceUrl,
+		Location:        params.Location,
+		Tags:            params.Tags,
+		Timezone:        params.Timezone,
+		Username:        params.Username,
+		Password:        params.Password,
+		FirmwareVersion: dd.FirmwareVersion,
+		Resolution:      dd.Resolution,
+	}
+	if create.Name == "" {
+		create.Name = dd.Name
+	}
+	if create.Name == "" {
+		create.Name = "esp32-" + strings.ReplaceAll(dd.Mac[9:], ":", "")
+	}
+	if len(dd.Capabilities) > 0 {
+		create.Capabilities = dd.Capabilities
+	}
+	if err := devices.ValidateDevice(create.Name, create.DeviceUrl, create.Timezone, create.Resolution, create.Capabilities); err != nil {
+		return devices.Device{}, err
+	}
+	d, err := s.DeviceRepo.CreateDevice(ctx, create)
+	if err != nil {
+		return devices.Device{}, err
+	}
+	if _, err := s.DiscoveryRepo.SetDiscoveredDeviceStatus(ctx, dd.ID, devices.DiscoveryApproved, &d.ID); err != nil {
+		return d, err
+	}
+	if err := s.provision(dd.Mac, d); err != nil {
+		// The device is approved, it'll be provisioned the next time it announces itself
+		logger.Error().Msgf("discovery.Approve -> %v", err)
+	}
+	return d, nil
+}
+
+// Reject a pending device. Its announcements are still recorded, but it isn't provisioned unless it's approved
+func (s *Service) Reject(ctx context.Context, id int64) (devices.DiscoveredDevice, error) {
+	dd, err := s.DiscoveryRepo.GetDiscoveredDevice(ctx, id)
+	if err != nil {
+		return devices.DiscoveredDevice{}, err
+	}
+	if dd.Status != devices.DiscoveryPending {
+		return devices.DiscoveredDevice{}, fmt.Errorf("%w: %s is %s", ErrNotPending, dd.Mac, dd.Status)
+	}
+	return s.DiscoveryRepo.SetDiscoveredDeviceStatus(ctx, dd.ID, devices.DiscoveryRejected, nil)
+}
+
+func (s *Service) provision(mac string, d devices.Device) error {
+	payload, err := json.Marshal(NewProvisioning(d))
+	if err != nil {
+		return err
+	}
+	if err := s.publisher.Publish(ProvisionTopic(mac), payload); err != nil {
+		return fmt.Errorf("error provisioning %s as device %d: %w", mac, d.ID, err)
+	}
+	logger.Info().Msgf("provisioned %s as device %d", mac, d.ID)
+	return nil
+}
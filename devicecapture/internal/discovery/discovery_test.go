@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type published struct {
+	topic   string
+	payload []byte
+}
+
+// fakePublisher records what would've been published
+type fakePublisher struct {
+	msgs []published
+	mu   sync.Mutex
+}
+
+func (f *fakePublisher) Publish(topic string, payload interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.msgs = append(f.msgs, published{topic: topic, payload: payload.([]byte)})
+	return nil
+}
+
+const testAnnouncement = `{"name": "", "device_url": "http://10.0.0.20", "firmware_version": "1.2.0", "resolution": "VGA", "capabilities": ["snapshot", "stream", "flash"]}`
+
+func TestService_Flow(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	pub := &fakePublisher{}
+	svc := NewService(domain.NewMockDeps(), pub)
+
+	dd, err := svc.Announce(ctx, "announce/DEADBEEF0001", []byte(testAnnouncement))
+	a.NoError(err)
+	a.Equal("de:ad:be:ef:00:01", dd.Mac)
+	a.Equal(devices.DiscoveryPending, dd.Status)
+	a.Empty(pub.msgs, "pending devices aren't provisioned")
+
+	d, err := svc.Approve(ctx, dd.ID, ApproveParams{Location: "porch", Timezone: "America/Chicago"})
+	a.NoError(err)
+	a.Equal("esp32-ef0001", d.Name, "the name defaults to the end of the MAC")
+	a.Equal("http://10.0.0.20", d.DeviceUrl)
+	a.Equal("porch", d.Location)
+	a.Equal("1.2.0", d.FirmwareVersion)
+	a.True(d.HasCapability(devices.CapabilityFlash))
+	if a.Len(pub.msgs, 1) {
+		a.Equal("provision/de:ad:be:ef:00:01", pub.msgs[0].topic)
+		var p Provisioning
+		a.NoError(json.Unmarshal(pub.msgs[0].payload, &p))
+		a.Equal(d.ID, p.DeviceID)
+		a.Equal("America/Chicago", p.Timezone)
+		a.Equal("image/"+d.StringId(), p.ImageTopic)
+	}
+	_, err = svc.Approve(ctx, dd.ID, ApproveParams{})
+	a.ErrorIs(err, ErrAlreadyApproved)
+
+	// Rebooted devices announce again & get their config back
+	again, err := svc.Announce(ctx, "announce/de:ad:be:ef:00:01", []byte(testAnnouncement))
+	a.NoError(err)
+	a.Equal(dd.ID, again.ID)
+	a.Equal(devices.DiscoveryApproved, again.Status)
+	a.Len(pub.msgs, 2)
+}
+
+func TestService_Reject(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	pub := &fakePublisher{}
+	svc := NewService(domain.NewMockDeps(), pub)
+
+	dd, err := svc.Announce(ctx, "announce/de:ad:be:ef:00:02", []byte(testAnnouncement))
+	a.NoError(err)
+	rejected, err := svc.Reject(ctx, dd.ID)
+	a.NoError(err)
+	a.Equal(devices.DiscoveryRejected, rejected.Status)
+	_, err = svc.Reject(ctx, dd.ID)
+	a.ErrorIs(err, ErrNotPending)
+
+	_, err = svc.Announce(ctx, "announce/de:ad:be:ef:00:02", []byte(testAnnouncement))
+	a.NoError(err)
+	a.Empty(pub.msgs, "rejected devices aren't provisioned")
+
+	_, err = svc.Approve(ctx, dd.ID, ApproveParams{Name: "garage"})
+	a.NoError(err, "rejected devices can still be approved")
+	a.Len(pub.msgs, 1)
+}
+
+func TestService_InvalidAnnouncements(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		payload string
+	}{
+		{name: "invalid MAC", topic: "announce/porch", payload: testAnnouncement},
+		{name: "invalid JSON", topic: "announce/de:ad:be:ef:00:03", payload: `{"device_url": `},
+		{name: "missing URL", topic: "announce/de:ad:be:ef:00:03", payload: `{"name": "porch"}`},
+		{name: "unknown capability", topic: "announce/de:ad:be:ef:00:03", payload: `{"device_url": "http://10.0.0.20", "capabilities": ["teleport"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewService(domain.NewMockDeps(), &fakePublisher{})
+			_, err := svc.Announce(t.Context(), tt.topic, []byte(tt.payload))
+			assert.Error(t, err)
+			pending, _ := svc.DiscoveryRepo.ListDiscoveredDevices(t.Context(), "")
+			assert.Empty(t, pending)
+		})
+	}
+}
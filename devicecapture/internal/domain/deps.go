@@ -1,34 +1,63 @@
 package domain
 
 import (
+	"devicecapture/internal/blob"
 	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/domain/receiver"
 )
 
 type Deps struct {
-	DeviceRepo    devices.DeviceRepository
-	HeartbeatRepo devices.HeartbeatRepo
-	ImageRepo     devices.ImageRepo
-	DetectionRepo devices.DetectionRepo
-	FrameRepo     receiver.FrameRepository
+	DeviceRepo         devices.DeviceRepository
+	HeartbeatRepo      devices.HeartbeatRepo
+	ImageRepo          devices.ImageRepo
+	DetectionRepo      devices.DetectionRepo
+	FrameRepo          receiver.FrameRepository
+	FilterRepo         devices.DetectionFilterRepo
+	BlobStore          blob.Store
+	DiscoveryRepo      devices.DiscoveryRepo
+	ConfigRepo         devices.DeviceConfigRepo
+	OutboxRepo         devices.OutboxRepo
+	UserRepo           devices.UserRepo
+	AuditRepo          devices.AuditRepo
+	CaptureSessionRepo devices.CaptureSessionRepo
 }
 
-func NewDeps(dev devices.DeviceRepository, hb devices.HeartbeatRepo, detRepo devices.DetectionRepo, img devices.ImageRepo, fr receiver.FrameRepository) *Deps {
+func NewDeps(dev devices.DeviceRepository, hb devices.HeartbeatRepo, detRepo devices.DetectionRepo, img devices.ImageRepo, fr receiver.FrameRepository, filters devices.DetectionFilterRepo, blobs blob.Store, discovery devices.DiscoveryRepo, configs devices.DeviceConfigRepo, outbox devices.OutboxRepo, users devices.UserRepo, audits devices.AuditRepo, sessions devices.CaptureSessionRepo) *Deps {
 	return &Deps{
-		DeviceRepo:    dev,
-		HeartbeatRepo: hb,
-		ImageRepo:     img,
-		DetectionRepo: detRepo,
-		FrameRepo:     fr,
+		DeviceRepo:         dev,
+		HeartbeatRepo:      hb,
+		ImageRepo:          img,
+		DetectionRepo:      detRepo,
+		FrameRepo:          fr,
+		FilterRepo:         filters,
+		BlobStore:          blobs,
+		DiscoveryRepo:      discovery,
+		ConfigRepo:         configs,
+		OutboxRepo:         outbox,
+		UserRepo:           users,
+		AuditRepo:          audits,
+		CaptureSessionRepo: sessions,
 	}
 }
 
 func NewMockDeps() *Deps {
+	detections := devices.NewMockDetection()
+	deviceRepo := devices.NewMockRepo()
+	users := devices.NewMockUsers()
+	users.Groups = deviceRepo
 	return &Deps{
-		DeviceRepo:    devices.NewMockRepo(),
-		HeartbeatRepo: devices.NewMockHeartbeat(),
-		ImageRepo:     devices.NewMockImageRepo(),
-		DetectionRepo: devices.NewMockDetection(),
-		FrameRepo:     receiver.NewMockFrameRepo(),
+		DeviceRepo:         deviceRepo,
+		HeartbeatRepo:      devices.NewMockHeartbeat(),
+		ImageRepo:          detections.Images,
+		DetectionRepo:      detections,
+		FrameRepo:          receiver.NewMockFrameRepo(),
+		FilterRepo:         devices.NewMockDetectionFilter(),
+		BlobStore:          blob.NewMockStore(),
+		DiscoveryRepo:      devices.NewMockDiscovery(),
+		ConfigRepo:         devices.NewMockDeviceConfig(),
+		OutboxRepo:         detections.Outbox,
+		UserRepo:           users,
+		AuditRepo:          devices.NewMockAudit(),
+		CaptureSessionRepo: devices.NewMockCaptureSession(detections.Images),
 	}
 }
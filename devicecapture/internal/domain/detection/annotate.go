@@ -0,0 +1,119 @@
+package detection
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// boxColors palette for bounding boxes, labels always get the same color
+var boxColors = []color.RGBA{
+	{R: 230, G: 25, B: 75, A: 255},
+	{R: 60, G: 180, B: 75, A: 255},
+	{R: 255, G: 225, B: 25, A: 255},
+	{R: 0, G: 130, B: 200, A: 255},
+	{R: 245, G: 130, B: 48, A: 255},
+	{R: 145, G: 30, B: 180, A: 255},
+	{R: 70, G: 240, B: 240, A: 255},
+	{R: 240, G: 50, B: 230, A: 255},
+}
+
+const boxThickness = 2
+
+// Annotate returns a copy of img with each Detection's BBox, label & confidence drawn on it.
+// BBoxes are in pixels, unless every coordinate is within [0, 1], in which case they're
+// treated as relative to the image size. Boxes are clipped to the image bounds
+func Annotate(img image.Image, detections []Detection) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+	for _, d := range detections {
+		rect := bboxRect(d.Bbox, bounds)
+		if rect.Empty() {
+			continue
+		}
+		c := labelColor(d.Label)
+		drawBox(dst, rect, c)
+		drawLabel(dst, rect, fmt.Sprintf("%s %.2f", d.Label, d.Confidence), c)
+	}
+	return dst
+}
+
+// AnnotateJpeg Annotate, encoded as a JPEG
+func AnnotateJpeg(img image.Image, detections []Detection) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Annotate(img, detections), nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func bboxRect(b BBox, bounds image.Rectangle) image.Rectangle {
+	x1, y1, x2, y2 := b.X1, b.Y1, b.X2, b.Y2
+	if x1 <= 1 && y1 <= 1 && x2 <= 1 && y2 <= 1 {
+		w, h := float64(bounds.Dx()), float64(bounds.Dy())
+		x1, x2 = x1*w, x2*w
+		y1, y2 = y1*h, y2*h
+	}
+	rect := image.Rect(int(x1), int(y1), int(x2), int(y2)).Add(bounds.Min)
+	return rect.Intersect(bounds)
+}
+
+func labelColor(label string) color.RGBA {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(label))
+	return boxColors[h.Sum32()%uint32(len(boxColors))]
+}
+
+func drawBox(dst *image.RGBA, rect image.Rectangle, c color.RGBA) {
+	src := image.NewUniform(c)
+	t := boxThickness
+	edges := []image.Rectangle{
+		image.Rect(rect.Min.X, rect.Min.Y, rect.Max.X, rect.Min.Y+t),
+		image.Rect(rect.Min.X, rect.Max.Y-t, rect.Max.X, rect.Max.Y),
+		image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+t, rect.Max.Y),
+		image.Rect(rect.Max.X-t, rect.Min.Y, rect.Max.X, rect.Max.Y),
+	}
+	for _, e := range edges {
+		draw.Draw(dst, e.Intersect(rect), src, image.Point{}, draw.Src)
+	}
+}
+
+// drawLabel draws text on a filled background above the box, or inside it when there's no room above
+func drawLabel(dst *image.RGBA, rect image.Rectangle, text string, c color.RGBA) {
+	face := basicfont.Face7x13
+	metrics := face.Metrics()
+	height := (metrics.Ascent + metrics.Descent).Ceil()
+	width := font.MeasureString(face, text).Ceil()
+	top := rect.Min.Y - height
+	if top < dst.Bounds().Min.Y {
+		top = rect.Min.Y
+	}
+	background := image.Rect(rect.Min.X, top, rect.Min.X+width+2, top+height).Intersect(dst.Bounds())
+	draw.Draw(dst, background, image.NewUniform(c), image.Point{}, draw.Src)
+
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(textColor(c)),
+		Face: face,
+		Dot:  fixed.Point26_6{X: fixed.I(rect.Min.X + 1), Y: fixed.I(top) + metrics.Ascent},
+	}
+	d.DrawString(text)
+}
+
+// textColor black or white, whichever reads better on c
+func textColor(c color.RGBA) color.Color {
+	luma := 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+	if luma > 140 {
+		return color.Black
+	}
+	return color.White
+}
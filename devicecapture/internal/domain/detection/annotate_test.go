@@ -0,0 +1,60 @@
+package detection
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			img.Set(x, y, color.RGBA{R: 10, G: 10, B: 10, A: 255})
+		}
+	}
+	return img
+}
+
+func TestAnnotate(t *testing.T) {
+	a := assert.New(t)
+	img := testImage()
+	detections := []Detection{
+		{Label: "dog", Confidence: 0.9, Bbox: BBox{X1: 50, Y1: 40, X2: 150, Y2: 90}},
+	}
+	out := Annotate(img, detections)
+	a.Equal(img.Bounds(), out.Bounds())
+
+	boxColor := labelColor("dog")
+	a.Equal(boxColor, out.RGBAAt(100, 89), "the bottom edge of the box is drawn")
+	a.Equal(boxColor, out.RGBAAt(50, 60), "the left edge of the box is drawn")
+	a.Equal(img.RGBAAt(100, 60), out.RGBAAt(100, 60), "the inside of the box is untouched")
+	a.Equal(boxColor, out.RGBAAt(51, 30), "the label background is drawn above the box")
+	a.Equal(color.RGBA{R: 10, G: 10, B: 10, A: 255}, img.RGBAAt(100, 89), "the source image is not modified")
+}
+
+func TestAnnotate_RelativeAndOutOfBounds(t *testing.T) {
+	a := assert.New(t)
+	img := testImage()
+	detections := []Detection{
+		{Label: "cat", Confidence: 0.5, Bbox: BBox{X1: 0.5, Y1: 0.5, X2: 1, Y2: 1}},
+		{Label: "train", Confidence: 0.31, Bbox: BBox{X1: 2423.35669, X2: 3278.05127, Y1: 1170.4054, Y2: 1772.38293}},
+		{Label: "person", Confidence: 0.7, Bbox: BBox{X1: -20, Y1: -20, X2: 20, Y2: 20}},
+	}
+	out := Annotate(img, detections)
+	a.Equal(labelColor("cat"), out.RGBAAt(150, 99), "relative boxes are scaled to the image")
+	a.Equal(labelColor("person"), out.RGBAAt(19, 18), "boxes are clipped to the image")
+}
+
+func TestAnnotateJpeg(t *testing.T) {
+	a := assert.New(t)
+	buf, err := AnnotateJpeg(testImage(), []Detection{{Label: "dog", Confidence: 0.9, Bbox: BBox{X1: 1, Y1: 1, X2: 50, Y2: 50}}})
+	a.NoError(err)
+	decoded, err := jpeg.Decode(bytes.NewReader(buf))
+	a.NoError(err)
+	a.Equal(image.Rect(0, 0, 200, 100), decoded.Bounds())
+}
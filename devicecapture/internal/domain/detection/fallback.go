@@ -0,0 +1,34 @@
+package detection
+
+import (
+	"context"
+	"devicecapture/internal/logger"
+)
+
+// FallbackDetector implements ObjectDetector.
+// Requests go to Primary, and are retried against Secondary when Primary returns an error
+type FallbackDetector struct {
+	Primary   ObjectDetector
+	Secondary ObjectDetector
+}
+
+func NewFallbackDetector(primary ObjectDetector, secondary ObjectDetector) *FallbackDetector {
+	return &FallbackDetector{
+		Primary:   primary,
+		Secondary: secondary,
+	}
+}
+
+// DetectObjectsForImage FallbackDetector implements ObjectDetector
+func (f *FallbackDetector) DetectObjectsForImage(ctx context.Context, req Req) ([]Detection, error) {
+	detections, err := f.Primary.DetectObjectsForImage(ctx, req)
+	if err == nil {
+		return detections, nil
+	}
+	if ctx.Err() != nil {
+		return detections, err
+	}
+	logger.Error().Str("service", "detection.FallbackDetector").Err(err).
+		Msgf("primary detector failed for device %d, falling back", req.DeviceId)
+	return f.Secondary.DetectObjectsForImage(ctx, req)
+}
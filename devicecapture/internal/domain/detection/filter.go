@@ -0,0 +1,167 @@
+package detection
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Filter the effective devices.DetectionFilter settings for a single device
+type Filter struct {
+	MinConfidence   float64
+	LabelConfidence map[string]float64
+	AllowLabels     []string
+	DenyLabels      []string
+	Aliases         map[string]string
+}
+
+// NewFilter merges the global filter with a device filter.
+// Device settings win: a non-zero MinConfidence & non-empty AllowLabels replace the global ones,
+// its LabelConfidence & Aliases override matching global keys, and DenyLabels are combined
+func NewFilter(settings []devices.DetectionFilter) Filter {
+	f := Filter{
+		LabelConfidence: map[string]float64{},
+		Aliases:         map[string]string{},
+	}
+	// Global settings come first so device settings are applied on top, without reordering the caller's slice
+	settings = slices.Clone(settings)
+	slices.SortStableFunc(settings, func(a, b devices.DetectionFilter) int {
+		if a.DeviceID == nil && b.DeviceID != nil {
+			return -1
+		}
+		if a.DeviceID != nil && b.DeviceID == nil {
+			return 1
+		}
+		return 0
+	})
+	for _, s := range settings {
+		if s.DeviceID == nil || s.MinConfidence > 0 {
+			f.MinConfidence = s.MinConfidence
+		}
+		for label, c := range s.LabelConfidence {
+			f.LabelConfidence[normalizeLabel(label)] = c
+		}
+		if len(s.AllowLabels) > 0 {
+			f.AllowLabels = normalizeLabels(s.AllowLabels)
+		}
+		f.DenyLabels = append(f.DenyLabels, normalizeLabels(s.DenyLabels)...)
+		for label, alias := range s.Aliases {
+			f.Aliases[normalizeLabel(label)] = alias
+		}
+	}
+	return f
+}
+
+// Apply drops detections that don't pass the filter & renames aliased labels.
+// Allow, deny & confidence rules match either the original or the aliased label
+func (f Filter) Apply(detections []Detection) []Detection {
+	var value []Detection
+	for _, d := range detections {
+		original := normalizeLabel(d.Label)
+		if alias, ok := f.Aliases[original]; ok {
+			d.Label = alias
+		}
+		labels := []string{original, normalizeLabel(d.Label)}
+		if f.matches(f.DenyLabels, labels) {
+			continue
+		}
+		if len(f.AllowLabels) > 0 && !f.matches(f.AllowLabels, labels) {
+			continue
+		}
+		if d.Confidence < f.minConfidence(labels) {
+			continue
+		}
+		value = append(value, d)
+	}
+	return value
+}
+
+func (f Filter) matches(list []string, labels []string) bool {
+	return slices.ContainsFunc(labels, func(l string) bool {
+		return slices.Contains(list, l)
+	})
+}
+
+// minConfidence label overrides (aliased label first) fall back to MinConfidence
+func (f Filter) minConfidence(labels []string) float64 {
+	for _, l := range slices.Backward(labels) {
+		if c, ok := f.LabelConfidence[l]; ok {
+			return c
+		}
+	}
+	return f.MinConfidence
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.TrimSpace(label))
+}
+
+func normalizeLabels(labels []string) []string {
+	value := make([]string, 0, len(labels))
+	for _, l := range labels {
+		value = append(value, normalizeLabel(l))
+	}
+	return value
+}
+
+// FilteringDetector implements ObjectDetector.
+// It runs Detector & applies the device's Filter to the results.
+// Filters are cached for CacheFor so we don't query the repo on every frame
+type FilteringDetector struct {
+	Detector ObjectDetector
+	Repo     devices.DetectionFilterRepo
+	CacheFor time.Duration
+	mu       sync.Mutex
+	cache    map[int64]cachedFilter
+}
+
+type cachedFilter struct {
+	filter    Filter
+	expiresAt time.Time
+}
+
+func NewFilteringDetector(detector ObjectDetector, repo devices.DetectionFilterRepo) *FilteringDetector {
+	return &FilteringDetector{
+		Detector: detector,
+		Repo:     repo,
+		CacheFor: 30 * time.Second,
+		cache:    map[int64]cachedFilter{},
+	}
+}
+
+// DetectObjectsForImage FilteringDetector implements ObjectDetector
+func (fd *FilteringDetector) DetectObjectsForImage(ctx context.Context, req Req) ([]Detection, error) {
+	detections, err := fd.Detector.DetectObjectsForImage(ctx, req)
+	if err != nil || len(detections) == 0 {
+		return detections, err
+	}
+	f, fErr := fd.filterFor(ctx, req.DeviceId)
+	if fErr != nil {
+		return []Detection{}, fErr
+	}
+	return f.Apply(detections), nil
+}
+
+func (fd *FilteringDetector) filterFor(ctx context.Context, deviceId int64) (Filter, error) {
+	fd.mu.Lock()
+	cached, ok := fd.cache[deviceId]
+	fd.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.filter, nil
+	}
+	settings, err := fd.Repo.GetDetectionFilters(ctx, deviceId)
+	if err != nil {
+		logger.Error().Str("service", "detection.FilteringDetector").Err(err).
+			Msgf("failed to load detection filters for device %d", deviceId)
+		return Filter{}, err
+	}
+	f := NewFilter(settings)
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.cache[deviceId] = cachedFilter{filter: f, expiresAt: time.Now().Add(fd.CacheFor)}
+	return f, nil
+}
@@ -0,0 +1,96 @@
+package detection
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Apply(t *testing.T) {
+	deviceId := int64(3)
+	global := devices.DetectionFilter{
+		MinConfidence:   0.5,
+		LabelConfidence: map[string]float64{"person": 0.3},
+		DenyLabels:      []string{"train"},
+		Aliases:         map[string]string{"car": "vehicle", "truck": "vehicle"},
+	}
+	device := devices.DetectionFilter{
+		DeviceID:        &deviceId,
+		LabelConfidence: map[string]float64{"vehicle": 0.8},
+		AllowLabels:     []string{"person", "vehicle"},
+	}
+
+	tests := []struct {
+		name     string
+		settings []devices.DetectionFilter
+		in       []Detection
+		want     []string
+	}{
+		{
+			name:     "no settings keeps everything",
+			settings: nil,
+			in:       []Detection{{Label: "train", Confidence: 0.31}},
+			want:     []string{"train"},
+		},
+		{
+			name:     "global min confidence & denylist",
+			settings: []devices.DetectionFilter{global},
+			in: []Detection{
+				{Label: "train", Confidence: 0.9},
+				{Label: "dog", Confidence: 0.4},
+				{Label: "cat", Confidence: 0.6},
+			},
+			want: []string{"cat"},
+		},
+		{
+			name:     "label overrides the min confidence",
+			settings: []devices.DetectionFilter{global},
+			in:       []Detection{{Label: "Person", Confidence: 0.35}},
+			want:     []string{"Person"},
+		},
+		{
+			name:     "labels are aliased",
+			settings: []devices.DetectionFilter{global},
+			in: []Detection{
+				{Label: "car", Confidence: 0.7},
+				{Label: "truck", Confidence: 0.7},
+			},
+			want: []string{"vehicle", "vehicle"},
+		},
+		{
+			name:     "device allowlist & thresholds apply on top of global settings",
+			settings: []devices.DetectionFilter{device, global},
+			in: []Detection{
+				{Label: "car", Confidence: 0.7},
+				{Label: "truck", Confidence: 0.85},
+				{Label: "cat", Confidence: 0.9},
+				{Label: "person", Confidence: 0.4},
+			},
+			want: []string{"vehicle", "person"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewFilter(test.settings)
+			assert.Equal(t, test.want, labels(f.Apply(test.in)))
+		})
+	}
+
+	settings := []devices.DetectionFilter{device, global}
+	NewFilter(settings)
+	assert.Equal(t, []devices.DetectionFilter{device, global}, settings, "the caller's settings aren't reordered")
+}
+
+func TestFilteringDetector(t *testing.T) {
+	a := assert.New(t)
+	repo := devices.NewMockDetectionFilter()
+	_, err := repo.UpsertDetectionFilter(context.Background(), devices.UpsertDetectionFilterParams{MinConfidence: 0.5})
+	a.NoError(err)
+
+	fd := NewFilteringDetector(MockDetectionService{}, repo)
+	value, err := fd.DetectObjectsForImage(t.Context(), Req{DeviceId: 1})
+	a.NoError(err)
+	a.Empty(value, "the mock's 0.31 train is below the global threshold")
+}
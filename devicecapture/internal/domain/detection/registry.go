@@ -0,0 +1,89 @@
+package detection
+
+import (
+	"devicecapture/internal/config"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry holds named ObjectDetector backends
+type Registry struct {
+	mu        sync.RWMutex
+	detectors map[string]ObjectDetector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		detectors: map[string]ObjectDetector{},
+	}
+}
+
+// NewRegistryFromConfig registers an ObjectDetectionService for every configured backend
+func NewRegistryFromConfig(c *config.Config) *Registry {
+	r := NewRegistry()
+	for name, url := range c.Detectors.Backends {
+		r.Register(name, NewObjectDetectionServiceForUrl(url))
+	}
+	if _, err := r.Get(config.DefaultDetector); err != nil {
+		r.Register(config.DefaultDetector, NewObjectDetectionService(c))
+	}
+	return r
+}
+
+// Register adds (or replaces) a named ObjectDetector
+func (r *Registry) Register(name string, d ObjectDetector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.detectors[name] = d
+}
+
+// Get returns the ObjectDetector registered as name
+func (r *Registry) Get(name string) (ObjectDetector, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.detectors[name]
+	if !ok {
+		return nil, fmt.Errorf("detector %q is not registered", name)
+	}
+	return d, nil
+}
+
+// Names returns the registered backend names, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.detectors))
+	for name := range r.detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewDetectorFromConfig builds the ObjectDetector used by the CameraService:
+// a RoutingDetector over the configured backends, wrapped in a FallbackDetector
+// when a fallback backend is configured
+func NewDetectorFromConfig(c *config.Config) (ObjectDetector, error) {
+	registry := NewRegistryFromConfig(c)
+	dc := c.Detectors
+	router := &RoutingDetector{
+		Registry:      registry,
+		Default:       dc.Default,
+		Devices:       dc.Devices,
+		Labels:        dc.Labels,
+		Cascade:       dc.Cascade,
+		CascadeLabels: dc.CascadeLabels,
+	}
+	if err := router.Validate(); err != nil {
+		return nil, err
+	}
+	if dc.Fallback == "" {
+		return router, nil
+	}
+	secondary, err := registry.Get(dc.Fallback)
+	if err != nil {
+		return nil, err
+	}
+	return NewFallbackDetector(router, secondary), nil
+}
@@ -0,0 +1,115 @@
+package detection
+
+import (
+	"context"
+	"devicecapture/internal/logger"
+	"slices"
+)
+
+// RoutingDetector implements ObjectDetector by choosing a backend from the Registry for each Req.
+//
+// Routes are checked in order:
+//  1. Devices - the device is pinned to a backend
+//  2. Cascade - run each stage in order, escalating only while a stage finds a label of interest
+//  3. Default - run the default backend, then re-run the frame on a Labels backend
+//     if the default backend found one of those labels
+type RoutingDetector struct {
+	Registry      *Registry
+	Default       string
+	Devices       map[int64]string
+	Labels        map[string]string
+	Cascade       []string
+	CascadeLabels []string
+}
+
+// Validate make sure every backend the RoutingDetector refers to is registered
+func (rd *RoutingDetector) Validate() error {
+	names := []string{rd.Default}
+	names = append(names, rd.Cascade...)
+	for _, name := range rd.Devices {
+		names = append(names, name)
+	}
+	for _, name := range rd.Labels {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if _, err := rd.Registry.Get(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DetectObjectsForImage RoutingDetector implements ObjectDetector
+func (rd *RoutingDetector) DetectObjectsForImage(ctx context.Context, req Req) ([]Detection, error) {
+	if name, ok := rd.Devices[req.DeviceId]; ok {
+		return rd.detect(ctx, name, req)
+	}
+	if len(rd.Cascade) > 0 {
+		return rd.cascade(ctx, req)
+	}
+	detections, err := rd.detect(ctx, rd.Default, req)
+	if err != nil {
+		return detections, err
+	}
+	name, ok := rd.labelRoute(detections)
+	if !ok || name == rd.Default {
+		return detections, nil
+	}
+	routed, routeErr := rd.detect(ctx, name, req)
+	if routeErr != nil {
+		// The default backend already answered, don't throw that away
+		logger.Error().Str("service", "detection.RoutingDetector").Err(routeErr).
+			Msgf("label route %s failed, using %s results", name, rd.Default)
+		return detections, nil
+	}
+	return routed, nil
+}
+
+// cascade runs each stage in order, returning the results from the last stage that ran
+func (rd *RoutingDetector) cascade(ctx context.Context, req Req) ([]Detection, error) {
+	var detections []Detection
+	for idx, name := range rd.Cascade {
+		stage, err := rd.detect(ctx, name, req)
+		if err != nil {
+			if idx == 0 {
+				return stage, err
+			}
+			logger.Error().Str("service", "detection.RoutingDetector").Err(err).
+				Msgf("cascade stage %s failed, using previous stage results", name)
+			return detections, nil
+		}
+		detections = stage
+		if !rd.hasLabelOfInterest(detections) {
+			break
+		}
+	}
+	return detections, nil
+}
+
+func (rd *RoutingDetector) detect(ctx context.Context, name string, req Req) ([]Detection, error) {
+	d, err := rd.Registry.Get(name)
+	if err != nil {
+		return []Detection{}, err
+	}
+	return d.DetectObjectsForImage(ctx, req)
+}
+
+// labelRoute returns the backend for the first detection that has a label route
+func (rd *RoutingDetector) labelRoute(detections []Detection) (string, bool) {
+	for _, d := range detections {
+		if name, ok := rd.Labels[d.Label]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (rd *RoutingDetector) hasLabelOfInterest(detections []Detection) bool {
+	if len(rd.CascadeLabels) == 0 {
+		return len(detections) > 0
+	}
+	return slices.ContainsFunc(detections, func(d Detection) bool {
+		return slices.Contains(rd.CascadeLabels, d.Label)
+	})
+}
@@ -0,0 +1,164 @@
+package detection
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubDetector returns fixed labels & counts how many times it was called
+type stubDetector struct {
+	labels []string
+	err    error
+	calls  int
+}
+
+func (s *stubDetector) DetectObjectsForImage(_ context.Context, _ Req) ([]Detection, error) {
+	s.calls++
+	if s.err != nil {
+		return []Detection{}, s.err
+	}
+	var detections []Detection
+	for _, l := range s.labels {
+		detections = append(detections, Detection{Label: l, Confidence: 0.9})
+	}
+	return detections, nil
+}
+
+func labels(detections []Detection) []string {
+	var value []string
+	for _, d := range detections {
+		value = append(value, d.Label)
+	}
+	return value
+}
+
+func TestRoutingDetector(t *testing.T) {
+	tests := []struct {
+		name       string
+		router     func(r *Registry) *RoutingDetector
+		deviceId   int64
+		fast       []string
+		heavy      []string
+		want       []string
+		heavyCalls int
+	}{
+		{
+			name: "default backend is used when no routes match",
+			router: func(r *Registry) *RoutingDetector {
+				return &RoutingDetector{Registry: r, Default: "fast"}
+			},
+			fast:       []string{"dog"},
+			heavy:      []string{"person"},
+			want:       []string{"dog"},
+			heavyCalls: 0,
+		},
+		{
+			name: "devices can be pinned to a backend",
+			router: func(r *Registry) *RoutingDetector {
+				return &RoutingDetector{Registry: r, Default: "fast", Devices: map[int64]string{7: "heavy"}}
+			},
+			deviceId:   7,
+			fast:       []string{"dog"},
+			heavy:      []string{"person"},
+			want:       []string{"person"},
+			heavyCalls: 1,
+		},
+		{
+			name: "labels of interest re-run the frame on their backend",
+			router: func(r *Registry) *RoutingDetector {
+				return &RoutingDetector{Registry: r, Default: "fast", Labels: map[string]string{"person": "heavy"}}
+			},
+			fast:       []string{"person"},
+			heavy:      []string{"person", "dog"},
+			want:       []string{"person", "dog"},
+			heavyCalls: 1,
+		},
+		{
+			name: "cascade stops when a stage finds nothing",
+			router: func(r *Registry) *RoutingDetector {
+				return &RoutingDetector{Registry: r, Default: "fast", Cascade: []string{"fast", "heavy"}}
+			},
+			fast:       nil,
+			heavy:      []string{"person"},
+			want:       nil,
+			heavyCalls: 0,
+		},
+		{
+			name: "cascade escalates on labels of interest",
+			router: func(r *Registry) *RoutingDetector {
+				return &RoutingDetector{
+					Registry:      r,
+					Default:       "fast",
+					Cascade:       []string{"fast", "heavy"},
+					CascadeLabels: []string{"person"},
+				}
+			},
+			fast:       []string{"person"},
+			heavy:      []string{"person", "backpack"},
+			want:       []string{"person", "backpack"},
+			heavyCalls: 1,
+		},
+		{
+			name: "cascade ignores labels that are not of interest",
+			router: func(r *Registry) *RoutingDetector {
+				return &RoutingDetector{
+					Registry:      r,
+					Default:       "fast",
+					Cascade:       []string{"fast", "heavy"},
+					CascadeLabels: []string{"person"},
+				}
+			},
+			fast:       []string{"train"},
+			heavy:      []string{"person"},
+			want:       []string{"train"},
+			heavyCalls: 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := assert.New(t)
+			fast := &stubDetector{labels: test.fast}
+			heavy := &stubDetector{labels: test.heavy}
+			registry := NewRegistry()
+			registry.Register("fast", fast)
+			registry.Register("heavy", heavy)
+			router := test.router(registry)
+			a.NoError(router.Validate())
+
+			value, err := router.DetectObjectsForImage(t.Context(), Req{DeviceId: test.deviceId})
+			a.NoError(err)
+			a.Equal(test.want, labels(value))
+			a.Equal(test.heavyCalls, heavy.calls)
+		})
+	}
+}
+
+func TestRoutingDetector_Validate(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("fast", &stubDetector{})
+	router := &RoutingDetector{Registry: registry, Default: "fast", Devices: map[int64]string{1: "missing"}}
+	assert.Error(t, router.Validate(), "routes to unregistered backends are rejected")
+}
+
+func TestFallbackDetector(t *testing.T) {
+	a := assert.New(t)
+	primary := &stubDetector{err: errors.New("connection refused")}
+	secondary := &stubDetector{labels: []string{"cat"}}
+	fb := NewFallbackDetector(primary, secondary)
+
+	value, err := fb.DetectObjectsForImage(t.Context(), Req{DeviceId: 1})
+	a.NoError(err)
+	a.Equal([]string{"cat"}, labels(value))
+	a.Equal(1, primary.calls)
+	a.Equal(1, secondary.calls)
+
+	primary.err = nil
+	primary.labels = []string{"dog"}
+	value, err = fb.DetectObjectsForImage(t.Context(), Req{DeviceId: 1})
+	a.NoError(err)
+	a.Equal([]string{"dog"}, labels(value))
+	a.Equal(1, secondary.calls, "the secondary is only used when the primary errors")
+}
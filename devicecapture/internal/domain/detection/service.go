@@ -5,38 +5,51 @@ import (
 	"devicecapture/internal/config"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"time"
 )
 
+var ErrDetectionTimeout = errors.New("detection service timed out")
+
 // ObjectDetectionService implements ObjectDetector
 type ObjectDetectionService struct {
 	url string
 }
 
 func NewObjectDetectionService(c *config.Config) ObjectDetectionService {
-	return ObjectDetectionService{url: c.DetectionServiceUrl}
+	return NewObjectDetectionServiceForUrl(c.DetectionServiceUrl)
+}
+
+// NewObjectDetectionServiceForUrl creates an ObjectDetectionService for a specific backend
+func NewObjectDetectionServiceForUrl(url string) ObjectDetectionService {
+	return ObjectDetectionService{url: url}
 }
 
 // DetectObjectsForImage ObjectDetectionService implements ObjectDetector
-func (o ObjectDetectionService) DetectObjectsForImage(_ context.Context, req Req) ([]Detection, error) {
-	value := make(chan []Detection, 1)
+func (o ObjectDetectionService) DetectObjectsForImage(ctx context.Context, req Req) ([]Detection, error) {
+	type result struct {
+		detections []Detection
+		err        error
+	}
+	value := make(chan result, 1)
 	go func() {
 		response, err := o.sendImage(req.Frame.Buf)
-		if err != nil {
-			value <- []Detection{}
-		} else {
-			value <- response
-		}
+		value <- result{detections: response, err: err}
 	}()
 	// This service must return in < 2 seconds
 	select {
 	case resp := <-value:
-		return resp, nil
+		if resp.err != nil {
+			return []Detection{}, resp.err
+		}
+		return resp.detections, nil
+	case <-ctx.Done():
+		return []Detection{}, ctx.Err()
 	case <-time.After(2 * time.Second):
-		return []Detection{}, nil
+		return []Detection{}, ErrDetectionTimeout
 	}
 }
 
@@ -0,0 +1,87 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry an operator action: who took it, from where & what it changed. Entries are never updated or deleted
+type AuditEntry struct {
+	ID    int64  `json:"id"`
+	Actor string `json:"actor"`
+	// ActorID the user's ID, nil when auth is disabled or the system took the action
+	ActorID    *int64 `json:"actor_id"`
+	Action     string `json:"action"`
+	TargetType string `json:"target_type"`
+	TargetID   string `json:"target_id"`
+	// Diff the target's changed fields, ex: {"before": {"device_url": "..."}, "after": {"device_url": "..."}}
+	Diff      json.RawMessage `json:"diff"`
+	SourceIP  string          `json:"source_ip"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Audited actions
+const (
+	AuditDeviceCreate = "device.create"
+	AuditDeviceUpdate = "device.update"
+	AuditDeviceDelete = "device.delete"
+	AuditDeviceMute   = "device.mute"
+	AuditStreamStart  = "stream.start"
+	AuditConfigPush   = "config.push"
+	AuditFilterUpdate = "filter.update"
+	AuditFilterDelete = "filter.delete"
+	// AuditImageDelete deleting an image deletes its detections
+	AuditImageDelete = "image.delete"
+)
+
+// Audit target types
+const (
+	AuditTargetDevice = "device"
+	AuditTargetFilter = "filter"
+	AuditTargetImage  = "image"
+)
+
+type CreateAuditParams struct {
+	Actor      string          `json:"actor"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Diff       json.RawMessage `json:"diff"`
+	SourceIP   string          `json:"source_ip"`
+}
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 10000
+)
+
+// AuditQuery filters the audit log, empty fields match every entry
+type AuditQuery struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	// After & Before bound CreatedAt, After inclusive & Before exclusive
+	After  time.Time
+	Before time.Time
+	// Limit DefaultAuditLimit when it's 0
+	Limit int32
+}
+
+// Matches whether e passes q's filters, ignoring Limit
+func (q AuditQuery) Matches(e AuditEntry) bool {
+	return (q.Actor == "" || e.Actor == q.Actor) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.TargetType == "" || e.TargetType == q.TargetType) &&
+		(q.TargetID == "" || e.TargetID == q.TargetID) &&
+		!e.CreatedAt.Before(q.After) &&
+		(q.Before.IsZero() || e.CreatedAt.Before(q.Before))
+}
+
+type AuditRepo interface {
+	CreateAuditEntry(ctx context.Context, params CreateAuditParams) (AuditEntry, error)
+	// ListAuditEntries the entries matching q, newest first
+	ListAuditEntries(ctx context.Context, q AuditQuery) ([]AuditEntry, error)
+}
@@ -0,0 +1,49 @@
+package devices
+
+import (
+	"context"
+	"time"
+)
+
+// CaptureSession a stream's or snapshot's frames, stored under SessionPath, ex: videos/1-123
+type CaptureSession struct {
+	ID          int64     `json:"id"`
+	DeviceID    int64     `json:"device_id"`
+	SessionPath string    `json:"session_path"`
+	StartedAt   time.Time `json:"started_at"`
+	// EndedAt zero while the session is capturing
+	EndedAt time.Time `json:"ended_at,omitzero"`
+	// FrameCount how many frames were stored when the session ended
+	FrameCount int32 `json:"frame_count"`
+}
+
+type CreateCaptureSessionParams struct {
+	DeviceID    int64     `json:"device_id"`
+	SessionPath string    `json:"session_path"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+const (
+	DefaultCaptureSessionLimit = 100
+	MaxCaptureSessionLimit     = 1000
+)
+
+// CaptureSessionQuery filters capture sessions
+type CaptureSessionQuery struct {
+	// DeviceIDs the devices whose sessions are listed
+	DeviceIDs []int64
+	// After & Before bound StartedAt, After inclusive & Before exclusive. Zero is unbounded
+	After  time.Time
+	Before time.Time
+	// Limit DefaultCaptureSessionLimit when it's 0
+	Limit int32
+}
+
+type CaptureSessionRepo interface {
+	CreateCaptureSession(ctx context.Context, params CreateCaptureSessionParams) (CaptureSession, error)
+	// EndCaptureSession sets EndedAt & counts the session's stored frames
+	EndCaptureSession(ctx context.Context, id int64, endedAt time.Time) (CaptureSession, error)
+	GetCaptureSession(ctx context.Context, id int64) (CaptureSession, error)
+	// ListCaptureSessions the sessions matching q, newest first
+	ListCaptureSessions(ctx context.Context, q CaptureSessionQuery) ([]CaptureSession, error)
+}
@@ -0,0 +1,135 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frameSizes esp32-camera frame sizes & their dimensions
+var frameSizes = map[string][2]int{
+	"96X96":   {96, 96},
+	"QQVGA":   {160, 120},
+	"QCIF":    {176, 144},
+	"HQVGA":   {240, 176},
+	"240X240": {240, 240},
+	"QVGA":    {320, 240},
+	"CIF":     {400, 296},
+	"HVGA":    {480, 320},
+	"VGA":     {640, 480},
+	"SVGA":    {800, 600},
+	"XGA":     {1024, 768},
+	"HD":      {1280, 720},
+	"SXGA":    {1280, 1024},
+	"UXGA":    {1600, 1200},
+}
+
+// FrameSizeDimensions the width & height for a frame size, ex: "VGA" or "640x480"
+func FrameSizeDimensions(frameSize string) (int, int, bool) {
+	if dims, ok := frameSizes[strings.ToUpper(frameSize)]; ok {
+		return dims[0], dims[1], true
+	}
+	w, h, found := strings.Cut(frameSize, "x")
+	if !found {
+		return 0, 0, false
+	}
+	width, wErr := strconv.Atoi(w)
+	height, hErr := strconv.Atoi(h)
+	if wErr != nil || hErr != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// CameraConfig the camera settings we push to a device
+type CameraConfig struct {
+	// FrameSize ex: VGA, UXGA or 640x480
+	FrameSize string `json:"framesize"`
+	// JpegQuality 0-63, lower is better quality (& bigger frames)
+	JpegQuality int  `json:"jpeg_quality"`
+	FlashLed    bool `json:"flash_led"`
+	StreamFps   int  `json:"stream_fps"`
+}
+
+var ErrInvalidConfig = errors.New("invalid camera config")
+
+func (c CameraConfig) Validate() error {
+	if _, _, ok := FrameSizeDimensions(c.FrameSize); !ok {
+		return fmt.Errorf("%w: framesize must be a frame size (ex: VGA) or WIDTHxHEIGHT", ErrInvalidConfig)
+	}
+	if c.JpegQuality < 0 || c.JpegQuality > 63 {
+		return fmt.Errorf("%w: jpeg_quality must be between 0 & 63", ErrInvalidConfig)
+	}
+	if c.StreamFps < 1 || c.StreamFps > 30 {
+		return fmt.Errorf("%w: stream_fps must be between 1 & 30", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Drift the JSON names of the fields that differ between c & other
+func (c CameraConfig) Drift(other CameraConfig) []string {
+	drift := []string{}
+	if c.FrameSize != other.FrameSize {
+		drift = append(drift, "framesize")
+	}
+	if c.JpegQuality != other.JpegQuality {
+		drift = append(drift, "jpeg_quality")
+	}
+	if c.FlashLed != other.FlashLed {
+		drift = append(drift, "flash_led")
+	}
+	if c.StreamFps != other.StreamFps {
+		drift = append(drift, "stream_fps")
+	}
+	return drift
+}
+
+// DeviceConfig a device's desired config & the config it last acknowledged
+type DeviceConfig struct {
+	DeviceID       int64        `json:"device_id"`
+	Desired        CameraConfig `json:"desired"`
+	DesiredVersion int64        `json:"desired_version"`
+	// Reported the config the device said it applied when it acknowledged AckedVersion
+	Reported     CameraConfig `json:"reported"`
+	AckedVersion int64        `json:"acked_version"`
+	// LastError why the device rejected the last push, if it did
+	LastError    string    `json:"last_error"`
+	PushAttempts int32     `json:"push_attempts"`
+	PushedAt     time.Time `json:"pushed_at"`
+	AckedAt      time.Time `json:"acked_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Acked whether the device acknowledged the desired version
+func (c *DeviceConfig) Acked() bool {
+	return c.AckedVersion >= c.DesiredVersion
+}
+
+// ConfigMsg what's published to config/<device_id>
+type ConfigMsg struct {
+	Version int64        `json:"version"`
+	Config  CameraConfig `json:"config"`
+}
+
+// ConfigAck what devices reply with on config/<device_id>/ack. Config is what the device is running, Error is
+// set when it couldn't apply Version
+type ConfigAck struct {
+	Version int64        `json:"version"`
+	Config  CameraConfig `json:"config"`
+	Error   string       `json:"error"`
+}
+
+type DeviceConfigRepo interface {
+	GetDeviceConfig(ctx context.Context, deviceId int64) (DeviceConfig, error)
+	ListDeviceConfigs(ctx context.Context) ([]DeviceConfig, error)
+	// SetDesiredConfig stores the config & bumps the desired version
+	SetDesiredConfig(ctx context.Context, deviceId int64, config CameraConfig) (DeviceConfig, error)
+	// ListUnackedConfigs configs that haven't been acknowledged, last pushed before pushedBefore
+	// & pushed fewer than maxAttempts times
+	ListUnackedConfigs(ctx context.Context, pushedBefore time.Time, maxAttempts int32) ([]DeviceConfig, error)
+	RecordConfigPush(ctx context.Context, deviceId int64) error
+	RecordConfigAck(ctx context.Context, deviceId int64, ack ConfigAck) (DeviceConfig, error)
+}
@@ -31,8 +31,17 @@ type QueryParams struct {
 
 type DetectionRepo interface {
 	GetDetectionsAfter(ctx context.Context, params QueryParams) ([]Detection, error)
+	// GetDetectionsAfterId at most limit detections with IDs after id, oldest first
+	GetDetectionsAfterId(ctx context.Context, id int64, limit int32) ([]Detection, error)
 	GetDeviceDetectionsAfter(ctx context.Context, params QueryParams) ([]Detection, error)
 	CreateDetection(ctx context.Context, params CreateDetectionParams) (Detection, error)
+	// CreateDetections creates the detections in one batch, either all of them are created or none are
 	CreateDetections(ctx context.Context, params []CreateDetectionParams) ([]Detection, error)
+	// CreateDetectionsWithMessages creates the detections & the OutboxMessage toMessage builds for each of them
+	// in one transaction, so a detection isn't stored without the message announcing it
+	CreateDetectionsWithMessages(ctx context.Context, params []CreateDetectionParams, toMessage OutboxMessageFunc) ([]Detection, error)
+	// CreateImageDetections creates a frame's image record & its detections in one transaction, setting their
+	// ImageID. When toMessage isn't nil it creates their messages too, like CreateDetectionsWithMessages
+	CreateImageDetections(ctx context.Context, image CreateImageParams, params []CreateDetectionParams, toMessage OutboxMessageFunc) (DeviceImage, []Detection, error)
 	DeleteDetections(ctx context.Context, deviceID int64) error
 }
@@ -2,28 +2,164 @@ package devices
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
+	"time"
 )
 
+// Capabilities a device can advertise
+const (
+	CapabilitySnapshot = "snapshot"
+	CapabilityStream   = "stream"
+	CapabilityFlash    = "flash"
+)
+
+// Capabilities every known capability
+var Capabilities = []string{CapabilitySnapshot, CapabilityStream, CapabilityFlash}
+
+// DefaultCapabilities what we assume a camera supports if it doesn't say otherwise
+var DefaultCapabilities = []string{CapabilitySnapshot, CapabilityStream}
+
+const DefaultTimezone = "UTC"
+
 type Device struct {
-	ID        int64  `json:"id"`
-	Name      string `json:"name"`
-	DeviceUrl string `json:"device_url"`
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	DeviceUrl string   `json:"device_url"`
+	Location  string   `json:"location"`
+	Tags      []string `json:"tags"`
+	Timezone  string   `json:"timezone"`
+	Enabled   bool     `json:"enabled"`
+	// Username & Password HTTP basic auth credentials for the camera. The password is never returned by the API
+	Username        string   `json:"username"`
+	Password        string   `json:"-"`
+	FirmwareVersion string   `json:"firmware_version"`
+	Resolution      string   `json:"resolution"`
+	Capabilities    []string `json:"capabilities"`
+	// MutedUntil detections are stored, but not published, until this time
+	MutedUntil time.Time `json:"muted_until"`
 }
 
 func (d *Device) StringId() string {
 	return strconv.Itoa(int(d.ID))
 }
 
+// HasCapability ex: d.HasCapability(CapabilityFlash)
+func (d *Device) HasCapability(capability string) bool {
+	return slices.Contains(d.Capabilities, capability)
+}
+
+// IsMuted whether the device's detections should be held back from subscribers at `now`
+func (d *Device) IsMuted(now time.Time) bool {
+	return d.MutedUntil.After(now)
+}
+
 type CreateDeviceParams struct {
-	Name      string `json:"name"`
-	DeviceUrl string `json:"device_url"`
+	Name      string   `json:"name"`
+	DeviceUrl string   `json:"device_url"`
+	Location  string   `json:"location"`
+	Tags      []string `json:"tags"`
+	Timezone  string   `json:"timezone"`
+	// Enabled nil = enabled
+	Enabled         *bool    `json:"enabled"`
+	Username        string   `json:"username"`
+	Password        string   `json:"password"`
+	FirmwareVersion string   `json:"firmware_version"`
+	Resolution      string   `json:"resolution"`
+	Capabilities    []string `json:"capabilities"`
+}
+
+// WithDefaults fills in the timezone, enabled flag & capabilities when they're omitted
+func (p CreateDeviceParams) WithDefaults() CreateDeviceParams {
+	if p.Timezone == "" {
+		p.Timezone = DefaultTimezone
+	}
+	if p.Enabled == nil {
+		enabled := true
+		p.Enabled = &enabled
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	if p.Capabilities == nil {
+		p.Capabilities = slices.Clone(DefaultCapabilities)
+	}
+	return p
 }
 
 type UpdateDeviceParams struct {
-	ID        int64  `json:"id"`
-	Name      string `json:"name"`
-	DeviceUrl string `json:"device_url"`
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	DeviceUrl string   `json:"device_url"`
+	Location  string   `json:"location"`
+	Tags      []string `json:"tags"`
+	Timezone  string   `json:"timezone"`
+	// Enabled nil keeps the existing flag
+	Enabled  *bool  `json:"enabled"`
+	Username string `json:"username"`
+	// Password nil keeps the existing password, "" clears it
+	Password        *string `json:"password"`
+	FirmwareVersion string  `json:"firmware_version"`
+	Resolution      string  `json:"resolution"`
+	// Capabilities nil keeps the existing capabilities
+	Capabilities []string `json:"capabilities"`
+}
+
+// WithDefaults fills in the timezone & tags when they're omitted. Enabled, Password & Capabilities are kept as they are
+func (p UpdateDeviceParams) WithDefaults() UpdateDeviceParams {
+	if p.Timezone == "" {
+		p.Timezone = DefaultTimezone
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	return p
+}
+
+// Merge fills in the fields that keep their existing value when they're omitted from d
+func (p UpdateDeviceParams) Merge(d Device) UpdateDeviceParams {
+	if p.Enabled == nil {
+		enabled := d.Enabled
+		p.Enabled = &enabled
+	}
+	if p.Capabilities == nil {
+		p.Capabilities = slices.Clone(d.Capabilities)
+	}
+	return p
+}
+
+// resolutionPattern ESP32 frame sizes (ex: VGA, UXGA) or WIDTHxHEIGHT
+var resolutionPattern = regexp.MustCompile(`^([A-Z0-9]{2,8}|\d{2,5}x\d{2,5})$`)
+
+var ErrInvalidDevice = errors.New("invalid device")
+
+// ValidateDevice checks the user-editable fields shared by CreateDeviceParams & UpdateDeviceParams
+func ValidateDevice(name string, deviceUrl string, timezone string, resolution string, capabilities []string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidDevice)
+	}
+	u, err := url.Parse(deviceUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: device_url must be an http(s) URL", ErrInvalidDevice)
+	}
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return fmt.Errorf("%w: unknown timezone %s", ErrInvalidDevice, timezone)
+		}
+	}
+	if resolution != "" && !resolutionPattern.MatchString(resolution) {
+		return fmt.Errorf("%w: resolution must be a frame size (ex: VGA) or WIDTHxHEIGHT", ErrInvalidDevice)
+	}
+	for _, c := range capabilities {
+		if !slices.Contains(Capabilities, c) {
+			return fmt.Errorf("%w: unknown capability %s", ErrInvalidDevice, c)
+		}
+	}
+	return nil
 }
 
 type DeviceRepository interface {
@@ -34,4 +170,17 @@ type DeviceRepository interface {
 	DeleteDevice(ctx context.Context, id int64) error
 	DeleteTestDevices(ctx context.Context) error
 	IsValidId(id string) bool
+	// MuteDevice holds back the device's detections until `until`. The zero time unmutes it
+	MuteDevice(ctx context.Context, deviceId int64, until time.Time) (Device, error)
+
+	CreateGroup(ctx context.Context, params CreateGroupParams) (Group, error)
+	GetGroup(ctx context.Context, groupId int64) (Group, error)
+	ListGroups(ctx context.Context) ([]Group, error)
+	UpdateGroup(ctx context.Context, params UpdateGroupParams) (Group, error)
+	DeleteGroup(ctx context.Context, groupId int64) error
+	// AddGroupDevice adds the device to the group, adding an existing member is a no-op
+	AddGroupDevice(ctx context.Context, groupId int64, deviceId int64) error
+	RemoveGroupDevice(ctx context.Context, groupId int64, deviceId int64) error
+	// ListGroupDevices the group's devices, ordered by name
+	ListGroupDevices(ctx context.Context, groupId int64) ([]Device, error)
 }
@@ -0,0 +1,120 @@
+package devices
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDevice(t *testing.T) {
+	tests := []struct {
+		name         string
+		deviceName   string
+		deviceUrl    string
+		timezone     string
+		resolution   string
+		capabilities []string
+		wantErr      bool
+	}{
+		{name: "valid", deviceName: "porch", deviceUrl: "http://10.0.0.5", timezone: "America/Chicago", resolution: "UXGA", capabilities: []string{CapabilityFlash}},
+		{name: "WxH resolution", deviceName: "porch", deviceUrl: "https://cam.local:8080", resolution: "1600x1200"},
+		{name: "missing name", deviceUrl: "http://10.0.0.5", wantErr: true},
+		{name: "invalid url", deviceName: "porch", deviceUrl: "10.0.0.5", wantErr: true},
+		{name: "unknown timezone", deviceName: "porch", deviceUrl: "http://10.0.0.5", timezone: "Mars/Olympus", wantErr: true},
+		{name: "invalid resolution", deviceName: "porch", deviceUrl: "http://10.0.0.5", resolution: "big", wantErr: true},
+		{name: "unknown capability", deviceName: "porch", deviceUrl: "http://10.0.0.5", capabilities: []string{"teleport"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDevice(tt.deviceName, tt.deviceUrl, tt.timezone, tt.resolution, tt.capabilities)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidDevice)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCreateDeviceParams_WithDefaults(t *testing.T) {
+	a := assert.New(t)
+	params := CreateDeviceParams{Name: "porch"}.WithDefaults()
+	a.Equal(DefaultTimezone, params.Timezone)
+	a.True(*params.Enabled)
+	a.Equal(DefaultCapabilities, params.Capabilities)
+
+	disabled := false
+	params = CreateDeviceParams{Enabled: &disabled, Capabilities: []string{}}.WithDefaults()
+	a.False(*params.Enabled, "an explicit enabled flag is kept")
+	a.Empty(params.Capabilities, "an explicit empty capability list is kept")
+}
+
+func TestUpdateDeviceParams_Merge(t *testing.T) {
+	a := assert.New(t)
+	d := Device{Enabled: false, Capabilities: []string{CapabilitySnapshot, CapabilityFlash}}
+	params := UpdateDeviceParams{Name: "porch"}.Merge(d)
+	a.False(*params.Enabled, "an omitted enabled flag is kept")
+	a.Equal(d.Capabilities, params.Capabilities, "omitted capabilities are kept")
+
+	enabled := true
+	params = UpdateDeviceParams{Enabled: &enabled, Capabilities: []string{}}.Merge(d)
+	a.True(*params.Enabled)
+	a.Empty(params.Capabilities, "an explicit empty capability list is kept")
+}
+
+func TestNormalizeMac(t *testing.T) {
+	tests := []struct {
+		mac     string
+		want    string
+		wantErr bool
+	}{
+		{mac: "de:ad:be:ef:00:01", want: "de:ad:be:ef:00:01"},
+		{mac: "DE-AD-BE-EF-00-01", want: "de:ad:be:ef:00:01"},
+		{mac: "DEADBEEF0001", want: "de:ad:be:ef:00:01"},
+		{mac: "de:ad:be:ef", wantErr: true},
+		{mac: "not-a-mac", wantErr: true},
+		{mac: "00:00:00:00:fe:80:00:00:00:00:00:00:02:00:5e:10", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mac, func(t *testing.T) {
+			got, err := NormalizeMac(tt.mac)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidDevice)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCameraConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CameraConfig
+		wantErr bool
+	}{
+		{name: "valid", config: CameraConfig{FrameSize: "VGA", JpegQuality: 12, StreamFps: 4}},
+		{name: "WxH framesize", config: CameraConfig{FrameSize: "320x240", JpegQuality: 0, StreamFps: 30, FlashLed: true}},
+		{name: "unknown framesize", config: CameraConfig{FrameSize: "HUGE", StreamFps: 4}, wantErr: true},
+		{name: "missing framesize", config: CameraConfig{StreamFps: 4}, wantErr: true},
+		{name: "quality out of range", config: CameraConfig{FrameSize: "VGA", JpegQuality: 64, StreamFps: 4}, wantErr: true},
+		{name: "fps out of range", config: CameraConfig{FrameSize: "VGA", StreamFps: 0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidConfig)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCameraConfig_Drift(t *testing.T) {
+	desired := CameraConfig{FrameSize: "UXGA", JpegQuality: 10, FlashLed: true, StreamFps: 4}
+	assert.Empty(t, desired.Drift(desired))
+	assert.Equal(t, []string{"framesize", "flash_led"}, desired.Drift(CameraConfig{FrameSize: "VGA", JpegQuality: 10, StreamFps: 4}))
+}
@@ -0,0 +1,84 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// DiscoveredDevice statuses
+const (
+	DiscoveryPending  = "pending"
+	DiscoveryApproved = "approved"
+	DiscoveryRejected = "rejected"
+)
+
+// DiscoveredDevice a device that announced itself on announce/<mac>. DeviceID is set once it's approved
+type DiscoveredDevice struct {
+	ID              int64     `json:"id"`
+	Mac             string    `json:"mac"`
+	Name            string    `json:"name"`
+	DeviceUrl       string    `json:"device_url"`
+	FirmwareVersion string    `json:"firmware_version"`
+	Resolution      string    `json:"resolution"`
+	Capabilities    []string  `json:"capabilities"`
+	Status          string    `json:"status"`
+	DeviceID        *int64    `json:"device_id"`
+	FirstSeenAt     time.Time `json:"first_seen_at"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
+}
+
+// Announcement the payload a device publishes to announce/<mac>. The MAC comes from the topic
+type Announcement struct {
+	Mac             string   `json:"-"`
+	Name            string   `json:"name"`
+	DeviceUrl       string   `json:"device_url"`
+	FirmwareVersion string   `json:"firmware_version"`
+	Resolution      string   `json:"resolution"`
+	Capabilities    []string `json:"capabilities"`
+}
+
+// Validate checks the MAC & the fields we'd copy onto a Device. The name is optional
+func (a Announcement) Validate() error {
+	if _, err := NormalizeMac(a.Mac); err != nil {
+		return err
+	}
+	u, err := url.Parse(a.DeviceUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: device_url must be an http(s) URL", ErrInvalidDevice)
+	}
+	if a.Resolution != "" && !resolutionPattern.MatchString(a.Resolution) {
+		return fmt.Errorf("%w: resolution must be a frame size (ex: VGA) or WIDTHxHEIGHT", ErrInvalidDevice)
+	}
+	for _, c := range a.Capabilities {
+		if !slices.Contains(Capabilities, c) {
+			return fmt.Errorf("%w: unknown capability %s", ErrInvalidDevice, c)
+		}
+	}
+	return nil
+}
+
+// NormalizeMac lower-case, colon separated, ex: "DE-AD-BE-EF-00-01" -> "de:ad:be:ef:00:01"
+func NormalizeMac(mac string) (string, error) {
+	if len(mac) == 12 {
+		// ESP32s commonly print their MAC without separators
+		mac = mac[0:2] + ":" + mac[2:4] + ":" + mac[4:6] + ":" + mac[6:8] + ":" + mac[8:10] + ":" + mac[10:12]
+	}
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return "", fmt.Errorf("%w: invalid MAC address %q", ErrInvalidDevice, mac)
+	}
+	return hw.String(), nil
+}
+
+type DiscoveryRepo interface {
+	// UpsertDiscoveredDevice records an announcement. Announcing again refreshes the details, not the status
+	UpsertDiscoveredDevice(ctx context.Context, a Announcement) (DiscoveredDevice, error)
+	GetDiscoveredDevice(ctx context.Context, id int64) (DiscoveredDevice, error)
+	// ListDiscoveredDevices most recently seen first, an empty status lists every device
+	ListDiscoveredDevices(ctx context.Context, status string) ([]DiscoveredDevice, error)
+	SetDiscoveredDeviceStatus(ctx context.Context, id int64, status string, deviceId *int64) (DiscoveredDevice, error)
+}
@@ -0,0 +1,37 @@
+package devices
+
+import (
+	"context"
+	"time"
+)
+
+// DetectionFilter confidence thresholds & label rules applied to detections before they're stored.
+// A nil DeviceID is the global filter, otherwise the filter overrides the global one for that device
+type DetectionFilter struct {
+	ID              int64              `db:"id" json:"id"`
+	DeviceID        *int64             `db:"device_id" json:"device_id"`
+	MinConfidence   float64            `db:"min_confidence" json:"min_confidence"`
+	LabelConfidence map[string]float64 `db:"label_confidence" json:"label_confidence"`
+	AllowLabels     []string           `db:"allow_labels" json:"allow_labels"`
+	DenyLabels      []string           `db:"deny_labels" json:"deny_labels"`
+	Aliases         map[string]string  `db:"aliases" json:"aliases"`
+	UpdatedAt       time.Time          `db:"updated_at" json:"updated_at"`
+}
+
+type UpsertDetectionFilterParams struct {
+	DeviceID        *int64             `db:"device_id" json:"device_id"`
+	MinConfidence   float64            `db:"min_confidence" json:"min_confidence"`
+	LabelConfidence map[string]float64 `db:"label_confidence" json:"label_confidence"`
+	AllowLabels     []string           `db:"allow_labels" json:"allow_labels"`
+	DenyLabels      []string           `db:"deny_labels" json:"deny_labels"`
+	Aliases         map[string]string  `db:"aliases" json:"aliases"`
+}
+
+type DetectionFilterRepo interface {
+	// GetDetectionFilters get the global filter & the filter for deviceId (global first)
+	GetDetectionFilters(ctx context.Context, deviceId int64) ([]DetectionFilter, error)
+	ListDetectionFilters(ctx context.Context) ([]DetectionFilter, error)
+	UpsertDetectionFilter(ctx context.Context, params UpsertDetectionFilterParams) (DetectionFilter, error)
+	// DeleteDetectionFilter delete the filter for deviceId, nil deletes the global filter
+	DeleteDetectionFilter(ctx context.Context, deviceId *int64) error
+}
@@ -0,0 +1,89 @@
+package devices
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Group a named set of devices, ex: a floor, building or "outdoor". Devices can be in any number of groups
+type Group struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	DeviceIDs   []int64   `json:"device_ids"`
+}
+
+// HasDevice ex: g.HasDevice(d.ID)
+func (g *Group) HasDevice(deviceId int64) bool {
+	return slices.Contains(g.DeviceIDs, deviceId)
+}
+
+type CreateGroupParams struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type UpdateGroupParams struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var ErrInvalidGroup = errors.New("invalid group")
+
+func ValidateGroup(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidGroup)
+	}
+	return nil
+}
+
+// GroupSettings settings applied to every device in a group. nil fields are left as they are
+type GroupSettings struct {
+	Enabled      *bool    `json:"enabled"`
+	Location     *string  `json:"location"`
+	Timezone     *string  `json:"timezone"`
+	Resolution   *string  `json:"resolution"`
+	Capabilities []string `json:"capabilities"`
+	AddTags      []string `json:"add_tags"`
+	RemoveTags   []string `json:"remove_tags"`
+}
+
+// Apply the UpdateDeviceParams that apply the settings to d, keeping its password & the enabled flag & capabilities
+// the settings leave out
+func (s GroupSettings) Apply(d Device) UpdateDeviceParams {
+	params := UpdateDeviceParams{
+		ID:              d.ID,
+		Name:            d.Name,
+		DeviceUrl:       d.DeviceUrl,
+		Location:        d.Location,
+		Tags:            slices.Clone(d.Tags),
+		Timezone:        d.Timezone,
+		Enabled:         s.Enabled,
+		Username:        d.Username,
+		FirmwareVersion: d.FirmwareVersion,
+		Resolution:      d.Resolution,
+		Capabilities:    slices.Clone(s.Capabilities),
+	}
+	if s.Location != nil {
+		params.Location = *s.Location
+	}
+	if s.Timezone != nil {
+		params.Timezone = *s.Timezone
+	}
+	if s.Resolution != nil {
+		params.Resolution = *s.Resolution
+	}
+	for _, tag := range s.AddTags {
+		if !slices.Contains(params.Tags, tag) {
+			params.Tags = append(params.Tags, tag)
+		}
+	}
+	params.Tags = slices.DeleteFunc(params.Tags, func(tag string) bool {
+		return slices.Contains(s.RemoveTags, tag)
+	})
+	return params
+}
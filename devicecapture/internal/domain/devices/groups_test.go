@@ -0,0 +1,66 @@
+package devices
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupSettings_Apply(t *testing.T) {
+	a := assert.New(t)
+	d := Device{
+		ID:           3,
+		Name:         "porch",
+		DeviceUrl:    "http://10.0.0.5",
+		Location:     "front",
+		Tags:         []string{"outdoor", "night"},
+		Timezone:     "America/Chicago",
+		Enabled:      true,
+		Username:     "admin",
+		Password:     "hunter2",
+		Resolution:   "VGA",
+		Capabilities: []string{CapabilitySnapshot},
+	}
+	disabled := false
+	resolution := "UXGA"
+	params := GroupSettings{
+		Enabled:    &disabled,
+		Resolution: &resolution,
+		AddTags:    []string{"floor-1", "outdoor"},
+		RemoveTags: []string{"night"},
+	}.Apply(d)
+
+	a.Equal(d.ID, params.ID)
+	a.Equal(d.Name, params.Name)
+	a.Equal(d.Location, params.Location, "nil settings are left alone")
+	a.Equal(d.Timezone, params.Timezone)
+	a.Nil(params.Capabilities, "the capabilities are kept")
+	a.Equal(&disabled, params.Enabled)
+	a.Equal("UXGA", params.Resolution)
+	a.Equal([]string{"outdoor", "floor-1"}, params.Tags)
+	a.Nil(params.Password, "the password is kept")
+	a.Equal([]string{"outdoor", "night"}, d.Tags, "the device isn't modified")
+}
+
+func TestMockRepo_Groups(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	repo := NewMockRepo()
+
+	g, err := repo.CreateGroup(ctx, CreateGroupParams{Name: "outdoor"})
+	a.NoError(err)
+	a.NoError(repo.AddGroupDevice(ctx, g.ID, GetMockDevice().ID))
+	a.NoError(repo.AddGroupDevice(ctx, g.ID, GetMockDevice().ID))
+	a.Error(repo.AddGroupDevice(ctx, g.ID, 99), "devices have to exist")
+
+	ds, err := repo.ListGroupDevices(ctx, g.ID)
+	a.NoError(err)
+	if a.Len(ds, 1) {
+		a.Equal(GetMockDevice().Name, ds[0].Name)
+	}
+
+	a.NoError(repo.DeleteDevice(ctx, GetMockDevice().ID))
+	g, err = repo.GetGroup(ctx, g.ID)
+	a.NoError(err)
+	a.Empty(g.DeviceIDs, "deleting a device removes it from its groups")
+}
@@ -6,18 +6,36 @@ import (
 )
 
 type DeviceImage struct {
-	ID        int64     `db:"id" json:"id"`
-	DeviceID  int64     `db:"device_id" json:"device_id"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	ImagePath string    `db:"image_path" json:"image_path"`
+	ID            int64     `db:"id" json:"id"`
+	DeviceID      int64     `db:"device_id" json:"device_id"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	ImagePath     string    `db:"image_path" json:"image_path"`
+	AnnotatedPath string    `db:"annotated_path" json:"annotated_path"`
+	// SessionID the CaptureSession the image is a frame of, nil for frames stored before sessions were
+	SessionID *int64 `db:"session_id" json:"session_id"`
 }
 
 type CreateImageParams struct {
 	DeviceID  int64  `db:"device_id" json:"device_id"`
 	ImagePath string `db:"image_path" json:"image_path"`
+	// AnnotatedPath optional, when the annotated copy is stored before the image record
+	AnnotatedPath string `db:"annotated_path" json:"annotated_path"`
+	SessionID     *int64 `db:"session_id" json:"session_id"`
 }
 
 type ImageRepo interface {
 	CreateImage(ctx context.Context, params CreateImageParams) (DeviceImage, error)
 	GetImages(ctx context.Context, deviceId int64) ([]DeviceImage, error)
+	GetImage(ctx context.Context, id int64) (DeviceImage, error)
+	// GetImagesByPrefix images whose keys start with prefix, in the order they were created, ex: a capture
+	// session's frames, videos/1-123/
+	GetImagesByPrefix(ctx context.Context, prefix string) ([]DeviceImage, error)
+	// GetSessionImages a capture session's frames, in the order they were created
+	GetSessionImages(ctx context.Context, sessionId int64) ([]DeviceImage, error)
+	// GetLatestDeviceImage the device's most recently created image
+	GetLatestDeviceImage(ctx context.Context, deviceId int64) (DeviceImage, error)
+	// SetAnnotatedPath link the copy of an image with its detections drawn on it
+	SetAnnotatedPath(ctx context.Context, id int64, annotatedPath string) (DeviceImage, error)
+	// DeleteImage delete an image record & its detections. Files are not removed
+	DeleteImage(ctx context.Context, id int64) error
 }
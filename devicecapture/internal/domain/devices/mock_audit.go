@@ -0,0 +1,58 @@
+package devices
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type MockAudit struct {
+	es []AuditEntry
+	mu sync.Mutex
+}
+
+func NewMockAudit() *MockAudit {
+	return &MockAudit{es: []AuditEntry{}}
+}
+
+func (m *MockAudit) CreateAuditEntry(_ context.Context, params CreateAuditParams) (AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	diff := params.Diff
+	if len(diff) == 0 {
+		diff = json.RawMessage("{}")
+	}
+	e := AuditEntry{
+		ID:         int64(len(m.es) + 1),
+		Actor:      params.Actor,
+		ActorID:    params.ActorID,
+		Action:     params.Action,
+		TargetType: params.TargetType,
+		TargetID:   params.TargetID,
+		Diff:       diff,
+		SourceIP:   params.SourceIP,
+		CreatedAt:  time.Now(),
+	}
+	m.es = append(m.es, e)
+	return e, nil
+}
+
+func (m *MockAudit) ListAuditEntries(_ context.Context, q AuditQuery) ([]AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultAuditLimit
+	}
+	result := []AuditEntry{}
+	for i := len(m.es) - 1; i >= 0; i-- {
+		if int32(len(result)) >= limit {
+			break
+		}
+		if q.Matches(m.es[i]) {
+			result = append(result, m.es[i])
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package devices
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+type MockCaptureSession struct {
+	// Images where the sessions' frames are counted
+	Images ImageRepo
+	ss     []CaptureSession
+	mu     sync.Mutex
+}
+
+func NewMockCaptureSession(images ImageRepo) *MockCaptureSession {
+	return &MockCaptureSession{Images: images, ss: []CaptureSession{}}
+}
+
+func (m *MockCaptureSession) CreateCaptureSession(_ context.Context, params CreateCaptureSessionParams) (CaptureSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if params.DeviceID < 0 {
+		return CaptureSession{}, errors.New("invalid device ID")
+	}
+	for _, s := range m.ss {
+		if s.SessionPath == params.SessionPath {
+			return CaptureSession{}, errors.New("duplicate session path")
+		}
+	}
+	s := CaptureSession{
+		ID:          int64(len(m.ss) + 1),
+		DeviceID:    params.DeviceID,
+		SessionPath: params.SessionPath,
+		StartedAt:   params.StartedAt,
+	}
+	m.ss = append(m.ss, s)
+	return s, nil
+}
+
+func (m *MockCaptureSession) EndCaptureSession(ctx context.Context, id int64, endedAt time.Time) (CaptureSession, error) {
+	frames, err := m.Images.GetSessionImages(ctx, id)
+	if err != nil {
+		return CaptureSession{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, s := range m.ss {
+		if s.ID == id {
+			m.ss[i].EndedAt = endedAt
+			m.ss[i].FrameCount = int32(len(frames))
+			return m.ss[i], nil
+		}
+	}
+	return CaptureSession{}, errors.New("session not found")
+}
+
+func (m *MockCaptureSession) GetCaptureSession(_ context.Context, id int64) (CaptureSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.ss {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return CaptureSession{}, errors.New("session not found")
+}
+
+func (m *MockCaptureSession) ListCaptureSessions(_ context.Context, q CaptureSessionQuery) ([]CaptureSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultCaptureSessionLimit
+	}
+	result := []CaptureSession{}
+	for _, s := range m.ss {
+		if slices.Contains(q.DeviceIDs, s.DeviceID) && !s.StartedAt.Before(q.After) &&
+			(q.Before.IsZero() || s.StartedAt.Before(q.Before)) {
+			result = append(result, s)
+		}
+	}
+	slices.SortStableFunc(result, func(a, b CaptureSession) int {
+		if c := b.StartedAt.Compare(a.StartedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return result[:min(len(result), int(limit))], nil
+}
@@ -0,0 +1,103 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+type MockDeviceConfig struct {
+	configs []DeviceConfig
+	mu      sync.Mutex
+}
+
+func NewMockDeviceConfig() *MockDeviceConfig {
+	return &MockDeviceConfig{}
+}
+
+// GetDeviceConfig MockDeviceConfig implements DeviceConfigRepo
+func (m *MockDeviceConfig) GetDeviceConfig(_ context.Context, deviceId int64) (DeviceConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	idx := m.index(deviceId)
+	if idx < 0 {
+		return DeviceConfig{}, errors.New("notfound")
+	}
+	return m.configs[idx], nil
+}
+
+// ListDeviceConfigs MockDeviceConfig implements DeviceConfigRepo
+func (m *MockDeviceConfig) ListDeviceConfigs(_ context.Context) ([]DeviceConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.configs), nil
+}
+
+// SetDesiredConfig MockDeviceConfig implements DeviceConfigRepo
+func (m *MockDeviceConfig) SetDesiredConfig(_ context.Context, deviceId int64, config CameraConfig) (DeviceConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	idx := m.index(deviceId)
+	if idx < 0 {
+		m.configs = append(m.configs, DeviceConfig{DeviceID: deviceId, PushedAt: time.Unix(0, 0), AckedAt: time.Unix(0, 0)})
+		idx = len(m.configs) - 1
+	}
+	c := &m.configs[idx]
+	c.Desired = config
+	c.DesiredVersion++
+	c.PushAttempts = 0
+	c.LastError = ""
+	c.UpdatedAt = time.Now()
+	return *c, nil
+}
+
+// ListUnackedConfigs MockDeviceConfig implements DeviceConfigRepo
+func (m *MockDeviceConfig) ListUnackedConfigs(_ context.Context, pushedBefore time.Time, maxAttempts int32) ([]DeviceConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := []DeviceConfig{}
+	for _, c := range m.configs {
+		if !c.Acked() && c.PushedAt.Before(pushedBefore) && c.PushAttempts < maxAttempts {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// RecordConfigPush MockDeviceConfig implements DeviceConfigRepo
+func (m *MockDeviceConfig) RecordConfigPush(_ context.Context, deviceId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if idx := m.index(deviceId); idx >= 0 {
+		m.configs[idx].PushedAt = time.Now()
+		m.configs[idx].PushAttempts++
+	}
+	return nil
+}
+
+// RecordConfigAck MockDeviceConfig implements DeviceConfigRepo
+func (m *MockDeviceConfig) RecordConfigAck(_ context.Context, deviceId int64, ack ConfigAck) (DeviceConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	idx := m.index(deviceId)
+	if idx < 0 {
+		return DeviceConfig{}, errors.New("notfound")
+	}
+	c := &m.configs[idx]
+	c.Reported = ack.Config
+	c.LastError = ack.Error
+	if ack.Error == "" {
+		c.AckedVersion = ack.Version
+		c.PushAttempts = 0
+	}
+	c.AckedAt = time.Now()
+	return *c, nil
+}
+
+func (m *MockDeviceConfig) index(deviceId int64) int {
+	return slices.IndexFunc(m.configs, func(c DeviceConfig) bool {
+		return c.DeviceID == deviceId
+	})
+}
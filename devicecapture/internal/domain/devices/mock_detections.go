@@ -8,12 +8,18 @@ import (
 
 type MockDetection struct {
 	ds []Detection
-	mu sync.Mutex
+	// Outbox where CreateDetectionsWithMessages writes messages
+	Outbox *MockOutbox
+	// Images where CreateImageDetections writes image records
+	Images *MockImage
+	mu     sync.Mutex
 }
 
 func NewMockDetection() *MockDetection {
 	return &MockDetection{
-		ds: []Detection{},
+		ds:     []Detection{},
+		Outbox: NewMockOutbox(),
+		Images: NewMockImageRepo(),
 	}
 }
 
@@ -31,6 +37,20 @@ func (d *MockDetection) GetDetectionsAfter(_ context.Context, params QueryParams
 	return result, nil
 }
 
+func (d *MockDetection) GetDetectionsAfterId(_ context.Context, id int64, limit int32) ([]Detection, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var result []Detection
+	for _, detection := range d.ds {
+		if detection.ID > id && len(result) < int(limit) {
+			result = append(result, detection)
+		}
+	}
+
+	return result, nil
+}
+
 func (d *MockDetection) GetDeviceDetectionsAfter(_ context.Context, params QueryParams) ([]Detection, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -48,28 +68,86 @@ func (d *MockDetection) GetDeviceDetectionsAfter(_ context.Context, params Query
 func (d *MockDetection) CreateDetection(_ context.Context, params CreateDetectionParams) (Detection, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	return d.createDetection(params), nil
+}
+
+// createDetection the caller must hold d.mu
+func (d *MockDetection) createDetection(params CreateDetectionParams) Detection {
 	detection := Detection{
 		ID:         int64(len(d.ds) + 1),
 		DeviceID:   params.DeviceID,
 		CreatedAt:  time.Now(),
+		ImageID:    params.ImageID,
 		Label:      params.Label,
 		Confidence: params.Confidence,
+		Bbox:       params.Bbox,
 	}
 
 	d.ds = append(d.ds, detection)
-	return detection, nil
+	return detection
 }
 
-func (d *MockDetection) CreateDetections(ctx context.Context, params []CreateDetectionParams) ([]Detection, error) {
+func (d *MockDetection) CreateDetections(_ context.Context, params []CreateDetectionParams) ([]Detection, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	var value []Detection
 	for _, param := range params {
-		record, err := d.CreateDetection(ctx, param)
+		value = append(value, d.createDetection(param))
+	}
+	return value, nil
+}
+
+func (d *MockDetection) CreateDetectionsWithMessages(_ context.Context, params []CreateDetectionParams, toMessage OutboxMessageFunc) ([]Detection, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.createDetectionsWithMessages(params, toMessage)
+}
+
+func (d *MockDetection) CreateImageDetections(ctx context.Context, image CreateImageParams, params []CreateDetectionParams, toMessage OutboxMessageFunc) (DeviceImage, []Detection, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	img, err := d.Images.CreateImage(ctx, image)
+	if err != nil {
+		return DeviceImage{}, nil, err
+	}
+	withImage := make([]CreateDetectionParams, len(params))
+	for i, p := range params {
+		p.ImageID = &img.ID
+		withImage[i] = p
+	}
+	var value []Detection
+	if toMessage == nil {
+		for _, p := range withImage {
+			value = append(value, d.createDetection(p))
+		}
+		return img, value, nil
+	}
+	value, err = d.createDetectionsWithMessages(withImage, toMessage)
+	if err != nil {
+		_ = d.Images.DeleteImage(ctx, img.ID)
+		return DeviceImage{}, nil, err
+	}
+	return img, value, nil
+}
+
+// createDetectionsWithMessages creates all of the detections & messages or none of them, the caller must hold d.mu
+func (d *MockDetection) createDetectionsWithMessages(params []CreateDetectionParams, toMessage OutboxMessageFunc) ([]Detection, error) {
+	created := len(d.ds)
+	var value []Detection
+	var messages []CreateOutboxParams
+	for _, param := range params {
+		detection := d.createDetection(param)
+		msg, err := toMessage(detection)
 		if err != nil {
-			return value, err
+			d.ds = d.ds[:created]
+			return nil, err
 		}
-		value = append(value, record)
+		value = append(value, detection)
+		messages = append(messages, msg)
+	}
+	if err := d.Outbox.createMessages(messages); err != nil {
+		d.ds = d.ds[:created]
+		return nil, err
 	}
 	return value, nil
 }
@@ -7,6 +7,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 func GetMockDevice() Device {
@@ -16,23 +17,32 @@ func GetMockDevice() Device {
 	}
 
 	return Device{
-		ID:        int64(1),
-		Name:      "mockdevice",
-		DeviceUrl: mockUrl,
+		ID:           int64(1),
+		Name:         "mockdevice",
+		DeviceUrl:    mockUrl,
+		Tags:         []string{},
+		Timezone:     DefaultTimezone,
+		Enabled:      true,
+		Capabilities: slices.Clone(DefaultCapabilities),
 	}
 }
 
 func GetTestFailDevice() Device {
 	return Device{
-		ID:        int64(2),
-		Name:      "fail",
-		DeviceUrl: "http://localhost:1234",
+		ID:           int64(2),
+		Name:         "fail",
+		DeviceUrl:    "http://localhost:1234",
+		Tags:         []string{},
+		Timezone:     DefaultTimezone,
+		Enabled:      true,
+		Capabilities: slices.Clone(DefaultCapabilities),
 	}
 }
 
 type MockRepo struct {
-	ds []Device
-	mu sync.Mutex
+	ds     []Device
+	groups []Group
+	mu     sync.Mutex
 }
 
 func NewMockRepo() *MockRepo {
@@ -59,11 +69,21 @@ func isLetter(s string) bool {
 func (mr *MockRepo) CreateDevice(_ context.Context, params CreateDeviceParams) (Device, error) {
 	mr.mu.Lock()
 	defer mr.mu.Unlock()
-	dev := GetMockDevice()
-	d := dev
-	d.ID = int64(len(mr.ds) + 1)
-	d.Name = params.Name
-	d.DeviceUrl = params.DeviceUrl
+	params = params.WithDefaults()
+	d := Device{
+		ID:              int64(len(mr.ds) + 1),
+		Name:            params.Name,
+		DeviceUrl:       params.DeviceUrl,
+		Location:        params.Location,
+		Tags:            params.Tags,
+		Timezone:        params.Timezone,
+		Enabled:         *params.Enabled,
+		Username:        params.Username,
+		Password:        params.Password,
+		FirmwareVersion: params.FirmwareVersion,
+		Resolution:      params.Resolution,
+		Capabilities:    params.Capabilities,
+	}
 	mr.ds = append(mr.ds, d)
 	return d, nil
 }
@@ -84,7 +104,7 @@ func (mr *MockRepo) GetDevice(_ context.Context, deviceId int64) (Device, error)
 func (mr *MockRepo) ListDevices(_ context.Context) ([]Device, error) {
 	mr.mu.Lock()
 	defer mr.mu.Unlock()
-	dSlice := make([]Device, len(mr.ds))
+	dSlice := make([]Device, 0, len(mr.ds))
 	for _, d := range mr.ds {
 		dSlice = append(dSlice, d)
 	}
@@ -95,10 +115,27 @@ func (mr *MockRepo) ListDevices(_ context.Context) ([]Device, error) {
 func (mr *MockRepo) UpdateDevice(_ context.Context, params UpdateDeviceParams) (Device, error) {
 	mr.mu.Lock()
 	defer mr.mu.Unlock()
-	for _, d := range mr.ds {
+	params = params.WithDefaults()
+	for idx, d := range mr.ds {
 		if d.ID == params.ID {
 			d.Name = params.Name
 			d.DeviceUrl = params.DeviceUrl
+			d.Location = params.Location
+			d.Tags = params.Tags
+			d.Timezone = params.Timezone
+			if params.Enabled != nil {
+				d.Enabled = *params.Enabled
+			}
+			d.Username = params.Username
+			if params.Password != nil {
+				d.Password = *params.Password
+			}
+			d.FirmwareVersion = params.FirmwareVersion
+			d.Resolution = params.Resolution
+			if params.Capabilities != nil {
+				d.Capabilities = params.Capabilities
+			}
+			mr.ds[idx] = d
 			return d, nil
 		}
 	}
@@ -118,9 +155,27 @@ func (mr *MockRepo) DeleteDevice(_ context.Context, id int64) error {
 	if found == false {
 		return errors.New("device not found")
 	}
+	for idx := range mr.groups {
+		mr.groups[idx].DeviceIDs = slices.DeleteFunc(mr.groups[idx].DeviceIDs, func(deviceId int64) bool {
+			return deviceId == id
+		})
+	}
 	return nil
 }
 
+// MuteDevice MockRepo implements DeviceRepository
+func (mr *MockRepo) MuteDevice(_ context.Context, deviceId int64, until time.Time) (Device, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for idx, d := range mr.ds {
+		if d.ID == deviceId {
+			mr.ds[idx].MutedUntil = until
+			return mr.ds[idx], nil
+		}
+	}
+	return Device{}, errors.New("notfound")
+}
+
 func (mr *MockRepo) DeleteTestDevices(_ context.Context) error {
 	mr.mu.Lock()
 	defer mr.mu.Unlock()
@@ -0,0 +1,87 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+type MockDiscovery struct {
+	ds []DiscoveredDevice
+	mu sync.Mutex
+}
+
+func NewMockDiscovery() *MockDiscovery {
+	return &MockDiscovery{}
+}
+
+// UpsertDiscoveredDevice MockDiscovery implements DiscoveryRepo
+func (m *MockDiscovery) UpsertDiscoveredDevice(_ context.Context, a Announcement) (DiscoveredDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	idx := slices.IndexFunc(m.ds, func(d DiscoveredDevice) bool {
+		return d.Mac == a.Mac
+	})
+	if idx < 0 {
+		m.ds = append(m.ds, DiscoveredDevice{
+			ID:          int64(len(m.ds) + 1),
+			Mac:         a.Mac,
+			Status:      DiscoveryPending,
+			FirstSeenAt: now,
+		})
+		idx = len(m.ds) - 1
+	}
+	d := &m.ds[idx]
+	d.Name = a.Name
+	d.DeviceUrl = a.DeviceUrl
+	d.FirmwareVersion = a.FirmwareVersion
+	d.Resolution = a.Resolution
+	d.Capabilities = slices.Clone(a.Capabilities)
+	d.LastSeenAt = now
+	return *d, nil
+}
+
+// GetDiscoveredDevice MockDiscovery implements DiscoveryRepo
+func (m *MockDiscovery) GetDiscoveredDevice(_ context.Context, id int64) (DiscoveredDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.ds {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return DiscoveredDevice{}, errors.New("notfound")
+}
+
+// ListDiscoveredDevices MockDiscovery implements DiscoveryRepo
+func (m *MockDiscovery) ListDiscoveredDevices(_ context.Context, status string) ([]DiscoveredDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := []DiscoveredDevice{}
+	for _, d := range m.ds {
+		if status == "" || d.Status == status {
+			result = append(result, d)
+		}
+	}
+	slices.SortFunc(result, func(a, b DiscoveredDevice) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+	return result, nil
+}
+
+// SetDiscoveredDeviceStatus MockDiscovery implements DiscoveryRepo
+func (m *MockDiscovery) SetDiscoveredDeviceStatus(_ context.Context, id int64, status string, deviceId *int64) (DiscoveredDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, d := range m.ds {
+		if d.ID == id {
+			m.ds[idx].Status = status
+			m.ds[idx].DeviceID = deviceId
+			return m.ds[idx], nil
+		}
+	}
+	return DiscoveredDevice{}, errors.New("notfound")
+}
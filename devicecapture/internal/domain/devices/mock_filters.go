@@ -0,0 +1,95 @@
+package devices
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type MockDetectionFilter struct {
+	fs []DetectionFilter
+	mu sync.Mutex
+}
+
+func NewMockDetectionFilter() *MockDetectionFilter {
+	return &MockDetectionFilter{
+		fs: []DetectionFilter{},
+	}
+}
+
+func (m *MockDetectionFilter) GetDetectionFilters(_ context.Context, deviceId int64) ([]DetectionFilter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []DetectionFilter
+	for _, f := range m.fs {
+		if f.DeviceID == nil || *f.DeviceID == deviceId {
+			result = append(result, f)
+		}
+	}
+	sortFilters(result)
+	return result, nil
+}
+
+func (m *MockDetectionFilter) ListDetectionFilters(_ context.Context) ([]DetectionFilter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]DetectionFilter, len(m.fs))
+	copy(result, m.fs)
+	sortFilters(result)
+	return result, nil
+}
+
+func (m *MockDetectionFilter) UpsertDetectionFilter(_ context.Context, params UpsertDetectionFilterParams) (DetectionFilter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := DetectionFilter{
+		ID:              int64(len(m.fs) + 1),
+		DeviceID:        params.DeviceID,
+		MinConfidence:   params.MinConfidence,
+		LabelConfidence: params.LabelConfidence,
+		AllowLabels:     params.AllowLabels,
+		DenyLabels:      params.DenyLabels,
+		Aliases:         params.Aliases,
+		UpdatedAt:       time.Now(),
+	}
+	for idx, existing := range m.fs {
+		if sameDevice(existing.DeviceID, params.DeviceID) {
+			f.ID = existing.ID
+			m.fs[idx] = f
+			return f, nil
+		}
+	}
+	m.fs = append(m.fs, f)
+	return f, nil
+}
+
+func (m *MockDetectionFilter) DeleteDetectionFilter(_ context.Context, deviceId *int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var filtered []DetectionFilter
+	for _, f := range m.fs {
+		if !sameDevice(f.DeviceID, deviceId) {
+			filtered = append(filtered, f)
+		}
+	}
+	m.fs = filtered
+	return nil
+}
+
+func sameDevice(a *int64, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// sortFilters global filter first, then by device ID
+func sortFilters(fs []DetectionFilter) {
+	sort.SliceStable(fs, func(i, j int) bool {
+		if fs[i].DeviceID == nil || fs[j].DeviceID == nil {
+			return fs[i].DeviceID == nil && fs[j].DeviceID != nil
+		}
+		return *fs[i].DeviceID < *fs[j].DeviceID
+	})
+}
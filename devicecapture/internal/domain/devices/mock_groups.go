@@ -0,0 +1,144 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CreateGroup MockRepo implements DeviceRepository
+func (mr *MockRepo) CreateGroup(_ context.Context, params CreateGroupParams) (Group, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for _, g := range mr.groups {
+		if g.Name == params.Name {
+			return Group{}, errors.New("duplicate group name")
+		}
+	}
+	var id int64 = 1
+	if len(mr.groups) > 0 {
+		id = mr.groups[len(mr.groups)-1].ID + 1
+	}
+	g := Group{
+		ID:          id,
+		Name:        params.Name,
+		Description: params.Description,
+		CreatedAt:   time.Now(),
+		DeviceIDs:   []int64{},
+	}
+	mr.groups = append(mr.groups, g)
+	return g, nil
+}
+
+// GetGroup MockRepo implements DeviceRepository
+func (mr *MockRepo) GetGroup(_ context.Context, groupId int64) (Group, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	idx := mr.groupIndex(groupId)
+	if idx < 0 {
+		return Group{}, errors.New("notfound")
+	}
+	return cloneGroup(mr.groups[idx]), nil
+}
+
+// ListGroups MockRepo implements DeviceRepository
+func (mr *MockRepo) ListGroups(_ context.Context) ([]Group, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	groups := make([]Group, 0, len(mr.groups))
+	for _, g := range mr.groups {
+		groups = append(groups, cloneGroup(g))
+	}
+	slices.SortFunc(groups, func(a, b Group) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return groups, nil
+}
+
+// UpdateGroup MockRepo implements DeviceRepository
+func (mr *MockRepo) UpdateGroup(_ context.Context, params UpdateGroupParams) (Group, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	idx := mr.groupIndex(params.ID)
+	if idx < 0 {
+		return Group{}, errors.New("notfound")
+	}
+	mr.groups[idx].Name = params.Name
+	mr.groups[idx].Description = params.Description
+	return cloneGroup(mr.groups[idx]), nil
+}
+
+// DeleteGroup MockRepo implements DeviceRepository
+func (mr *MockRepo) DeleteGroup(_ context.Context, groupId int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.groups = slices.DeleteFunc(mr.groups, func(g Group) bool {
+		return g.ID == groupId
+	})
+	return nil
+}
+
+// AddGroupDevice MockRepo implements DeviceRepository
+func (mr *MockRepo) AddGroupDevice(_ context.Context, groupId int64, deviceId int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	idx := mr.groupIndex(groupId)
+	if idx < 0 {
+		return errors.New("group not found")
+	}
+	if !slices.ContainsFunc(mr.ds, func(d Device) bool { return d.ID == deviceId }) {
+		return errors.New("device not found")
+	}
+	if !mr.groups[idx].HasDevice(deviceId) {
+		mr.groups[idx].DeviceIDs = append(mr.groups[idx].DeviceIDs, deviceId)
+		slices.Sort(mr.groups[idx].DeviceIDs)
+	}
+	return nil
+}
+
+// RemoveGroupDevice MockRepo implements DeviceRepository
+func (mr *MockRepo) RemoveGroupDevice(_ context.Context, groupId int64, deviceId int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	idx := mr.groupIndex(groupId)
+	if idx < 0 {
+		return nil
+	}
+	mr.groups[idx].DeviceIDs = slices.DeleteFunc(mr.groups[idx].DeviceIDs, func(id int64) bool {
+		return id == deviceId
+	})
+	return nil
+}
+
+// ListGroupDevices MockRepo implements DeviceRepository
+func (mr *MockRepo) ListGroupDevices(_ context.Context, groupId int64) ([]Device, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	result := []Device{}
+	idx := mr.groupIndex(groupId)
+	if idx < 0 {
+		return result, nil
+	}
+	for _, d := range mr.ds {
+		if mr.groups[idx].HasDevice(d.ID) {
+			result = append(result, d)
+		}
+	}
+	slices.SortFunc(result, func(a, b Device) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result, nil
+}
+
+func (mr *MockRepo) groupIndex(groupId int64) int {
+	return slices.IndexFunc(mr.groups, func(g Group) bool {
+		return g.ID == groupId
+	})
+}
+
+func cloneGroup(g Group) Group {
+	g.DeviceIDs = slices.Clone(g.DeviceIDs)
+	return g
+}
@@ -3,6 +3,8 @@ package devices
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,10 +32,12 @@ func (ir *MockImage) CreateImage(_ context.Context, params CreateImageParams) (D
 	}
 
 	img := DeviceImage{
-		ID:        int64(len(ir.ds) + 1),
-		DeviceID:  params.DeviceID,
-		CreatedAt: time.Now(),
-		ImagePath: params.ImagePath,
+		ID:            int64(len(ir.ds) + 1),
+		DeviceID:      params.DeviceID,
+		CreatedAt:     time.Now(),
+		ImagePath:     params.ImagePath,
+		AnnotatedPath: params.AnnotatedPath,
+		SessionID:     params.SessionID,
 	}
 	ir.ds = append(ir.ds, img)
 	return img, nil
@@ -50,3 +54,70 @@ func (ir *MockImage) GetImages(_ context.Context, deviceId int64) ([]DeviceImage
 	}
 	return imgs, nil
 }
+
+func (ir *MockImage) GetImage(_ context.Context, id int64) (DeviceImage, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	for _, img := range ir.ds {
+		if img.ID == id {
+			return img, nil
+		}
+	}
+	return DeviceImage{}, errors.New("image not found")
+}
+
+func (ir *MockImage) GetImagesByPrefix(_ context.Context, prefix string) ([]DeviceImage, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	var imgs []DeviceImage
+	for _, img := range ir.ds {
+		if strings.HasPrefix(img.ImagePath, prefix) {
+			imgs = append(imgs, img)
+		}
+	}
+	return imgs, nil
+}
+
+func (ir *MockImage) GetSessionImages(_ context.Context, sessionId int64) ([]DeviceImage, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	var imgs []DeviceImage
+	for _, img := range ir.ds {
+		if img.SessionID != nil && *img.SessionID == sessionId {
+			imgs = append(imgs, img)
+		}
+	}
+	return imgs, nil
+}
+
+func (ir *MockImage) GetLatestDeviceImage(_ context.Context, deviceId int64) (DeviceImage, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	for _, img := range slices.Backward(ir.ds) {
+		if img.DeviceID == deviceId {
+			return img, nil
+		}
+	}
+	return DeviceImage{}, errors.New("image not found")
+}
+
+func (ir *MockImage) SetAnnotatedPath(_ context.Context, id int64, annotatedPath string) (DeviceImage, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	for idx, img := range ir.ds {
+		if img.ID == id {
+			ir.ds[idx].AnnotatedPath = annotatedPath
+			return ir.ds[idx], nil
+		}
+	}
+	return DeviceImage{}, errors.New("image not found")
+}
+
+func (ir *MockImage) DeleteImage(_ context.Context, id int64) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	ir.ds = slices.DeleteFunc(ir.ds, func(img DeviceImage) bool {
+		return img.ID == id
+	})
+	return nil
+}
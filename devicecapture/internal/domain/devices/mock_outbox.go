@@ -0,0 +1,112 @@
+package devices
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type MockOutbox struct {
+	ms      []OutboxMessage
+	claimed map[int64]time.Time
+	mu      sync.Mutex
+}
+
+func NewMockOutbox() *MockOutbox {
+	return &MockOutbox{
+		ms:      []OutboxMessage{},
+		claimed: map[int64]time.Time{},
+	}
+}
+
+// Messages every message, sent or not
+func (o *MockOutbox) Messages() []OutboxMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutboxMessage{}, o.ms...)
+}
+
+// createMessages adds the messages, all or nothing like the Postgres transaction
+func (o *MockOutbox) createMessages(params []CreateOutboxParams) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	seen := map[string]bool{}
+	for _, m := range o.ms {
+		seen[m.MessageID] = true
+	}
+	for _, p := range params {
+		if seen[p.MessageID] {
+			return fmt.Errorf("duplicate outbox message ID %s", p.MessageID)
+		}
+		seen[p.MessageID] = true
+	}
+	for _, p := range params {
+		o.ms = append(o.ms, OutboxMessage{
+			ID:        int64(len(o.ms) + 1),
+			MessageID: p.MessageID,
+			Topic:     p.Topic,
+			Payload:   p.Payload,
+			CreatedAt: time.Now(),
+		})
+	}
+	return nil
+}
+
+func (o *MockOutbox) ClaimOutboxMessages(_ context.Context, limit int32, lease time.Duration) ([]OutboxMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	var result []OutboxMessage
+	for _, m := range o.ms {
+		if int32(len(result)) >= limit {
+			break
+		}
+		if m.Sent() || o.claimed[m.ID].After(now) {
+			continue
+		}
+		o.claimed[m.ID] = now.Add(lease)
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func (o *MockOutbox) MarkOutboxMessageSent(_ context.Context, id int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range o.ms {
+		if o.ms[i].ID == id {
+			o.ms[i].SentAt = time.Now()
+			return nil
+		}
+	}
+	return nil
+}
+
+func (o *MockOutbox) RecordOutboxMessageFailure(_ context.Context, id int64, lastError string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range o.ms {
+		if o.ms[i].ID == id {
+			o.ms[i].Attempts++
+			o.ms[i].LastError = lastError
+			delete(o.claimed, id)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (o *MockOutbox) DeleteSentOutboxMessages(_ context.Context, sentBefore time.Time) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var kept []OutboxMessage
+	for _, m := range o.ms {
+		if !m.Sent() || !m.SentAt.Before(sentBefore) {
+			kept = append(kept, m)
+		}
+	}
+	deleted := int64(len(o.ms) - len(kept))
+	o.ms = kept
+	return deleted, nil
+}
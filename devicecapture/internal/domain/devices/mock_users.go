@@ -0,0 +1,249 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+type MockUsers struct {
+	// Groups resolves group grants in ListGrantedDeviceIds
+	Groups   DeviceRepository
+	users    []User
+	sessions []Session
+	tokens   []ApiToken
+	grants   []Grant
+	mu       sync.Mutex
+}
+
+func NewMockUsers() *MockUsers {
+	return &MockUsers{}
+}
+
+// CreateUser MockUsers implements UserRepo
+func (m *MockUsers) CreateUser(_ context.Context, params CreateUserParams) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Username == params.Username {
+			return User{}, errors.New("duplicate username")
+		}
+	}
+	u := User{
+		ID:           int64(len(m.users) + 1),
+		Username:     params.Username,
+		PasswordHash: params.PasswordHash,
+		CreatedAt:    time.Now(),
+		Role:         params.Role,
+	}
+	m.users = append(m.users, u)
+	return u, nil
+}
+
+// GetUser MockUsers implements UserRepo
+func (m *MockUsers) GetUser(_ context.Context, id int64) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return User{}, errors.New("notfound")
+}
+
+// GetUserByUsername MockUsers implements UserRepo
+func (m *MockUsers) GetUserByUsername(_ context.Context, username string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return User{}, errors.New("notfound")
+}
+
+// ListUsers MockUsers implements UserRepo
+func (m *MockUsers) ListUsers(_ context.Context) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.users), nil
+}
+
+// UpdateUserRole MockUsers implements UserRepo
+func (m *MockUsers) UpdateUserRole(_ context.Context, id int64, role string) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, u := range m.users {
+		if u.ID == id {
+			m.users[i].Role = role
+			return m.users[i], nil
+		}
+	}
+	return User{}, errors.New("notfound")
+}
+
+// CreateSession MockUsers implements UserRepo
+func (m *MockUsers) CreateSession(_ context.Context, params CreateSessionParams) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Session{
+		TokenHash: params.TokenHash,
+		UserID:    params.UserID,
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	m.sessions = append(m.sessions, s)
+	return s, nil
+}
+
+// GetSession MockUsers implements UserRepo
+func (m *MockUsers) GetSession(_ context.Context, tokenHash string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sessions {
+		if s.TokenHash == tokenHash && s.ExpiresAt.After(time.Now()) {
+			return s, nil
+		}
+	}
+	return Session{}, errors.New("notfound")
+}
+
+// DeleteSession MockUsers implements UserRepo
+func (m *MockUsers) DeleteSession(_ context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions = slices.DeleteFunc(m.sessions, func(s Session) bool {
+		return s.TokenHash == tokenHash
+	})
+	return nil
+}
+
+// DeleteExpiredSessions MockUsers implements UserRepo
+func (m *MockUsers) DeleteExpiredSessions(_ context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := len(m.sessions)
+	m.sessions = slices.DeleteFunc(m.sessions, func(s Session) bool {
+		return s.ExpiresAt.Before(before)
+	})
+	return int64(count - len(m.sessions)), nil
+}
+
+// CreateApiToken MockUsers implements UserRepo
+func (m *MockUsers) CreateApiToken(_ context.Context, params CreateApiTokenParams) (ApiToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := ApiToken{
+		ID:        int64(len(m.tokens) + 1),
+		UserID:    params.UserID,
+		Name:      params.Name,
+		TokenHash: params.TokenHash,
+		Scopes:    slices.Clone(params.Scopes),
+		ExpiresAt: params.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	m.tokens = append(m.tokens, t)
+	return t, nil
+}
+
+// GetApiToken MockUsers implements UserRepo
+func (m *MockUsers) GetApiToken(_ context.Context, tokenHash string) (ApiToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tokens {
+		if t.TokenHash == tokenHash && (t.ExpiresAt.IsZero() || t.ExpiresAt.After(time.Now())) {
+			return t, nil
+		}
+	}
+	return ApiToken{}, errors.New("notfound")
+}
+
+// ListApiTokens MockUsers implements UserRepo
+func (m *MockUsers) ListApiTokens(_ context.Context, userId int64) ([]ApiToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := []ApiToken{}
+	for _, t := range m.tokens {
+		if t.UserID == userId {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+// DeleteApiToken MockUsers implements UserRepo
+func (m *MockUsers) DeleteApiToken(_ context.Context, userId int64, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	idx := slices.IndexFunc(m.tokens, func(t ApiToken) bool {
+		return t.ID == id && t.UserID == userId
+	})
+	if idx < 0 {
+		return errors.New("notfound")
+	}
+	m.tokens = slices.Delete(m.tokens, idx, idx+1)
+	return nil
+}
+
+// CreateGrant MockUsers implements UserRepo
+func (m *MockUsers) CreateGrant(_ context.Context, params CreateGrantParams) (Grant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g := Grant{
+		ID:        int64(len(m.grants) + 1),
+		UserID:    params.UserID,
+		DeviceID:  params.DeviceID,
+		GroupID:   params.GroupID,
+		CreatedAt: time.Now(),
+	}
+	m.grants = append(m.grants, g)
+	return g, nil
+}
+
+// ListGrants MockUsers implements UserRepo
+func (m *MockUsers) ListGrants(_ context.Context, userId int64) ([]Grant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := []Grant{}
+	for _, g := range m.grants {
+		if g.UserID == userId {
+			result = append(result, g)
+		}
+	}
+	return result, nil
+}
+
+// DeleteGrant MockUsers implements UserRepo
+func (m *MockUsers) DeleteGrant(_ context.Context, userId int64, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	idx := slices.IndexFunc(m.grants, func(g Grant) bool {
+		return g.ID == id && g.UserID == userId
+	})
+	if idx < 0 {
+		return errors.New("notfound")
+	}
+	m.grants = slices.Delete(m.grants, idx, idx+1)
+	return nil
+}
+
+// ListGrantedDeviceIds MockUsers implements UserRepo
+func (m *MockUsers) ListGrantedDeviceIds(ctx context.Context, userId int64) ([]int64, error) {
+	grants, _ := m.ListGrants(ctx, userId)
+	ids := []int64{}
+	for _, g := range grants {
+		if g.DeviceID != nil {
+			ids = append(ids, *g.DeviceID)
+		} else if m.Groups != nil {
+			if group, err := m.Groups.GetGroup(ctx, *g.GroupID); err == nil {
+				ids = append(ids, group.DeviceIDs...)
+			}
+		}
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
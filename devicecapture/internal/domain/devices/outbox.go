@@ -0,0 +1,44 @@
+package devices
+
+import (
+	"context"
+	"time"
+)
+
+// OutboxMessage a message written in the same transaction as the rows it describes, then published by
+// outbox.Relay. Messages can be published more than once, MessageID lets consumers deduplicate them
+type OutboxMessage struct {
+	ID        int64     `json:"id"`
+	MessageID string    `json:"message_id"`
+	Topic     string    `json:"topic"`
+	Payload   []byte    `json:"payload"`
+	Attempts  int32     `json:"attempts"`
+	LastError string    `json:"last_error"`
+	CreatedAt time.Time `json:"created_at"`
+	// SentAt the zero time until the message is published
+	SentAt time.Time `json:"sent_at"`
+}
+
+func (m OutboxMessage) Sent() bool {
+	return !m.SentAt.IsZero()
+}
+
+type CreateOutboxParams struct {
+	MessageID string `json:"message_id"`
+	Topic     string `json:"topic"`
+	Payload   []byte `json:"payload"`
+}
+
+// OutboxMessageFunc builds the message published for a detection
+type OutboxMessageFunc func(d Detection) (CreateOutboxParams, error)
+
+type OutboxRepo interface {
+	// ClaimOutboxMessages claims up to limit pending messages for lease, oldest first. Claimed messages aren't
+	// returned again until the lease expires or a failure is recorded
+	ClaimOutboxMessages(ctx context.Context, limit int32, lease time.Duration) ([]OutboxMessage, error)
+	MarkOutboxMessageSent(ctx context.Context, id int64) error
+	// RecordOutboxMessageFailure releases the message's claim so it's retried
+	RecordOutboxMessageFailure(ctx context.Context, id int64, lastError string) error
+	// DeleteSentOutboxMessages returns how many messages were deleted
+	DeleteSentOutboxMessages(ctx context.Context, sentBefore time.Time) (int64, error)
+}
@@ -0,0 +1,178 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// User someone who can log in to the dashboard & own API tokens. What they can do is up to their Role
+type User struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	Role         string    `json:"role"`
+}
+
+// User roles
+const (
+	// RoleViewer watch the devices they've been granted: streams, images, detections & configs
+	RoleViewer = "viewer"
+	// RoleOperator also snapshot, stream, mute & change the settings & filters of the devices they've been granted
+	RoleOperator = "operator"
+	// RoleAdmin every device, & manage devices, groups, discovery, global filters & users
+	RoleAdmin = "admin"
+)
+
+var Roles = []string{RoleViewer, RoleOperator, RoleAdmin}
+
+// Grant a viewer or operator access to a device, or every device in a group. Exactly one of DeviceID & GroupID is set.
+// Admins don't need grants
+type Grant struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	DeviceID  *int64    `json:"device_id"`
+	GroupID   *int64    `json:"group_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Session a logged-in browser. TokenHash is the SHA-256 of the session cookie, the cookie itself isn't stored
+type Session struct {
+	TokenHash string    `json:"-"`
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// API token scopes
+const (
+	// ScopeRead GET devices, images, streams & detections
+	ScopeRead = "read"
+	// ScopeWrite create, update & delete devices, groups, filters & configs. Doesn't imply ScopeRead
+	ScopeWrite = "write"
+	// ScopeAdmin manage users
+	ScopeAdmin = "admin"
+)
+
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// ApiToken a bearer token for machine clients, limited to its Scopes. A zero ExpiresAt never expires
+type ApiToken struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	TokenHash string    `json:"-"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t ApiToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+type CreateUserParams struct {
+	Username     string
+	PasswordHash string
+	Role         string
+}
+
+type CreateGrantParams struct {
+	UserID   int64  `json:"-"`
+	DeviceID *int64 `json:"device_id"`
+	GroupID  *int64 `json:"group_id"`
+}
+
+type CreateSessionParams struct {
+	TokenHash string
+	UserID    int64
+	ExpiresAt time.Time
+}
+
+type CreateApiTokenParams struct {
+	UserID    int64
+	Name      string
+	TokenHash string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+var ErrInvalidUser = errors.New("invalid user")
+
+// MinPasswordLength & MaxPasswordLength bcrypt ignores anything past 72 bytes
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+func ValidateUser(username string, password string, role string) error {
+	if username == "" || len(username) > 100 {
+		return fmt.Errorf("%w: username is required, up to 100 characters", ErrInvalidUser)
+	}
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return fmt.Errorf("%w: password must be %d to %d characters", ErrInvalidUser, MinPasswordLength, MaxPasswordLength)
+	}
+	return ValidateRole(role)
+}
+
+func ValidateRole(role string) error {
+	if !slices.Contains(Roles, role) {
+		return fmt.Errorf("%w: role must be one of %s", ErrInvalidUser, strings.Join(Roles, ", "))
+	}
+	return nil
+}
+
+var ErrInvalidGrant = errors.New("invalid grant")
+
+func ValidateGrant(params CreateGrantParams) error {
+	if (params.DeviceID == nil) == (params.GroupID == nil) {
+		return fmt.Errorf("%w: set one of device_id or group_id", ErrInvalidGrant)
+	}
+	return nil
+}
+
+var ErrInvalidToken = errors.New("invalid API token")
+
+func ValidateApiToken(name string, scopes []string) error {
+	if name == "" || len(name) > 100 {
+		return fmt.Errorf("%w: name is required, up to 100 characters", ErrInvalidToken)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidToken)
+	}
+	for _, s := range scopes {
+		if !slices.Contains(Scopes, s) {
+			return fmt.Errorf("%w: unknown scope %s", ErrInvalidToken, s)
+		}
+	}
+	return nil
+}
+
+type UserRepo interface {
+	CreateUser(ctx context.Context, params CreateUserParams) (User, error)
+	GetUser(ctx context.Context, id int64) (User, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	UpdateUserRole(ctx context.Context, id int64, role string) (User, error)
+	CreateSession(ctx context.Context, params CreateSessionParams) (Session, error)
+	// GetSession an unexpired session
+	GetSession(ctx context.Context, tokenHash string) (Session, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error)
+	CreateApiToken(ctx context.Context, params CreateApiTokenParams) (ApiToken, error)
+	// GetApiToken an unexpired token
+	GetApiToken(ctx context.Context, tokenHash string) (ApiToken, error)
+	ListApiTokens(ctx context.Context, userId int64) ([]ApiToken, error)
+	// DeleteApiToken deletes one of the user's tokens
+	DeleteApiToken(ctx context.Context, userId int64, id int64) error
+	CreateGrant(ctx context.Context, params CreateGrantParams) (Grant, error)
+	ListGrants(ctx context.Context, userId int64) ([]Grant, error)
+	// DeleteGrant deletes one of the user's grants
+	DeleteGrant(ctx context.Context, userId int64, id int64) error
+	// ListGrantedDeviceIds the devices the user was granted, directly or through a group
+	ListGrantedDeviceIds(ctx context.Context, userId int64) ([]int64, error)
+}
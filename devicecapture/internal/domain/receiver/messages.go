@@ -2,7 +2,10 @@ package receiver
 
 import (
 	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/signedurl"
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -23,12 +26,21 @@ func (fm *FrameMsg) UnmarshalJSON(b []byte) error {
 	return err
 }
 
-func FrameJson(thisIp string, deviceId string, filePath string, fr Frame) (string, error) {
+// BlobRoute deviceserver route that serves stored frames by key
+const BlobRoute = "/blobs/"
+
+// BlobUrl the deviceserver URL of a stored frame
+func BlobUrl(thisIp string, key string) string {
+	return thisIp + BlobRoute + strings.TrimPrefix(key, "/")
+}
+
+// FrameJson the frame message of fr stored at filePath, its URL signed by signer so it works without a login
+func FrameJson(thisIp string, signer *signedurl.Signer, deviceId string, filePath string, fr Frame) (string, error) {
 	var msg = FrameMsg{
 		DeviceId:  deviceId,
 		FileName:  filePath,
 		Timestamp: fr.Timestamp,
-		Url:       thisIp + filePath,
+		Url:       signer.Sign(BlobUrl(thisIp, filePath)),
 	}
 	value, err := json.Marshal(msg)
 	if err != nil {
@@ -38,18 +50,31 @@ func FrameJson(thisIp string, deviceId string, filePath string, fr Frame) (strin
 }
 
 type DetectionMsg struct {
-	ID         int64       `db:"id" json:"id"`
-	DeviceID   int64       `db:"device_id" json:"device_id"`
-	ImageID    *int64      `db:"image_id" json:"image_id"`
-	CreatedAt  time.Time   `db:"created_at" json:"created_at"`
-	Label      string      `db:"label" json:"label"`
-	Confidence float64     `db:"confidence" json:"confidence"`
-	Bbox       [][]float64 `db:"bbox" json:"bbox"`
-	Url        string      `json:"url"`
+	// MessageID is the same each time the detection is published, see DetectionMessageID
+	MessageID    string      `json:"message_id"`
+	ID           int64       `db:"id" json:"id"`
+	DeviceID     int64       `db:"device_id" json:"device_id"`
+	ImageID      *int64      `db:"image_id" json:"image_id"`
+	CreatedAt    time.Time   `db:"created_at" json:"created_at"`
+	Label        string      `db:"label" json:"label"`
+	Confidence   float64     `db:"confidence" json:"confidence"`
+	Bbox         [][]float64 `db:"bbox" json:"bbox"`
+	Url          string      `json:"url"`
+	AnnotatedUrl string      `json:"annotated_url"`
+}
+
+// AnnotatedQuery appended to image URLs to request the annotated copy
+const AnnotatedQuery = "?annotated=1"
+
+// DetectionMessageID identifies a detection's message, so consumers can drop messages they've already seen
+func DetectionMessageID(d devices.Detection) string {
+	return "detection-" + strconv.FormatInt(d.ID, 10)
 }
 
-func DetectionToMsg(thisIp string, filePath string, d devices.Detection) (string, error) {
+// NewDetectionMsg d's message, with the URLs of the frame stored at filePath
+func NewDetectionMsg(thisIp string, filePath string, annotated bool, d devices.Detection) DetectionMsg {
 	var msg = DetectionMsg{
+		MessageID:  DetectionMessageID(d),
 		ID:         d.ID,
 		DeviceID:   d.DeviceID,
 		ImageID:    d.ImageID,
@@ -57,7 +82,21 @@ func DetectionToMsg(thisIp string, filePath string, d devices.Detection) (string
 		Label:      d.Label,
 		Confidence: d.Confidence,
 		Bbox:       d.Bbox,
-		Url:        thisIp + filePath,
+		Url:        BlobUrl(thisIp, filePath),
+	}
+	if annotated {
+		msg.AnnotatedUrl = msg.Url + AnnotatedQuery
+	}
+	return msg
+}
+
+// DetectionToMsg d's published message, its URLs signed by signer so consumers that can't log in can fetch the frame,
+// ex: Home Assistant
+func DetectionToMsg(thisIp string, signer *signedurl.Signer, filePath string, annotated bool, d devices.Detection) (string, error) {
+	msg := NewDetectionMsg(thisIp, filePath, annotated, d)
+	msg.Url = signer.Sign(msg.Url)
+	if msg.AnnotatedUrl != "" {
+		msg.AnnotatedUrl = signer.Sign(msg.AnnotatedUrl)
 	}
 	value, err := json.Marshal(msg)
 	if err != nil {
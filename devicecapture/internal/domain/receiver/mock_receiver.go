@@ -20,10 +20,14 @@ func NewMockFrameRepo() *MockFrameRepo {
 }
 
 func (fr *MockFrameRepo) GetFrame() *Frame {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
 	return fr.lastFrame
 }
 
 func (fr *MockFrameRepo) GetSession() *CaptureSession {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
 	return fr.lastSession
 }
 
@@ -41,7 +45,7 @@ func (fr *MockFrameRepo) StartSession(deviceId string) (*CaptureSession, error)
 }
 
 // EndSession MockFrameRepo implements receiver.FrameRepository
-func (fr *MockFrameRepo) EndSession() error {
+func (fr *MockFrameRepo) EndSession(_ *CaptureSession) error {
 	fr.mu.Lock()
 	defer fr.mu.Unlock()
 	fr.Running = false
@@ -49,7 +53,7 @@ func (fr *MockFrameRepo) EndSession() error {
 }
 
 // ReceiveFrame MockFrameRepo implements receiver.FrameRepository
-func (fr *MockFrameRepo) ReceiveFrame(frame Frame, _ string) error {
+func (fr *MockFrameRepo) ReceiveFrame(_ *CaptureSession, frame Frame, _ string) error {
 	fr.mu.Lock()
 	defer fr.mu.Unlock()
 	fr.lastFrame = &frame
@@ -57,7 +61,7 @@ func (fr *MockFrameRepo) ReceiveFrame(frame Frame, _ string) error {
 }
 
 // ReceiveFrameStream MockFrameRepo implements receiver.FrameRepository
-func (fr *MockFrameRepo) ReceiveFrameStream(ctx context.Context, imgChan <-chan Frame) error {
+func (fr *MockFrameRepo) ReceiveFrameStream(ctx context.Context, session *CaptureSession, imgChan <-chan Frame) error {
 	done := make(chan error)
 	go func() {
 		for {
@@ -67,7 +71,7 @@ func (fr *MockFrameRepo) ReceiveFrameStream(ctx context.Context, imgChan <-chan
 					done <- nil
 					return
 				}
-				err := fr.ReceiveFrame(img, FramePath("/tmp", fr.lastSession, img))
+				err := fr.ReceiveFrame(session, img, FramePath("/tmp", session, img))
 				if err != nil {
 					done <- err
 					return
@@ -1,25 +1,90 @@
 package receiver
 
 import (
+	"bytes"
 	"context"
+	"devicecapture/internal/domain/devices"
+	"errors"
 	"fmt"
 	"image"
+	"image/jpeg"
+	"path"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-// FrameRepository interface for storing frames
+// FrameRepository interface for storing frames. Sessions are passed back in rather than kept by the repository,
+// so one FrameRepository can serve several devices' sessions at once
 type FrameRepository interface {
 	StartSession(deviceId string) (*CaptureSession, error)
-	EndSession() error
-	ReceiveFrame(frame Frame, framePath string) error
-	ReceiveFrameStream(ctx context.Context, imgChan <-chan Frame) error
+	EndSession(session *CaptureSession) error
+	ReceiveFrame(session *CaptureSession, frame Frame, framePath string) error
+	ReceiveFrameStream(ctx context.Context, session *CaptureSession, imgChan <-chan Frame) error
 }
 
+// Frame a JPEG received from a device.
+// Buf holds the original JPEG bytes, which are written to disk & sent to the detector as-is.
+// The JPEG is only decoded when something needs the pixels (see Frame.Image)
 type Frame struct {
 	Buf       []byte
-	Image     image.Image
 	Timestamp int64
+	decoded   *decodedImage
+}
+
+// decodedImage is shared between copies of a Frame, so it's decoded at most once
+type decodedImage struct {
+	once sync.Once
+	img  image.Image
+	err  error
+}
+
+// NewFrame wraps JPEG bytes in a Frame without decoding them
+func NewFrame(buf []byte, timestamp int64) Frame {
+	return Frame{
+		Buf:       buf,
+		Timestamp: timestamp,
+		decoded:   &decodedImage{},
+	}
+}
+
+// NewFrameFromImage encodes img as a JPEG Frame, for sources that only have pixels (ex: tests)
+func NewFrameFromImage(img image.Image, timestamp int64) (Frame, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		return Frame{}, err
+	}
+	f := NewFrame(buf.Bytes(), timestamp)
+	f.decoded.once.Do(func() {
+		f.decoded.img = img
+	})
+	return f, nil
+}
+
+// Image decodes the JPEG the first time it's called, later calls (& copies of the Frame) reuse the result
+func (f Frame) Image() (image.Image, error) {
+	if f.decoded == nil {
+		return f.decode()
+	}
+	f.decoded.once.Do(func() {
+		f.decoded.img, f.decoded.err = f.decode()
+	})
+	return f.decoded.img, f.decoded.err
+}
+
+func (f Frame) decode() (image.Image, error) {
+	if len(f.Buf) == 0 {
+		return nil, ErrEmptyFrame
+	}
+	return jpeg.Decode(bytes.NewReader(f.Buf))
+}
+
+var ErrEmptyFrame = errors.New("frame is empty")
+
+// IsJpeg cheap check that buf starts with a JPEG SOI marker
+func IsJpeg(buf []byte) bool {
+	return len(buf) > 2 && buf[0] == 0xFF && buf[1] == 0xD8
 }
 
 // CaptureSession A reference to when we started capturing Frames from a Camera
@@ -59,13 +124,63 @@ func (cr *CaptureSession) GetFrameCount() int {
 	return cr.frameCount
 }
 
+// SessionPath the blob key prefix of a session's frames, ex: videos/1-123
+func SessionPath(prefix string, session *CaptureSession) string {
+	return fmt.Sprintf("%s/%s-%v", prefix, session.DeviceID, session.StartedAt)
+}
+
+// FramePath the blob key of a frame, ex: videos/1-123/output-1-456.jpeg
 func FramePath(prefix string, session *CaptureSession, frame Frame) string {
 	return fmt.Sprintf(
-		"%s/%s-%v/output-%s-%v.jpeg",
-		prefix,
-		session.DeviceID,
-		session.StartedAt,
+		"%s/output-%s-%v.jpeg",
+		SessionPath(prefix, session),
 		session.DeviceID,
 		frame.Timestamp,
 	)
 }
+
+// FrameDeviceID the device a frame's blob key, annotated copy or variant is from, per FramePath
+// ex: videos/1-123/output-1-456_detection.jpeg -> 1
+func FrameDeviceID(framePath string) (int64, bool) {
+	rest, ok := strings.CutPrefix(path.Base(framePath), "output-")
+	if !ok {
+		return 0, false
+	}
+	id, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	deviceId, err := strconv.ParseInt(id, 10, 64)
+	return deviceId, err == nil
+}
+
+// FrameTimestamp when a frame was captured in unix milliseconds, per FramePath. Only original frames have one
+// ex: videos/1-123/output-1-456.jpeg -> 456
+func FrameTimestamp(framePath string) (int64, bool) {
+	name := strings.TrimSuffix(path.Base(framePath), path.Ext(framePath))
+	rest, ok := strings.CutPrefix(name, "output-")
+	if !ok {
+		return 0, false
+	}
+	_, timestamp, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	return ms, err == nil
+}
+
+// CapturedAt when a stored frame was captured, per its key, or when it was stored if its key doesn't say
+func CapturedAt(img devices.DeviceImage) time.Time {
+	if ms, ok := FrameTimestamp(img.ImagePath); ok {
+		return time.UnixMilli(ms)
+	}
+	return img.CreatedAt
+}
+
+// AnnotatedFramePath the key of a frame's annotated copy, stored alongside the original.
+// ex: videos/1-123/output-1-456.jpeg -> videos/1-123/output-1-456_detection.jpeg
+func AnnotatedFramePath(framePath string) string {
+	ext := path.Ext(framePath)
+	return strings.TrimSuffix(framePath, ext) + "_detection" + ext
+}
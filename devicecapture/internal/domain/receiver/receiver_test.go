@@ -0,0 +1,99 @@
+package receiver
+
+import (
+	"devicecapture/internal/domain/devices"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrame_Image(t *testing.T) {
+	a := assert.New(t)
+	src := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	encoded, err := NewFrameFromImage(src, 1)
+	a.NoError(err)
+
+	frame := NewFrame(encoded.Buf, 2)
+	a.Nil(frame.decoded.img, "frames are not decoded up front")
+	copied := frame
+
+	img, err := frame.Image()
+	a.NoError(err)
+	a.Equal(src.Bounds(), img.Bounds())
+	again, err := copied.Image()
+	a.NoError(err)
+	a.Same(img, again, "copies of a frame share the decoded image")
+
+	_, err = NewFrame([]byte("not a jpeg"), 3).Image()
+	a.Error(err)
+	_, err = Frame{}.Image()
+	a.ErrorIs(err, ErrEmptyFrame)
+}
+
+func TestIsJpeg(t *testing.T) {
+	encoded, err := NewFrameFromImage(image.NewRGBA(image.Rect(0, 0, 4, 4)), 1)
+	assert.NoError(t, err)
+	assert.True(t, IsJpeg(encoded.Buf))
+	assert.False(t, IsJpeg([]byte("--frame")))
+	assert.False(t, IsJpeg(nil))
+}
+
+func TestAnnotatedFramePath(t *testing.T) {
+	assert.Equal(t, "videos/1-123/output-1-456_detection.jpeg", AnnotatedFramePath("videos/1-123/output-1-456.jpeg"))
+}
+
+func TestFrameDeviceID(t *testing.T) {
+	tests := []struct {
+		key    string
+		want   int64
+		wantOk bool
+	}{
+		{key: "videos/12-123/output-12-456.jpeg", want: 12, wantOk: true},
+		{key: "/static/videos/1-123/output-1-456_detection.jpeg", want: 1, wantOk: true},
+		{key: "videos/1-123/output-1-456_thumb.jpeg", want: 1, wantOk: true},
+		{key: "index.html"},
+		{key: "videos/1-123/output-x-456.jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := FrameDeviceID(tt.key)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFrameTimestamp(t *testing.T) {
+	tests := []struct {
+		key    string
+		want   int64
+		wantOk bool
+	}{
+		{key: "videos/12-123/output-12-456.jpeg", want: 456, wantOk: true},
+		{key: "videos/1-123/output-1-456_detection.jpeg"},
+		{key: "index.html"},
+		{key: "videos/1-123/output-1.jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := FrameTimestamp(tt.key)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCapturedAt(t *testing.T) {
+	storedAt := time.UnixMilli(789)
+	a := assert.New(t)
+	a.Equal(time.UnixMilli(456), CapturedAt(devices.DeviceImage{ImagePath: "videos/1-123/output-1-456.jpeg", CreatedAt: storedAt}))
+	a.Equal(storedAt, CapturedAt(devices.DeviceImage{ImagePath: "videos/1/a.jpeg", CreatedAt: storedAt}), "keys without a capture time")
+}
+
+func TestSessionPath(t *testing.T) {
+	session := &CaptureSession{DeviceID: "1", StartedAt: 123}
+	assert.Equal(t, "videos/1-123", SessionPath("videos", session))
+	assert.Equal(t, "videos/1-123/output-1-456.jpeg", FramePath("videos", session, Frame{Timestamp: 456}))
+}
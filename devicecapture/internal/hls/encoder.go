@@ -0,0 +1,79 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content types of playlists & segments
+const (
+	ContentTypePlaylist = "application/vnd.apple.mpegurl"
+	ContentTypeSegment  = "video/mp2t"
+)
+
+// Encoder packages a segment's JPEG frames into an MPEG-TS segment
+type Encoder interface {
+	// Encode shows each frame for its duration. offset is where the segment starts within its recording, so its
+	// timestamps carry on from the previous segment's
+	Encode(ctx context.Context, frames [][]byte, durations []time.Duration, offset time.Duration) ([]byte, error)
+}
+
+// FfmpegEncoder encodes segments as H.264 with the ffmpeg binary at Path
+type FfmpegEncoder struct {
+	Path string
+}
+
+func NewFfmpegEncoder(path string) *FfmpegEncoder {
+	return &FfmpegEncoder{Path: path}
+}
+
+func (e *FfmpegEncoder) Encode(ctx context.Context, frames [][]byte, durations []time.Duration, offset time.Duration) ([]byte, error) {
+	if len(frames) == 0 || len(frames) != len(durations) {
+		return nil, fmt.Errorf("%d frames with %d durations", len(frames), len(durations))
+	}
+	dir, err := os.MkdirTemp("", "hls-segment-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// The concat demuxer shows each file for its duration, the last file is listed twice or its duration is ignored
+	var list strings.Builder
+	for i, frame := range frames {
+		name := strconv.Itoa(i) + ".jpeg"
+		if err := os.WriteFile(filepath.Join(dir, name), frame, 0o600); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&list, "file '%s'\nduration %.3f\n", name, durations[i].Seconds())
+	}
+	fmt.Fprintf(&list, "file '%d.jpeg'\n", len(frames)-1)
+	listPath := filepath.Join(dir, "frames.txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0o600); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Path,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "concat", "-safe", "0", "-i", listPath,
+		// H.264 needs even dimensions
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2,format=yuv420p",
+		"-fps_mode", "vfr",
+		"-c:v", "libx264", "-preset", "veryfast",
+		"-output_ts_offset", strconv.FormatFloat(offset.Seconds(), 'f', 3, 64),
+		"-f", "mpegts", "pipe:1",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
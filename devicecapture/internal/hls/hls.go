@@ -0,0 +1,254 @@
+// Package hls packages stored frames into HLS playlists & MPEG-TS segments, for players that can't handle MJPEG or
+// need to seek. A recording is a capture session's frames, ex: videos/1-123/output-1-456.jpeg is in recording
+// 1-123, indexed by their device_images rows. It's the same capture session /api/sessions lists with its ID, see
+// SessionRecordingID. Recordings are split into segments of Conf.SegmentDuration by the
+// frames' capture times. While frames are still arriving the newest segments aren't listed, so a listed segment
+// never changes & is encoded once, then cached alongside the frames. Deleting a frame can move the boundaries of the
+// segments after it, so they're cached by their frames & encoded again, see SegmentKey
+package hls
+
+import (
+	"context"
+	"devicecapture/internal/blob"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrInvalidRecording  = errors.New("invalid recording ID")
+	ErrRecordingNotFound = errors.New("recording not found")
+	ErrSegmentNotFound   = errors.New("segment not found")
+	ErrNotLive           = errors.New("device isn't streaming")
+)
+
+// Recording a capture session's frames, oldest first
+type Recording struct {
+	// ID the session's directory, ex: 1-123
+	ID       string
+	DeviceID int64
+	Frames   []Frame
+	// LastStoredAt when the newest frame was stored
+	LastStoredAt time.Time
+}
+
+// RecordingID the recording a frame's key belongs to, ex: videos/1-123/output-1-456.jpeg -> 1-123
+func RecordingID(key string) string {
+	return path.Base(path.Dir(key))
+}
+
+// SessionRecordingID the recording of a capture session's frames, ex: videos/1-123 -> 1-123, see
+// devices.CaptureSession SessionPath
+func SessionRecordingID(sessionPath string) string {
+	return path.Base(sessionPath)
+}
+
+// ParseRecordingID the device a recording is from, ex: 1-123 -> 1
+func ParseRecordingID(id string) (int64, error) {
+	device, startedAt, ok := strings.Cut(id, "-")
+	deviceId, err := strconv.ParseInt(device, 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidRecording, id)
+	}
+	if _, err := strconv.ParseInt(startedAt, 10, 64); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidRecording, id)
+	}
+	return deviceId, nil
+}
+
+type Service struct {
+	ImageRepo devices.ImageRepo
+	BlobStore blob.Store
+	Encoder   Encoder
+	Conf      config.HlsConfig
+	// VideoPath the key prefix of recordings, see receiver.FramePath
+	VideoPath string
+	// encodes one encode per SegmentKey at a time, concurrent requests share its result or error
+	encodes singleflight.Group
+}
+
+func NewService(conf *config.Config, deps *domain.Deps, encoder Encoder) *Service {
+	return &Service{
+		ImageRepo: deps.ImageRepo,
+		BlobStore: deps.BlobStore,
+		Encoder:   encoder,
+		Conf:      conf.Hls,
+		VideoPath: conf.VideoPath,
+	}
+}
+
+// Recording the recording's frames. Frames without a capture time in their key go by when they were stored
+func (s *Service) Recording(ctx context.Context, id string) (Recording, error) {
+	deviceId, err := ParseRecordingID(id)
+	if err != nil {
+		return Recording{}, err
+	}
+	imgs, err := s.ImageRepo.GetImagesByPrefix(ctx, s.VideoPath+"/"+id+"/")
+	if err != nil {
+		return Recording{}, err
+	}
+	if len(imgs) == 0 {
+		return Recording{}, ErrRecordingNotFound
+	}
+	r := Recording{ID: id, DeviceID: deviceId}
+	for _, img := range imgs {
+		r.Frames = append(r.Frames, Frame{Key: img.ImagePath, Timestamp: receiver.CapturedAt(img)})
+		if img.CreatedAt.After(r.LastStoredAt) {
+			r.LastStoredAt = img.CreatedAt
+		}
+	}
+	slices.SortStableFunc(r.Frames, func(a, b Frame) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return r, nil
+}
+
+// Active whether frames are still arriving at now, a frame was stored within a segment's duration
+func (s *Service) Active(r Recording, now time.Time) bool {
+	return now.Sub(r.LastStoredAt) < s.Conf.SegmentDuration
+}
+
+// Segments the recording's segments. While it's Active frames can still arrive out of order, ex: after
+// inference, so segments are only listed once frames captured a segment's duration after them have arrived
+func (s *Service) Segments(r Recording, now time.Time) []Segment {
+	segments := Split(r.Frames, s.Conf.SegmentDuration)
+	if !s.Active(r, now) {
+		return segments
+	}
+	settled := r.Frames[len(r.Frames)-1].Timestamp.Add(-s.Conf.SegmentDuration)
+	n := 0
+	for n+1 < len(segments) && !segments[n+1].Start().After(settled) {
+		n++
+	}
+	return segments[:n]
+}
+
+// RecordingPlaylist a playlist of the whole recording, a PlaylistEvent that isn't Ended while it's Active
+func (s *Service) RecordingPlaylist(ctx context.Context, id string, now time.Time) ([]byte, error) {
+	r, err := s.Recording(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	p := Playlist{
+		Type:     PlaylistVOD,
+		Segments: s.Segments(r, now),
+		Ended:    true,
+		URI: func(seg Segment) string {
+			return "segments/" + strconv.Itoa(seg.Sequence) + ".ts"
+		},
+	}
+	if s.Active(r, now) {
+		p.Type = PlaylistEvent
+		p.Ended = false
+	}
+	return p.Encode(), nil
+}
+
+// LivePlaylist the last Conf.LiveSegments segments of the device's latest recording, ErrNotLive if it isn't
+// Active. Its segments are the recording's, relative to /api/devices/<id>/live.m3u8
+func (s *Service) LivePlaylist(ctx context.Context, deviceId int64, now time.Time) ([]byte, error) {
+	img, err := s.ImageRepo.GetLatestDeviceImage(ctx, deviceId)
+	if err != nil {
+		return nil, ErrNotLive
+	}
+	r, err := s.Recording(ctx, RecordingID(img.ImagePath))
+	if err != nil {
+		return nil, err
+	}
+	if !s.Active(r, now) {
+		return nil, ErrNotLive
+	}
+	segments := s.Segments(r, now)
+	p := Playlist{
+		Segments: segments[max(0, len(segments)-s.Conf.LiveSegments):],
+		URI: func(seg Segment) string {
+			return "../../recordings/" + r.ID + "/segments/" + strconv.Itoa(seg.Sequence) + ".ts"
+		},
+	}
+	return p.Encode(), nil
+}
+
+// Segment the recording's sequence'th segment as MPEG-TS, encoded the first time it's requested. Concurrent requests
+// for it share that encode, which isn't canceled when the request that started it is
+func (s *Service) Segment(ctx context.Context, id string, sequence int, now time.Time) ([]byte, error) {
+	r, err := s.Recording(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	segments := s.Segments(r, now)
+	if sequence < 0 || sequence >= len(segments) {
+		return nil, ErrSegmentNotFound
+	}
+	segment := segments[sequence]
+	key := SegmentKey(segment)
+	if cached, err := s.readBlob(ctx, key); err == nil {
+		return cached, nil
+	} else if !errors.Is(err, blob.ErrNotFound) {
+		return nil, err
+	}
+	ts, err, _ := s.encodes.Do(key, func() (interface{}, error) {
+		return s.encodeSegment(context.WithoutCancel(ctx), r, segment, key)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding segment %d of %s: %w", sequence, id, err)
+	}
+	return ts.([]byte), nil
+}
+
+// encodeSegment encodes the recording's segment & caches it at key
+func (s *Service) encodeSegment(ctx context.Context, r Recording, segment Segment, key string) ([]byte, error) {
+	// Another request may have encoded it since we looked
+	if cached, err := s.readBlob(ctx, key); err == nil {
+		return cached, nil
+	} else if !errors.Is(err, blob.ErrNotFound) {
+		return nil, err
+	}
+	frames := make([][]byte, 0, len(segment.Frames))
+	for _, f := range segment.Frames {
+		buf, err := s.readBlob(ctx, f.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", f.Key, err)
+		}
+		frames = append(frames, buf)
+	}
+	ts, err := s.Encoder.Encode(ctx, frames, segment.Durations, segment.Start().Sub(r.Frames[0].Timestamp))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.BlobStore.Put(ctx, key, ts, ContentTypeSegment); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// SegmentKey where an encoded segment is cached, next to its frames, ex: videos/1-123/hls/0-<hash>.ts. The hash
+// covers its frames & their durations, so a segment whose frames change after a delete isn't served from the cache
+func SegmentKey(segment Segment) string {
+	h := fnv.New64a()
+	for i, f := range segment.Frames {
+		fmt.Fprintf(h, "%s %d\n", f.Key, segment.Durations[i])
+	}
+	name := strconv.Itoa(segment.Sequence) + "-" + strconv.FormatUint(h.Sum64(), 16) + ".ts"
+	return path.Join(path.Dir(segment.Frames[0].Key), "hls", name)
+}
+
+func (s *Service) readBlob(ctx context.Context, key string) ([]byte, error) {
+	rc, _, err := s.BlobStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
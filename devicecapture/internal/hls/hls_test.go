@@ -0,0 +1,273 @@
+package hls
+
+import (
+	"context"
+	"devicecapture/internal/blob"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEncoder "encodes" a segment as its frames & offset
+type fakeEncoder struct {
+	calls int
+	// delay how long encoding takes
+	delay time.Duration
+	// err fails the encodes
+	err error
+	mu  sync.Mutex
+}
+
+func (e *fakeEncoder) Encode(_ context.Context, frames [][]byte, durations []time.Duration, offset time.Duration) ([]byte, error) {
+	e.mu.Lock()
+	e.calls++
+	err := e.err
+	e.mu.Unlock()
+	time.Sleep(e.delay)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for i, f := range frames {
+		fmt.Fprintf(&b, "%s:%s,", f, durations[i])
+	}
+	fmt.Fprintf(&b, "offset=%s", offset)
+	return []byte(b.String()), nil
+}
+
+func TestParseRecordingID(t *testing.T) {
+	tests := []struct {
+		id      string
+		want    int64
+		wantErr bool
+	}{
+		{id: "1-1700000000000", want: 1},
+		{id: "42-1", want: 42},
+		{id: "1", wantErr: true},
+		{id: "1-", wantErr: true},
+		{id: "porch-1", wantErr: true},
+		{id: "1-1-1", wantErr: true},
+		{id: "..", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := ParseRecordingID(tt.id)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRecording)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestService(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	encoder := &fakeEncoder{}
+	conf := &config.Config{VideoPath: "videos", Hls: config.HlsConfig{SegmentDuration: time.Second, LiveSegments: 2}}
+	s := NewService(conf, deps, encoder)
+
+	store := func(deviceId int64, key string) {
+		t.Helper()
+		_, err := deps.ImageRepo.CreateImage(ctx, devices.CreateImageParams{DeviceID: deviceId, ImagePath: key})
+		a.NoError(err)
+		a.NoError(deps.BlobStore.Put(ctx, key, []byte(key[strings.LastIndex(key, "-")+1:len(key)-len(".jpeg")]), "image/jpeg"))
+	}
+	// An earlier recording, another device's & a recording whose 1500 frame arrives last
+	store(1, "videos/1-1600000000000/output-1-1600000000000.jpeg")
+	store(2, "videos/2-1700000000000/output-2-1700000000000.jpeg")
+	for _, ms := range []int64{0, 250, 500, 750, 1000, 1250, 3000, 3250, 1500} {
+		store(1, fmt.Sprintf("videos/1-1700000000000/output-1-%d.jpeg", 1700000000000+ms))
+	}
+	const id = "1-1700000000000"
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	t.Run("recording", func(t *testing.T) {
+		r, err := s.Recording(ctx, id)
+		a.NoError(err)
+		a.Equal(int64(1), r.DeviceID)
+		a.Len(r.Frames, 9)
+		a.Equal("videos/1-1700000000000/output-1-1700000001500.jpeg", r.Frames[6].Key, "frames are ordered by capture time")
+		a.True(s.Active(r, now))
+		a.False(s.Active(r, later))
+
+		_, err = s.Recording(ctx, "1-1")
+		a.ErrorIs(err, ErrRecordingNotFound)
+		_, err = s.Recording(ctx, "../1-1")
+		a.ErrorIs(err, ErrInvalidRecording)
+	})
+
+	t.Run("recording playlist", func(t *testing.T) {
+		p, err := s.RecordingPlaylist(ctx, id, now)
+		a.NoError(err)
+		a.Equal("#EXTM3U\n"+
+			"#EXT-X-VERSION:3\n"+
+			"#EXT-X-TARGETDURATION:1\n"+
+			"#EXT-X-MEDIA-SEQUENCE:0\n"+
+			"#EXT-X-PLAYLIST-TYPE:EVENT\n"+
+			"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:20.000Z\n"+
+			"#EXTINF:1.000,\n"+
+			"segments/0.ts\n", string(p), "while recording, segments with frames that may still arrive aren't listed")
+
+		p, err = s.RecordingPlaylist(ctx, id, later)
+		a.NoError(err)
+		a.Equal("#EXTM3U\n"+
+			"#EXT-X-VERSION:3\n"+
+			"#EXT-X-TARGETDURATION:2\n"+
+			"#EXT-X-MEDIA-SEQUENCE:0\n"+
+			"#EXT-X-PLAYLIST-TYPE:VOD\n"+
+			"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:20.000Z\n"+
+			"#EXTINF:1.000,\n"+
+			"segments/0.ts\n"+
+			"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:21.000Z\n"+
+			"#EXTINF:1.500,\n"+
+			"segments/1.ts\n"+
+			"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:23.000Z\n"+
+			"#EXTINF:0.500,\n"+
+			"segments/2.ts\n"+
+			"#EXT-X-ENDLIST\n", string(p))
+	})
+
+	t.Run("live playlist", func(t *testing.T) {
+		p, err := s.LivePlaylist(ctx, 1, now)
+		a.NoError(err)
+		a.Equal("#EXTM3U\n"+
+			"#EXT-X-VERSION:3\n"+
+			"#EXT-X-TARGETDURATION:1\n"+
+			"#EXT-X-MEDIA-SEQUENCE:0\n"+
+			"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:20.000Z\n"+
+			"#EXTINF:1.000,\n"+
+			"../../recordings/1-1700000000000/segments/0.ts\n", string(p))
+
+		_, err = s.LivePlaylist(ctx, 1, later)
+		a.ErrorIs(err, ErrNotLive, "stopped recording")
+		_, err = s.LivePlaylist(ctx, 3, now)
+		a.ErrorIs(err, ErrNotLive, "no frames")
+	})
+
+	t.Run("segments", func(t *testing.T) {
+		_, err := s.Segment(ctx, id, 1, now)
+		a.ErrorIs(err, ErrSegmentNotFound, "not listed yet")
+		_, err = s.Segment(ctx, id, 3, later)
+		a.ErrorIs(err, ErrSegmentNotFound)
+
+		ts, err := s.Segment(ctx, id, 1, later)
+		a.NoError(err)
+		a.Equal("1700000001000:250ms,1700000001250:250ms,1700000001500:1s,offset=1s", string(ts))
+		ts, err = s.Segment(ctx, id, 1, later)
+		a.NoError(err)
+		a.Equal("1700000001000:250ms,1700000001250:250ms,1700000001500:1s,offset=1s", string(ts))
+		a.Equal(1, encoder.calls, "encoded once")
+		r, err := s.Recording(ctx, id)
+		a.NoError(err)
+		_, info, err := deps.BlobStore.Get(ctx, SegmentKey(s.Segments(r, later)[1]))
+		a.NoError(err)
+		a.Equal(ContentTypeSegment, info.ContentType)
+
+		a.NoError(deps.BlobStore.Delete(ctx, "videos/1-1700000000000/output-1-1700000000000.jpeg"))
+		_, err = s.Segment(ctx, id, 0, later)
+		a.ErrorIs(err, blob.ErrNotFound, "deleted frame")
+	})
+
+	t.Run("concurrent segments", func(t *testing.T) {
+		encoder.mu.Lock()
+		encoder.calls = 0
+		encoder.delay = 50 * time.Millisecond
+		encoder.mu.Unlock()
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ts, err := s.Segment(ctx, id, 2, later)
+				a.NoError(err)
+				a.Equal("1700000003000:250ms,1700000003250:250ms,offset=3s", string(ts))
+			}()
+		}
+		wg.Wait()
+		a.Equal(1, encoder.calls, "concurrent requests wait for the first one's encode")
+	})
+
+	t.Run("concurrent failed encodes", func(t *testing.T) {
+		failed := errors.New("ffmpeg failed")
+		r, err := s.Recording(ctx, id)
+		a.NoError(err)
+		a.NoError(deps.BlobStore.Delete(ctx, SegmentKey(s.Segments(r, later)[1])))
+		encoder.mu.Lock()
+		encoder.calls = 0
+		encoder.err = failed
+		encoder.mu.Unlock()
+		defer func() {
+			encoder.mu.Lock()
+			encoder.err = nil
+			encoder.mu.Unlock()
+		}()
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.Segment(ctx, id, 1, later)
+				a.ErrorIs(err, failed)
+			}()
+		}
+		wg.Wait()
+		a.Equal(1, encoder.calls, "concurrent requests share a failed encode too")
+	})
+
+	t.Run("deleted frames", func(t *testing.T) {
+		ts, err := s.Segment(ctx, id, 1, later)
+		a.NoError(err)
+		a.Equal("1700000001000:250ms,1700000001250:250ms,1700000001500:1s,offset=1s", string(ts))
+		// The 0ms frame's file was deleted in segments, now its row is too
+		images, err := deps.ImageRepo.GetImages(ctx, 1)
+		a.NoError(err)
+		for _, img := range images {
+			if img.ImagePath == "videos/1-1700000000000/output-1-1700000000000.jpeg" {
+				a.NoError(deps.ImageRepo.DeleteImage(ctx, img.ID))
+			}
+		}
+		ts, err = s.Segment(ctx, id, 1, later)
+		a.NoError(err)
+		a.Equal("1700000001250:250ms,1700000001500:1s,offset=1s", string(ts),
+			"segments start at 250ms now, the moved segment isn't served from the cache")
+	})
+}
+
+func TestFfmpegEncoder(t *testing.T) {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg isn't installed")
+	}
+	a := assert.New(t)
+	// 2x2 black JPEG
+	frame := []byte{
+		0xff, 0xd8, 0xff, 0xdb, 0x00, 0x43, 0x00, 0x08, 0x06, 0x06, 0x07, 0x06, 0x05, 0x08, 0x07, 0x07, 0x07, 0x09,
+		0x09, 0x08, 0x0a, 0x0c, 0x14, 0x0d, 0x0c, 0x0b, 0x0b, 0x0c, 0x19, 0x12, 0x13, 0x0f, 0x14, 0x1d, 0x1a, 0x1f,
+		0x1e, 0x1d, 0x1a, 0x1c, 0x1c, 0x20, 0x24, 0x2e, 0x27, 0x20, 0x22, 0x2c, 0x23, 0x1c, 0x1c, 0x28, 0x37, 0x29,
+		0x2c, 0x30, 0x31, 0x34, 0x34, 0x34, 0x1f, 0x27, 0x39, 0x3d, 0x38, 0x32, 0x3c, 0x2e, 0x33, 0x34, 0x32, 0xff,
+		0xc0, 0x00, 0x0b, 0x08, 0x00, 0x02, 0x00, 0x02, 0x01, 0x01, 0x11, 0x00, 0xff, 0xc4, 0x00, 0x14, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x09,
+		0xff, 0xc4, 0x00, 0x14, 0x10, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xda, 0x00, 0x08, 0x01, 0x01, 0x00, 0x00, 0x3f, 0x00, 0x2a, 0x9f,
+		0xff, 0xd9,
+	}
+	ts, err := NewFfmpegEncoder(path).Encode(t.Context(), [][]byte{frame, frame}, []time.Duration{250 * time.Millisecond, 250 * time.Millisecond}, time.Second)
+	a.NoError(err)
+	if a.NotEmpty(ts) {
+		a.Equal(byte(0x47), ts[0], "MPEG-TS sync byte")
+	}
+}
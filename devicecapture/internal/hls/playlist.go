@@ -0,0 +1,118 @@
+package hls
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"time"
+)
+
+// DefaultFrameDuration how long a frame is shown when there's no frame after it to go by, 4 FPS like a stream
+const DefaultFrameDuration = 250 * time.Millisecond
+
+// Playlist types
+const (
+	// PlaylistVOD a finished recording, segments won't change
+	PlaylistVOD = "VOD"
+	// PlaylistEvent a recording that's still being captured, segments are only added
+	PlaylistEvent = "EVENT"
+)
+
+// Frame a stored frame's key & when it was captured
+type Frame struct {
+	Key       string
+	Timestamp time.Time
+}
+
+// Segment consecutive frames of a recording. Sequence is its index within the recording
+type Segment struct {
+	Sequence int
+	Frames   []Frame
+	// Durations how long each frame is shown, until the next frame was captured
+	Durations []time.Duration
+}
+
+// Start when the first frame was captured
+func (s Segment) Start() time.Time {
+	return s.Frames[0].Timestamp
+}
+
+// Duration how long the segment plays, to the millisecond
+func (s Segment) Duration() time.Duration {
+	var d time.Duration
+	for _, fd := range s.Durations {
+		d += fd
+	}
+	return d.Round(time.Millisecond)
+}
+
+// Split groups frames, oldest first, into segments that start every target. A frame is shown until the next one
+// was captured, at most target, so a stalled device doesn't make a segment drag on
+func Split(frames []Frame, target time.Duration) []Segment {
+	var segments []Segment
+	for i, f := range frames {
+		if len(segments) == 0 || f.Timestamp.Sub(segments[len(segments)-1].Start()) >= target {
+			segments = append(segments, Segment{Sequence: len(segments)})
+		}
+		d := DefaultFrameDuration
+		switch {
+		case i+1 < len(frames):
+			d = frames[i+1].Timestamp.Sub(f.Timestamp)
+		case i > 0:
+			d = f.Timestamp.Sub(frames[i-1].Timestamp)
+		}
+		d = min(max(d, time.Millisecond), target)
+		s := &segments[len(segments)-1]
+		s.Frames = append(s.Frames, f)
+		s.Durations = append(s.Durations, d)
+	}
+	return segments
+}
+
+// Playlist an HLS media playlist, see RFC 8216
+type Playlist struct {
+	// Type PlaylistVOD or PlaylistEvent, empty for live playlists that only list the latest segments
+	Type     string
+	Segments []Segment
+	// Ended no segments will be added
+	Ended bool
+	// URI a segment's URI, relative to the playlist
+	URI func(s Segment) string
+}
+
+// TargetDuration the longest segment in whole seconds, rounded up & at least 1
+func (p Playlist) TargetDuration() int {
+	target := 1
+	for _, s := range p.Segments {
+		target = max(target, int(math.Ceil(s.Duration().Seconds())))
+	}
+	return target
+}
+
+// MediaSequence the first segment's Sequence
+func (p Playlist) MediaSequence() int {
+	if len(p.Segments) == 0 {
+		return 0
+	}
+	return p.Segments[0].Sequence
+}
+
+// Encode the playlist as an .m3u8 file. Each segment has its capture time, so players can show & seek by wall clock
+func (p Playlist) Encode() []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	b.WriteString("#EXT-X-TARGETDURATION:" + strconv.Itoa(p.TargetDuration()) + "\n")
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:" + strconv.Itoa(p.MediaSequence()) + "\n")
+	if p.Type != "" {
+		b.WriteString("#EXT-X-PLAYLIST-TYPE:" + p.Type + "\n")
+	}
+	for _, s := range p.Segments {
+		b.WriteString("#EXT-X-PROGRAM-DATE-TIME:" + s.Start().UTC().Format("2006-01-02T15:04:05.000Z07:00") + "\n")
+		b.WriteString("#EXTINF:" + strconv.FormatFloat(s.Duration().Seconds(), 'f', 3, 64) + ",\n")
+		b.WriteString(p.URI(s) + "\n")
+	}
+	if p.Ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.Bytes()
+}
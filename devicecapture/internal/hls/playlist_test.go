@@ -0,0 +1,141 @@
+package hls
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// frames captured at the offsets in milliseconds from t0
+func frames(t0 time.Time, offsets ...int64) []Frame {
+	var fs []Frame
+	for _, ms := range offsets {
+		ts := t0.Add(time.Duration(ms) * time.Millisecond)
+		fs = append(fs, Frame{Key: "videos/1-1/output-1-" + strconv.FormatInt(ts.UnixMilli(), 10) + ".jpeg", Timestamp: ts})
+	}
+	return fs
+}
+
+func TestSplit(t *testing.T) {
+	t0 := time.UnixMilli(1700000000000)
+	ms := time.Millisecond
+	tests := []struct {
+		name      string
+		frames    []Frame
+		target    time.Duration
+		want      [][]time.Duration
+		wantStart []int64
+	}{
+		{
+			name:   "no frames",
+			target: time.Second,
+		},
+		{
+			name:      "a single frame is shown for the default duration",
+			frames:    frames(t0, 0),
+			target:    time.Second,
+			want:      [][]time.Duration{{DefaultFrameDuration}},
+			wantStart: []int64{0},
+		},
+		{
+			name:      "segments start every target",
+			frames:    frames(t0, 0, 250, 500, 750, 1000, 1250),
+			target:    time.Second,
+			want:      [][]time.Duration{{250 * ms, 250 * ms, 250 * ms, 250 * ms}, {250 * ms, 250 * ms}},
+			wantStart: []int64{0, 1000},
+		},
+		{
+			name:      "gaps are capped at target & the next segment starts after them",
+			frames:    frames(t0, 0, 500, 4000, 4100),
+			target:    time.Second,
+			want:      [][]time.Duration{{500 * ms, time.Second}, {100 * ms, 100 * ms}},
+			wantStart: []int64{0, 4000},
+		},
+		{
+			name:      "frames captured at the same time",
+			frames:    frames(t0, 0, 0, 100),
+			target:    time.Second,
+			want:      [][]time.Duration{{ms, 100 * ms, 100 * ms}},
+			wantStart: []int64{0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			segments := Split(tt.frames, tt.target)
+			a.Len(segments, len(tt.want))
+			n := 0
+			for i, s := range segments {
+				a.Equal(i, s.Sequence)
+				a.Equal(tt.want[i], s.Durations)
+				a.Equal(tt.frames[n:n+len(s.Frames)], s.Frames, "frames stay in order")
+				a.Equal(t0.Add(time.Duration(tt.wantStart[i])*ms), s.Start())
+				n += len(s.Frames)
+			}
+			a.Equal(len(tt.frames), n)
+		})
+	}
+}
+
+func TestPlaylist_Encode(t *testing.T) {
+	t0 := time.UnixMilli(1700000000000)
+	segments := Split(frames(t0, 0, 250, 500, 750, 1000, 1250, 1500, 3000, 3250), time.Second)
+	uri := func(s Segment) string {
+		return "segments/" + strconv.Itoa(s.Sequence) + ".ts"
+	}
+	tests := []struct {
+		name     string
+		playlist Playlist
+		want     string
+	}{
+		{
+			name:     "vod",
+			playlist: Playlist{Type: PlaylistVOD, Segments: segments, Ended: true, URI: uri},
+			want: "#EXTM3U\n" +
+				"#EXT-X-VERSION:3\n" +
+				"#EXT-X-TARGETDURATION:2\n" +
+				"#EXT-X-MEDIA-SEQUENCE:0\n" +
+				"#EXT-X-PLAYLIST-TYPE:VOD\n" +
+				"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:20.000Z\n" +
+				"#EXTINF:1.000,\n" +
+				"segments/0.ts\n" +
+				"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:21.000Z\n" +
+				"#EXTINF:1.500,\n" +
+				"segments/1.ts\n" +
+				"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:23.000Z\n" +
+				"#EXTINF:0.500,\n" +
+				"segments/2.ts\n" +
+				"#EXT-X-ENDLIST\n",
+		},
+		{
+			name:     "live",
+			playlist: Playlist{Segments: segments[1:], URI: uri},
+			want: "#EXTM3U\n" +
+				"#EXT-X-VERSION:3\n" +
+				"#EXT-X-TARGETDURATION:2\n" +
+				"#EXT-X-MEDIA-SEQUENCE:1\n" +
+				"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:21.000Z\n" +
+				"#EXTINF:1.500,\n" +
+				"segments/1.ts\n" +
+				"#EXT-X-PROGRAM-DATE-TIME:2023-11-14T22:13:23.000Z\n" +
+				"#EXTINF:0.500,\n" +
+				"segments/2.ts\n",
+		},
+		{
+			name:     "event without segments yet",
+			playlist: Playlist{Type: PlaylistEvent, URI: uri},
+			want: "#EXTM3U\n" +
+				"#EXT-X-VERSION:3\n" +
+				"#EXT-X-TARGETDURATION:1\n" +
+				"#EXT-X-MEDIA-SEQUENCE:0\n" +
+				"#EXT-X-PLAYLIST-TYPE:EVENT\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(tt.playlist.Encode()))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package homeassistant
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+)
+
+// DeviceRepo wraps a devices.DeviceRepository, publishing discovery configs when devices are created or updated
+// & removing them when devices are deleted. Publish errors are logged, they don't fail the repo call
+type DeviceRepo struct {
+	devices.DeviceRepository
+	service *Service
+}
+
+func NewDeviceRepo(repo devices.DeviceRepository, service *Service) *DeviceRepo {
+	return &DeviceRepo{DeviceRepository: repo, service: service}
+}
+
+func (r *DeviceRepo) CreateDevice(ctx context.Context, params devices.CreateDeviceParams) (devices.Device, error) {
+	d, err := r.DeviceRepository.CreateDevice(ctx, params)
+	if err != nil {
+		return d, err
+	}
+	if err := r.service.PublishDevice(d); err != nil {
+		logger.Error().Msgf("homeassistant.DeviceRepo.CreateDevice -> %v", err)
+	}
+	return d, nil
+}
+
+func (r *DeviceRepo) UpdateDevice(ctx context.Context, params devices.UpdateDeviceParams) (devices.Device, error) {
+	d, err := r.DeviceRepository.UpdateDevice(ctx, params)
+	if err != nil {
+		return d, err
+	}
+	if err := r.service.PublishDevice(d); err != nil {
+		logger.Error().Msgf("homeassistant.DeviceRepo.UpdateDevice -> %v", err)
+	}
+	return d, nil
+}
+
+func (r *DeviceRepo) DeleteDevice(ctx context.Context, id int64) error {
+	if err := r.DeviceRepository.DeleteDevice(ctx, id); err != nil {
+		return err
+	}
+	if err := r.service.RemoveDevice(id); err != nil {
+		logger.Error().Msgf("homeassistant.DeviceRepo.DeleteDevice -> %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+// Package homeassistant publishes Home Assistant MQTT discovery configs, so every device shows up in
+// Home Assistant without any YAML.
+//
+// Each device gets retained configs under <prefix>/<component>/openblink_<device_id>/<object_id>/config for:
+//   - a camera showing the latest detection frame, its stream_url attribute is the /image-stream/<device_id> MJPEG stream
+//     & its snapshot_url /camera/<device_id>/snapshot, the latest stored frame
+//   - a binary sensor per label in config.HomeAssistantConfig Labels, on for OffDelay after the label's detected
+//   - a connectivity binary sensor, on while the device has sent a heartbeat within OfflineAfter
+//   - an image of the last detection
+//
+// Entity state is published under openblink/<device_id>/ from detection/<device_id> & the heartbeat table.
+// Home Assistant can't log in, so the camera's & detection frame URLs are signed when AUTH_URL_SIGNING_KEY is set,
+// see package signedurl. Run republishes the camera's URLs before their signatures expire
+// Configs & retained state are cleared when a device is deleted, see DeviceRepo
+package homeassistant
+
+import (
+	"context"
+	"devicecapture/internal/blob"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/logger"
+	"devicecapture/internal/pubsub"
+	"devicecapture/internal/signedurl"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DetectionTopic detections are published to detection/<device_id>
+const DetectionTopic = "detection/+"
+
+// Durable names Run's detection subscription on buses that store messages, ex: NATS with JetStream. Detections
+// published while deviceserver was down are applied when it comes back
+const Durable = "homeassistant"
+
+const (
+	PayloadOn      = "ON"
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+)
+
+// syncTimeout how long we spend publishing configs or handling a single detection
+const syncTimeout = 30 * time.Second
+
+// StateTopic the base topic for a device's entity state, ex: openblink/1
+func StateTopic(deviceId int64) string {
+	return "openblink/" + strconv.FormatInt(deviceId, 10)
+}
+
+// Publisher publishes messages & retained messages, ex: a pubsub.MqttClient
+type Publisher interface {
+	pubsub.RetainPublisher
+	Publish(topic string, payload interface{}) error
+}
+
+// Entity a Home Assistant entity & the discovery config it's published with
+type Entity struct {
+	// Component the Home Assistant platform, ex: camera, binary_sensor, image
+	Component string
+	ObjectID  string
+	Config    EntityConfig
+}
+
+// ConfigTopic where Home Assistant looks for the entity's config
+func (e Entity) ConfigTopic(prefix string, deviceId int64) string {
+	return fmt.Sprintf("%s/%s/%s/%s/config", prefix, e.Component, nodeId(deviceId), e.ObjectID)
+}
+
+// EntityConfig the subset of Home Assistant's MQTT discovery schema we use
+type EntityConfig struct {
+	Name                string     `json:"name"`
+	UniqueID            string     `json:"unique_id"`
+	ObjectID            string     `json:"object_id"`
+	Device              DeviceInfo `json:"device"`
+	Origin              OriginInfo `json:"origin"`
+	DeviceClass         string     `json:"device_class,omitempty"`
+	Topic               string     `json:"topic,omitempty"`
+	StateTopic          string     `json:"state_topic,omitempty"`
+	PayloadOn           string     `json:"payload_on,omitempty"`
+	PayloadOff          string     `json:"payload_off,omitempty"`
+	OffDelay            int        `json:"off_delay,omitempty"`
+	UrlTopic            string     `json:"url_topic,omitempty"`
+	UrlTemplate         string     `json:"url_template,omitempty"`
+	JsonAttributesTopic string     `json:"json_attributes_topic,omitempty"`
+}
+
+// DeviceInfo groups a device's entities in Home Assistant
+type DeviceInfo struct {
+	Identifiers   []string `json:"identifiers"`
+	Name          string   `json:"name"`
+	Manufacturer  string   `json:"manufacturer"`
+	Model         string   `json:"model"`
+	SwVersion     string   `json:"sw_version,omitempty"`
+	SuggestedArea string   `json:"suggested_area,omitempty"`
+}
+
+// OriginInfo identifies us as the source of the discovery configs
+type OriginInfo struct {
+	Name string `json:"name"`
+	Url  string `json:"support_url"`
+}
+
+var origin = OriginInfo{Name: "open-blink", Url: "https://github.com/chrisromito/open-blink"}
+
+// CameraAttributes published to the camera's json_attributes_topic
+type CameraAttributes struct {
+	StreamUrl   string `json:"stream_url"`
+	SnapshotUrl string `json:"snapshot_url"`
+}
+
+type Service struct {
+	DeviceRepo    devices.DeviceRepository
+	HeartbeatRepo devices.HeartbeatRepo
+	ImageRepo     devices.ImageRepo
+	BlobStore     blob.Store
+	Conf          config.HomeAssistantConfig
+	// baseUrl where the deviceserver is reachable, ex: http://192.168.1.20:4000
+	baseUrl string
+	// signer signs the camera's stream_url & snapshot_url, nil leaves them unsigned
+	signer    *signedurl.Signer
+	publisher Publisher
+	mu        sync.Mutex
+	// online the last connectivity published for each device
+	online map[int64]bool
+	// lastImage the last frame published to each device's camera, devices publish a detection per object
+	lastImage map[int64]int64
+}
+
+func NewService(conf *config.Config, deps *domain.Deps, publisher Publisher) *Service {
+	return &Service{
+		DeviceRepo:    deps.DeviceRepo,
+		HeartbeatRepo: deps.HeartbeatRepo,
+		ImageRepo:     deps.ImageRepo,
+		BlobStore:     deps.BlobStore,
+		Conf:          conf.HomeAssistant,
+		baseUrl:       strings.TrimSuffix(conf.ThisIp, "/"),
+		signer:        signedurl.New(conf.Auth.UrlSigningKey, conf.Blob.SignedUrlTTL),
+		publisher:     publisher,
+		online:        map[int64]bool{},
+		lastImage:     map[int64]int64{},
+	}
+}
+
+// Entities the device's entities, see the package docs
+func (s *Service) Entities(d devices.Device) []Entity {
+	base := StateTopic(d.ID)
+	info := DeviceInfo{
+		Identifiers:   []string{nodeId(d.ID)},
+		Name:          d.Name,
+		Manufacturer:  "open-blink",
+		Model:         "ESP32 camera",
+		SwVersion:     d.FirmwareVersion,
+		SuggestedArea: d.Location,
+	}
+	entity := func(component, objectId, name string, c EntityConfig) Entity {
+		c.Name = name
+		c.UniqueID = nodeId(d.ID) + "_" + objectId
+		c.ObjectID = c.UniqueID
+		c.Device = info
+		c.Origin = origin
+		return Entity{Component: component, ObjectID: objectId, Config: c}
+	}
+	entities := []Entity{
+		entity("camera", "camera", "Camera", EntityConfig{
+			Topic:               base + "/camera",
+			JsonAttributesTopic: base + "/camera/attributes",
+		}),
+		entity("binary_sensor", "status", "Status", EntityConfig{
+			DeviceClass: "connectivity",
+			StateTopic:  base + "/status",
+			PayloadOn:   PayloadOnline,
+			PayloadOff:  PayloadOffline,
+		}),
+		entity("image", "last_detection", "Last detection", EntityConfig{
+			UrlTopic:            base + "/detection",
+			UrlTemplate:         "{{ value_json.annotated_url or value_json.url }}",
+			JsonAttributesTopic: base + "/detection",
+		}),
+	}
+	for _, label := range s.Conf.Labels {
+		slug := labelSlug(label)
+		entities = append(entities, entity("binary_sensor", slug, label, EntityConfig{
+			DeviceClass: "occupancy",
+			StateTopic:  base + "/labels/" + slug,
+			PayloadOn:   PayloadOn,
+			OffDelay:    int(s.Conf.OffDelay.Seconds()),
+		}))
+	}
+	return entities
+}
+
+// PublishDevice publishes the device's discovery configs & camera attributes
+func (s *Service) PublishDevice(d devices.Device) error {
+	var errs []error
+	for _, e := range s.Entities(d) {
+		payload, err := json.Marshal(e.Config)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, s.publisher.PublishRetained(e.ConfigTopic(s.Conf.DiscoveryPrefix, d.ID), payload))
+	}
+	errs = append(errs, s.PublishAttributes(d))
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error publishing Home Assistant configs for device %d: %w", d.ID, err)
+	}
+	return nil
+}
+
+// PublishAttributes publishes the camera's attributes, its URLs signed so Home Assistant can open them
+func (s *Service) PublishAttributes(d devices.Device) error {
+	attributes, err := json.Marshal(CameraAttributes{
+		StreamUrl:   s.signer.Sign(s.baseUrl + "/image-stream/" + d.StringId()),
+		SnapshotUrl: s.signer.Sign(s.baseUrl + "/camera/" + d.StringId() + "/snapshot"),
+	})
+	if err != nil {
+		return err
+	}
+	return s.publisher.PublishRetained(StateTopic(d.ID)+"/camera/attributes", attributes)
+}
+
+// RefreshAttributes publishes every device's camera attributes again, so their URLs are signed for another TTL
+func (s *Service) RefreshAttributes(ctx context.Context) error {
+	ds, err := s.DeviceRepo.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, d := range ds {
+		errs = append(errs, s.PublishAttributes(d))
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveDevice clears the device's discovery configs & retained state, so Home Assistant removes its entities
+func (s *Service) RemoveDevice(deviceId int64) error {
+	var errs []error
+	for _, e := range s.Entities(devices.Device{ID: deviceId}) {
+		errs = append(errs, s.publisher.PublishRetained(e.ConfigTopic(s.Conf.DiscoveryPrefix, deviceId), ""))
+	}
+	base := StateTopic(deviceId)
+	for _, topic := range []string{base + "/camera", base + "/camera/attributes", base + "/status", base + "/detection"} {
+		errs = append(errs, s.publisher.PublishRetained(topic, ""))
+	}
+	s.mu.Lock()
+	delete(s.online, deviceId)
+	delete(s.lastImage, deviceId)
+	s.mu.Unlock()
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error removing Home Assistant configs for device %d: %w", deviceId, err)
+	}
+	return nil
+}
+
+// Sync publishes every device's discovery configs & connectivity
+func (s *Service) Sync(ctx context.Context) error {
+	ds, err := s.DeviceRepo.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, d := range ds {
+		errs = append(errs, s.PublishDevice(d))
+	}
+	errs = append(errs, s.UpdateConnectivity(ctx, time.Now()))
+	return errors.Join(errs...)
+}
+
+// UpdateConnectivity publishes devices' status when it's changed, devices are online if they've sent a
+// heartbeat within OfflineAfter of now
+func (s *Service) UpdateConnectivity(ctx context.Context, now time.Time) error {
+	ds, err := s.DeviceRepo.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	beats, err := s.HeartbeatRepo.LatestBeats(ctx)
+	if err != nil {
+		return err
+	}
+	lastBeat := map[int64]time.Time{}
+	for _, b := range beats {
+		if b.CreatedAt.After(lastBeat[b.DeviceID]) {
+			lastBeat[b.DeviceID] = b.CreatedAt
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, d := range ds {
+		online := now.Sub(lastBeat[d.ID]) < s.Conf.OfflineAfter
+		if published, ok := s.online[d.ID]; ok && published == online {
+			continue
+		}
+		payload := PayloadOffline
+		if online {
+			payload = PayloadOnline
+		}
+		if err := s.publisher.PublishRetained(StateTopic(d.ID)+"/status", payload); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.online[d.ID] = online
+	}
+	return errors.Join(errs...)
+}
+
+// HandleDetection updates the device's entities from a receiver.DetectionMsg published to topic (detection/<device_id>)
+func (s *Service) HandleDetection(ctx context.Context, topic string, payload []byte) error {
+	deviceId, err := strconv.ParseInt(strings.TrimPrefix(topic, "detection/"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid detection topic %s", topic)
+	}
+	var msg receiver.DetectionMsg
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return fmt.Errorf("invalid detection: %w", err)
+	}
+	base := StateTopic(deviceId)
+	var errs []error
+	errs = append(errs, s.publisher.PublishRetained(base+"/detection", payload))
+	for _, label := range s.Conf.Labels {
+		if strings.EqualFold(label, msg.Label) {
+			// Not retained, the sensor turns itself off after OffDelay
+			errs = append(errs, s.publisher.Publish(base+"/labels/"+labelSlug(label), PayloadOn))
+		}
+	}
+	if msg.ImageID != nil {
+		errs = append(errs, s.publishFrame(ctx, deviceId, *msg.ImageID))
+	}
+	return errors.Join(errs...)
+}
+
+// publishFrame publishes the image to the device's camera, unless it's the frame it's already showing
+func (s *Service) publishFrame(ctx context.Context, deviceId, imageId int64) error {
+	s.mu.Lock()
+	if s.lastImage[deviceId] == imageId {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastImage[deviceId] = imageId
+	s.mu.Unlock()
+	img, err := s.ImageRepo.GetImage(ctx, imageId)
+	if err != nil {
+		return err
+	}
+	key := img.ImagePath
+	if img.AnnotatedPath != "" {
+		key = img.AnnotatedPath
+	}
+	r, _, err := s.BlobStore.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error reading frame %s: %w", key, err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.publisher.PublishRetained(StateTopic(deviceId)+"/camera", buf)
+}
+
+// Run publishes every device's configs, then keeps their entities updated from DetectionTopic & heartbeats
+// until ctx is done. The detection subscription is durable where the bus supports it, see Durable.
+// Signed camera URLs are republished twice per TTL, so the retained ones are always valid
+func (s *Service) Run(ctx context.Context, bus pubsub.Bus) error {
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	if err := s.Sync(syncCtx); err != nil {
+		// Devices that failed are published again when they're updated
+		logger.Error().Msgf("homeassistant.Run -> %v", err)
+	}
+	sub, err := pubsub.SubscribeDurable(bus, Durable, DetectionTopic, func(msg pubsub.Message) {
+		detCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+		defer cancel()
+		if err := s.HandleDetection(detCtx, msg.Topic, msg.Payload); err != nil {
+			logger.Error().Msgf("homeassistant.Run -> %s: %v", msg.Topic, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer func() {
+			_ = sub.Unsubscribe()
+		}()
+		// Check twice per OfflineAfter, so devices are shown offline at most OfflineAfter * 1.5 after their last beat
+		ticker := time.NewTicker(s.Conf.OfflineAfter / 2)
+		defer ticker.Stop()
+		// Unsigned URLs don't expire, a nil channel never fires
+		var refresh <-chan time.Time
+		if s.signer != nil {
+			refreshTicker := time.NewTicker(s.signer.TTL / 2)
+			defer refreshTicker.Stop()
+			refresh = refreshTicker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := s.UpdateConnectivity(ctx, now); err != nil {
+					logger.Error().Msgf("homeassistant.Run -> %v", err)
+				}
+			case <-refresh:
+				if err := s.RefreshAttributes(ctx); err != nil {
+					logger.Error().Msgf("homeassistant.Run -> %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// nodeId groups the device's configs, ex: openblink_1
+func nodeId(deviceId int64) string {
+	return "openblink_" + strconv.FormatInt(deviceId, 10)
+}
+
+// labelSlug a label as a topic level & object ID, ex: "traffic light" -> "traffic_light"
+func labelSlug(label string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '_'
+		}
+	}, label)
+}
@@ -0,0 +1,268 @@
+package homeassistant
+
+import (
+	"context"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/pubsub"
+	"devicecapture/internal/signedurl"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(t *testing.T) (*Service, *domain.Deps, *pubsub.MemoryBus) {
+	deps := domain.NewMockDeps()
+	bus := pubsub.NewMemoryBus()
+	t.Cleanup(func() {
+		_ = bus.Close()
+	})
+	conf := &config.Config{
+		ThisIp: "http://192.168.1.20:4000",
+		HomeAssistant: config.HomeAssistantConfig{
+			Enabled:         true,
+			DiscoveryPrefix: "homeassistant",
+			Labels:          []string{"person", "traffic light"},
+			OffDelay:        30 * time.Second,
+			OfflineAfter:    5 * time.Minute,
+		},
+	}
+	return NewService(conf, deps, bus), deps, bus
+}
+
+// retainedJson unmarshals the message retained for topic into v
+func retainedJson(t *testing.T, bus *pubsub.MemoryBus, topic string, v interface{}) {
+	buf, ok := bus.Retained(topic)
+	if !ok {
+		t.Fatalf("nothing retained for %s", topic)
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		t.Fatalf("invalid JSON retained for %s: %v", topic, err)
+	}
+}
+
+func TestService_PublishDevice(t *testing.T) {
+	a := assert.New(t)
+	svc, _, bus := newTestService(t)
+	d := devices.GetMockDevice()
+	d.FirmwareVersion = "1.2.0"
+	a.NoError(svc.PublishDevice(d))
+
+	var camera EntityConfig
+	retainedJson(t, bus, "homeassistant/camera/openblink_1/camera/config", &camera)
+	a.Equal("openblink_1_camera", camera.UniqueID)
+	a.Equal("openblink/1/camera", camera.Topic)
+	a.Equal(DeviceInfo{
+		Identifiers:  []string{"openblink_1"},
+		Name:         "mockdevice",
+		Manufacturer: "open-blink",
+		Model:        "ESP32 camera",
+		SwVersion:    "1.2.0",
+	}, camera.Device)
+	var attributes CameraAttributes
+	retainedJson(t, bus, camera.JsonAttributesTopic, &attributes)
+	a.Equal("http://192.168.1.20:4000/image-stream/1", attributes.StreamUrl)
+
+	var status EntityConfig
+	retainedJson(t, bus, "homeassistant/binary_sensor/openblink_1/status/config", &status)
+	a.Equal("connectivity", status.DeviceClass)
+	a.Equal("openblink/1/status", status.StateTopic)
+
+	var label EntityConfig
+	retainedJson(t, bus, "homeassistant/binary_sensor/openblink_1/traffic_light/config", &label)
+	a.Equal("traffic light", label.Name)
+	a.Equal("openblink/1/labels/traffic_light", label.StateTopic)
+	a.Equal(30, label.OffDelay)
+
+	var image EntityConfig
+	retainedJson(t, bus, "homeassistant/image/openblink_1/last_detection/config", &image)
+	a.Equal("openblink/1/detection", image.UrlTopic)
+}
+
+func TestService_HandleDetection(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	svc, deps, bus := newTestService(t)
+	img, err := deps.ImageRepo.CreateImage(ctx, devices.CreateImageParams{DeviceID: 1, ImagePath: "videos/1/frame.jpeg"})
+	a.NoError(err)
+	a.NoError(deps.BlobStore.Put(ctx, img.ImagePath, []byte("jpeg"), "image/jpeg"))
+
+	var labels []pubsub.Message
+	_, err = bus.Subscribe("openblink/1/labels/+", func(msg pubsub.Message) {
+		labels = append(labels, msg)
+	})
+	a.NoError(err)
+	detection := func(label string) []byte {
+		payload, err := receiver.DetectionToMsg("http://192.168.1.20:4000", nil, img.ImagePath, false, devices.Detection{
+			ID:         1,
+			DeviceID:   1,
+			ImageID:    &img.ID,
+			Label:      label,
+			Confidence: 0.9,
+		})
+		a.NoError(err)
+		return []byte(payload)
+	}
+	a.NoError(svc.HandleDetection(ctx, "detection/1", detection("person")))
+	a.NoError(svc.HandleDetection(ctx, "detection/1", detection("Traffic Light")))
+	a.NoError(svc.HandleDetection(ctx, "detection/1", detection("dog")), "labels without a sensor still update the image")
+
+	a.Equal([]pubsub.Message{
+		{Topic: "openblink/1/labels/person", Payload: []byte(PayloadOn)},
+		{Topic: "openblink/1/labels/traffic_light", Payload: []byte(PayloadOn)},
+	}, labels)
+	_, retained := bus.Retained("openblink/1/labels/person")
+	a.False(retained, "label sensors turn themselves off, so ON isn't retained")
+	var last receiver.DetectionMsg
+	retainedJson(t, bus, "openblink/1/detection", &last)
+	a.Equal("dog", last.Label)
+	frame, _ := bus.Retained("openblink/1/camera")
+	a.Equal("jpeg", string(frame))
+
+	a.Error(svc.HandleDetection(ctx, "detection/abc", detection("person")))
+	a.Error(svc.HandleDetection(ctx, "detection/1", []byte("not json")))
+}
+
+// TestService_Run_Durable detections published to NATS while Run is stopped are applied when it's started again
+func TestService_Run_Durable(t *testing.T) {
+	a := assert.New(t)
+	svc, _, bus := newTestService(t)
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server didn't start")
+	}
+	t.Cleanup(ns.Shutdown)
+	natsConf := config.NatsConfig{Url: ns.ClientURL(), JetStream: true, Stream: "OPENBLINK_TEST", StreamTopics: []string{"detection/#"}, MaxAge: time.Hour}
+	connect := func() *pubsub.NatsBus {
+		nb, err := pubsub.NewNatsBus(t.Context(), natsConf, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nb
+	}
+	detection := func(label string) string {
+		payload, err := receiver.DetectionToMsg("http://192.168.1.20:4000", nil, "videos/1/frame.jpeg", false, devices.Detection{ID: 1, DeviceID: 1, Label: label})
+		a.NoError(err)
+		return payload
+	}
+	lastLabel := func() string {
+		buf, _ := bus.Retained("openblink/1/detection")
+		var last receiver.DetectionMsg
+		_ = json.Unmarshal(buf, &last)
+		return last.Label
+	}
+
+	first := connect()
+	ctx, cancel := context.WithCancel(t.Context())
+	a.NoError(svc.Run(ctx, first))
+	a.NoError(first.Publish("detection/1", detection("person")))
+	a.Eventually(func() bool { return lastLabel() == "person" }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	_ = first.Close()
+
+	publisher := connect()
+	defer func() {
+		_ = publisher.Close()
+	}()
+	a.NoError(publisher.Publish("detection/1", detection("dog")))
+	a.Equal("person", lastLabel(), "stopped")
+
+	restarted := connect()
+	defer func() {
+		_ = restarted.Close()
+	}()
+	a.NoError(svc.Run(t.Context(), restarted))
+	a.Eventually(func() bool { return lastLabel() == "dog" }, 5*time.Second, 10*time.Millisecond, "the detection published while stopped is applied")
+}
+
+func TestService_UpdateConnectivity(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	svc, deps, bus := newTestService(t)
+	var statuses []pubsub.Message
+	_, err := bus.Subscribe("openblink/+/status", func(msg pubsub.Message) {
+		statuses = append(statuses, msg)
+	})
+	a.NoError(err)
+
+	_, err = deps.HeartbeatRepo.RecordBeat(ctx, 1)
+	a.NoError(err)
+	now := time.Now()
+	a.NoError(svc.UpdateConnectivity(ctx, now))
+	status, _ := bus.Retained("openblink/1/status")
+	a.Equal(PayloadOnline, string(status))
+	a.Contains(statuses, pubsub.Message{Topic: "openblink/1/status", Payload: []byte(PayloadOnline)})
+	published := len(statuses)
+
+	a.NoError(svc.UpdateConnectivity(ctx, now.Add(time.Minute)))
+	a.Len(statuses, published, "unchanged statuses aren't published again")
+
+	a.NoError(svc.UpdateConnectivity(ctx, now.Add(svc.Conf.OfflineAfter)))
+	status, _ = bus.Retained("openblink/1/status")
+	a.Equal(PayloadOffline, string(status))
+}
+
+func TestDeviceRepo(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	svc, deps, bus := newTestService(t)
+	repo := NewDeviceRepo(deps.DeviceRepo, svc)
+
+	d, err := repo.CreateDevice(ctx, devices.CreateDeviceParams{Name: "porch", DeviceUrl: "http://10.0.0.9"})
+	a.NoError(err)
+	cameraTopic := Entity{Component: "camera", ObjectID: "camera"}.ConfigTopic("homeassistant", d.ID)
+	var camera EntityConfig
+	retainedJson(t, bus, cameraTopic, &camera)
+	a.Equal("porch", camera.Device.Name)
+
+	_, err = repo.UpdateDevice(ctx, devices.UpdateDeviceParams{ID: d.ID, Name: "front porch", DeviceUrl: d.DeviceUrl})
+	a.NoError(err)
+	retainedJson(t, bus, cameraTopic, &camera)
+	a.Equal("front porch", camera.Device.Name)
+
+	a.NoError(svc.UpdateConnectivity(ctx, time.Now()))
+	a.NoError(repo.DeleteDevice(ctx, d.ID))
+	for _, e := range svc.Entities(d) {
+		_, ok := bus.Retained(e.ConfigTopic("homeassistant", d.ID))
+		a.False(ok, "%s is cleared", e.ObjectID)
+	}
+	_, ok := bus.Retained(StateTopic(d.ID) + "/status")
+	a.False(ok, "retained state is cleared")
+	_, ok = bus.Retained(StateTopic(d.ID) + "/camera/attributes")
+	a.False(ok)
+}
+
+func TestService_PublishAttributes_Signed(t *testing.T) {
+	a := assert.New(t)
+	deps := domain.NewMockDeps()
+	bus := pubsub.NewMemoryBus()
+	defer bus.Close()
+	conf := &config.Config{
+		ThisIp: "http://192.168.1.20:4000",
+		Auth:   config.AuthConfig{UrlSigningKey: "secret"},
+		Blob:   config.BlobConfig{SignedUrlTTL: 15 * time.Minute},
+	}
+	svc := NewService(conf, deps, bus)
+	a.NoError(svc.PublishAttributes(devices.GetMockDevice()))
+
+	var attributes CameraAttributes
+	retainedJson(t, bus, "openblink/1/camera/attributes", &attributes)
+	streamUrl, err := url.Parse(attributes.StreamUrl)
+	a.NoError(err)
+	a.Equal("/image-stream/1", streamUrl.Path)
+	a.True(signedurl.New("secret", time.Minute).Valid(streamUrl), "Home Assistant can't log in, so the stream_url should be signed")
+	snapshotUrl, err := url.Parse(attributes.SnapshotUrl)
+	a.NoError(err)
+	a.Equal("/camera/1/snapshot", snapshotUrl.Path)
+	a.True(signedurl.New("secret", time.Minute).Valid(snapshotUrl))
+}
@@ -0,0 +1,36 @@
+package live
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"strconv"
+)
+
+// AuditRepo wraps a devices.AuditRepo, publishing an EventDevice for every entry about a device
+type AuditRepo struct {
+	devices.AuditRepo
+	hub *Hub
+}
+
+func NewAuditRepo(repo devices.AuditRepo, hub *Hub) *AuditRepo {
+	return &AuditRepo{AuditRepo: repo, hub: hub}
+}
+
+func (r *AuditRepo) CreateAuditEntry(ctx context.Context, params devices.CreateAuditParams) (devices.AuditEntry, error) {
+	e, err := r.AuditRepo.CreateAuditEntry(ctx, params)
+	if err != nil || e.TargetType != devices.AuditTargetDevice {
+		return e, err
+	}
+	deviceId, err := strconv.ParseInt(e.TargetID, 10, 64)
+	if err != nil {
+		// Still recorded, there's just no device to publish it for
+		return e, nil
+	}
+	r.hub.Publish(Event{Type: EventDevice, DeviceID: deviceId, Device: &DeviceEvent{
+		DeviceID:  deviceId,
+		Action:    e.Action,
+		Actor:     e.Actor,
+		CreatedAt: e.CreatedAt,
+	}})
+	return e, nil
+}
@@ -0,0 +1,39 @@
+package live
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/pubsub"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditRepo(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	hub := NewHub(pubsub.NewMemoryBus())
+	client, err := hub.Join(func(deviceId int64) bool { return deviceId == 1 })
+	a.NoError(err)
+	a.NoError(client.Subscribe("all", Filter{}))
+	repo := NewAuditRepo(devices.NewMockAudit(), hub)
+
+	for _, params := range []devices.CreateAuditParams{
+		{Actor: "admin", Action: devices.AuditFilterUpdate, TargetType: devices.AuditTargetFilter, TargetID: "1"},
+		{Actor: "admin", Action: devices.AuditDeviceUpdate, TargetType: devices.AuditTargetDevice, TargetID: "2"},
+		{Actor: "admin", Action: devices.AuditDeviceMute, TargetType: devices.AuditTargetDevice, TargetID: "1"},
+	} {
+		_, err := repo.CreateAuditEntry(ctx, params)
+		a.NoError(err)
+	}
+	entries, err := repo.ListAuditEntries(ctx, devices.AuditQuery{})
+	a.NoError(err)
+	a.Len(entries, 3, "every entry is recorded")
+
+	m := <-client.Events()
+	a.Equal(EventDevice, m.Type)
+	if a.NotNil(m.Device) {
+		a.Equal(DeviceEvent{DeviceID: 1, Action: devices.AuditDeviceMute, Actor: "admin", CreatedAt: entries[0].CreatedAt}, *m.Device,
+			"only device entries are published, to clients that can see the device")
+	}
+	a.Empty(client.Events())
+}
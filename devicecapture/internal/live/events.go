@@ -0,0 +1,60 @@
+package live
+
+import (
+	"devicecapture/internal/domain/receiver"
+	"time"
+)
+
+// Event types
+const (
+	// EventDetection a detection published to detection/<device_id>
+	EventDetection = "detection"
+	// EventDevice a device was created, updated, deleted, muted or streamed from, see AuditRepo
+	EventDevice = "event"
+	// EventHealth a device went online or offline, see HealthMonitor
+	EventHealth = "health"
+)
+
+var EventTypes = []string{EventDetection, EventDevice, EventHealth}
+
+// Event something that happened to a device. Detection, Device or Health is set, per Type
+type Event struct {
+	Type      string
+	DeviceID  int64
+	Detection *receiver.DetectionMsg
+	Device    *DeviceEvent
+	Health    *Health
+}
+
+// DetectionEvent d as an EventDetection
+func DetectionEvent(d receiver.DetectionMsg) Event {
+	return Event{Type: EventDetection, DeviceID: d.DeviceID, Detection: &d}
+}
+
+// Payload the Detection, Device or Health, whichever is set
+func (e Event) Payload() any {
+	switch {
+	case e.Detection != nil:
+		return e.Detection
+	case e.Device != nil:
+		return e.Device
+	default:
+		return e.Health
+	}
+}
+
+// DeviceEvent an operator's action on a device, from the audit log
+type DeviceEvent struct {
+	DeviceID  int64     `json:"device_id"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Health whether a device is online. LastHeartbeat is zero for devices that never sent one
+type Health struct {
+	DeviceID      int64     `json:"device_id"`
+	Online        bool      `json:"online"`
+	LastHeartbeat time.Time `json:"last_heartbeat,omitzero"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
@@ -0,0 +1,57 @@
+package live
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter picks the events a client subscribed to. Empty Types, DeviceIDs & Labels match every type, device & label.
+// Labels & MinConfidence only filter detections
+type Filter struct {
+	// Types EventDetection, EventDevice or EventHealth
+	Types     []string `json:"types"`
+	DeviceIDs []int64  `json:"devices"`
+	// Labels are matched case-insensitively
+	Labels        []string `json:"labels"`
+	MinConfidence float64  `json:"min_confidence"`
+}
+
+func (f Filter) Validate() error {
+	for _, t := range f.Types {
+		if !slices.Contains(EventTypes, t) {
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidFilter, t)
+		}
+	}
+	if f.MinConfidence < 0 || f.MinConfidence > 1 {
+		return fmt.Errorf("%w: min_confidence must be between 0 and 1", ErrInvalidFilter)
+	}
+	for _, label := range f.Labels {
+		if label == "" {
+			return fmt.Errorf("%w: labels cannot be empty", ErrInvalidFilter)
+		}
+	}
+	return nil
+}
+
+func (f Filter) Matches(e Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+	if len(f.DeviceIDs) > 0 && !slices.Contains(f.DeviceIDs, e.DeviceID) {
+		return false
+	}
+	d := e.Detection
+	if d == nil {
+		return true
+	}
+	if len(f.Labels) > 0 && !slices.ContainsFunc(f.Labels, func(label string) bool {
+		return strings.EqualFold(label, d.Label)
+	}) {
+		return false
+	}
+	return d.Confidence >= f.MinConfidence
+}
@@ -0,0 +1,88 @@
+package live
+
+import (
+	"context"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"sync"
+	"time"
+)
+
+// DefaultOfflineAfter devices without a heartbeat for this long are offline
+const DefaultOfflineAfter = 5 * time.Minute
+
+// HealthMonitor publishes an EventHealth whenever a device goes online or offline. Devices are online while
+// they've sent a heartbeat within OfflineAfter
+type HealthMonitor struct {
+	DeviceRepo    devices.DeviceRepository
+	HeartbeatRepo devices.HeartbeatRepo
+	OfflineAfter  time.Duration
+	hub           *Hub
+	// online is only read & written with mu held
+	online map[int64]bool
+	mu     sync.Mutex
+}
+
+func NewHealthMonitor(deps *domain.Deps, hub *Hub) *HealthMonitor {
+	return &HealthMonitor{
+		DeviceRepo:    deps.DeviceRepo,
+		HeartbeatRepo: deps.HeartbeatRepo,
+		OfflineAfter:  DefaultOfflineAfter,
+		hub:           hub,
+		online:        map[int64]bool{},
+	}
+}
+
+// Check publishes the health of devices that changed since the last Check, every device's the first time
+func (m *HealthMonitor) Check(ctx context.Context, now time.Time) error {
+	ds, err := m.DeviceRepo.ListDevices(ctx)
+	if err != nil {
+		return err
+	}
+	beats, err := m.HeartbeatRepo.LatestBeats(ctx)
+	if err != nil {
+		return err
+	}
+	lastBeat := map[int64]time.Time{}
+	for _, b := range beats {
+		if b.CreatedAt.After(lastBeat[b.DeviceID]) {
+			lastBeat[b.DeviceID] = b.CreatedAt
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := map[int64]bool{}
+	for _, d := range ds {
+		online := now.Sub(lastBeat[d.ID]) < m.OfflineAfter
+		current[d.ID] = online
+		if was, ok := m.online[d.ID]; ok && was == online {
+			continue
+		}
+		m.hub.Publish(Event{Type: EventHealth, DeviceID: d.ID, Health: &Health{
+			DeviceID:      d.ID,
+			Online:        online,
+			LastHeartbeat: lastBeat[d.ID],
+			ChangedAt:     now,
+		}})
+	}
+	// Deleted devices are forgotten
+	m.online = current
+	return nil
+}
+
+// Run checks every OfflineAfter / 2 until ctx is done
+func (m *HealthMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.OfflineAfter / 2)
+	defer ticker.Stop()
+	for {
+		if err := m.Check(ctx, time.Now()); err != nil {
+			logger.Error().Msgf("live.HealthMonitor -> %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
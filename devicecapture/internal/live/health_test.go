@@ -0,0 +1,49 @@
+package live
+
+import (
+	"devicecapture/internal/domain"
+	"devicecapture/internal/pubsub"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthMonitor_Check(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	hub := NewHub(pubsub.NewMemoryBus())
+	client, err := hub.Join(func(int64) bool { return true })
+	a.NoError(err)
+	a.NoError(client.Subscribe("health", Filter{Types: []string{EventHealth}}))
+	health := func() []Health {
+		var hs []Health
+		for {
+			select {
+			case m := <-client.Events():
+				hs = append(hs, *m.Health)
+			default:
+				return hs
+			}
+		}
+	}
+	monitor := NewHealthMonitor(deps, hub)
+
+	beat, err := deps.HeartbeatRepo.RecordBeat(ctx, 1)
+	a.NoError(err)
+	now := time.Now()
+	a.NoError(monitor.Check(ctx, now))
+	hs := health()
+	a.ElementsMatch([]Health{
+		{DeviceID: 1, Online: true, LastHeartbeat: beat.CreatedAt, ChangedAt: now},
+		{DeviceID: 2, Online: false, ChangedAt: now},
+	}, hs, "every device's health is published the first time")
+
+	a.NoError(monitor.Check(ctx, now.Add(time.Minute)))
+	a.Empty(health(), "unchanged health isn't published again")
+
+	offline := now.Add(monitor.OfflineAfter)
+	a.NoError(monitor.Check(ctx, offline))
+	a.Equal([]Health{{DeviceID: 1, Online: false, LastHeartbeat: beat.CreatedAt, ChangedAt: offline}}, health())
+}
@@ -0,0 +1,187 @@
+// Package live fans device Events out to streaming clients, ex: the detection websocket & the event stream.
+// Detections published to detection/<device_id> reach every client through the Hub's one bus subscription, device
+// events & health changes are published to the Hub by AuditRepo & HealthMonitor. Clients subscribe with Filters &
+// only get the events of devices they're allowed to see. A client that falls Buffer events behind is dropped
+// rather than holding up everyone else
+package live
+
+import (
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/logger"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// DetectionTopic detections are published to detection/<device_id>
+const DetectionTopic = "detection/+"
+
+// DefaultBuffer how many events a client can fall behind before it's dropped
+const DefaultBuffer = 64
+
+var ErrForbiddenDevice = errors.New("device not found")
+
+// Match an event & the IDs of the client's subscriptions it matched
+type Match struct {
+	Event
+	Subscriptions []string
+}
+
+type Hub struct {
+	Bus    pubsub.Bus
+	Buffer int
+	sub    pubsub.Subscription
+	// clients is only read & written with mu held
+	clients map[*Client]struct{}
+	mu      sync.Mutex
+}
+
+func NewHub(bus pubsub.Bus) *Hub {
+	return &Hub{
+		Bus:     bus,
+		Buffer:  DefaultBuffer,
+		clients: map[*Client]struct{}{},
+	}
+}
+
+// Join adds a client that can only see the devices allowed returns true for. The hub subscribes to
+// DetectionTopic when the first client joins. Clients must Leave
+func (h *Hub) Join(allowed func(deviceId int64) bool) (*Client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sub == nil {
+		sub, err := h.Bus.Subscribe(DetectionTopic, h.handle)
+		if err != nil {
+			return nil, err
+		}
+		h.sub = sub
+	}
+	c := &Client{
+		allowed: allowed,
+		filters: map[string]Filter{},
+		events:  make(chan Match, h.Buffer),
+		dropped: make(chan struct{}),
+	}
+	h.clients[c] = struct{}{}
+	return c, nil
+}
+
+func (h *Hub) Leave(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+}
+
+// Clients how many clients are connected
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Close unsubscribes from the bus, clients stop getting detections
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sub == nil {
+		return nil
+	}
+	err := h.sub.Unsubscribe()
+	h.sub = nil
+	return err
+}
+
+// handle decodes the detection once & publishes it
+func (h *Hub) handle(msg pubsub.Message) {
+	var d receiver.DetectionMsg
+	if err := json.Unmarshal(msg.Payload, &d); err != nil {
+		logger.Error().Msgf("live.Hub -> invalid detection on %s: %v", msg.Topic, err)
+		return
+	}
+	h.Publish(DetectionEvent(d))
+}
+
+// Publish hands e to every client, dropping the ones that are full
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if !c.deliver(e) {
+			logger.Debug().Msg("live.Hub -> dropping a slow client")
+			delete(h.clients, c)
+			close(c.dropped)
+		}
+	}
+}
+
+// Client a streaming client's subscriptions & the events that matched them
+type Client struct {
+	allowed func(deviceId int64) bool
+	filters map[string]Filter
+	events  chan Match
+	dropped chan struct{}
+	mu      sync.Mutex
+}
+
+// Subscribe adds or replaces subscription id. Naming a device the client can't see is ErrForbiddenDevice
+func (c *Client) Subscribe(id string, f Filter) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	for _, deviceId := range f.DeviceIDs {
+		if !c.allowed(deviceId) {
+			return fmt.Errorf("%w: %d", ErrForbiddenDevice, deviceId)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filters[id] = f
+	return nil
+}
+
+// Unsubscribe removes subscription id, false if there wasn't one
+func (c *Client) Unsubscribe(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.filters[id]
+	delete(c.filters, id)
+	return ok
+}
+
+// Events the events matching any of the client's subscriptions
+func (c *Client) Events() <-chan Match {
+	return c.events
+}
+
+// Dropped is closed when the client fell too far behind, it doesn't get any more events
+func (c *Client) Dropped() <-chan struct{} {
+	return c.dropped
+}
+
+// deliver queues e if it matches a subscription, false if the client's buffer is full
+func (c *Client) deliver(e Event) bool {
+	if !c.allowed(e.DeviceID) {
+		return true
+	}
+	c.mu.Lock()
+	var matched []string
+	for _, id := range slices.Sorted(maps.Keys(c.filters)) {
+		if c.filters[id].Matches(e) {
+			matched = append(matched, id)
+		}
+	}
+	c.mu.Unlock()
+	if len(matched) == 0 {
+		return true
+	}
+	select {
+	case c.events <- Match{Event: e, Subscriptions: matched}:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,84 @@
+package live
+
+import (
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/pubsub"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Matches(t *testing.T) {
+	person := DetectionEvent(receiver.DetectionMsg{DeviceID: 1, Label: "person", Confidence: 0.7})
+	online := Event{Type: EventHealth, DeviceID: 1, Health: &Health{DeviceID: 1, Online: true}}
+	tests := []struct {
+		name   string
+		filter Filter
+		event  Event
+		want   bool
+	}{
+		{name: "everything", filter: Filter{}, event: person, want: true},
+		{name: "device", filter: Filter{DeviceIDs: []int64{1, 2}}, event: person, want: true},
+		{name: "other device", filter: Filter{DeviceIDs: []int64{2}}, event: person, want: false},
+		{name: "label", filter: Filter{Labels: []string{"cat", "Person"}}, event: person, want: true},
+		{name: "other label", filter: Filter{Labels: []string{"cat"}}, event: person, want: false},
+		{name: "confident enough", filter: Filter{MinConfidence: 0.7}, event: person, want: true},
+		{name: "not confident enough", filter: Filter{MinConfidence: 0.8}, event: person, want: false},
+		{name: "everything matches", filter: Filter{DeviceIDs: []int64{1}, Labels: []string{"person"}, MinConfidence: 0.5}, event: person, want: true},
+		{name: "type", filter: Filter{Types: []string{EventDetection}}, event: person, want: true},
+		{name: "other type", filter: Filter{Types: []string{EventDetection}}, event: online, want: false},
+		{name: "labels only filter detections", filter: Filter{Labels: []string{"cat"}, MinConfidence: 0.9}, event: online, want: true},
+		{name: "devices filter every type", filter: Filter{DeviceIDs: []int64{2}}, event: online, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Matches(tt.event))
+		})
+	}
+}
+
+func TestHub(t *testing.T) {
+	a := assert.New(t)
+	bus := pubsub.NewMemoryBus()
+	hub := NewHub(bus)
+	hub.Buffer = 2
+	defer func() {
+		a.NoError(hub.Close())
+	}()
+	visible := func(deviceId int64) bool { return deviceId == 1 }
+	slow, err := hub.Join(visible)
+	a.NoError(err)
+	fast, err := hub.Join(visible)
+	a.NoError(err)
+	a.ErrorIs(slow.Subscribe("other", Filter{DeviceIDs: []int64{2}}), ErrForbiddenDevice)
+	a.ErrorIs(slow.Subscribe("bad", Filter{Labels: []string{""}}), ErrInvalidFilter)
+	a.ErrorIs(slow.Subscribe("bad type", Filter{Types: []string{"video"}}), ErrInvalidFilter)
+	a.NoError(slow.Subscribe("all", Filter{}))
+	a.NoError(fast.Subscribe("all", Filter{}))
+
+	a.NoError(bus.Publish("detection/2", `{"id": 1, "device_id": 2}`))
+	a.NoError(bus.Publish("detection/1", `not json`))
+	// The fast client reads every detection, the slow one doesn't read any
+	for id := int64(2); id <= 4; id++ {
+		a.NoError(bus.Publish("detection/1", fmt.Sprintf(`{"id": %d, "device_id": 1}`, id)))
+		<-fast.Events()
+	}
+	select {
+	case <-slow.Dropped():
+	default:
+		t.Fatal("the slow client fell 3 detections behind, it should have been dropped")
+	}
+	select {
+	case <-fast.Dropped():
+		t.Fatal("the fast client kept up")
+	default:
+	}
+	a.Equal(1, hub.Clients())
+	m := <-slow.Events()
+	a.Equal(int64(2), m.Detection.ID, "other devices & invalid payloads are skipped")
+	a.Equal([]string{"all"}, m.Subscriptions)
+
+	hub.Leave(fast)
+	a.Equal(0, hub.Clients())
+}
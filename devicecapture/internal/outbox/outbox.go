@@ -0,0 +1,112 @@
+// Package outbox publishes messages stored alongside the rows they describe, ex: detections.
+//
+// Messages are written to the outbox in the same transaction as their rows, so a crash can't store a detection
+// without its message. The Relay claims pending messages, publishes them & marks them sent. A crash between
+// publishing & marking publishes the message again once its claim expires, so delivery is at least once &
+// consumers deduplicate on the message ID, ex: receiver.DetectionMsg's message_id
+package outbox
+
+import (
+	"context"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"time"
+)
+
+const (
+	DefaultInterval  = 500 * time.Millisecond
+	DefaultBatchSize = 100
+	DefaultLease     = 30 * time.Second
+	DefaultRetention = 24 * time.Hour
+)
+
+// pruneInterval how often sent messages older than Retention are deleted
+const pruneInterval = time.Hour
+
+// Publisher publishes messages, ex: a pubsub.Bus
+type Publisher interface {
+	Publish(topic string, payload interface{}) error
+}
+
+type Relay struct {
+	OutboxRepo devices.OutboxRepo
+	// Interval how often pending messages are checked for
+	Interval  time.Duration
+	BatchSize int32
+	// Lease how long the relay has to publish the messages it claims, before another relay can claim them
+	Lease time.Duration
+	// Retention how long sent messages are kept
+	Retention time.Duration
+	publisher Publisher
+}
+
+func NewRelay(deps *domain.Deps, publisher Publisher) *Relay {
+	return &Relay{
+		OutboxRepo: deps.OutboxRepo,
+		Interval:   DefaultInterval,
+		BatchSize:  DefaultBatchSize,
+		Lease:      DefaultLease,
+		Retention:  DefaultRetention,
+		publisher:  publisher,
+	}
+}
+
+// RelayPending publishes pending messages oldest first until there aren't any left, returns how many were sent.
+// Messages that fail to publish are retried on the next call
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		messages, err := r.OutboxRepo.ClaimOutboxMessages(ctx, r.BatchSize, r.Lease)
+		if err != nil {
+			return sent, err
+		}
+		failed := 0
+		for _, msg := range messages {
+			if err := r.publisher.Publish(msg.Topic, msg.Payload); err != nil {
+				failed++
+				logger.Error().Msgf("outbox.RelayPending -> error publishing %s to %s: %v", msg.MessageID, msg.Topic, err)
+				if fErr := r.OutboxRepo.RecordOutboxMessageFailure(ctx, msg.ID, err.Error()); fErr != nil {
+					return sent, fErr
+				}
+				continue
+			}
+			// If this fails the message is published again once its claim expires
+			if err := r.OutboxRepo.MarkOutboxMessageSent(ctx, msg.ID); err != nil {
+				return sent, err
+			}
+			sent++
+		}
+		// Stop on a short batch, or when everything failed so we don't spin on a broken bus
+		if int32(len(messages)) < r.BatchSize || failed == len(messages) {
+			return sent, nil
+		}
+	}
+}
+
+// Prune deletes messages sent more than Retention ago, returns how many were deleted
+func (r *Relay) Prune(ctx context.Context, now time.Time) (int64, error) {
+	return r.OutboxRepo.DeleteSentOutboxMessages(ctx, now.Add(-r.Retention))
+}
+
+// Run relays pending messages every Interval & prunes sent messages until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(pruneInterval)
+	defer pruneTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.RelayPending(ctx); err != nil {
+				logger.Error().Msgf("outbox.Run -> %v", err)
+			}
+		case now := <-pruneTicker.C:
+			if _, err := r.Prune(ctx, now); err != nil {
+				logger.Error().Msgf("outbox.Run -> %v", err)
+			}
+		}
+	}
+}
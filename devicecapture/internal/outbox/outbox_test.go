@@ -0,0 +1,158 @@
+package outbox
+
+import (
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePublisher records what would've been published, failing while err is set
+type fakePublisher struct {
+	topics   []string
+	payloads []string
+	err      error
+	mu       sync.Mutex
+}
+
+func (f *fakePublisher) Publish(topic string, payload interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.topics = append(f.topics, topic)
+	f.payloads = append(f.payloads, string(payload.([]byte)))
+	return nil
+}
+
+// createDetections stores n detections for device 1 with their messages
+func createDetections(t *testing.T, deps *domain.Deps, n int) []devices.Detection {
+	var params []devices.CreateDetectionParams
+	for range n {
+		params = append(params, devices.CreateDetectionParams{DeviceID: 1, Label: "person", Confidence: 0.9})
+	}
+	ds, err := deps.DetectionRepo.CreateDetectionsWithMessages(t.Context(), params, func(d devices.Detection) (devices.CreateOutboxParams, error) {
+		return devices.CreateOutboxParams{
+			MessageID: fmt.Sprintf("detection-%d", d.ID),
+			Topic:     "detection/1",
+			Payload:   []byte(fmt.Sprintf(`{"id": %d}`, d.ID)),
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("CreateDetectionsWithMessages failed: %v", err)
+	}
+	return ds
+}
+
+func TestRelay_RelayPending(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	pub := &fakePublisher{}
+	relay := NewRelay(deps, pub)
+	relay.BatchSize = 2
+	createDetections(t, deps, 3)
+
+	sent, err := relay.RelayPending(ctx)
+	a.NoError(err)
+	a.Equal(3, sent, "every batch is relayed")
+	a.Equal([]string{`{"id": 1}`, `{"id": 2}`, `{"id": 3}`}, pub.payloads, "oldest first")
+	a.Equal("detection/1", pub.topics[0])
+
+	sent, err = relay.RelayPending(ctx)
+	a.NoError(err)
+	a.Zero(sent, "sent messages aren't published again")
+}
+
+func TestRelay_RetriesFailures(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	pub := &fakePublisher{err: errors.New("broker down")}
+	relay := NewRelay(deps, pub)
+	createDetections(t, deps, 2)
+
+	sent, err := relay.RelayPending(ctx)
+	a.NoError(err)
+	a.Zero(sent)
+	for _, m := range deps.OutboxRepo.(*devices.MockOutbox).Messages() {
+		a.False(m.Sent())
+		a.Equal(int32(1), m.Attempts)
+		a.Equal("broker down", m.LastError)
+	}
+
+	pub.err = nil
+	sent, err = relay.RelayPending(ctx)
+	a.NoError(err)
+	a.Equal(2, sent, "failed messages are retried")
+}
+
+func TestRelay_ClaimedMessages(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	createDetections(t, deps, 1)
+
+	// Another relay claimed the message & crashed before marking it sent
+	claimed, err := deps.OutboxRepo.ClaimOutboxMessages(ctx, 10, time.Millisecond)
+	a.NoError(err)
+	a.Len(claimed, 1)
+	pub := &fakePublisher{}
+	relay := NewRelay(deps, pub)
+	time.Sleep(5 * time.Millisecond)
+	sent, err := relay.RelayPending(ctx)
+	a.NoError(err)
+	a.Equal(1, sent, "messages are published again once their claim expires")
+
+	createDetections(t, deps, 1)
+	_, err = deps.OutboxRepo.ClaimOutboxMessages(ctx, 10, time.Minute)
+	a.NoError(err)
+	sent, err = relay.RelayPending(ctx)
+	a.NoError(err)
+	a.Zero(sent, "messages claimed by another relay are skipped")
+}
+
+func TestRelay_Prune(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	relay := NewRelay(deps, &fakePublisher{})
+	createDetections(t, deps, 2)
+	_, err := relay.RelayPending(ctx)
+	a.NoError(err)
+	createDetections(t, deps, 1)
+
+	deleted, err := relay.Prune(ctx, time.Now())
+	a.NoError(err)
+	a.Zero(deleted, "messages are kept for Retention")
+	deleted, err = relay.Prune(ctx, time.Now().Add(relay.Retention+time.Minute))
+	a.NoError(err)
+	a.Equal(int64(2), deleted)
+	a.Len(deps.OutboxRepo.(*devices.MockOutbox).Messages(), 1, "pending messages are kept")
+}
+
+func TestCreateDetectionsWithMessages_Atomic(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	_, err := deps.DetectionRepo.CreateDetectionsWithMessages(ctx, []devices.CreateDetectionParams{
+		{DeviceID: 1, Label: "person"},
+		{DeviceID: 1, Label: "car"},
+	}, func(d devices.Detection) (devices.CreateOutboxParams, error) {
+		if d.Label == "car" {
+			return devices.CreateOutboxParams{}, errors.New("can't build message")
+		}
+		return devices.CreateOutboxParams{MessageID: "m", Topic: "detection/1"}, nil
+	})
+	a.Error(err)
+	ds, err := deps.DetectionRepo.GetDetectionsAfter(ctx, devices.QueryParams{})
+	a.NoError(err)
+	a.Empty(ds, "detections aren't stored without their messages")
+	a.Empty(deps.OutboxRepo.(*devices.MockOutbox).Messages())
+}
@@ -29,6 +29,7 @@ func (r *iteratorForCreateDetections) Next() bool {
 
 func (r iteratorForCreateDetections) Values() ([]interface{}, error) {
 	return []interface{}{
+		r.rows[0].ID,
 		r.rows[0].DeviceID,
 		r.rows[0].Label,
 		r.rows[0].Confidence,
@@ -42,5 +43,39 @@ func (r iteratorForCreateDetections) Err() error {
 }
 
 func (q *Queries) CreateDetections(ctx context.Context, arg []CreateDetectionsParams) (int64, error) {
-	return q.db.CopyFrom(ctx, []string{"detections"}, []string{"device_id", "label", "confidence", "image_id", "bbox"}, &iteratorForCreateDetections{rows: arg})
+	return q.db.CopyFrom(ctx, []string{"detections"}, []string{"id", "device_id", "label", "confidence", "image_id", "bbox"}, &iteratorForCreateDetections{rows: arg})
+}
+
+// iteratorForCreateOutboxMessages implements pgx.CopyFromSource.
+type iteratorForCreateOutboxMessages struct {
+	rows                 []CreateOutboxMessagesParams
+	skippedFirstNextCall bool
+}
+
+func (r *iteratorForCreateOutboxMessages) Next() bool {
+	if len(r.rows) == 0 {
+		return false
+	}
+	if !r.skippedFirstNextCall {
+		r.skippedFirstNextCall = true
+		return true
+	}
+	r.rows = r.rows[1:]
+	return len(r.rows) > 0
+}
+
+func (r iteratorForCreateOutboxMessages) Values() ([]interface{}, error) {
+	return []interface{}{
+		r.rows[0].MessageID,
+		r.rows[0].Topic,
+		r.rows[0].Payload,
+	}, nil
+}
+
+func (r iteratorForCreateOutboxMessages) Err() error {
+	return nil
+}
+
+func (q *Queries) CreateOutboxMessages(ctx context.Context, arg []CreateOutboxMessagesParams) (int64, error) {
+	return q.db.CopyFrom(ctx, []string{"outbox_messages"}, []string{"message_id", "topic", "payload"}, &iteratorForCreateOutboxMessages{rows: arg})
 }
@@ -8,6 +8,37 @@ import (
 	"time"
 )
 
+type ApiToken struct {
+	ID        int64     `db:"id" json:"id"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	TokenHash string    `db:"token_hash" json:"token_hash"`
+	Scopes    []string  `db:"scopes" json:"scopes"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type AuditLog struct {
+	ID         int64     `db:"id" json:"id"`
+	Actor      string    `db:"actor" json:"actor"`
+	ActorID    *int64    `db:"actor_id" json:"actor_id"`
+	Action     string    `db:"action" json:"action"`
+	TargetType string    `db:"target_type" json:"target_type"`
+	TargetID   string    `db:"target_id" json:"target_id"`
+	Diff       []byte    `db:"diff" json:"diff"`
+	SourceIp   string    `db:"source_ip" json:"source_ip"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type CaptureSession struct {
+	ID          int64     `db:"id" json:"id"`
+	DeviceID    int64     `db:"device_id" json:"device_id"`
+	SessionPath string    `db:"session_path" json:"session_path"`
+	StartedAt   time.Time `db:"started_at" json:"started_at"`
+	EndedAt     time.Time `db:"ended_at" json:"ended_at"`
+	FrameCount  int32     `db:"frame_count" json:"frame_count"`
+}
+
 type Detection struct {
 	ID         int64       `db:"id" json:"id"`
 	DeviceID   int64       `db:"device_id" json:"device_id"`
@@ -18,10 +49,56 @@ type Detection struct {
 	Bbox       [][]float64 `db:"bbox" json:"bbox"`
 }
 
+type DetectionFilter struct {
+	ID              int64     `db:"id" json:"id"`
+	DeviceID        *int64    `db:"device_id" json:"device_id"`
+	MinConfidence   float64   `db:"min_confidence" json:"min_confidence"`
+	LabelConfidence []byte    `db:"label_confidence" json:"label_confidence"`
+	AllowLabels     []string  `db:"allow_labels" json:"allow_labels"`
+	DenyLabels      []string  `db:"deny_labels" json:"deny_labels"`
+	Aliases         []byte    `db:"aliases" json:"aliases"`
+	UpdatedAt       time.Time `db:"updated_at" json:"updated_at"`
+}
+
 type Device struct {
-	ID        int64  `db:"id" json:"id"`
-	Name      string `db:"name" json:"name"`
-	DeviceUrl string `db:"device_url" json:"device_url"`
+	ID              int64     `db:"id" json:"id"`
+	Name            string    `db:"name" json:"name"`
+	DeviceUrl       string    `db:"device_url" json:"device_url"`
+	Location        string    `db:"location" json:"location"`
+	Tags            []string  `db:"tags" json:"tags"`
+	Timezone        string    `db:"timezone" json:"timezone"`
+	Enabled         bool      `db:"enabled" json:"enabled"`
+	Username        string    `db:"username" json:"username"`
+	Password        string    `db:"password" json:"password"`
+	FirmwareVersion string    `db:"firmware_version" json:"firmware_version"`
+	Resolution      string    `db:"resolution" json:"resolution"`
+	Capabilities    []string  `db:"capabilities" json:"capabilities"`
+	MutedUntil      time.Time `db:"muted_until" json:"muted_until"`
+}
+
+type DeviceConfig struct {
+	DeviceID       int64     `db:"device_id" json:"device_id"`
+	Desired        []byte    `db:"desired" json:"desired"`
+	DesiredVersion int64     `db:"desired_version" json:"desired_version"`
+	Reported       []byte    `db:"reported" json:"reported"`
+	AckedVersion   int64     `db:"acked_version" json:"acked_version"`
+	LastError      string    `db:"last_error" json:"last_error"`
+	PushAttempts   int32     `db:"push_attempts" json:"push_attempts"`
+	PushedAt       time.Time `db:"pushed_at" json:"pushed_at"`
+	AckedAt        time.Time `db:"acked_at" json:"acked_at"`
+	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type DeviceGroup struct {
+	ID          int64     `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeviceGroupMember struct {
+	GroupID  int64 `db:"group_id" json:"group_id"`
+	DeviceID int64 `db:"device_id" json:"device_id"`
 }
 
 type DeviceHeartbeat struct {
@@ -31,8 +108,59 @@ type DeviceHeartbeat struct {
 }
 
 type DeviceImage struct {
+	ID            int64     `db:"id" json:"id"`
+	DeviceID      int64     `db:"device_id" json:"device_id"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	ImagePath     string    `db:"image_path" json:"image_path"`
+	AnnotatedPath string    `db:"annotated_path" json:"annotated_path"`
+	SessionID     *int64    `db:"session_id" json:"session_id"`
+}
+
+type DiscoveredDevice struct {
+	ID              int64     `db:"id" json:"id"`
+	Mac             string    `db:"mac" json:"mac"`
+	Name            string    `db:"name" json:"name"`
+	DeviceUrl       string    `db:"device_url" json:"device_url"`
+	FirmwareVersion string    `db:"firmware_version" json:"firmware_version"`
+	Resolution      string    `db:"resolution" json:"resolution"`
+	Capabilities    []string  `db:"capabilities" json:"capabilities"`
+	Status          string    `db:"status" json:"status"`
+	DeviceID        *int64    `db:"device_id" json:"device_id"`
+	FirstSeenAt     time.Time `db:"first_seen_at" json:"first_seen_at"`
+	LastSeenAt      time.Time `db:"last_seen_at" json:"last_seen_at"`
+}
+
+type OutboxMessage struct {
+	ID           int64     `db:"id" json:"id"`
+	MessageID    string    `db:"message_id" json:"message_id"`
+	Topic        string    `db:"topic" json:"topic"`
+	Payload      []byte    `db:"payload" json:"payload"`
+	Attempts     int32     `db:"attempts" json:"attempts"`
+	LastError    string    `db:"last_error" json:"last_error"`
+	ClaimedUntil time.Time `db:"claimed_until" json:"claimed_until"`
+	SentAt       time.Time `db:"sent_at" json:"sent_at"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+type User struct {
+	ID           int64     `db:"id" json:"id"`
+	Username     string    `db:"username" json:"username"`
+	PasswordHash string    `db:"password_hash" json:"password_hash"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	Role         string    `db:"role" json:"role"`
+}
+
+type UserGrant struct {
 	ID        int64     `db:"id" json:"id"`
-	DeviceID  int64     `db:"device_id" json:"device_id"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	DeviceID  *int64    `db:"device_id" json:"device_id"`
+	GroupID   *int64    `db:"group_id" json:"group_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type UserSession struct {
+	TokenHash string    `db:"token_hash" json:"token_hash"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	ImagePath string    `db:"image_path" json:"image_path"`
 }
@@ -10,6 +10,173 @@ import (
 	"time"
 )
 
+const addDeviceGroupMember = `-- name: AddDeviceGroupMember :exec
+INSERT INTO device_group_members (group_id, device_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type AddDeviceGroupMemberParams struct {
+	GroupID  int64 `db:"group_id" json:"group_id"`
+	DeviceID int64 `db:"device_id" json:"device_id"`
+}
+
+func (q *Queries) AddDeviceGroupMember(ctx context.Context, arg AddDeviceGroupMemberParams) error {
+	_, err := q.db.Exec(ctx, addDeviceGroupMember, arg.GroupID, arg.DeviceID)
+	return err
+}
+
+const claimOutboxMessages = `-- name: ClaimOutboxMessages :many
+UPDATE outbox_messages
+SET claimed_until = $1
+WHERE id IN (SELECT id
+             FROM outbox_messages
+             WHERE sent_at = 'epoch'
+               AND claimed_until < NOW()
+             ORDER BY id
+             LIMIT $2 FOR UPDATE SKIP LOCKED)
+RETURNING id, message_id, topic, payload, attempts, last_error, claimed_until, sent_at, created_at
+`
+
+type ClaimOutboxMessagesParams struct {
+	ClaimedUntil time.Time `db:"claimed_until" json:"claimed_until"`
+	MaxMessages  int32     `db:"max_messages" json:"max_messages"`
+}
+
+// Claims up to max_messages pending messages until claimed_until, skipping messages other relays have claimed
+func (q *Queries) ClaimOutboxMessages(ctx context.Context, arg ClaimOutboxMessagesParams) ([]OutboxMessage, error) {
+	rows, err := q.db.Query(ctx, claimOutboxMessages, arg.ClaimedUntil, arg.MaxMessages)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []OutboxMessage{}
+	for rows.Next() {
+		var i OutboxMessage
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Topic,
+			&i.Payload,
+			&i.Attempts,
+			&i.LastError,
+			&i.ClaimedUntil,
+			&i.SentAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createApiToken = `-- name: CreateApiToken :one
+INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, user_id, name, token_hash, scopes, expires_at, created_at
+`
+
+type CreateApiTokenParams struct {
+	UserID    int64     `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	TokenHash string    `db:"token_hash" json:"token_hash"`
+	Scopes    []string  `db:"scopes" json:"scopes"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+}
+
+func (q *Queries) CreateApiToken(ctx context.Context, arg CreateApiTokenParams) (ApiToken, error) {
+	row := q.db.QueryRow(ctx, createApiToken,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	var i ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createAuditEntry = `-- name: CreateAuditEntry :one
+INSERT INTO audit_log (actor, actor_id, action, target_type, target_id, diff, source_ip)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, actor, actor_id, action, target_type, target_id, diff, source_ip, created_at
+`
+
+type CreateAuditEntryParams struct {
+	Actor      string `db:"actor" json:"actor"`
+	ActorID    *int64 `db:"actor_id" json:"actor_id"`
+	Action     string `db:"action" json:"action"`
+	TargetType string `db:"target_type" json:"target_type"`
+	TargetID   string `db:"target_id" json:"target_id"`
+	Diff       []byte `db:"diff" json:"diff"`
+	SourceIp   string `db:"source_ip" json:"source_ip"`
+}
+
+func (q *Queries) CreateAuditEntry(ctx context.Context, arg CreateAuditEntryParams) (AuditLog, error) {
+	row := q.db.QueryRow(ctx, createAuditEntry,
+		arg.Actor,
+		arg.ActorID,
+		arg.Action,
+		arg.TargetType,
+		arg.TargetID,
+		arg.Diff,
+		arg.SourceIp,
+	)
+	var i AuditLog
+	err := row.Scan(
+		&i.ID,
+		&i.Actor,
+		&i.ActorID,
+		&i.Action,
+		&i.TargetType,
+		&i.TargetID,
+		&i.Diff,
+		&i.SourceIp,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createCaptureSession = `-- name: CreateCaptureSession :one
+INSERT INTO capture_sessions (device_id, session_path, started_at)
+VALUES ($1, $2, $3)
+RETURNING id, device_id, session_path, started_at, ended_at, frame_count
+`
+
+type CreateCaptureSessionParams struct {
+	DeviceID    int64     `db:"device_id" json:"device_id"`
+	SessionPath string    `db:"session_path" json:"session_path"`
+	StartedAt   time.Time `db:"started_at" json:"started_at"`
+}
+
+// ---------- Capture sessions
+func (q *Queries) CreateCaptureSession(ctx context.Context, arg CreateCaptureSessionParams) (CaptureSession, error) {
+	row := q.db.QueryRow(ctx, createCaptureSession, arg.DeviceID, arg.SessionPath, arg.StartedAt)
+	var i CaptureSession
+	err := row.Scan(
+		&i.ID,
+		&i.DeviceID,
+		&i.SessionPath,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.FrameCount,
+	)
+	return i, err
+}
+
 const createDetection = `-- name: CreateDetection :one
 INSERT INTO detections (id, device_id, label, confidence, image_id, bbox)
 VALUES (DEFAULT, $1, $2, $3, $4, $5)
@@ -49,6 +216,7 @@ func (q *Queries) CreateDetection(ctx context.Context, arg CreateDetectionParams
 }
 
 type CreateDetectionsParams struct {
+	ID         int64       `db:"id" json:"id"`
 	DeviceID   int64       `db:"device_id" json:"device_id"`
 	Label      string      `db:"label" json:"label"`
 	Confidence float64     `db:"confidence" json:"confidence"`
@@ -57,44 +225,171 @@ type CreateDetectionsParams struct {
 }
 
 const createDevice = `-- name: CreateDevice :one
-INSERT INTO devices (id, name, device_url)
-VALUES (DEFAULT, $1, $2)
-RETURNING id, name, device_url
+INSERT INTO devices (id, name, device_url, location, tags, timezone, enabled, username, password,
+                     firmware_version, resolution, capabilities)
+VALUES (DEFAULT, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING id, name, device_url, location, tags, timezone, enabled, username, password, firmware_version, resolution, capabilities, muted_until
 `
 
 type CreateDeviceParams struct {
-	Name      string `db:"name" json:"name"`
-	DeviceUrl string `db:"device_url" json:"device_url"`
+	Name            string   `db:"name" json:"name"`
+	DeviceUrl       string   `db:"device_url" json:"device_url"`
+	Location        string   `db:"location" json:"location"`
+	Tags            []string `db:"tags" json:"tags"`
+	Timezone        string   `db:"timezone" json:"timezone"`
+	Enabled         bool     `db:"enabled" json:"enabled"`
+	Username        string   `db:"username" json:"username"`
+	Password        string   `db:"password" json:"password"`
+	FirmwareVersion string   `db:"firmware_version" json:"firmware_version"`
+	Resolution      string   `db:"resolution" json:"resolution"`
+	Capabilities    []string `db:"capabilities" json:"capabilities"`
 }
 
 func (q *Queries) CreateDevice(ctx context.Context, arg CreateDeviceParams) (Device, error) {
-	row := q.db.QueryRow(ctx, createDevice, arg.Name, arg.DeviceUrl)
+	row := q.db.QueryRow(ctx, createDevice,
+		arg.Name,
+		arg.DeviceUrl,
+		arg.Location,
+		arg.Tags,
+		arg.Timezone,
+		arg.Enabled,
+		arg.Username,
+		arg.Password,
+		arg.FirmwareVersion,
+		arg.Resolution,
+		arg.Capabilities,
+	)
 	var i Device
-	err := row.Scan(&i.ID, &i.Name, &i.DeviceUrl)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.Location,
+		&i.Tags,
+		&i.Timezone,
+		&i.Enabled,
+		&i.Username,
+		&i.Password,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.MutedUntil,
+	)
+	return i, err
+}
+
+const createDeviceGroup = `-- name: CreateDeviceGroup :one
+INSERT INTO device_groups (name, description)
+VALUES ($1, $2)
+RETURNING id, name, description, created_at
+`
+
+type CreateDeviceGroupParams struct {
+	Name        string `db:"name" json:"name"`
+	Description string `db:"description" json:"description"`
+}
+
+func (q *Queries) CreateDeviceGroup(ctx context.Context, arg CreateDeviceGroupParams) (DeviceGroup, error) {
+	row := q.db.QueryRow(ctx, createDeviceGroup, arg.Name, arg.Description)
+	var i DeviceGroup
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.CreatedAt,
+	)
 	return i, err
 }
 
 const createImage = `-- name: CreateImage :one
 
-INSERT INTO device_images (id, device_id, created_at, image_path)
-VALUES (DEFAULT, $1, DEFAULT, $2)
-RETURNING id, device_id, created_at, image_path
+INSERT INTO device_images (id, device_id, created_at, image_path, annotated_path, session_id)
+VALUES (DEFAULT, $1, DEFAULT, $2, $3, $4)
+RETURNING id, device_id, created_at, image_path, annotated_path, session_id
 `
 
 type CreateImageParams struct {
-	DeviceID  int64  `db:"device_id" json:"device_id"`
-	ImagePath string `db:"image_path" json:"image_path"`
+	DeviceID      int64  `db:"device_id" json:"device_id"`
+	ImagePath     string `db:"image_path" json:"image_path"`
+	AnnotatedPath string `db:"annotated_path" json:"annotated_path"`
+	SessionID     *int64 `db:"session_id" json:"session_id"`
 }
 
 // ---------- Images
 func (q *Queries) CreateImage(ctx context.Context, arg CreateImageParams) (DeviceImage, error) {
-	row := q.db.QueryRow(ctx, createImage, arg.DeviceID, arg.ImagePath)
+	row := q.db.QueryRow(ctx, createImage,
+		arg.DeviceID,
+		arg.ImagePath,
+		arg.AnnotatedPath,
+		arg.SessionID,
+	)
 	var i DeviceImage
 	err := row.Scan(
 		&i.ID,
 		&i.DeviceID,
 		&i.CreatedAt,
 		&i.ImagePath,
+		&i.AnnotatedPath,
+		&i.SessionID,
+	)
+	return i, err
+}
+
+const createOutboxMessage = `-- name: CreateOutboxMessage :one
+INSERT INTO outbox_messages (message_id, topic, payload)
+VALUES ($1, $2, $3)
+RETURNING id, message_id, topic, payload, attempts, last_error, claimed_until, sent_at, created_at
+`
+
+type CreateOutboxMessageParams struct {
+	MessageID string `db:"message_id" json:"message_id"`
+	Topic     string `db:"topic" json:"topic"`
+	Payload   []byte `db:"payload" json:"payload"`
+}
+
+func (q *Queries) CreateOutboxMessage(ctx context.Context, arg CreateOutboxMessageParams) (OutboxMessage, error) {
+	row := q.db.QueryRow(ctx, createOutboxMessage, arg.MessageID, arg.Topic, arg.Payload)
+	var i OutboxMessage
+	err := row.Scan(
+		&i.ID,
+		&i.MessageID,
+		&i.Topic,
+		&i.Payload,
+		&i.Attempts,
+		&i.LastError,
+		&i.ClaimedUntil,
+		&i.SentAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+type CreateOutboxMessagesParams struct {
+	MessageID string `db:"message_id" json:"message_id"`
+	Topic     string `db:"topic" json:"topic"`
+	Payload   []byte `db:"payload" json:"payload"`
+}
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO user_sessions (token_hash, user_id, expires_at)
+VALUES ($1, $2, $3)
+RETURNING token_hash, user_id, expires_at, created_at
+`
+
+type CreateSessionParams struct {
+	TokenHash string    `db:"token_hash" json:"token_hash"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (UserSession, error) {
+	row := q.db.QueryRow(ctx, createSession, arg.TokenHash, arg.UserID, arg.ExpiresAt)
+	var i UserSession
+	err := row.Scan(
+		&i.TokenHash,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
 	)
 	return i, err
 }
@@ -102,16 +397,103 @@ func (q *Queries) CreateImage(ctx context.Context, arg CreateImageParams) (Devic
 const createTestDevice = `-- name: CreateTestDevice :one
 INSERT INTO devices (id, name, device_url)
 VALUES (DEFAULT, 'mockdevice', 'http://mock_device:8080')
-RETURNING id, name, device_url
+RETURNING id, name, device_url, location, tags, timezone, enabled, username, password, firmware_version, resolution, capabilities, muted_until
 `
 
 func (q *Queries) CreateTestDevice(ctx context.Context) (Device, error) {
 	row := q.db.QueryRow(ctx, createTestDevice)
 	var i Device
-	err := row.Scan(&i.ID, &i.Name, &i.DeviceUrl)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.Location,
+		&i.Tags,
+		&i.Timezone,
+		&i.Enabled,
+		&i.Username,
+		&i.Password,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.MutedUntil,
+	)
+	return i, err
+}
+
+const createUser = `-- name: CreateUser :one
+
+INSERT INTO users (username, password_hash, role)
+VALUES ($1, $2, $3)
+RETURNING id, username, password_hash, created_at, role
+`
+
+type CreateUserParams struct {
+	Username     string `db:"username" json:"username"`
+	PasswordHash string `db:"password_hash" json:"password_hash"`
+	Role         string `db:"role" json:"role"`
+}
+
+// ---------------
+// Users & auth
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, createUser, arg.Username, arg.PasswordHash, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.Role,
+	)
+	return i, err
+}
+
+const createUserGrant = `-- name: CreateUserGrant :one
+INSERT INTO user_grants (user_id, device_id, group_id)
+VALUES ($1, $2, $3)
+RETURNING id, user_id, device_id, group_id, created_at
+`
+
+type CreateUserGrantParams struct {
+	UserID   int64  `db:"user_id" json:"user_id"`
+	DeviceID *int64 `db:"device_id" json:"device_id"`
+	GroupID  *int64 `db:"group_id" json:"group_id"`
+}
+
+func (q *Queries) CreateUserGrant(ctx context.Context, arg CreateUserGrantParams) (UserGrant, error) {
+	row := q.db.QueryRow(ctx, createUserGrant, arg.UserID, arg.DeviceID, arg.GroupID)
+	var i UserGrant
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.DeviceID,
+		&i.GroupID,
+		&i.CreatedAt,
+	)
 	return i, err
 }
 
+const deleteApiToken = `-- name: DeleteApiToken :execrows
+DELETE
+FROM api_tokens
+WHERE id = $1
+  AND user_id = $2
+`
+
+type DeleteApiTokenParams struct {
+	ID     int64 `db:"id" json:"id"`
+	UserID int64 `db:"user_id" json:"user_id"`
+}
+
+func (q *Queries) DeleteApiToken(ctx context.Context, arg DeleteApiTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteApiToken, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const deleteBeats = `-- name: DeleteBeats :exec
 DELETE
 FROM device_heartbeats
@@ -123,6 +505,17 @@ func (q *Queries) DeleteBeats(ctx context.Context, deviceID int64) error {
 	return err
 }
 
+const deleteDetectionFilter = `-- name: DeleteDetectionFilter :exec
+DELETE
+FROM detection_filters
+WHERE device_id IS NOT DISTINCT FROM $1
+`
+
+func (q *Queries) DeleteDetectionFilter(ctx context.Context, deviceID *int64) error {
+	_, err := q.db.Exec(ctx, deleteDetectionFilter, deviceID)
+	return err
+}
+
 const deleteDetections = `-- name: DeleteDetections :exec
 DELETE
 FROM detections
@@ -145,6 +538,68 @@ func (q *Queries) DeleteDevice(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteDeviceGroup = `-- name: DeleteDeviceGroup :exec
+DELETE
+FROM device_groups
+WHERE id = $1
+`
+
+func (q *Queries) DeleteDeviceGroup(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteDeviceGroup, id)
+	return err
+}
+
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :execrows
+DELETE
+FROM user_sessions
+WHERE expires_at < $1
+`
+
+func (q *Queries) DeleteExpiredSessions(ctx context.Context, expiresAt time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredSessions, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteImage = `-- name: DeleteImage :exec
+DELETE
+FROM device_images
+WHERE id = $1
+`
+
+func (q *Queries) DeleteImage(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteImage, id)
+	return err
+}
+
+const deleteSentOutboxMessages = `-- name: DeleteSentOutboxMessages :execrows
+DELETE
+FROM outbox_messages
+WHERE sent_at <> 'epoch'
+  AND sent_at < $1
+`
+
+func (q *Queries) DeleteSentOutboxMessages(ctx context.Context, sentAt time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSentOutboxMessages, sentAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteSession = `-- name: DeleteSession :exec
+DELETE
+FROM user_sessions
+WHERE token_hash = $1
+`
+
+func (q *Queries) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := q.db.Exec(ctx, deleteSession, tokenHash)
+	return err
+}
+
 const deleteTestDevices = `-- name: DeleteTestDevices :exec
 DELETE
 FROM devices
@@ -157,6 +612,138 @@ func (q *Queries) DeleteTestDevices(ctx context.Context) error {
 	return err
 }
 
+const deleteUserGrant = `-- name: DeleteUserGrant :execrows
+DELETE
+FROM user_grants
+WHERE id = $1
+  AND user_id = $2
+`
+
+type DeleteUserGrantParams struct {
+	ID     int64 `db:"id" json:"id"`
+	UserID int64 `db:"user_id" json:"user_id"`
+}
+
+func (q *Queries) DeleteUserGrant(ctx context.Context, arg DeleteUserGrantParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserGrant, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const endCaptureSession = `-- name: EndCaptureSession :one
+UPDATE capture_sessions
+SET ended_at    = $1,
+    frame_count = (SELECT count(*) FROM device_images WHERE session_id = $2)
+WHERE id = $2
+RETURNING id, device_id, session_path, started_at, ended_at, frame_count
+`
+
+type EndCaptureSessionParams struct {
+	EndedAt time.Time `db:"ended_at" json:"ended_at"`
+	ID      int64     `db:"id" json:"id"`
+}
+
+// The frame count is the session's stored frames
+func (q *Queries) EndCaptureSession(ctx context.Context, arg EndCaptureSessionParams) (CaptureSession, error) {
+	row := q.db.QueryRow(ctx, endCaptureSession, arg.EndedAt, arg.ID)
+	var i CaptureSession
+	err := row.Scan(
+		&i.ID,
+		&i.DeviceID,
+		&i.SessionPath,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.FrameCount,
+	)
+	return i, err
+}
+
+const getApiTokenByHash = `-- name: GetApiTokenByHash :one
+SELECT id, user_id, name, token_hash, scopes, expires_at, created_at
+FROM api_tokens
+WHERE token_hash = $1
+  AND (expires_at = 'epoch' OR expires_at > NOW())
+LIMIT 1
+`
+
+func (q *Queries) GetApiTokenByHash(ctx context.Context, tokenHash string) (ApiToken, error) {
+	row := q.db.QueryRow(ctx, getApiTokenByHash, tokenHash)
+	var i ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getCaptureSession = `-- name: GetCaptureSession :one
+SELECT id, device_id, session_path, started_at, ended_at, frame_count
+FROM capture_sessions
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetCaptureSession(ctx context.Context, id int64) (CaptureSession, error) {
+	row := q.db.QueryRow(ctx, getCaptureSession, id)
+	var i CaptureSession
+	err := row.Scan(
+		&i.ID,
+		&i.DeviceID,
+		&i.SessionPath,
+		&i.StartedAt,
+		&i.EndedAt,
+		&i.FrameCount,
+	)
+	return i, err
+}
+
+const getDetectionFilters = `-- name: GetDetectionFilters :many
+SELECT id, device_id, min_confidence, label_confidence, allow_labels, deny_labels, aliases, updated_at
+FROM detection_filters
+WHERE device_id IS NULL
+   OR device_id = $1
+ORDER BY device_id NULLS FIRST
+`
+
+// ---------------
+// Detection filters
+// ---------------
+func (q *Queries) GetDetectionFilters(ctx context.Context, deviceID *int64) ([]DetectionFilter, error) {
+	rows, err := q.db.Query(ctx, getDetectionFilters, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DetectionFilter{}
+	for rows.Next() {
+		var i DetectionFilter
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.MinConfidence,
+			&i.LabelConfidence,
+			&i.AllowLabels,
+			&i.DenyLabels,
+			&i.Aliases,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDetectionsAfter = `-- name: GetDetectionsAfter :many
 SELECT id, device_id, image_id, created_at, label, confidence, bbox
 FROM detections
@@ -192,17 +779,132 @@ func (q *Queries) GetDetectionsAfter(ctx context.Context, createdAt time.Time) (
 	return items, nil
 }
 
-const getDeviceById = `-- name: GetDeviceById :one
-SELECT id, name, device_url
-FROM devices
-WHERE id = $1
-LIMIT 1
-`
+const getDetectionsAfterId = `-- name: GetDetectionsAfterId :many
+SELECT id, device_id, image_id, created_at, label, confidence, bbox
+FROM detections
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type GetDetectionsAfterIdParams struct {
+	ID    int64 `db:"id" json:"id"`
+	Limit int32 `db:"limit" json:"limit"`
+}
+
+func (q *Queries) GetDetectionsAfterId(ctx context.Context, arg GetDetectionsAfterIdParams) ([]Detection, error) {
+	rows, err := q.db.Query(ctx, getDetectionsAfterId, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Detection{}
+	for rows.Next() {
+		var i Detection
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.ImageID,
+			&i.CreatedAt,
+			&i.Label,
+			&i.Confidence,
+			&i.Bbox,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDetectionsByIds = `-- name: GetDetectionsByIds :many
+SELECT id, device_id, image_id, created_at, label, confidence, bbox
+FROM detections
+WHERE id = ANY ($1::bigint[])
+ORDER BY id
+`
+
+func (q *Queries) GetDetectionsByIds(ctx context.Context, ids []int64) ([]Detection, error) {
+	rows, err := q.db.Query(ctx, getDetectionsByIds, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Detection{}
+	for rows.Next() {
+		var i Detection
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.ImageID,
+			&i.CreatedAt,
+			&i.Label,
+			&i.Confidence,
+			&i.Bbox,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeviceById = `-- name: GetDeviceById :one
+SELECT id, name, device_url, location, tags, timezone, enabled, username, password, firmware_version, resolution, capabilities, muted_until
+FROM devices
+WHERE id = $1
+LIMIT 1
+`
 
 func (q *Queries) GetDeviceById(ctx context.Context, id int64) (Device, error) {
 	row := q.db.QueryRow(ctx, getDeviceById, id)
 	var i Device
-	err := row.Scan(&i.ID, &i.Name, &i.DeviceUrl)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.Location,
+		&i.Tags,
+		&i.Timezone,
+		&i.Enabled,
+		&i.Username,
+		&i.Password,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.MutedUntil,
+	)
+	return i, err
+}
+
+const getDeviceConfig = `-- name: GetDeviceConfig :one
+SELECT device_id, desired, desired_version, reported, acked_version, last_error, push_attempts, pushed_at, acked_at, updated_at
+FROM device_configs
+WHERE device_id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetDeviceConfig(ctx context.Context, deviceID int64) (DeviceConfig, error) {
+	row := q.db.QueryRow(ctx, getDeviceConfig, deviceID)
+	var i DeviceConfig
+	err := row.Scan(
+		&i.DeviceID,
+		&i.Desired,
+		&i.DesiredVersion,
+		&i.Reported,
+		&i.AckedVersion,
+		&i.LastError,
+		&i.PushAttempts,
+		&i.PushedAt,
+		&i.AckedAt,
+		&i.UpdatedAt,
+	)
 	return i, err
 }
 
@@ -249,6 +951,66 @@ func (q *Queries) GetDeviceDetectionsAfter(ctx context.Context, arg GetDeviceDet
 	return items, nil
 }
 
+const getDeviceGroup = `-- name: GetDeviceGroup :one
+SELECT id, name, description, created_at
+FROM device_groups
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetDeviceGroup(ctx context.Context, id int64) (DeviceGroup, error) {
+	row := q.db.QueryRow(ctx, getDeviceGroup, id)
+	var i DeviceGroup
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getDeviceGroupDevices = `-- name: GetDeviceGroupDevices :many
+SELECT id, name, device_url, location, tags, timezone, enabled, username, password, firmware_version, resolution, capabilities, muted_until
+FROM devices
+WHERE id IN (SELECT device_id FROM device_group_members WHERE group_id = $1)
+ORDER BY name
+`
+
+func (q *Queries) GetDeviceGroupDevices(ctx context.Context, groupID int64) ([]Device, error) {
+	rows, err := q.db.Query(ctx, getDeviceGroupDevices, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Device{}
+	for rows.Next() {
+		var i Device
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.DeviceUrl,
+			&i.Location,
+			&i.Tags,
+			&i.Timezone,
+			&i.Enabled,
+			&i.Username,
+			&i.Password,
+			&i.FirmwareVersion,
+			&i.Resolution,
+			&i.Capabilities,
+			&i.MutedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDeviceHeartBeats = `-- name: GetDeviceHeartBeats :many
 
 SELECT id, device_id, created_at
@@ -287,7 +1049,7 @@ func (q *Queries) GetDeviceHeartBeats(ctx context.Context, arg GetDeviceHeartBea
 }
 
 const getDeviceImages = `-- name: GetDeviceImages :many
-SELECT id, device_id, created_at, image_path
+SELECT id, device_id, created_at, image_path, annotated_path, session_id
 FROM device_images
 WHERE device_id = $1
 `
@@ -306,6 +1068,8 @@ func (q *Queries) GetDeviceImages(ctx context.Context, deviceID int64) ([]Device
 			&i.DeviceID,
 			&i.CreatedAt,
 			&i.ImagePath,
+			&i.AnnotatedPath,
+			&i.SessionID,
 		); err != nil {
 			return nil, err
 		}
@@ -318,7 +1082,7 @@ func (q *Queries) GetDeviceImages(ctx context.Context, deviceID int64) ([]Device
 }
 
 const getDevices = `-- name: GetDevices :many
-SELECT id, name, device_url
+SELECT id, name, device_url, location, tags, timezone, enabled, username, password, firmware_version, resolution, capabilities, muted_until
 FROM devices
 ORDER BY name
 `
@@ -332,7 +1096,178 @@ func (q *Queries) GetDevices(ctx context.Context) ([]Device, error) {
 	items := []Device{}
 	for rows.Next() {
 		var i Device
-		if err := rows.Scan(&i.ID, &i.Name, &i.DeviceUrl); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.DeviceUrl,
+			&i.Location,
+			&i.Tags,
+			&i.Timezone,
+			&i.Enabled,
+			&i.Username,
+			&i.Password,
+			&i.FirmwareVersion,
+			&i.Resolution,
+			&i.Capabilities,
+			&i.MutedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDiscoveredDevice = `-- name: GetDiscoveredDevice :one
+SELECT id, mac, name, device_url, firmware_version, resolution, capabilities, status, device_id, first_seen_at, last_seen_at
+FROM discovered_devices
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetDiscoveredDevice(ctx context.Context, id int64) (DiscoveredDevice, error) {
+	row := q.db.QueryRow(ctx, getDiscoveredDevice, id)
+	var i DiscoveredDevice
+	err := row.Scan(
+		&i.ID,
+		&i.Mac,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.Status,
+		&i.DeviceID,
+		&i.FirstSeenAt,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const getImage = `-- name: GetImage :one
+SELECT id, device_id, created_at, image_path, annotated_path, session_id
+FROM device_images
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetImage(ctx context.Context, id int64) (DeviceImage, error) {
+	row := q.db.QueryRow(ctx, getImage, id)
+	var i DeviceImage
+	err := row.Scan(
+		&i.ID,
+		&i.DeviceID,
+		&i.CreatedAt,
+		&i.ImagePath,
+		&i.AnnotatedPath,
+		&i.SessionID,
+	)
+	return i, err
+}
+
+const getImagesByPattern = `-- name: GetImagesByPattern :many
+SELECT id, device_id, created_at, image_path, annotated_path, session_id
+FROM device_images
+WHERE image_path LIKE $1
+ORDER BY id
+`
+
+func (q *Queries) GetImagesByPattern(ctx context.Context, pattern string) ([]DeviceImage, error) {
+	rows, err := q.db.Query(ctx, getImagesByPattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DeviceImage{}
+	for rows.Next() {
+		var i DeviceImage
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.CreatedAt,
+			&i.ImagePath,
+			&i.AnnotatedPath,
+			&i.SessionID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestDeviceImage = `-- name: GetLatestDeviceImage :one
+SELECT id, device_id, created_at, image_path, annotated_path, session_id
+FROM device_images
+WHERE device_id = $1
+ORDER BY id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLatestDeviceImage(ctx context.Context, deviceID int64) (DeviceImage, error) {
+	row := q.db.QueryRow(ctx, getLatestDeviceImage, deviceID)
+	var i DeviceImage
+	err := row.Scan(
+		&i.ID,
+		&i.DeviceID,
+		&i.CreatedAt,
+		&i.ImagePath,
+		&i.AnnotatedPath,
+		&i.SessionID,
+	)
+	return i, err
+}
+
+const getSession = `-- name: GetSession :one
+SELECT token_hash, user_id, expires_at, created_at
+FROM user_sessions
+WHERE token_hash = $1
+  AND expires_at > NOW()
+LIMIT 1
+`
+
+func (q *Queries) GetSession(ctx context.Context, tokenHash string) (UserSession, error) {
+	row := q.db.QueryRow(ctx, getSession, tokenHash)
+	var i UserSession
+	err := row.Scan(
+		&i.TokenHash,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getSessionImages = `-- name: GetSessionImages :many
+SELECT id, device_id, created_at, image_path, annotated_path, session_id
+FROM device_images
+WHERE session_id = $1
+ORDER BY id
+`
+
+func (q *Queries) GetSessionImages(ctx context.Context, sessionID *int64) ([]DeviceImage, error) {
+	rows, err := q.db.Query(ctx, getSessionImages, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DeviceImage{}
+	for rows.Next() {
+		var i DeviceImage
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.CreatedAt,
+			&i.ImagePath,
+			&i.AnnotatedPath,
+			&i.SessionID,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -344,7 +1279,7 @@ func (q *Queries) GetDevices(ctx context.Context) ([]Device, error) {
 }
 
 const getTestDevice = `-- name: GetTestDevice :one
-SELECT id, name, device_url
+SELECT id, name, device_url, location, tags, timezone, enabled, username, password, firmware_version, resolution, capabilities, muted_until
 FROM devices
 WHERE name ILIKE '%mockdevice%'
 LIMIT 1
@@ -353,7 +1288,61 @@ LIMIT 1
 func (q *Queries) GetTestDevice(ctx context.Context) (Device, error) {
 	row := q.db.QueryRow(ctx, getTestDevice)
 	var i Device
-	err := row.Scan(&i.ID, &i.Name, &i.DeviceUrl)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.Location,
+		&i.Tags,
+		&i.Timezone,
+		&i.Enabled,
+		&i.Username,
+		&i.Password,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.MutedUntil,
+	)
+	return i, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, username, password_hash, created_at, role
+FROM users
+WHERE id = $1
+LIMIT 1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRow(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, username, password_hash, created_at, role
+FROM users
+WHERE username = $1
+LIMIT 1
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.Role,
+	)
 	return i, err
 }
 
@@ -425,33 +1414,940 @@ func (q *Queries) LatestBeats(ctx context.Context) ([]LatestBeatsRow, error) {
 	return items, nil
 }
 
-const recordBeat = `-- name: RecordBeat :one
-INSERT INTO device_heartbeats (id, device_id, created_at)
-VALUES (DEFAULT, $1, NOW())
-RETURNING id, device_id, created_at
+const listApiTokens = `-- name: ListApiTokens :many
+SELECT id, user_id, name, token_hash, scopes, expires_at, created_at
+FROM api_tokens
+WHERE user_id = $1
+ORDER BY id
 `
 
-func (q *Queries) RecordBeat(ctx context.Context, deviceID int64) (DeviceHeartbeat, error) {
-	row := q.db.QueryRow(ctx, recordBeat, deviceID)
-	var i DeviceHeartbeat
-	err := row.Scan(&i.ID, &i.DeviceID, &i.CreatedAt)
-	return i, err
+func (q *Queries) ListApiTokens(ctx context.Context, userID int64) ([]ApiToken, error) {
+	rows, err := q.db.Query(ctx, listApiTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ApiToken{}
+	for rows.Next() {
+		var i ApiToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.TokenHash,
+			&i.Scopes,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const updateDevice = `-- name: UpdateDevice :exec
-UPDATE devices
-SET name       = $2,
-    device_url = $3
+const listAuditEntries = `-- name: ListAuditEntries :many
+SELECT id, actor, actor_id, action, target_type, target_id, diff, source_ip, created_at
+FROM audit_log
+WHERE ($1::varchar = '' OR actor = $1)
+  AND ($2::varchar = '' OR action = $2)
+  AND ($3::varchar = '' OR target_type = $3)
+  AND ($4::varchar = '' OR target_id = $4)
+  AND created_at >= $5
+  AND ($6::timestamptz = 'epoch' OR created_at < $6)
+ORDER BY id DESC
+LIMIT $7
+`
+
+type ListAuditEntriesParams struct {
+	Actor         string    `db:"actor" json:"actor"`
+	Action        string    `db:"action" json:"action"`
+	TargetType    string    `db:"target_type" json:"target_type"`
+	TargetID      string    `db:"target_id" json:"target_id"`
+	CreatedAfter  time.Time `db:"created_after" json:"created_after"`
+	CreatedBefore time.Time `db:"created_before" json:"created_before"`
+	RowLimit      int32     `db:"row_limit" json:"row_limit"`
+}
+
+// Empty filters match every entry, an 'epoch' created_before has no upper bound. Newest first
+func (q *Queries) ListAuditEntries(ctx context.Context, arg ListAuditEntriesParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditEntries,
+		arg.Actor,
+		arg.Action,
+		arg.TargetType,
+		arg.TargetID,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditLog{}
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.Actor,
+			&i.ActorID,
+			&i.Action,
+			&i.TargetType,
+			&i.TargetID,
+			&i.Diff,
+			&i.SourceIp,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCaptureSessions = `-- name: ListCaptureSessions :many
+SELECT id, device_id, session_path, started_at, ended_at, frame_count
+FROM capture_sessions
+WHERE device_id = ANY ($1::bigint[])
+  AND started_at >= $2
+  AND ($3::timestamptz = 'epoch' OR started_at < $3)
+ORDER BY started_at DESC, id DESC
+LIMIT $4
+`
+
+type ListCaptureSessionsParams struct {
+	DeviceIds     []int64   `db:"device_ids" json:"device_ids"`
+	StartedAfter  time.Time `db:"started_after" json:"started_after"`
+	StartedBefore time.Time `db:"started_before" json:"started_before"`
+	RowLimit      int32     `db:"row_limit" json:"row_limit"`
+}
+
+// An 'epoch' started_before has no upper bound. Newest first
+func (q *Queries) ListCaptureSessions(ctx context.Context, arg ListCaptureSessionsParams) ([]CaptureSession, error) {
+	rows, err := q.db.Query(ctx, listCaptureSessions,
+		arg.DeviceIds,
+		arg.StartedAfter,
+		arg.StartedBefore,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CaptureSession{}
+	for rows.Next() {
+		var i CaptureSession
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.SessionPath,
+			&i.StartedAt,
+			&i.EndedAt,
+			&i.FrameCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDetectionFilters = `-- name: ListDetectionFilters :many
+SELECT id, device_id, min_confidence, label_confidence, allow_labels, deny_labels, aliases, updated_at
+FROM detection_filters
+ORDER BY device_id NULLS FIRST
+`
+
+func (q *Queries) ListDetectionFilters(ctx context.Context) ([]DetectionFilter, error) {
+	rows, err := q.db.Query(ctx, listDetectionFilters)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DetectionFilter{}
+	for rows.Next() {
+		var i DetectionFilter
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.MinConfidence,
+			&i.LabelConfidence,
+			&i.AllowLabels,
+			&i.DenyLabels,
+			&i.Aliases,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeviceConfigs = `-- name: ListDeviceConfigs :many
+SELECT device_id, desired, desired_version, reported, acked_version, last_error, push_attempts, pushed_at, acked_at, updated_at
+FROM device_configs
+ORDER BY device_id
+`
+
+func (q *Queries) ListDeviceConfigs(ctx context.Context) ([]DeviceConfig, error) {
+	rows, err := q.db.Query(ctx, listDeviceConfigs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DeviceConfig{}
+	for rows.Next() {
+		var i DeviceConfig
+		if err := rows.Scan(
+			&i.DeviceID,
+			&i.Desired,
+			&i.DesiredVersion,
+			&i.Reported,
+			&i.AckedVersion,
+			&i.LastError,
+			&i.PushAttempts,
+			&i.PushedAt,
+			&i.AckedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeviceGroupMembers = `-- name: ListDeviceGroupMembers :many
+SELECT group_id, device_id
+FROM device_group_members
+ORDER BY group_id, device_id
+`
+
+func (q *Queries) ListDeviceGroupMembers(ctx context.Context) ([]DeviceGroupMember, error) {
+	rows, err := q.db.Query(ctx, listDeviceGroupMembers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DeviceGroupMember{}
+	for rows.Next() {
+		var i DeviceGroupMember
+		if err := rows.Scan(&i.GroupID, &i.DeviceID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeviceGroups = `-- name: ListDeviceGroups :many
+SELECT id, name, description, created_at
+FROM device_groups
+ORDER BY name
+`
+
+func (q *Queries) ListDeviceGroups(ctx context.Context) ([]DeviceGroup, error) {
+	rows, err := q.db.Query(ctx, listDeviceGroups)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DeviceGroup{}
+	for rows.Next() {
+		var i DeviceGroup
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDiscoveredDevices = `-- name: ListDiscoveredDevices :many
+SELECT id, mac, name, device_url, firmware_version, resolution, capabilities, status, device_id, first_seen_at, last_seen_at
+FROM discovered_devices
+WHERE $1::varchar = ''
+   OR status = $1
+ORDER BY last_seen_at DESC
+`
+
+// An empty status lists every discovered device
+func (q *Queries) ListDiscoveredDevices(ctx context.Context, status string) ([]DiscoveredDevice, error) {
+	rows, err := q.db.Query(ctx, listDiscoveredDevices, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DiscoveredDevice{}
+	for rows.Next() {
+		var i DiscoveredDevice
+		if err := rows.Scan(
+			&i.ID,
+			&i.Mac,
+			&i.Name,
+			&i.DeviceUrl,
+			&i.FirmwareVersion,
+			&i.Resolution,
+			&i.Capabilities,
+			&i.Status,
+			&i.DeviceID,
+			&i.FirstSeenAt,
+			&i.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGrantedDeviceIds = `-- name: ListGrantedDeviceIds :many
+SELECT device_id::bigint AS device_id
+FROM user_grants
+WHERE user_id = $1
+  AND device_id IS NOT NULL
+UNION
+SELECT m.device_id
+FROM user_grants g
+         JOIN device_group_members m ON m.group_id = g.group_id
+WHERE g.user_id = $1
+`
+
+func (q *Queries) ListGrantedDeviceIds(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := q.db.Query(ctx, listGrantedDeviceIds, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var device_id int64
+		if err := rows.Scan(&device_id); err != nil {
+			return nil, err
+		}
+		items = append(items, device_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnackedDeviceConfigs = `-- name: ListUnackedDeviceConfigs :many
+SELECT device_id, desired, desired_version, reported, acked_version, last_error, push_attempts, pushed_at, acked_at, updated_at
+FROM device_configs
+WHERE acked_version < desired_version
+  AND pushed_at < $1
+  AND push_attempts < $2
+ORDER BY device_id
+`
+
+type ListUnackedDeviceConfigsParams struct {
+	PushedBefore time.Time `db:"pushed_before" json:"pushed_before"`
+	MaxAttempts  int32     `db:"max_attempts" json:"max_attempts"`
+}
+
+// Configs due for another push
+func (q *Queries) ListUnackedDeviceConfigs(ctx context.Context, arg ListUnackedDeviceConfigsParams) ([]DeviceConfig, error) {
+	rows, err := q.db.Query(ctx, listUnackedDeviceConfigs, arg.PushedBefore, arg.MaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []DeviceConfig{}
+	for rows.Next() {
+		var i DeviceConfig
+		if err := rows.Scan(
+			&i.DeviceID,
+			&i.Desired,
+			&i.DesiredVersion,
+			&i.Reported,
+			&i.AckedVersion,
+			&i.LastError,
+			&i.PushAttempts,
+			&i.PushedAt,
+			&i.AckedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserGrants = `-- name: ListUserGrants :many
+SELECT id, user_id, device_id, group_id, created_at
+FROM user_grants
+WHERE user_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListUserGrants(ctx context.Context, userID int64) ([]UserGrant, error) {
+	rows, err := q.db.Query(ctx, listUserGrants, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []UserGrant{}
+	for rows.Next() {
+		var i UserGrant
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.DeviceID,
+			&i.GroupID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, username, password_hash, created_at, role
+FROM users
+ORDER BY id
+`
+
+func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.PasswordHash,
+			&i.CreatedAt,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markOutboxMessageSent = `-- name: MarkOutboxMessageSent :exec
+UPDATE outbox_messages
+SET sent_at = NOW()
 WHERE id = $1
 `
 
-type UpdateDeviceParams struct {
+func (q *Queries) MarkOutboxMessageSent(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, markOutboxMessageSent, id)
+	return err
+}
+
+const muteDevice = `-- name: MuteDevice :one
+UPDATE devices
+SET muted_until = $1
+WHERE id = $2
+RETURNING id, name, device_url, location, tags, timezone, enabled, username, password, firmware_version, resolution, capabilities, muted_until
+`
+
+type MuteDeviceParams struct {
+	MutedUntil time.Time `db:"muted_until" json:"muted_until"`
+	ID         int64     `db:"id" json:"id"`
+}
+
+// Detections from a muted device are stored, but not published until muted_until
+func (q *Queries) MuteDevice(ctx context.Context, arg MuteDeviceParams) (Device, error) {
+	row := q.db.QueryRow(ctx, muteDevice, arg.MutedUntil, arg.ID)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.Location,
+		&i.Tags,
+		&i.Timezone,
+		&i.Enabled,
+		&i.Username,
+		&i.Password,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.MutedUntil,
+	)
+	return i, err
+}
+
+const recordBeat = `-- name: RecordBeat :one
+INSERT INTO device_heartbeats (id, device_id, created_at)
+VALUES (DEFAULT, $1, NOW())
+RETURNING id, device_id, created_at
+`
+
+func (q *Queries) RecordBeat(ctx context.Context, deviceID int64) (DeviceHeartbeat, error) {
+	row := q.db.QueryRow(ctx, recordBeat, deviceID)
+	var i DeviceHeartbeat
+	err := row.Scan(&i.ID, &i.DeviceID, &i.CreatedAt)
+	return i, err
+}
+
+const recordDeviceConfigAck = `-- name: RecordDeviceConfigAck :one
+UPDATE device_configs
+SET reported      = $1,
+    acked_version = CASE WHEN $2::varchar = '' THEN $3 ELSE acked_version END,
+    last_error    = $2,
+    push_attempts = CASE WHEN $2::varchar = '' THEN 0 ELSE push_attempts END,
+    acked_at      = NOW()
+WHERE device_id = $4
+RETURNING device_id, desired, desired_version, reported, acked_version, last_error, push_attempts, pushed_at, acked_at, updated_at
+`
+
+type RecordDeviceConfigAckParams struct {
+	Reported     []byte `db:"reported" json:"reported"`
+	LastError    string `db:"last_error" json:"last_error"`
+	AckedVersion int64  `db:"acked_version" json:"acked_version"`
+	DeviceID     int64  `db:"device_id" json:"device_id"`
+}
+
+// acked_version is whatever the device says it's running, so a device that reboots & reports version 0 is pushed
+// its config again. Failed acks keep the previous version
+func (q *Queries) RecordDeviceConfigAck(ctx context.Context, arg RecordDeviceConfigAckParams) (DeviceConfig, error) {
+	row := q.db.QueryRow(ctx, recordDeviceConfigAck, arg.Reported, arg.LastError, arg.AckedVersion, arg.DeviceID)
+	var i DeviceConfig
+	err := row.Scan(
+		&i.DeviceID,
+		&i.Desired,
+		&i.DesiredVersion,
+		&i.Reported,
+		&i.AckedVersion,
+		&i.LastError,
+		&i.PushAttempts,
+		&i.PushedAt,
+		&i.AckedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const recordDeviceConfigPush = `-- name: RecordDeviceConfigPush :exec
+UPDATE device_configs
+SET pushed_at     = NOW(),
+    push_attempts = push_attempts + 1
+WHERE device_id = $1
+`
+
+func (q *Queries) RecordDeviceConfigPush(ctx context.Context, deviceID int64) error {
+	_, err := q.db.Exec(ctx, recordDeviceConfigPush, deviceID)
+	return err
+}
+
+const recordOutboxMessageFailure = `-- name: RecordOutboxMessageFailure :exec
+UPDATE outbox_messages
+SET attempts      = attempts + 1,
+    last_error    = $1,
+    claimed_until = 'epoch'
+WHERE id = $2
+`
+
+type RecordOutboxMessageFailureParams struct {
+	LastError string `db:"last_error" json:"last_error"`
 	ID        int64  `db:"id" json:"id"`
-	Name      string `db:"name" json:"name"`
-	DeviceUrl string `db:"device_url" json:"device_url"`
 }
 
-func (q *Queries) UpdateDevice(ctx context.Context, arg UpdateDeviceParams) error {
-	_, err := q.db.Exec(ctx, updateDevice, arg.ID, arg.Name, arg.DeviceUrl)
+// Releases the claim, so the message is retried
+func (q *Queries) RecordOutboxMessageFailure(ctx context.Context, arg RecordOutboxMessageFailureParams) error {
+	_, err := q.db.Exec(ctx, recordOutboxMessageFailure, arg.LastError, arg.ID)
+	return err
+}
+
+const removeDeviceGroupMember = `-- name: RemoveDeviceGroupMember :exec
+DELETE
+FROM device_group_members
+WHERE group_id = $1
+  AND device_id = $2
+`
+
+type RemoveDeviceGroupMemberParams struct {
+	GroupID  int64 `db:"group_id" json:"group_id"`
+	DeviceID int64 `db:"device_id" json:"device_id"`
+}
+
+func (q *Queries) RemoveDeviceGroupMember(ctx context.Context, arg RemoveDeviceGroupMemberParams) error {
+	_, err := q.db.Exec(ctx, removeDeviceGroupMember, arg.GroupID, arg.DeviceID)
 	return err
 }
+
+const reserveDetectionIds = `-- name: ReserveDetectionIds :many
+SELECT nextval(pg_get_serial_sequence('detections', 'id'))::bigint AS id
+FROM generate_series(1, $1::integer)
+`
+
+func (q *Queries) ReserveDetectionIds(ctx context.Context, count int32) ([]int64, error) {
+	rows, err := q.db.Query(ctx, reserveDetectionIds, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setDesiredDeviceConfig = `-- name: SetDesiredDeviceConfig :one
+INSERT INTO device_configs (device_id, desired)
+VALUES ($1, $2)
+ON CONFLICT (device_id) DO UPDATE
+    SET desired         = EXCLUDED.desired,
+        desired_version = device_configs.desired_version + 1,
+        push_attempts   = 0,
+        last_error      = '',
+        updated_at      = NOW()
+RETURNING device_id, desired, desired_version, reported, acked_version, last_error, push_attempts, pushed_at, acked_at, updated_at
+`
+
+type SetDesiredDeviceConfigParams struct {
+	DeviceID int64  `db:"device_id" json:"device_id"`
+	Desired  []byte `db:"desired" json:"desired"`
+}
+
+// Each change bumps desired_version & restarts the push attempts
+func (q *Queries) SetDesiredDeviceConfig(ctx context.Context, arg SetDesiredDeviceConfigParams) (DeviceConfig, error) {
+	row := q.db.QueryRow(ctx, setDesiredDeviceConfig, arg.DeviceID, arg.Desired)
+	var i DeviceConfig
+	err := row.Scan(
+		&i.DeviceID,
+		&i.Desired,
+		&i.DesiredVersion,
+		&i.Reported,
+		&i.AckedVersion,
+		&i.LastError,
+		&i.PushAttempts,
+		&i.PushedAt,
+		&i.AckedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const setDiscoveredDeviceStatus = `-- name: SetDiscoveredDeviceStatus :one
+UPDATE discovered_devices
+SET status    = $1,
+    device_id = $2
+WHERE id = $3
+RETURNING id, mac, name, device_url, firmware_version, resolution, capabilities, status, device_id, first_seen_at, last_seen_at
+`
+
+type SetDiscoveredDeviceStatusParams struct {
+	Status   string `db:"status" json:"status"`
+	DeviceID *int64 `db:"device_id" json:"device_id"`
+	ID       int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) SetDiscoveredDeviceStatus(ctx context.Context, arg SetDiscoveredDeviceStatusParams) (DiscoveredDevice, error) {
+	row := q.db.QueryRow(ctx, setDiscoveredDeviceStatus, arg.Status, arg.DeviceID, arg.ID)
+	var i DiscoveredDevice
+	err := row.Scan(
+		&i.ID,
+		&i.Mac,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.Status,
+		&i.DeviceID,
+		&i.FirstSeenAt,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const setImageAnnotatedPath = `-- name: SetImageAnnotatedPath :one
+UPDATE device_images
+SET annotated_path = $1
+WHERE id = $2
+RETURNING id, device_id, created_at, image_path, annotated_path, session_id
+`
+
+type SetImageAnnotatedPathParams struct {
+	AnnotatedPath string `db:"annotated_path" json:"annotated_path"`
+	ID            int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) SetImageAnnotatedPath(ctx context.Context, arg SetImageAnnotatedPathParams) (DeviceImage, error) {
+	row := q.db.QueryRow(ctx, setImageAnnotatedPath, arg.AnnotatedPath, arg.ID)
+	var i DeviceImage
+	err := row.Scan(
+		&i.ID,
+		&i.DeviceID,
+		&i.CreatedAt,
+		&i.ImagePath,
+		&i.AnnotatedPath,
+		&i.SessionID,
+	)
+	return i, err
+}
+
+const updateDevice = `-- name: UpdateDevice :one
+UPDATE devices
+SET name             = $1,
+    device_url       = $2,
+    location         = $3,
+    tags             = $4,
+    timezone         = $5,
+    enabled          = COALESCE($6::boolean, enabled),
+    username         = $7,
+    password         = CASE WHEN $8::boolean THEN $9::varchar ELSE password END,
+    firmware_version = $10,
+    resolution       = $11,
+    capabilities     = COALESCE($12::text[], capabilities)
+WHERE id = $13
+RETURNING id, name, device_url, location, tags, timezone, enabled, username, password, firmware_version, resolution, capabilities, muted_until
+`
+
+type UpdateDeviceParams struct {
+	Name            string   `db:"name" json:"name"`
+	DeviceUrl       string   `db:"device_url" json:"device_url"`
+	Location        string   `db:"location" json:"location"`
+	Tags            []string `db:"tags" json:"tags"`
+	Timezone        string   `db:"timezone" json:"timezone"`
+	Enabled         *bool    `db:"enabled" json:"enabled"`
+	Username        string   `db:"username" json:"username"`
+	SetPassword     bool     `db:"set_password" json:"set_password"`
+	Password        string   `db:"password" json:"password"`
+	FirmwareVersion string   `db:"firmware_version" json:"firmware_version"`
+	Resolution      string   `db:"resolution" json:"resolution"`
+	Capabilities    []string `db:"capabilities" json:"capabilities"`
+	ID              int64    `db:"id" json:"id"`
+}
+
+// The password is only replaced when set_password is true, a null enabled or capabilities keeps the existing value
+func (q *Queries) UpdateDevice(ctx context.Context, arg UpdateDeviceParams) (Device, error) {
+	row := q.db.QueryRow(ctx, updateDevice,
+		arg.Name,
+		arg.DeviceUrl,
+		arg.Location,
+		arg.Tags,
+		arg.Timezone,
+		arg.Enabled,
+		arg.Username,
+		arg.SetPassword,
+		arg.Password,
+		arg.FirmwareVersion,
+		arg.Resolution,
+		arg.Capabilities,
+		arg.ID,
+	)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.Location,
+		&i.Tags,
+		&i.Timezone,
+		&i.Enabled,
+		&i.Username,
+		&i.Password,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.MutedUntil,
+	)
+	return i, err
+}
+
+const updateDeviceGroup = `-- name: UpdateDeviceGroup :one
+UPDATE device_groups
+SET name        = $1,
+    description = $2
+WHERE id = $3
+RETURNING id, name, description, created_at
+`
+
+type UpdateDeviceGroupParams struct {
+	Name        string `db:"name" json:"name"`
+	Description string `db:"description" json:"description"`
+	ID          int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateDeviceGroup(ctx context.Context, arg UpdateDeviceGroupParams) (DeviceGroup, error) {
+	row := q.db.QueryRow(ctx, updateDeviceGroup, arg.Name, arg.Description, arg.ID)
+	var i DeviceGroup
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2
+WHERE id = $1
+RETURNING id, username, password_hash, created_at, role
+`
+
+type UpdateUserRoleParams struct {
+	ID   int64  `db:"id" json:"id"`
+	Role string `db:"role" json:"role"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.Role,
+	)
+	return i, err
+}
+
+const upsertDetectionFilter = `-- name: UpsertDetectionFilter :one
+INSERT INTO detection_filters (device_id, min_confidence, label_confidence, allow_labels, deny_labels, aliases)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (device_id) DO UPDATE
+    SET min_confidence   = EXCLUDED.min_confidence,
+        label_confidence = EXCLUDED.label_confidence,
+        allow_labels     = EXCLUDED.allow_labels,
+        deny_labels      = EXCLUDED.deny_labels,
+        aliases          = EXCLUDED.aliases,
+        updated_at       = NOW()
+RETURNING id, device_id, min_confidence, label_confidence, allow_labels, deny_labels, aliases, updated_at
+`
+
+type UpsertDetectionFilterParams struct {
+	DeviceID        *int64   `db:"device_id" json:"device_id"`
+	MinConfidence   float64  `db:"min_confidence" json:"min_confidence"`
+	LabelConfidence []byte   `db:"label_confidence" json:"label_confidence"`
+	AllowLabels     []string `db:"allow_labels" json:"allow_labels"`
+	DenyLabels      []string `db:"deny_labels" json:"deny_labels"`
+	Aliases         []byte   `db:"aliases" json:"aliases"`
+}
+
+func (q *Queries) UpsertDetectionFilter(ctx context.Context, arg UpsertDetectionFilterParams) (DetectionFilter, error) {
+	row := q.db.QueryRow(ctx, upsertDetectionFilter,
+		arg.DeviceID,
+		arg.MinConfidence,
+		arg.LabelConfidence,
+		arg.AllowLabels,
+		arg.DenyLabels,
+		arg.Aliases,
+	)
+	var i DetectionFilter
+	err := row.Scan(
+		&i.ID,
+		&i.DeviceID,
+		&i.MinConfidence,
+		&i.LabelConfidence,
+		&i.AllowLabels,
+		&i.DenyLabels,
+		&i.Aliases,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertDiscoveredDevice = `-- name: UpsertDiscoveredDevice :one
+INSERT INTO discovered_devices (mac, name, device_url, firmware_version, resolution, capabilities)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (mac) DO UPDATE
+    SET name             = EXCLUDED.name,
+        device_url       = EXCLUDED.device_url,
+        firmware_version = EXCLUDED.firmware_version,
+        resolution       = EXCLUDED.resolution,
+        capabilities     = EXCLUDED.capabilities,
+        last_seen_at     = NOW()
+RETURNING id, mac, name, device_url, firmware_version, resolution, capabilities, status, device_id, first_seen_at, last_seen_at
+`
+
+type UpsertDiscoveredDeviceParams struct {
+	Mac             string   `db:"mac" json:"mac"`
+	Name            string   `db:"name" json:"name"`
+	DeviceUrl       string   `db:"device_url" json:"device_url"`
+	FirmwareVersion string   `db:"firmware_version" json:"firmware_version"`
+	Resolution      string   `db:"resolution" json:"resolution"`
+	Capabilities    []string `db:"capabilities" json:"capabilities"`
+}
+
+// Announcing again refreshes the details, the status is left alone
+func (q *Queries) UpsertDiscoveredDevice(ctx context.Context, arg UpsertDiscoveredDeviceParams) (DiscoveredDevice, error) {
+	row := q.db.QueryRow(ctx, upsertDiscoveredDevice,
+		arg.Mac,
+		arg.Name,
+		arg.DeviceUrl,
+		arg.FirmwareVersion,
+		arg.Resolution,
+		arg.Capabilities,
+	)
+	var i DiscoveredDevice
+	err := row.Scan(
+		&i.ID,
+		&i.Mac,
+		&i.Name,
+		&i.DeviceUrl,
+		&i.FirmwareVersion,
+		&i.Resolution,
+		&i.Capabilities,
+		&i.Status,
+		&i.DeviceID,
+		&i.FirstSeenAt,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"devicecapture/internal/postgres/db"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+)
+
+// sqlcModels the sqlc generated model for each table
+var sqlcModels = map[string]any{
+	"devices":              db.Device{},
+	"device_heartbeats":    db.DeviceHeartbeat{},
+	"device_images":        db.DeviceImage{},
+	"detections":           db.Detection{},
+	"detection_filters":    db.DetectionFilter{},
+	"device_groups":        db.DeviceGroup{},
+	"device_group_members": db.DeviceGroupMember{},
+	"discovered_devices":   db.DiscoveredDevice{},
+	"device_configs":       db.DeviceConfig{},
+	"outbox_messages":      db.OutboxMessage{},
+	"users":                db.User{},
+	"user_sessions":        db.UserSession{},
+	"api_tokens":           db.ApiToken{},
+	"user_grants":          db.UserGrant{},
+	"audit_log":            db.AuditLog{},
+	"capture_sessions":     db.CaptureSession{},
+}
+
+// sqlcGoType the Go type sqlc.yaml maps a column to
+func sqlcGoType(udtName string, nullable bool) string {
+	scalar := map[string]string{
+		"int8":        "int64",
+		"int4":        "int32",
+		"varchar":     "string",
+		"text":        "string",
+		"float8":      "float64",
+		"bool":        "bool",
+		"timestamptz": "time.Time",
+		"jsonb":       "[]uint8",
+		"bytea":       "[]uint8",
+		"_text":       "[]string",
+		"_varchar":    "[]string",
+		"_float8":     "[][]float64",
+	}[udtName]
+	if nullable && udtName == "int8" {
+		return "*" + scalar
+	}
+	return scalar
+}
+
+// newMigrationTestPool a pool on the test database whose search_path is an empty, throwaway schema
+func newMigrationTestPool(t *testing.T) *pgxpool.Pool {
+	ctx := t.Context()
+	appDb, err := NewTestAppDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer appDb.Db.Close()
+	_, err = appDb.Db.Exec(ctx, "DROP SCHEMA IF EXISTS migrations_test CASCADE; CREATE SCHEMA migrations_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := pgxpool.ParseConfig(testDatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = "migrations_test"
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Close()
+		cleanup, err := NewTestAppDb()
+		if err == nil {
+			_, _ = cleanup.Db.Exec(context.Background(), "DROP SCHEMA IF EXISTS migrations_test CASCADE")
+			cleanup.Db.Close()
+		}
+	})
+	return pool
+}
+
+func tableNames(t *testing.T, pool *pgxpool.Pool) []string {
+	rows, err := pool.Query(t.Context(),
+		"SELECT table_name FROM information_schema.tables WHERE table_schema = 'migrations_test' ORDER BY table_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestMigrations(t *testing.T) {
+	a := assert.New(t)
+	migrations, err := Migrations()
+	a.NoError(err)
+	a.NotEmpty(migrations)
+	for i, m := range migrations {
+		a.Equal(int64(i+1), m.Version, "versions are sequential")
+		a.NotEmpty(m.Up)
+		a.NotEmpty(m.Down)
+	}
+
+	_, err = readMigrations(fstest.MapFS{
+		"m/000001_init.up.sql": {Data: []byte("SELECT 1")},
+	}, "m")
+	a.Error(err, "every migration needs a down file")
+	_, err = readMigrations(fstest.MapFS{
+		"m/init.sql": {Data: []byte("SELECT 1")},
+	}, "m")
+	a.Error(err, "file names must be <version>_<name>.<up|down>.sql")
+}
+
+func TestMigrator_FromScratch(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	pool := newMigrationTestPool(t)
+	m, err := NewMigrator(pool)
+	a.NoError(err)
+
+	applied, err := m.Up(ctx)
+	a.NoError(err)
+	a.Len(applied, int(m.Latest()))
+	version, err := m.Version(ctx)
+	a.NoError(err)
+	a.Equal(m.Latest(), version)
+	applied, err = m.Up(ctx)
+	a.NoError(err)
+	a.Empty(applied, "up is a no-op once everything is applied")
+
+	// The migrated schema matches the models sqlc generated
+	rows, err := pool.Query(ctx, `SELECT table_name, column_name, udt_name, is_nullable = 'YES'
+FROM information_schema.columns
+WHERE table_schema = 'migrations_test' AND table_name <> 'schema_migrations'`)
+	a.NoError(err)
+	columns := map[string]map[string]string{}
+	for rows.Next() {
+		var table, column, udt string
+		var nullable bool
+		a.NoError(rows.Scan(&table, &column, &udt, &nullable))
+		if columns[table] == nil {
+			columns[table] = map[string]string{}
+		}
+		columns[table][column] = sqlcGoType(udt, nullable)
+	}
+	rows.Close()
+	a.Len(columns, len(sqlcModels), "every table has a sqlc model")
+	for table, model := range sqlcModels {
+		rt := reflect.TypeOf(model)
+		fields := map[string]string{}
+		for i := 0; i < rt.NumField(); i++ {
+			fields[rt.Field(i).Tag.Get("db")] = rt.Field(i).Type.String()
+		}
+		a.Equal(fields, columns[table], "%s matches db.%s", table, rt.Name())
+	}
+
+	// Down & To walk back through the history
+	reverted, err := m.Down(ctx, 1)
+	a.NoError(err)
+	if a.Len(reverted, 1) {
+		a.Equal(m.Latest(), reverted[0].Version)
+	}
+	_, err = m.To(ctx, 0)
+	a.NoError(err)
+	a.Equal([]string{"schema_migrations"}, tableNames(t, pool), "migrating to 0 drops everything")
+	statuses, err := m.Status(ctx)
+	a.NoError(err)
+	for _, s := range statuses {
+		a.Nil(s.AppliedAt)
+	}
+	_, err = m.To(ctx, 1)
+	a.NoError(err)
+	version, err = m.Version(ctx)
+	a.NoError(err)
+	a.Equal(int64(1), version)
+	_, err = m.To(ctx, 999)
+	a.ErrorIs(err, ErrUnknownVersion)
+}
@@ -60,3 +60,16 @@ func NewTestAppDb() (*AppDb, error) {
 	}
 	return appDb, nil
 }
+
+// Migrate applies any pending migrations
+func (a *AppDb) Migrate(ctx context.Context) error {
+	m, err := NewMigrator(a.Db)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx)
+	for _, mig := range applied {
+		log.Info().Msgf("Applied migration %d_%s", mig.Version, mig.Name)
+	}
+	return err
+}
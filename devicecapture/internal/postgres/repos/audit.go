@@ -0,0 +1,76 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres/db"
+)
+
+// PgAuditRepo implements devices.AuditRepo
+type PgAuditRepo struct {
+	queries *db.Queries
+}
+
+func NewPgAuditRepo(queries *db.Queries) *PgAuditRepo {
+	return &PgAuditRepo{
+		queries: queries,
+	}
+}
+
+func (ar *PgAuditRepo) CreateAuditEntry(ctx context.Context, params devices.CreateAuditParams) (devices.AuditEntry, error) {
+	diff := []byte(params.Diff)
+	if len(diff) == 0 {
+		diff = []byte("{}")
+	}
+	e, err := ar.queries.CreateAuditEntry(ctx, db.CreateAuditEntryParams{
+		Actor:      params.Actor,
+		ActorID:    params.ActorID,
+		Action:     params.Action,
+		TargetType: params.TargetType,
+		TargetID:   params.TargetID,
+		Diff:       diff,
+		SourceIp:   params.SourceIP,
+	})
+	if err != nil {
+		return devices.AuditEntry{}, err
+	}
+	return auditToDomain(e), nil
+}
+
+func (ar *PgAuditRepo) ListAuditEntries(ctx context.Context, q devices.AuditQuery) ([]devices.AuditEntry, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = devices.DefaultAuditLimit
+	}
+	rows, err := ar.queries.ListAuditEntries(ctx, db.ListAuditEntriesParams{
+		Actor:         q.Actor,
+		Action:        q.Action,
+		TargetType:    q.TargetType,
+		TargetID:      q.TargetID,
+		CreatedAfter:  q.After,
+		CreatedBefore: toEpoch(q.Before),
+		RowLimit:      limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := []devices.AuditEntry{}
+	for _, e := range rows {
+		entries = append(entries, auditToDomain(e))
+	}
+	return entries, nil
+}
+
+func auditToDomain(e db.AuditLog) devices.AuditEntry {
+	return devices.AuditEntry{
+		ID:         e.ID,
+		Actor:      e.Actor,
+		ActorID:    e.ActorID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Diff:       e.Diff,
+		SourceIP:   e.SourceIp,
+		CreatedAt:  e.CreatedAt,
+	}
+}
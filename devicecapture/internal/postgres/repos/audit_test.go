@@ -0,0 +1,68 @@
+package repos
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	repo := NewPgAuditRepo(appDb.GetQueries())
+	ctx := t.Context()
+
+	// Entries can't be deleted, so each run filters on its own actor
+	actor := "test" + generateRandomString(10)
+	actorId := int64(1)
+	start := time.Now().Add(-time.Second)
+	created, err := repo.CreateAuditEntry(ctx, devices.CreateAuditParams{
+		Actor:      actor,
+		ActorID:    &actorId,
+		Action:     devices.AuditDeviceUpdate,
+		TargetType: devices.AuditTargetDevice,
+		TargetID:   "1",
+		Diff:       json.RawMessage(`{"before": {"device_url": "http://a"}, "after": {"device_url": "http://b"}}`),
+		SourceIP:   "192.0.2.10",
+	})
+	a.NoError(err)
+	a.JSONEq(`{"before": {"device_url": "http://a"}, "after": {"device_url": "http://b"}}`, string(created.Diff))
+	_, err = repo.CreateAuditEntry(ctx, devices.CreateAuditParams{
+		Actor:      actor,
+		Action:     devices.AuditStreamStart,
+		TargetType: devices.AuditTargetDevice,
+		TargetID:   "1",
+	})
+	a.NoError(err)
+
+	entries, err := repo.ListAuditEntries(ctx, devices.AuditQuery{Actor: actor})
+	a.NoError(err)
+	if a.Len(entries, 2) {
+		a.Equal(devices.AuditStreamStart, entries[0].Action, "newest first")
+		a.JSONEq(`{}`, string(entries[0].Diff))
+		a.Nil(entries[0].ActorID)
+	}
+	entries, err = repo.ListAuditEntries(ctx, devices.AuditQuery{Actor: actor, Action: devices.AuditDeviceUpdate, After: start, Before: time.Now().Add(time.Minute)})
+	a.NoError(err)
+	if a.Len(entries, 1) {
+		a.Equal(created.ID, entries[0].ID)
+		a.Equal("192.0.2.10", entries[0].SourceIP)
+	}
+	entries, err = repo.ListAuditEntries(ctx, devices.AuditQuery{Actor: actor, Before: start})
+	a.NoError(err)
+	a.Empty(entries)
+	entries, err = repo.ListAuditEntries(ctx, devices.AuditQuery{Actor: actor, Limit: 1})
+	a.NoError(err)
+	a.Len(entries, 1)
+
+	_, err = appDb.Db.Exec(ctx, "UPDATE audit_log SET actor = 'mallory' WHERE id = $1", created.ID)
+	a.Error(err, "the audit log is append-only")
+	_, err = appDb.Db.Exec(ctx, "DELETE FROM audit_log WHERE id = $1", created.ID)
+	a.Error(err, "the audit log is append-only")
+}
@@ -0,0 +1,86 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres/db"
+	"time"
+)
+
+// PgCaptureSessionRepo implements devices.CaptureSessionRepo
+type PgCaptureSessionRepo struct {
+	queries *db.Queries
+}
+
+func NewPgCaptureSessionRepo(queries *db.Queries) *PgCaptureSessionRepo {
+	return &PgCaptureSessionRepo{
+		queries: queries,
+	}
+}
+
+func (sr *PgCaptureSessionRepo) CreateCaptureSession(ctx context.Context, params devices.CreateCaptureSessionParams) (devices.CaptureSession, error) {
+	s, err := sr.queries.CreateCaptureSession(ctx, db.CreateCaptureSessionParams{
+		DeviceID:    params.DeviceID,
+		SessionPath: params.SessionPath,
+		StartedAt:   params.StartedAt,
+	})
+	if err != nil {
+		return devices.CaptureSession{}, err
+	}
+	return captureSessionToDomain(s), nil
+}
+
+func (sr *PgCaptureSessionRepo) EndCaptureSession(ctx context.Context, id int64, endedAt time.Time) (devices.CaptureSession, error) {
+	s, err := sr.queries.EndCaptureSession(ctx, db.EndCaptureSessionParams{
+		EndedAt: toEpoch(endedAt),
+		ID:      id,
+	})
+	if err != nil {
+		return devices.CaptureSession{}, err
+	}
+	return captureSessionToDomain(s), nil
+}
+
+func (sr *PgCaptureSessionRepo) GetCaptureSession(ctx context.Context, id int64) (devices.CaptureSession, error) {
+	s, err := sr.queries.GetCaptureSession(ctx, id)
+	if err != nil {
+		return devices.CaptureSession{}, err
+	}
+	return captureSessionToDomain(s), nil
+}
+
+func (sr *PgCaptureSessionRepo) ListCaptureSessions(ctx context.Context, q devices.CaptureSessionQuery) ([]devices.CaptureSession, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = devices.DefaultCaptureSessionLimit
+	}
+	deviceIds := q.DeviceIDs
+	if deviceIds == nil {
+		deviceIds = []int64{}
+	}
+	rows, err := sr.queries.ListCaptureSessions(ctx, db.ListCaptureSessionsParams{
+		DeviceIds:     deviceIds,
+		StartedAfter:  q.After,
+		StartedBefore: toEpoch(q.Before),
+		RowLimit:      limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sessions := []devices.CaptureSession{}
+	for _, s := range rows {
+		sessions = append(sessions, captureSessionToDomain(s))
+	}
+	return sessions, nil
+}
+
+func captureSessionToDomain(s db.CaptureSession) devices.CaptureSession {
+	return devices.CaptureSession{
+		ID:          s.ID,
+		DeviceID:    s.DeviceID,
+		SessionPath: s.SessionPath,
+		StartedAt:   s.StartedAt,
+		EndedAt:     fromEpoch(s.EndedAt),
+		FrameCount:  s.FrameCount,
+	}
+}
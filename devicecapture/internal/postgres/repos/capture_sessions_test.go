@@ -0,0 +1,74 @@
+package repos
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureSessions(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	q := appDb.GetQueries()
+	repo := NewPgCaptureSessionRepo(q)
+	images := NewPgImageRepo(q)
+	ctx := t.Context()
+	testDevice, deviceErr := GetOrCreateTestDevice(ctx, q)
+	a.NoError(deviceErr)
+
+	// Sessions can outlive runs, so each run uses its own paths & start times
+	dir := "videos/" + generateRandomString(20)
+	startedAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	created, err := repo.CreateCaptureSession(ctx, devices.CreateCaptureSessionParams{
+		DeviceID:    testDevice.ID,
+		SessionPath: dir,
+		StartedAt:   startedAt,
+	})
+	a.NoError(err)
+	a.True(created.EndedAt.IsZero(), "capturing sessions haven't ended")
+	_, err = repo.CreateCaptureSession(ctx, devices.CreateCaptureSessionParams{DeviceID: testDevice.ID, SessionPath: dir, StartedAt: startedAt})
+	a.Error(err, "session paths are unique")
+
+	for _, name := range []string{"/output-1.jpeg", "/output-2.jpeg"} {
+		_, err := images.CreateImage(ctx, devices.CreateImageParams{DeviceID: testDevice.ID, ImagePath: dir + name, SessionID: &created.ID})
+		a.NoError(err)
+	}
+	_, err = images.CreateImage(ctx, devices.CreateImageParams{DeviceID: testDevice.ID, ImagePath: dir + "x/output-3.jpeg"})
+	a.NoError(err)
+	frames, err := images.GetSessionImages(ctx, created.ID)
+	a.NoError(err)
+	if a.Len(frames, 2) {
+		a.Equal(dir+"/output-1.jpeg", frames[0].ImagePath)
+		a.Equal(&created.ID, frames[0].SessionID)
+	}
+
+	endedAt := startedAt.Add(15 * time.Second)
+	ended, err := repo.EndCaptureSession(ctx, created.ID, endedAt)
+	a.NoError(err)
+	a.True(endedAt.Equal(ended.EndedAt))
+	a.Equal(int32(2), ended.FrameCount, "the session's stored frames")
+
+	got, err := repo.GetCaptureSession(ctx, created.ID)
+	a.NoError(err)
+	a.Equal(dir, got.SessionPath)
+	_, err = repo.GetCaptureSession(ctx, -1)
+	a.Error(err)
+
+	listed, err := repo.ListCaptureSessions(ctx, devices.CaptureSessionQuery{
+		DeviceIDs: []int64{testDevice.ID},
+		After:     startedAt,
+		Before:    startedAt.Add(time.Millisecond),
+	})
+	a.NoError(err)
+	if a.Len(listed, 1) {
+		a.Equal(created.ID, listed[0].ID)
+	}
+	listed, err = repo.ListCaptureSessions(ctx, devices.CaptureSessionQuery{After: startedAt})
+	a.NoError(err)
+	a.Empty(listed, "no devices, no sessions")
+}
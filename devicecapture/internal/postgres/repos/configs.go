@@ -0,0 +1,117 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres/db"
+	"encoding/json"
+	"time"
+)
+
+// PgDeviceConfigRepo implements devices.DeviceConfigRepo
+type PgDeviceConfigRepo struct {
+	queries *db.Queries
+}
+
+func NewPgDeviceConfigRepo(queries *db.Queries) *PgDeviceConfigRepo {
+	return &PgDeviceConfigRepo{
+		queries: queries,
+	}
+}
+
+func (cr *PgDeviceConfigRepo) GetDeviceConfig(ctx context.Context, deviceId int64) (devices.DeviceConfig, error) {
+	row, err := cr.queries.GetDeviceConfig(ctx, deviceId)
+	if err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	return cr.dbToDomain(row)
+}
+
+func (cr *PgDeviceConfigRepo) ListDeviceConfigs(ctx context.Context) ([]devices.DeviceConfig, error) {
+	rows, err := cr.queries.ListDeviceConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cr.dbToDomainSlice(rows)
+}
+
+// SetDesiredConfig store the config & bump the desired version
+func (cr *PgDeviceConfigRepo) SetDesiredConfig(ctx context.Context, deviceId int64, config devices.CameraConfig) (devices.DeviceConfig, error) {
+	desired, err := json.Marshal(config)
+	if err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	row, err := cr.queries.SetDesiredDeviceConfig(ctx, db.SetDesiredDeviceConfigParams{
+		DeviceID: deviceId,
+		Desired:  desired,
+	})
+	if err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	return cr.dbToDomain(row)
+}
+
+// ListUnackedConfigs configs due for another push
+func (cr *PgDeviceConfigRepo) ListUnackedConfigs(ctx context.Context, pushedBefore time.Time, maxAttempts int32) ([]devices.DeviceConfig, error) {
+	rows, err := cr.queries.ListUnackedDeviceConfigs(ctx, db.ListUnackedDeviceConfigsParams{
+		PushedBefore: pushedBefore,
+		MaxAttempts:  maxAttempts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cr.dbToDomainSlice(rows)
+}
+
+func (cr *PgDeviceConfigRepo) RecordConfigPush(ctx context.Context, deviceId int64) error {
+	return cr.queries.RecordDeviceConfigPush(ctx, deviceId)
+}
+
+func (cr *PgDeviceConfigRepo) RecordConfigAck(ctx context.Context, deviceId int64, ack devices.ConfigAck) (devices.DeviceConfig, error) {
+	reported, err := json.Marshal(ack.Config)
+	if err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	row, err := cr.queries.RecordDeviceConfigAck(ctx, db.RecordDeviceConfigAckParams{
+		Reported:     reported,
+		LastError:    ack.Error,
+		AckedVersion: ack.Version,
+		DeviceID:     deviceId,
+	})
+	if err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	return cr.dbToDomain(row)
+}
+
+func (cr *PgDeviceConfigRepo) dbToDomainSlice(rows []db.DeviceConfig) ([]devices.DeviceConfig, error) {
+	value := make([]devices.DeviceConfig, 0, len(rows))
+	for _, row := range rows {
+		c, err := cr.dbToDomain(row)
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, c)
+	}
+	return value, nil
+}
+
+func (cr *PgDeviceConfigRepo) dbToDomain(row db.DeviceConfig) (devices.DeviceConfig, error) {
+	c := devices.DeviceConfig{
+		DeviceID:       row.DeviceID,
+		DesiredVersion: row.DesiredVersion,
+		AckedVersion:   row.AckedVersion,
+		LastError:      row.LastError,
+		PushAttempts:   row.PushAttempts,
+		PushedAt:       row.PushedAt,
+		AckedAt:        row.AckedAt,
+		UpdatedAt:      row.UpdatedAt,
+	}
+	if err := json.Unmarshal(row.Desired, &c.Desired); err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	if err := json.Unmarshal(row.Reported, &c.Reported); err != nil {
+		return devices.DeviceConfig{}, err
+	}
+	return c, nil
+}
@@ -0,0 +1,70 @@
+package repos
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceConfigs(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	deviceRepo := NewPgDeviceRepo(appDb.GetQueries())
+	repo := NewPgDeviceConfigRepo(appDb.GetQueries())
+	ctx := t.Context()
+
+	d, err := deviceRepo.CreateDevice(ctx, devices.CreateDeviceParams{
+		Name:      "test" + generateRandomString(10),
+		DeviceUrl: "http://test" + generateRandomString(10) + ":1234",
+	})
+	a.NoError(err)
+	defer func() {
+		_ = deviceRepo.DeleteDevice(ctx, d.ID)
+	}()
+
+	desired := devices.CameraConfig{FrameSize: "UXGA", JpegQuality: 10, StreamFps: 4}
+	c, err := repo.SetDesiredConfig(ctx, d.ID, desired)
+	a.NoError(err)
+	a.Equal(int64(1), c.DesiredVersion)
+	a.Equal(desired, c.Desired)
+	a.False(c.Acked())
+
+	unacked, err := repo.ListUnackedConfigs(ctx, time.Now(), 3)
+	a.NoError(err)
+	a.True(containsConfig(unacked, d.ID), "new configs are due for a push")
+	a.NoError(repo.RecordConfigPush(ctx, d.ID))
+	unacked, err = repo.ListUnackedConfigs(ctx, time.Now().Add(-time.Minute), 3)
+	a.NoError(err)
+	a.False(containsConfig(unacked, d.ID), "recently pushed configs aren't")
+
+	failed, err := repo.RecordConfigAck(ctx, d.ID, devices.ConfigAck{Version: 1, Error: "framesize too large"})
+	a.NoError(err)
+	a.Equal(int64(0), failed.AckedVersion)
+	a.Equal("framesize too large", failed.LastError)
+	a.Equal(int32(1), failed.PushAttempts)
+
+	acked, err := repo.RecordConfigAck(ctx, d.ID, devices.ConfigAck{Version: 1, Config: desired})
+	a.NoError(err)
+	a.True(acked.Acked())
+	a.Equal(desired, acked.Reported)
+	a.Empty(acked.LastError)
+
+	c, err = repo.SetDesiredConfig(ctx, d.ID, devices.CameraConfig{FrameSize: "VGA", StreamFps: 10})
+	a.NoError(err)
+	a.Equal(int64(2), c.DesiredVersion)
+	a.False(c.Acked())
+}
+
+func containsConfig(configs []devices.DeviceConfig, deviceId int64) bool {
+	for _, c := range configs {
+		if c.DeviceID == deviceId {
+			return true
+		}
+	}
+	return false
+}
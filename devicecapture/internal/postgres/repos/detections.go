@@ -5,16 +5,19 @@ import (
 	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/logger"
 	"devicecapture/internal/postgres/db"
+	"slices"
 )
 
 // PgDetectionRepo implements devices.DetectionRepo
 type PgDetectionRepo struct {
 	queries *db.Queries
+	txs     TxBeginner
 }
 
-func NewPgDetectionRepo(queries *db.Queries) *PgDetectionRepo {
+func NewPgDetectionRepo(queries *db.Queries, txs TxBeginner) *PgDetectionRepo {
 	return &PgDetectionRepo{
 		queries: queries,
+		txs:     txs,
 	}
 }
 
@@ -34,24 +37,130 @@ func (d *PgDetectionRepo) CreateDetection(ctx context.Context, params devices.Cr
 	return d.dbToDomain(detect), nil
 }
 
+// CreateDetections creates the detections in one transaction, see createDetections
 func (d *PgDetectionRepo) CreateDetections(ctx context.Context, params []devices.CreateDetectionParams) ([]devices.Detection, error) {
 	var value []devices.Detection
-	for _, p := range params {
-		record, err := d.queries.CreateDetection(ctx, db.CreateDetectionParams{
+	err := inTx(ctx, d.txs, d.queries, func(q *db.Queries) error {
+		var err error
+		value, err = d.createDetections(ctx, q, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// CreateDetectionsWithMessages creates the detections & their outbox messages in one transaction
+func (d *PgDetectionRepo) CreateDetectionsWithMessages(ctx context.Context, params []devices.CreateDetectionParams, toMessage devices.OutboxMessageFunc) ([]devices.Detection, error) {
+	var value []devices.Detection
+	err := inTx(ctx, d.txs, d.queries, func(q *db.Queries) error {
+		var err error
+		value, err = d.createDetections(ctx, q, params)
+		if err != nil {
+			return err
+		}
+		return d.createMessages(ctx, q, value, toMessage)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// CreateImageDetections creates the image record, its detections & optionally their outbox messages
+// in one transaction
+func (d *PgDetectionRepo) CreateImageDetections(ctx context.Context, image devices.CreateImageParams, params []devices.CreateDetectionParams, toMessage devices.OutboxMessageFunc) (devices.DeviceImage, []devices.Detection, error) {
+	var img devices.DeviceImage
+	var value []devices.Detection
+	err := inTx(ctx, d.txs, d.queries, func(q *db.Queries) error {
+		record, err := q.CreateImage(ctx, db.CreateImageParams{
+			DeviceID:      image.DeviceID,
+			ImagePath:     image.ImagePath,
+			AnnotatedPath: image.AnnotatedPath,
+			SessionID:     image.SessionID,
+		})
+		if err != nil {
+			return err
+		}
+		img = imageToDomain(record)
+		withImage := make([]devices.CreateDetectionParams, len(params))
+		for i, p := range params {
+			p.ImageID = &img.ID
+			withImage[i] = p
+		}
+		value, err = d.createDetections(ctx, q, withImage)
+		if err != nil || toMessage == nil {
+			return err
+		}
+		return d.createMessages(ctx, q, value, toMessage)
+	})
+	if err != nil {
+		return devices.DeviceImage{}, nil, err
+	}
+	return img, value, nil
+}
+
+// createDetections inserts the detections with one COPY. COPY doesn't return the rows it inserts, so their IDs
+// are reserved first & the rows are read back by ID. q should be bound to a transaction so a failure part way
+// through doesn't leave some of them behind
+func (d *PgDetectionRepo) createDetections(ctx context.Context, q *db.Queries, params []devices.CreateDetectionParams) ([]devices.Detection, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	ids, err := q.ReserveDetectionIds(ctx, int32(len(params)))
+	if err != nil {
+		return nil, err
+	}
+	// Ascending, so the rows read back by ID are in the same order as params
+	slices.Sort(ids)
+	rows := make([]db.CreateDetectionsParams, len(params))
+	for i, p := range params {
+		rows[i] = db.CreateDetectionsParams{
+			ID:         ids[i],
 			DeviceID:   p.DeviceID,
 			Label:      p.Label,
 			Confidence: p.Confidence,
 			ImageID:    p.ImageID,
 			Bbox:       p.Bbox,
-		})
-		if err != nil {
-			return value, err
 		}
+	}
+	if _, err := q.CreateDetections(ctx, rows); err != nil {
+		return nil, err
+	}
+	records, err := q.GetDetectionsByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]devices.Detection, 0, len(records))
+	for _, record := range records {
 		value = append(value, d.dbToDomain(record))
 	}
 	return value, nil
 }
 
+// createMessages inserts the outbox message toMessage builds for each detection with one COPY, in the same order
+// as detections so the relay publishes them in that order
+func (d *PgDetectionRepo) createMessages(ctx context.Context, q *db.Queries, detections []devices.Detection, toMessage devices.OutboxMessageFunc) error {
+	if len(detections) == 0 {
+		return nil
+	}
+	rows := make([]db.CreateOutboxMessagesParams, len(detections))
+	for i, detection := range detections {
+		msg, err := toMessage(detection)
+		if err != nil {
+			return err
+		}
+		rows[i] = db.CreateOutboxMessagesParams{
+			MessageID: msg.MessageID,
+			Topic:     msg.Topic,
+			Payload:   msg.Payload,
+		}
+	}
+	_, err := q.CreateOutboxMessages(ctx, rows)
+	return err
+}
+
 // GetDetectionsAfter get all domain detections after the specified point in time
 func (d *PgDetectionRepo) GetDetectionsAfter(ctx context.Context, params devices.QueryParams) ([]devices.Detection, error) {
 	value, err := d.queries.GetDetectionsAfter(ctx, params.CreatedAt)
@@ -65,6 +174,19 @@ func (d *PgDetectionRepo) GetDetectionsAfter(ctx context.Context, params devices
 	return detections, nil
 }
 
+// GetDetectionsAfterId get at most limit detections with IDs after id, oldest first
+func (d *PgDetectionRepo) GetDetectionsAfterId(ctx context.Context, id int64, limit int32) ([]devices.Detection, error) {
+	value, err := d.queries.GetDetectionsAfterId(ctx, db.GetDetectionsAfterIdParams{ID: id, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	var detections []devices.Detection
+	for _, detection := range value {
+		detections = append(detections, d.dbToDomain(detection))
+	}
+	return detections, nil
+}
+
 // GetDeviceDetectionsAfter get detections for a given domain, after the specified point in time
 func (d *PgDetectionRepo) GetDeviceDetectionsAfter(ctx context.Context, params devices.QueryParams) ([]devices.Detection, error) {
 	dbParams, err := d.toDbQueryParams(params)
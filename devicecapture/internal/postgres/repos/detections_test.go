@@ -4,6 +4,7 @@ import (
 	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/postgres"
 	"github.com/stretchr/testify/assert"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -18,7 +19,7 @@ func TestCreateDetection(t *testing.T) {
 	assert.NoError(t, dbErr)
 	defer appDb.Db.Close()
 	q := appDb.GetQueries()
-	repo := NewPgDetectionRepo(q)
+	repo := NewPgDetectionRepo(q, appDb.Db)
 	testDevice, deviceErr := GetOrCreateTestDevice(t.Context(), q)
 	assert.NoError(t, deviceErr)
 	deviceId := testDevice.ID
@@ -94,7 +95,7 @@ func TestGetDetectionsAfter(t *testing.T) {
 	a.NoError(dbErr)
 	defer appDb.Db.Close()
 	q := appDb.GetQueries()
-	repo := NewPgDetectionRepo(q)
+	repo := NewPgDetectionRepo(q, appDb.Db)
 	testDevice, deviceErr := GetOrCreateTestDevice(t.Context(), q)
 	a.NoError(deviceErr)
 	deviceId := testDevice.ID
@@ -160,3 +161,173 @@ func TestGetDetectionsAfter(t *testing.T) {
 		}
 	})
 }
+
+func TestGetDetectionsAfterId(t *testing.T) {
+	appDb, dbErr := postgres.NewTestAppDb()
+	a := assert.New(t)
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	q := appDb.GetQueries()
+	repo := NewPgDetectionRepo(q, appDb.Db)
+	testDevice, deviceErr := GetOrCreateTestDevice(t.Context(), q)
+	a.NoError(deviceErr)
+
+	created, err := repo.CreateDetections(t.Context(), []devices.CreateDetectionParams{
+		{DeviceID: testDevice.ID, Label: "person", Confidence: 0.9, Bbox: validBbox},
+		{DeviceID: testDevice.ID, Label: "dog", Confidence: 0.8, Bbox: validBbox},
+		{DeviceID: testDevice.ID, Label: "cat", Confidence: 0.2, Bbox: validBbox},
+	})
+	if !a.NoError(err) || !a.Len(created, 3) {
+		return
+	}
+
+	value, err := repo.GetDetectionsAfterId(t.Context(), created[0].ID, 1)
+	a.NoError(err)
+	if a.Len(value, 1, "limited") {
+		a.Equal(created[1].ID, value[0].ID, "oldest first, excluding the ID itself")
+	}
+	value, err = repo.GetDetectionsAfterId(t.Context(), created[2].ID, 10)
+	a.NoError(err)
+	a.Empty(value)
+}
+
+func TestCreateDetections(t *testing.T) {
+	appDb, dbErr := postgres.NewTestAppDb()
+	a := assert.New(t)
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	q := appDb.GetQueries()
+	repo := NewPgDetectionRepo(q, appDb.Db)
+	testDevice, deviceErr := GetOrCreateTestDevice(t.Context(), q)
+	a.NoError(deviceErr)
+	deviceId := testDevice.ID
+
+	t.Run("returns_the_created_rows_in_order", func(t *testing.T) {
+		a := assert.New(t)
+		params := []devices.CreateDetectionParams{
+			{DeviceID: deviceId, Label: "person", Confidence: 0.9, Bbox: validBbox},
+			{DeviceID: deviceId, Label: "dog", Confidence: 0.8, Bbox: nil},
+			{DeviceID: deviceId, Label: "cat", Confidence: 0.2, Bbox: validBbox},
+		}
+		value, err := repo.CreateDetections(t.Context(), params)
+		a.NoError(err)
+		if !a.Len(value, len(params)) {
+			return
+		}
+		for i, d := range value {
+			a.NotZero(d.ID)
+			a.Equal(params[i].Label, d.Label)
+			a.Equal(params[i].Confidence, d.Confidence)
+			a.False(d.CreatedAt.IsZero())
+		}
+		a.Equal(validBbox, value[0].Bbox)
+	})
+
+	t.Run("all_or_nothing", func(t *testing.T) {
+		a := assert.New(t)
+		label := "partial-" + generateRandomString(10)
+		start := time.Now().Add(-time.Second)
+		_, err := repo.CreateDetections(t.Context(), []devices.CreateDetectionParams{
+			{DeviceID: deviceId, Label: label, Confidence: 0.9},
+			{DeviceID: -5, Label: label, Confidence: 0.9},
+		})
+		a.Error(err, "An error is thrown if a device ID is not in the database")
+		value, err := repo.GetDeviceDetectionsAfter(t.Context(), devices.QueryParams{DeviceID: deviceId, CreatedAt: start})
+		a.NoError(err)
+		for _, d := range value {
+			a.NotEqual(label, d.Label, "none of the batch is stored")
+		}
+	})
+
+	t.Run("create_image_detections", func(t *testing.T) {
+		a := assert.New(t)
+		ctx := t.Context()
+		suffix := generateRandomString(10)
+		img, value, err := repo.CreateImageDetections(ctx, devices.CreateImageParams{
+			DeviceID:      deviceId,
+			ImagePath:     "/videos/test_image_detections" + suffix + ".jpg",
+			AnnotatedPath: "/videos/test_image_detections" + suffix + "-annotated.jpg",
+		}, []devices.CreateDetectionParams{
+			{DeviceID: deviceId, Label: "dog", Confidence: 0.9, Bbox: validBbox},
+			{DeviceID: deviceId, Label: "cat", Confidence: 0.8, Bbox: validBbox},
+		}, nil)
+		a.NoError(err)
+		a.NotZero(img.ID)
+		a.Equal("/videos/test_image_detections"+suffix+"-annotated.jpg", img.AnnotatedPath)
+		a.Len(value, 2)
+		for _, d := range value {
+			a.Equal(&img.ID, d.ImageID)
+		}
+
+		imagePath := "/videos/test_image_detections_rollback" + suffix + ".jpg"
+		_, _, err = repo.CreateImageDetections(ctx, devices.CreateImageParams{DeviceID: deviceId, ImagePath: imagePath},
+			[]devices.CreateDetectionParams{{DeviceID: -5, Label: "dog", Confidence: 0.9}}, nil)
+		a.Error(err)
+		images, err := NewPgImageRepo(q).GetImages(ctx, deviceId)
+		a.NoError(err)
+		for _, i := range images {
+			a.NotEqual(imagePath, i.ImagePath, "the image isn't stored without its detections")
+		}
+	})
+}
+
+// BenchmarkCreateDetections a frame with 50 detections, CreateDetections' single COPY vs an INSERT per row, &
+// CreateImageDetections storing the frame, its detections & their outbox messages the way CameraService does
+func BenchmarkCreateDetections(b *testing.B) {
+	appDb, dbErr := postgres.NewTestAppDb()
+	if dbErr != nil {
+		b.Fatal(dbErr)
+	}
+	defer appDb.Db.Close()
+	q := appDb.GetQueries()
+	repo := NewPgDetectionRepo(q, appDb.Db)
+	testDevice, deviceErr := GetOrCreateTestDevice(b.Context(), q)
+	if deviceErr != nil {
+		b.Fatal(deviceErr)
+	}
+	params := make([]devices.CreateDetectionParams, 50)
+	for i := range params {
+		params[i] = devices.CreateDetectionParams{DeviceID: testDevice.ID, Label: "person", Confidence: 0.9, Bbox: validBbox}
+	}
+
+	b.Run("copy", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.CreateDetections(b.Context(), params); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("row_by_row", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, p := range params {
+				if _, err := repo.CreateDetection(b.Context(), p); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	run := strconv.FormatInt(time.Now().UnixNano(), 10)
+	toMessage := func(d devices.Detection) (devices.CreateOutboxParams, error) {
+		return devices.CreateOutboxParams{
+			MessageID: "bench-" + run + "-" + strconv.FormatInt(d.ID, 10),
+			Topic:     "detection/" + strconv.FormatInt(d.DeviceID, 10),
+			Payload:   []byte(`{"label":"person"}`),
+		}, nil
+	}
+	b.Run("image_with_messages", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			image := devices.CreateImageParams{DeviceID: testDevice.ID, ImagePath: "bench/" + run + "/" + strconv.Itoa(i) + ".jpeg"}
+			if _, _, err := repo.CreateImageDetections(b.Context(), image, params, toMessage); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"github.com/jackc/pgx/v5"
 	"strconv"
+	"time"
 )
 
 // PgDeviceRepo implements devices.DeviceRepository
@@ -57,31 +58,51 @@ func (dr *PgDeviceRepo) ListDevices(ctx context.Context) ([]devices.Device, erro
 
 // CreateDevice PgDeviceRepo implements devices.DeviceRepository
 func (dr *PgDeviceRepo) CreateDevice(ctx context.Context, params devices.CreateDeviceParams) (devices.Device, error) {
-	d, err := dr.queries.CreateDevice(ctx, db.CreateDeviceParams{Name: params.Name, DeviceUrl: params.DeviceUrl})
+	params = params.WithDefaults()
+	d, err := dr.queries.CreateDevice(ctx, db.CreateDeviceParams{
+		Name:            params.Name,
+		DeviceUrl:       params.DeviceUrl,
+		Location:        params.Location,
+		Tags:            params.Tags,
+		Timezone:        params.Timezone,
+		Enabled:         *params.Enabled,
+		Username:        params.Username,
+		Password:        params.Password,
+		FirmwareVersion: params.FirmwareVersion,
+		Resolution:      params.Resolution,
+		Capabilities:    params.Capabilities,
+	})
 	if err != nil {
 		return devices.Device{}, err
 	}
-	return devices.Device{
-		ID:        d.ID,
-		Name:      d.Name,
-		DeviceUrl: d.DeviceUrl,
-	}, nil
+	return dr.dbToDomain(d), nil
 }
 
 func (dr *PgDeviceRepo) UpdateDevice(ctx context.Context, params devices.UpdateDeviceParams) (devices.Device, error) {
-	err := dr.queries.UpdateDevice(ctx, db.UpdateDeviceParams{
-		ID:        params.ID,
-		Name:      params.Name,
-		DeviceUrl: params.DeviceUrl,
+	params = params.WithDefaults()
+	var password string
+	if params.Password != nil {
+		password = *params.Password
+	}
+	d, err := dr.queries.UpdateDevice(ctx, db.UpdateDeviceParams{
+		ID:              params.ID,
+		Name:            params.Name,
+		DeviceUrl:       params.DeviceUrl,
+		Location:        params.Location,
+		Tags:            params.Tags,
+		Timezone:        params.Timezone,
+		Enabled:         params.Enabled,
+		Username:        params.Username,
+		SetPassword:     params.Password != nil,
+		Password:        password,
+		FirmwareVersion: params.FirmwareVersion,
+		Resolution:      params.Resolution,
+		Capabilities:    params.Capabilities,
 	})
 	if err != nil {
 		return devices.Device{}, err
 	}
-	return devices.Device{
-		ID:        params.ID,
-		Name:      params.Name,
-		DeviceUrl: params.DeviceUrl,
-	}, nil
+	return dr.dbToDomain(d), nil
 }
 
 func (dr *PgDeviceRepo) DeleteDevice(ctx context.Context, id int64) error {
@@ -94,11 +115,36 @@ func (dr *PgDeviceRepo) DeleteTestDevices(ctx context.Context) error {
 	return err
 }
 
+func (dr *PgDeviceRepo) MuteDevice(ctx context.Context, deviceId int64, until time.Time) (devices.Device, error) {
+	if until.IsZero() {
+		// The column isn't nullable, so unmuted devices are "muted" until the epoch
+		until = time.Unix(0, 0)
+	}
+	d, err := dr.queries.MuteDevice(ctx, db.MuteDeviceParams{
+		MutedUntil: until,
+		ID:         deviceId,
+	})
+	if err != nil {
+		return devices.Device{}, err
+	}
+	return dr.dbToDomain(d), nil
+}
+
 func (dr *PgDeviceRepo) dbToDomain(d db.Device) devices.Device {
 	return devices.Device{
-		ID:        d.ID,
-		Name:      d.Name,
-		DeviceUrl: d.DeviceUrl,
+		ID:              d.ID,
+		Name:            d.Name,
+		DeviceUrl:       d.DeviceUrl,
+		Location:        d.Location,
+		Tags:            d.Tags,
+		Timezone:        d.Timezone,
+		Enabled:         d.Enabled,
+		Username:        d.Username,
+		Password:        d.Password,
+		FirmwareVersion: d.FirmwareVersion,
+		Resolution:      d.Resolution,
+		Capabilities:    d.Capabilities,
+		MutedUntil:      d.MutedUntil,
 	}
 }
 
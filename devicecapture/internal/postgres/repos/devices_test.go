@@ -58,6 +58,61 @@ func TestCreateDevices(t *testing.T) {
 	}
 }
 
+func TestUpdateDevice_Details(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	repo := NewPgDeviceRepo(appDb.GetQueries())
+	ctx := t.Context()
+
+	created, err := repo.CreateDevice(ctx, devices.CreateDeviceParams{
+		Name:      "test" + generateRandomString(10),
+		DeviceUrl: "http://test" + generateRandomString(10) + ":1234",
+		Username:  "admin",
+		Password:  "hunter2",
+	})
+	a.NoError(err)
+	a.True(created.Enabled, "devices are enabled by default")
+	a.Equal(devices.DefaultTimezone, created.Timezone)
+	a.Equal(devices.DefaultCapabilities, created.Capabilities)
+	defer func() {
+		_ = repo.DeleteDevice(ctx, created.ID)
+	}()
+
+	updated, err := repo.UpdateDevice(ctx, devices.UpdateDeviceParams{
+		ID:              created.ID,
+		Name:            created.Name,
+		DeviceUrl:       created.DeviceUrl,
+		Location:        "garage",
+		Tags:            []string{"outdoor"},
+		Timezone:        "America/Chicago",
+		Enabled:         new(bool),
+		Username:        "admin",
+		FirmwareVersion: "1.2.0",
+		Resolution:      "UXGA",
+		Capabilities:    []string{devices.CapabilitySnapshot, devices.CapabilityFlash},
+	})
+	a.NoError(err)
+	a.Equal("garage", updated.Location)
+	a.Equal([]string{"outdoor"}, updated.Tags)
+	a.False(updated.Enabled)
+	a.True(updated.HasCapability(devices.CapabilityFlash))
+	a.Equal("hunter2", updated.Password, "the password is kept when it's omitted")
+
+	cleared := ""
+	updated, err = repo.UpdateDevice(ctx, devices.UpdateDeviceParams{
+		ID:        created.ID,
+		Name:      created.Name,
+		DeviceUrl: created.DeviceUrl,
+		Password:  &cleared,
+	})
+	a.NoError(err)
+	a.Empty(updated.Password)
+	a.False(updated.Enabled, "omitted flags & capabilities are kept")
+	a.Equal([]string{devices.CapabilitySnapshot, devices.CapabilityFlash}, updated.Capabilities)
+}
+
 //
 //func TestList_And_UpdateDevices(t *testing.T) {
 //	a := assert.New(t)
@@ -0,0 +1,87 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres/db"
+)
+
+// PgDiscoveryRepo implements devices.DiscoveryRepo
+type PgDiscoveryRepo struct {
+	queries *db.Queries
+}
+
+func NewPgDiscoveryRepo(queries *db.Queries) *PgDiscoveryRepo {
+	return &PgDiscoveryRepo{
+		queries: queries,
+	}
+}
+
+// UpsertDiscoveredDevice record an announcement, keeping the status of devices we've already seen
+func (dr *PgDiscoveryRepo) UpsertDiscoveredDevice(ctx context.Context, a devices.Announcement) (devices.DiscoveredDevice, error) {
+	capabilities := a.Capabilities
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+	d, err := dr.queries.UpsertDiscoveredDevice(ctx, db.UpsertDiscoveredDeviceParams{
+		Mac:             a.Mac,
+		Name:            a.Name,
+		DeviceUrl:       a.DeviceUrl,
+		FirmwareVersion: a.FirmwareVersion,
+		Resolution:      a.Resolution,
+		Capabilities:    capabilities,
+	})
+	if err != nil {
+		return devices.DiscoveredDevice{}, err
+	}
+	return dr.dbToDomain(d), nil
+}
+
+func (dr *PgDiscoveryRepo) GetDiscoveredDevice(ctx context.Context, id int64) (devices.DiscoveredDevice, error) {
+	d, err := dr.queries.GetDiscoveredDevice(ctx, id)
+	if err != nil {
+		return devices.DiscoveredDevice{}, err
+	}
+	return dr.dbToDomain(d), nil
+}
+
+// ListDiscoveredDevices most recently seen first, an empty status lists every device
+func (dr *PgDiscoveryRepo) ListDiscoveredDevices(ctx context.Context, status string) ([]devices.DiscoveredDevice, error) {
+	rows, err := dr.queries.ListDiscoveredDevices(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]devices.DiscoveredDevice, len(rows))
+	for i, d := range rows {
+		result[i] = dr.dbToDomain(d)
+	}
+	return result, nil
+}
+
+func (dr *PgDiscoveryRepo) SetDiscoveredDeviceStatus(ctx context.Context, id int64, status string, deviceId *int64) (devices.DiscoveredDevice, error) {
+	d, err := dr.queries.SetDiscoveredDeviceStatus(ctx, db.SetDiscoveredDeviceStatusParams{
+		Status:   status,
+		DeviceID: deviceId,
+		ID:       id,
+	})
+	if err != nil {
+		return devices.DiscoveredDevice{}, err
+	}
+	return dr.dbToDomain(d), nil
+}
+
+func (dr *PgDiscoveryRepo) dbToDomain(d db.DiscoveredDevice) devices.DiscoveredDevice {
+	return devices.DiscoveredDevice{
+		ID:              d.ID,
+		Mac:             d.Mac,
+		Name:            d.Name,
+		DeviceUrl:       d.DeviceUrl,
+		FirmwareVersion: d.FirmwareVersion,
+		Resolution:      d.Resolution,
+		Capabilities:    d.Capabilities,
+		Status:          d.Status,
+		DeviceID:        d.DeviceID,
+		FirstSeenAt:     d.FirstSeenAt,
+		LastSeenAt:      d.LastSeenAt,
+	}
+}
@@ -0,0 +1,58 @@
+package repos
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoveredDevices(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	q := appDb.GetQueries()
+	repo := NewPgDiscoveryRepo(q)
+	ctx := t.Context()
+	defer func() {
+		_, _ = appDb.Db.Exec(ctx, "DELETE FROM discovered_devices WHERE mac = 'de:ad:be:ef:00:ff'")
+	}()
+
+	announcement := devices.Announcement{
+		Mac:          "de:ad:be:ef:00:ff",
+		Name:         "esp32-cam",
+		DeviceUrl:    "http://10.0.0.20",
+		Capabilities: []string{devices.CapabilitySnapshot},
+	}
+	d, err := repo.UpsertDiscoveredDevice(ctx, announcement)
+	a.NoError(err)
+	a.Equal(devices.DiscoveryPending, d.Status)
+	a.Nil(d.DeviceID)
+
+	testDevice, err := GetOrCreateTestDevice(ctx, q)
+	a.NoError(err)
+	approved, err := repo.SetDiscoveredDeviceStatus(ctx, d.ID, devices.DiscoveryApproved, &testDevice.ID)
+	a.NoError(err)
+	a.Equal(devices.DiscoveryApproved, approved.Status)
+
+	announcement.DeviceUrl = "http://10.0.0.21"
+	again, err := repo.UpsertDiscoveredDevice(ctx, announcement)
+	a.NoError(err)
+	a.Equal(d.ID, again.ID, "devices are unique by MAC")
+	a.Equal("http://10.0.0.21", again.DeviceUrl)
+	a.Equal(devices.DiscoveryApproved, again.Status, "announcing again keeps the status")
+	if a.NotNil(again.DeviceID) {
+		a.Equal(testDevice.ID, *again.DeviceID)
+	}
+
+	pending, err := repo.ListDiscoveredDevices(ctx, devices.DiscoveryPending)
+	a.NoError(err)
+	for _, p := range pending {
+		a.NotEqual(d.ID, p.ID)
+	}
+	all, err := repo.ListDiscoveredDevices(ctx, "")
+	a.NoError(err)
+	a.NotEmpty(all)
+}
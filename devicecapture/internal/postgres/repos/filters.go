@@ -0,0 +1,110 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres/db"
+	"encoding/json"
+)
+
+// PgDetectionFilterRepo implements devices.DetectionFilterRepo
+type PgDetectionFilterRepo struct {
+	queries *db.Queries
+}
+
+func NewPgDetectionFilterRepo(queries *db.Queries) *PgDetectionFilterRepo {
+	return &PgDetectionFilterRepo{
+		queries: queries,
+	}
+}
+
+// GetDetectionFilters get the global filter & the filter for a given device
+func (fr *PgDetectionFilterRepo) GetDetectionFilters(ctx context.Context, deviceId int64) ([]devices.DetectionFilter, error) {
+	rows, err := fr.queries.GetDetectionFilters(ctx, &deviceId)
+	if err != nil {
+		return nil, err
+	}
+	return fr.dbToDomainSlice(rows)
+}
+
+// ListDetectionFilters get every configured filter, global first
+func (fr *PgDetectionFilterRepo) ListDetectionFilters(ctx context.Context) ([]devices.DetectionFilter, error) {
+	rows, err := fr.queries.ListDetectionFilters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fr.dbToDomainSlice(rows)
+}
+
+// UpsertDetectionFilter create or replace the filter for params.DeviceID
+func (fr *PgDetectionFilterRepo) UpsertDetectionFilter(ctx context.Context, params devices.UpsertDetectionFilterParams) (devices.DetectionFilter, error) {
+	labelConfidence, err := json.Marshal(nonNilMap(params.LabelConfidence))
+	if err != nil {
+		return devices.DetectionFilter{}, err
+	}
+	aliases, err := json.Marshal(nonNilMap(params.Aliases))
+	if err != nil {
+		return devices.DetectionFilter{}, err
+	}
+	record, err := fr.queries.UpsertDetectionFilter(ctx, db.UpsertDetectionFilterParams{
+		DeviceID:        params.DeviceID,
+		MinConfidence:   params.MinConfidence,
+		LabelConfidence: labelConfidence,
+		AllowLabels:     nonNilSlice(params.AllowLabels),
+		DenyLabels:      nonNilSlice(params.DenyLabels),
+		Aliases:         aliases,
+	})
+	if err != nil {
+		return devices.DetectionFilter{}, err
+	}
+	return fr.dbToDomain(record)
+}
+
+// DeleteDetectionFilter delete the filter for a given device, nil deletes the global filter
+func (fr *PgDetectionFilterRepo) DeleteDetectionFilter(ctx context.Context, deviceId *int64) error {
+	return fr.queries.DeleteDetectionFilter(ctx, deviceId)
+}
+
+func (fr *PgDetectionFilterRepo) dbToDomainSlice(rows []db.DetectionFilter) ([]devices.DetectionFilter, error) {
+	var value []devices.DetectionFilter
+	for _, row := range rows {
+		f, err := fr.dbToDomain(row)
+		if err != nil {
+			return nil, err
+		}
+		value = append(value, f)
+	}
+	return value, nil
+}
+
+func (fr *PgDetectionFilterRepo) dbToDomain(row db.DetectionFilter) (devices.DetectionFilter, error) {
+	f := devices.DetectionFilter{
+		ID:            row.ID,
+		DeviceID:      row.DeviceID,
+		MinConfidence: row.MinConfidence,
+		AllowLabels:   row.AllowLabels,
+		DenyLabels:    row.DenyLabels,
+		UpdatedAt:     row.UpdatedAt,
+	}
+	if err := json.Unmarshal(row.LabelConfidence, &f.LabelConfidence); err != nil {
+		return devices.DetectionFilter{}, err
+	}
+	if err := json.Unmarshal(row.Aliases, &f.Aliases); err != nil {
+		return devices.DetectionFilter{}, err
+	}
+	return f, nil
+}
+
+func nonNilMap[V any](m map[string]V) map[string]V {
+	if m == nil {
+		return map[string]V{}
+	}
+	return m
+}
+
+func nonNilSlice(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
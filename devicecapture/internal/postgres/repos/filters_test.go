@@ -0,0 +1,56 @@
+package repos
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Upsert_DetectionFilters(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	q := appDb.GetQueries()
+	repo := NewPgDetectionFilterRepo(q)
+	testDevice, deviceErr := GetOrCreateTestDevice(t.Context(), q)
+	a.NoError(deviceErr)
+	ctx := t.Context()
+
+	global, err := repo.UpsertDetectionFilter(ctx, devices.UpsertDetectionFilterParams{
+		MinConfidence: 0.4,
+		DenyLabels:    []string{"train"},
+	})
+	a.NoError(err, "we can create the global filter")
+	a.Nil(global.DeviceID)
+
+	params := devices.UpsertDetectionFilterParams{
+		DeviceID:        &testDevice.ID,
+		MinConfidence:   0.6,
+		LabelConfidence: map[string]float64{"person": 0.3},
+		AllowLabels:     []string{"person", "vehicle"},
+		Aliases:         map[string]string{"car": "vehicle"},
+	}
+	created, err := repo.UpsertDetectionFilter(ctx, params)
+	a.NoError(err, "we can create device filters")
+	a.Equal(map[string]string{"car": "vehicle"}, created.Aliases)
+
+	params.MinConfidence = 0.7
+	updated, err := repo.UpsertDetectionFilter(ctx, params)
+	a.NoError(err, "upserting the same device updates the existing filter")
+	a.Equal(created.ID, updated.ID)
+	a.Equal(0.7, updated.MinConfidence)
+
+	filters, err := repo.GetDetectionFilters(ctx, testDevice.ID)
+	a.NoError(err)
+	if a.Len(filters, 2, "global & device filters are returned") {
+		a.Nil(filters[0].DeviceID, "the global filter comes first")
+	}
+
+	a.NoError(repo.DeleteDetectionFilter(ctx, &testDevice.ID))
+	a.NoError(repo.DeleteDetectionFilter(ctx, nil))
+	filters, err = repo.GetDetectionFilters(ctx, testDevice.ID)
+	a.NoError(err)
+	a.Empty(filters)
+}
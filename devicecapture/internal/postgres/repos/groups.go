@@ -0,0 +1,118 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres/db"
+)
+
+// CreateGroup PgDeviceRepo implements devices.DeviceRepository
+func (dr *PgDeviceRepo) CreateGroup(ctx context.Context, params devices.CreateGroupParams) (devices.Group, error) {
+	g, err := dr.queries.CreateDeviceGroup(ctx, db.CreateDeviceGroupParams{
+		Name:        params.Name,
+		Description: params.Description,
+	})
+	if err != nil {
+		return devices.Group{}, err
+	}
+	return groupToDomain(g, []int64{}), nil
+}
+
+// GetGroup PgDeviceRepo implements devices.DeviceRepository
+func (dr *PgDeviceRepo) GetGroup(ctx context.Context, groupId int64) (devices.Group, error) {
+	g, err := dr.queries.GetDeviceGroup(ctx, groupId)
+	if err != nil {
+		return devices.Group{}, err
+	}
+	members, err := dr.queries.GetDeviceGroupDevices(ctx, groupId)
+	if err != nil {
+		return devices.Group{}, err
+	}
+	deviceIds := make([]int64, len(members))
+	for i, d := range members {
+		deviceIds[i] = d.ID
+	}
+	return groupToDomain(g, deviceIds), nil
+}
+
+// ListGroups PgDeviceRepo implements devices.DeviceRepository
+func (dr *PgDeviceRepo) ListGroups(ctx context.Context) ([]devices.Group, error) {
+	groups, err := dr.queries.ListDeviceGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members, err := dr.queries.ListDeviceGroupMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deviceIds := map[int64][]int64{}
+	for _, m := range members {
+		deviceIds[m.GroupID] = append(deviceIds[m.GroupID], m.DeviceID)
+	}
+	result := make([]devices.Group, len(groups))
+	for i, g := range groups {
+		ids := deviceIds[g.ID]
+		if ids == nil {
+			ids = []int64{}
+		}
+		result[i] = groupToDomain(g, ids)
+	}
+	return result, nil
+}
+
+// UpdateGroup PgDeviceRepo implements devices.DeviceRepository
+func (dr *PgDeviceRepo) UpdateGroup(ctx context.Context, params devices.UpdateGroupParams) (devices.Group, error) {
+	_, err := dr.queries.UpdateDeviceGroup(ctx, db.UpdateDeviceGroupParams{
+		Name:        params.Name,
+		Description: params.Description,
+		ID:          params.ID,
+	})
+	if err != nil {
+		return devices.Group{}, err
+	}
+	return dr.GetGroup(ctx, params.ID)
+}
+
+// DeleteGroup PgDeviceRepo implements devices.DeviceRepository
+func (dr *PgDeviceRepo) DeleteGroup(ctx context.Context, groupId int64) error {
+	return dr.queries.DeleteDeviceGroup(ctx, groupId)
+}
+
+// AddGroupDevice PgDeviceRepo implements devices.DeviceRepository
+func (dr *PgDeviceRepo) AddGroupDevice(ctx context.Context, groupId int64, deviceId int64) error {
+	return dr.queries.AddDeviceGroupMember(ctx, db.AddDeviceGroupMemberParams{
+		GroupID:  groupId,
+		DeviceID: deviceId,
+	})
+}
+
+// RemoveGroupDevice PgDeviceRepo implements devices.DeviceRepository
+func (dr *PgDeviceRepo) RemoveGroupDevice(ctx context.Context, groupId int64, deviceId int64) error {
+	return dr.queries.RemoveDeviceGroupMember(ctx, db.RemoveDeviceGroupMemberParams{
+		GroupID:  groupId,
+		DeviceID: deviceId,
+	})
+}
+
+// ListGroupDevices PgDeviceRepo implements devices.DeviceRepository
+func (dr *PgDeviceRepo) ListGroupDevices(ctx context.Context, groupId int64) ([]devices.Device, error) {
+	ds, err := dr.queries.GetDeviceGroupDevices(ctx, groupId)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]devices.Device, len(ds))
+	for i, d := range ds {
+		result[i] = dr.dbToDomain(d)
+	}
+	return result, nil
+}
+
+func groupToDomain(g db.DeviceGroup, deviceIds []int64) devices.Group {
+	return devices.Group{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		CreatedAt:   g.CreatedAt,
+		DeviceIDs:   deviceIds,
+	}
+}
@@ -0,0 +1,91 @@
+package repos
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceGroups(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	repo := NewPgDeviceRepo(appDb.GetQueries())
+	ctx := t.Context()
+
+	d, err := repo.CreateDevice(ctx, devices.CreateDeviceParams{
+		Name:      "test" + generateRandomString(10),
+		DeviceUrl: "http://test" + generateRandomString(10) + ":1234",
+	})
+	a.NoError(err)
+	defer func() {
+		_ = repo.DeleteDevice(ctx, d.ID)
+	}()
+
+	g, err := repo.CreateGroup(ctx, devices.CreateGroupParams{Name: "test" + generateRandomString(10), Description: "outdoor"})
+	a.NoError(err)
+	defer func() {
+		_ = repo.DeleteGroup(ctx, g.ID)
+	}()
+	a.Empty(g.DeviceIDs)
+	_, err = repo.CreateGroup(ctx, devices.CreateGroupParams{Name: g.Name})
+	a.Error(err, "group names are unique")
+
+	a.NoError(repo.AddGroupDevice(ctx, g.ID, d.ID))
+	a.NoError(repo.AddGroupDevice(ctx, g.ID, d.ID), "adding a member twice is a no-op")
+	got, err := repo.GetGroup(ctx, g.ID)
+	a.NoError(err)
+	a.Equal([]int64{d.ID}, got.DeviceIDs)
+	members, err := repo.ListGroupDevices(ctx, g.ID)
+	a.NoError(err)
+	if a.Len(members, 1) {
+		a.Equal(d.Name, members[0].Name)
+	}
+	groups, err := repo.ListGroups(ctx)
+	a.NoError(err)
+	for _, lg := range groups {
+		if lg.ID == g.ID {
+			a.Equal([]int64{d.ID}, lg.DeviceIDs)
+		}
+	}
+
+	updated, err := repo.UpdateGroup(ctx, devices.UpdateGroupParams{ID: g.ID, Name: g.Name, Description: "indoor"})
+	a.NoError(err)
+	a.Equal("indoor", updated.Description)
+	a.Equal([]int64{d.ID}, updated.DeviceIDs)
+
+	a.NoError(repo.RemoveGroupDevice(ctx, g.ID, d.ID))
+	members, err = repo.ListGroupDevices(ctx, g.ID)
+	a.NoError(err)
+	a.Empty(members)
+}
+
+func TestMuteDevice(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	repo := NewPgDeviceRepo(appDb.GetQueries())
+	ctx := t.Context()
+
+	d, err := repo.CreateDevice(ctx, devices.CreateDeviceParams{
+		Name:      "test" + generateRandomString(10),
+		DeviceUrl: "http://test" + generateRandomString(10) + ":1234",
+	})
+	a.NoError(err)
+	defer func() {
+		_ = repo.DeleteDevice(ctx, d.ID)
+	}()
+	a.False(d.IsMuted(time.Now()), "devices aren't muted by default")
+
+	muted, err := repo.MuteDevice(ctx, d.ID, time.Now().Add(time.Hour))
+	a.NoError(err)
+	a.True(muted.IsMuted(time.Now()))
+	unmuted, err := repo.MuteDevice(ctx, d.ID, time.Time{})
+	a.NoError(err)
+	a.False(unmuted.IsMuted(time.Now()))
+}
@@ -4,8 +4,12 @@ import (
 	"context"
 	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/postgres/db"
+	"strings"
 )
 
+// likeEscaper escapes LIKE's wildcards, so keys are matched literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 type PgImageRepo struct {
 	queries *db.Queries
 }
@@ -16,13 +20,15 @@ func NewPgImageRepo(q *db.Queries) *PgImageRepo {
 
 func (ir *PgImageRepo) CreateImage(ctx context.Context, params devices.CreateImageParams) (devices.DeviceImage, error) {
 	dbImg, err := ir.queries.CreateImage(ctx, db.CreateImageParams{
-		DeviceID:  params.DeviceID,
-		ImagePath: params.ImagePath,
+		DeviceID:      params.DeviceID,
+		ImagePath:     params.ImagePath,
+		AnnotatedPath: params.AnnotatedPath,
+		SessionID:     params.SessionID,
 	})
 	if err != nil {
 		return devices.DeviceImage{}, err
 	}
-	return ir.toDomain(dbImg), nil
+	return imageToDomain(dbImg), nil
 }
 
 func (ir *PgImageRepo) GetImages(ctx context.Context, deviceId int64) ([]devices.DeviceImage, error) {
@@ -33,16 +39,74 @@ func (ir *PgImageRepo) GetImages(ctx context.Context, deviceId int64) ([]devices
 	}
 	var list []devices.DeviceImage
 	for _, img := range imgs {
-		list = append(list, ir.toDomain(img))
+		list = append(list, imageToDomain(img))
+	}
+	return list, nil
+}
+
+func (ir *PgImageRepo) GetImage(ctx context.Context, id int64) (devices.DeviceImage, error) {
+	dbImg, err := ir.queries.GetImage(ctx, id)
+	if err != nil {
+		return devices.DeviceImage{}, err
+	}
+	return imageToDomain(dbImg), nil
+}
+
+func (ir *PgImageRepo) GetImagesByPrefix(ctx context.Context, prefix string) ([]devices.DeviceImage, error) {
+	imgs, err := ir.queries.GetImagesByPattern(ctx, likeEscaper.Replace(prefix)+"%")
+	if err != nil {
+		return nil, err
+	}
+	var list []devices.DeviceImage
+	for _, img := range imgs {
+		list = append(list, imageToDomain(img))
 	}
 	return list, nil
 }
 
-func (ir *PgImageRepo) toDomain(dbImg db.DeviceImage) devices.DeviceImage {
+func (ir *PgImageRepo) GetSessionImages(ctx context.Context, sessionId int64) ([]devices.DeviceImage, error) {
+	imgs, err := ir.queries.GetSessionImages(ctx, &sessionId)
+	if err != nil {
+		return nil, err
+	}
+	var list []devices.DeviceImage
+	for _, img := range imgs {
+		list = append(list, imageToDomain(img))
+	}
+	return list, nil
+}
+
+func (ir *PgImageRepo) GetLatestDeviceImage(ctx context.Context, deviceId int64) (devices.DeviceImage, error) {
+	dbImg, err := ir.queries.GetLatestDeviceImage(ctx, deviceId)
+	if err != nil {
+		return devices.DeviceImage{}, err
+	}
+	return imageToDomain(dbImg), nil
+}
+
+func (ir *PgImageRepo) SetAnnotatedPath(ctx context.Context, id int64, annotatedPath string) (devices.DeviceImage, error) {
+	dbImg, err := ir.queries.SetImageAnnotatedPath(ctx, db.SetImageAnnotatedPathParams{
+		AnnotatedPath: annotatedPath,
+		ID:            id,
+	})
+	if err != nil {
+		return devices.DeviceImage{}, err
+	}
+	return imageToDomain(dbImg), nil
+}
+
+func (ir *PgImageRepo) DeleteImage(ctx context.Context, id int64) error {
+	return ir.queries.DeleteImage(ctx, id)
+}
+
+// imageToDomain convert a db.DeviceImage to a devices.DeviceImage
+func imageToDomain(dbImg db.DeviceImage) devices.DeviceImage {
 	return devices.DeviceImage{
-		ID:        dbImg.ID,
-		DeviceID:  dbImg.DeviceID,
-		CreatedAt: dbImg.CreatedAt,
-		ImagePath: dbImg.ImagePath,
+		ID:            dbImg.ID,
+		DeviceID:      dbImg.DeviceID,
+		CreatedAt:     dbImg.CreatedAt,
+		ImagePath:     dbImg.ImagePath,
+		AnnotatedPath: dbImg.AnnotatedPath,
+		SessionID:     dbImg.SessionID,
 	}
 }
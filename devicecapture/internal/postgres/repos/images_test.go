@@ -117,3 +117,35 @@ func Test_Get_Images(t *testing.T) {
 		}
 	}
 }
+
+func Test_Get_Images_By_Prefix(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	q := appDb.GetQueries()
+	repo := NewPgImageRepo(q)
+	testDevice, deviceErr := GetOrCreateTestDevice(t.Context(), q)
+	a.NoError(deviceErr)
+
+	// A recording & one whose prefix matches it if _ isn't escaped
+	dir := "/videos" + generateRandomString(30)
+	paths := []string{dir + "_1/test-1.jpeg", dir + "_1/test-2.jpeg", dir + "x1/test-3.jpeg"}
+	for _, p := range paths {
+		_, err := repo.CreateImage(t.Context(), devices.CreateImageParams{DeviceID: testDevice.ID, ImagePath: p})
+		a.NoError(err)
+	}
+
+	results, err := repo.GetImagesByPrefix(t.Context(), dir+"_1/")
+	a.NoError(err)
+	if a.Len(results, 2, "wildcards in the prefix are escaped") {
+		a.Equal(paths[0], results[0].ImagePath, "oldest first")
+		a.Equal(paths[1], results[1].ImagePath)
+	}
+
+	latest, err := repo.GetLatestDeviceImage(t.Context(), testDevice.ID)
+	a.NoError(err)
+	a.Equal(paths[2], latest.ImagePath)
+	_, err = repo.GetLatestDeviceImage(t.Context(), -12)
+	a.Error(err, "devices without images have no latest image")
+}
@@ -0,0 +1,21 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/postgres"
+	"os"
+	"testing"
+)
+
+// TestMain migrates the test database before the repo tests run against it
+func TestMain(m *testing.M) {
+	appDb, err := postgres.NewTestAppDb()
+	if err == nil {
+		err = appDb.Migrate(context.Background())
+		appDb.Db.Close()
+	}
+	if err != nil {
+		_, _ = os.Stderr.WriteString("migrating the test database: " + err.Error() + "\n")
+	}
+	os.Exit(m.Run())
+}
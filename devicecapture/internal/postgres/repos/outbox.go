@@ -0,0 +1,71 @@
+package repos
+
+import (
+	"cmp"
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres/db"
+	"slices"
+	"time"
+)
+
+// PgOutboxRepo implements devices.OutboxRepo
+type PgOutboxRepo struct {
+	queries *db.Queries
+}
+
+func NewPgOutboxRepo(queries *db.Queries) *PgOutboxRepo {
+	return &PgOutboxRepo{
+		queries: queries,
+	}
+}
+
+func (or *PgOutboxRepo) ClaimOutboxMessages(ctx context.Context, limit int32, lease time.Duration) ([]devices.OutboxMessage, error) {
+	rows, err := or.queries.ClaimOutboxMessages(ctx, db.ClaimOutboxMessagesParams{
+		ClaimedUntil: time.Now().Add(lease),
+		MaxMessages:  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// UPDATE ... RETURNING doesn't keep the subquery's order
+	slices.SortFunc(rows, func(a, b db.OutboxMessage) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	var messages []devices.OutboxMessage
+	for _, row := range rows {
+		messages = append(messages, or.dbToDomain(row))
+	}
+	return messages, nil
+}
+
+func (or *PgOutboxRepo) MarkOutboxMessageSent(ctx context.Context, id int64) error {
+	return or.queries.MarkOutboxMessageSent(ctx, id)
+}
+
+func (or *PgOutboxRepo) RecordOutboxMessageFailure(ctx context.Context, id int64, lastError string) error {
+	if len(lastError) > 1000 {
+		lastError = lastError[:1000]
+	}
+	return or.queries.RecordOutboxMessageFailure(ctx, db.RecordOutboxMessageFailureParams{
+		LastError: lastError,
+		ID:        id,
+	})
+}
+
+func (or *PgOutboxRepo) DeleteSentOutboxMessages(ctx context.Context, sentBefore time.Time) (int64, error) {
+	return or.queries.DeleteSentOutboxMessages(ctx, sentBefore)
+}
+
+func (or *PgOutboxRepo) dbToDomain(row db.OutboxMessage) devices.OutboxMessage {
+	return devices.OutboxMessage{
+		ID:        row.ID,
+		MessageID: row.MessageID,
+		Topic:     row.Topic,
+		Payload:   row.Payload,
+		Attempts:  row.Attempts,
+		LastError: row.LastError,
+		CreatedAt: row.CreatedAt,
+		SentAt:    fromEpoch(row.SentAt),
+	}
+}
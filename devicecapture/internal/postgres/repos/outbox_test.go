@@ -0,0 +1,78 @@
+package repos
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	q := appDb.GetQueries()
+	detectionRepo := NewPgDetectionRepo(q, appDb.Db)
+	outboxRepo := NewPgOutboxRepo(q)
+	testDevice, deviceErr := GetOrCreateTestDevice(ctx, q)
+	a.NoError(deviceErr)
+
+	suffix := generateRandomString(10)
+	toMessage := func(d devices.Detection) (devices.CreateOutboxParams, error) {
+		return devices.CreateOutboxParams{
+			MessageID: "outbox-test-" + suffix + "-" + d.Label,
+			Topic:     "detection/1",
+			Payload:   []byte(d.Label),
+		}, nil
+	}
+	params := []devices.CreateDetectionParams{
+		{DeviceID: testDevice.ID, Label: "dog", Confidence: 0.9, Bbox: validBbox},
+		{DeviceID: testDevice.ID, Label: "cat", Confidence: 0.8, Bbox: validBbox},
+	}
+	ds, err := detectionRepo.CreateDetectionsWithMessages(ctx, params, toMessage)
+	a.NoError(err)
+	a.Len(ds, 2)
+
+	t.Run("duplicate_message_ids_roll_back", func(t *testing.T) {
+		a := assert.New(t)
+		start := time.Now().Add(-time.Second)
+		_, err := detectionRepo.CreateDetectionsWithMessages(ctx, []devices.CreateDetectionParams{
+			{DeviceID: testDevice.ID, Label: "dog-" + suffix, Confidence: 0.9},
+			{DeviceID: testDevice.ID, Label: "dog", Confidence: 0.9},
+		}, toMessage)
+		a.Error(err)
+		after, err := detectionRepo.GetDeviceDetectionsAfter(ctx, devices.QueryParams{DeviceID: testDevice.ID, CreatedAt: start})
+		a.NoError(err)
+		for _, d := range after {
+			a.NotEqual("dog-"+suffix, d.Label, "the detection isn't stored without its message")
+		}
+	})
+
+	t.Run("claim_and_send", func(t *testing.T) {
+		a := assert.New(t)
+		claimed, err := outboxRepo.ClaimOutboxMessages(ctx, 1000, time.Minute)
+		a.NoError(err)
+		mine := map[string]devices.OutboxMessage{}
+		for _, m := range claimed {
+			mine[m.MessageID] = m
+		}
+		dog, ok := mine["outbox-test-"+suffix+"-dog"]
+		a.True(ok, "pending messages are claimed")
+		a.Equal("dog", string(dog.Payload))
+		a.False(dog.Sent())
+
+		again, err := outboxRepo.ClaimOutboxMessages(ctx, 1000, time.Minute)
+		a.NoError(err)
+		for _, m := range again {
+			a.NotEqual(dog.ID, m.ID, "claimed messages can't be claimed again until their lease expires")
+		}
+
+		a.NoError(outboxRepo.RecordOutboxMessageFailure(ctx, dog.ID, "broker down"))
+		a.NoError(outboxRepo.MarkOutboxMessageSent(ctx, dog.ID))
+		_, err = outboxRepo.DeleteSentOutboxMessages(ctx, time.Now().Add(time.Minute))
+		a.NoError(err)
+	})
+}
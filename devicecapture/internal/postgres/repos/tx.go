@@ -0,0 +1,37 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/postgres/db"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TxBeginner starts transactions, ex: a *pgxpool.Pool
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// inTx runs fn with queries bound to a transaction, committing if it returns nil & rolling back otherwise
+func inTx(ctx context.Context, txs TxBeginner, queries *db.Queries, fn func(q *db.Queries) error) error {
+	return pgx.BeginFunc(ctx, txs, func(tx pgx.Tx) error {
+		return fn(queries.WithTx(tx))
+	})
+}
+
+// fromEpoch columns that aren't nullable default to the epoch, that's the zero time in the domain
+func fromEpoch(t time.Time) time.Time {
+	if t.Unix() == 0 {
+		return time.Time{}
+	}
+	return t
+}
+
+// toEpoch the zero time is stored as the epoch, see fromEpoch
+func toEpoch(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Unix(0, 0)
+	}
+	return t
+}
@@ -0,0 +1,222 @@
+package repos
+
+import (
+	"context"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres/db"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PgUserRepo implements devices.UserRepo
+type PgUserRepo struct {
+	queries *db.Queries
+}
+
+func NewPgUserRepo(queries *db.Queries) *PgUserRepo {
+	return &PgUserRepo{
+		queries: queries,
+	}
+}
+
+func (ur *PgUserRepo) CreateUser(ctx context.Context, params devices.CreateUserParams) (devices.User, error) {
+	u, err := ur.queries.CreateUser(ctx, db.CreateUserParams{
+		Username:     params.Username,
+		PasswordHash: params.PasswordHash,
+		Role:         params.Role,
+	})
+	if err != nil {
+		return devices.User{}, err
+	}
+	return userToDomain(u), nil
+}
+
+func (ur *PgUserRepo) GetUser(ctx context.Context, id int64) (devices.User, error) {
+	u, err := ur.queries.GetUser(ctx, id)
+	if err != nil {
+		return devices.User{}, err
+	}
+	return userToDomain(u), nil
+}
+
+func (ur *PgUserRepo) GetUserByUsername(ctx context.Context, username string) (devices.User, error) {
+	u, err := ur.queries.GetUserByUsername(ctx, username)
+	if err != nil {
+		return devices.User{}, err
+	}
+	return userToDomain(u), nil
+}
+
+func (ur *PgUserRepo) ListUsers(ctx context.Context) ([]devices.User, error) {
+	rows, err := ur.queries.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users := []devices.User{}
+	for _, u := range rows {
+		users = append(users, userToDomain(u))
+	}
+	return users, nil
+}
+
+func (ur *PgUserRepo) UpdateUserRole(ctx context.Context, id int64, role string) (devices.User, error) {
+	u, err := ur.queries.UpdateUserRole(ctx, db.UpdateUserRoleParams{ID: id, Role: role})
+	if err != nil {
+		return devices.User{}, err
+	}
+	return userToDomain(u), nil
+}
+
+func (ur *PgUserRepo) CreateSession(ctx context.Context, params devices.CreateSessionParams) (devices.Session, error) {
+	s, err := ur.queries.CreateSession(ctx, db.CreateSessionParams{
+		TokenHash: params.TokenHash,
+		UserID:    params.UserID,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		return devices.Session{}, err
+	}
+	return sessionToDomain(s), nil
+}
+
+func (ur *PgUserRepo) GetSession(ctx context.Context, tokenHash string) (devices.Session, error) {
+	s, err := ur.queries.GetSession(ctx, tokenHash)
+	if err != nil {
+		return devices.Session{}, err
+	}
+	return sessionToDomain(s), nil
+}
+
+func (ur *PgUserRepo) DeleteSession(ctx context.Context, tokenHash string) error {
+	return ur.queries.DeleteSession(ctx, tokenHash)
+}
+
+func (ur *PgUserRepo) DeleteExpiredSessions(ctx context.Context, before time.Time) (int64, error) {
+	return ur.queries.DeleteExpiredSessions(ctx, before)
+}
+
+func (ur *PgUserRepo) CreateApiToken(ctx context.Context, params devices.CreateApiTokenParams) (devices.ApiToken, error) {
+	t, err := ur.queries.CreateApiToken(ctx, db.CreateApiTokenParams{
+		UserID:    params.UserID,
+		Name:      params.Name,
+		TokenHash: params.TokenHash,
+		Scopes:    params.Scopes,
+		ExpiresAt: toEpoch(params.ExpiresAt),
+	})
+	if err != nil {
+		return devices.ApiToken{}, err
+	}
+	return tokenToDomain(t), nil
+}
+
+func (ur *PgUserRepo) GetApiToken(ctx context.Context, tokenHash string) (devices.ApiToken, error) {
+	t, err := ur.queries.GetApiTokenByHash(ctx, tokenHash)
+	if err != nil {
+		return devices.ApiToken{}, err
+	}
+	return tokenToDomain(t), nil
+}
+
+func (ur *PgUserRepo) ListApiTokens(ctx context.Context, userId int64) ([]devices.ApiToken, error) {
+	rows, err := ur.queries.ListApiTokens(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []devices.ApiToken{}
+	for _, t := range rows {
+		tokens = append(tokens, tokenToDomain(t))
+	}
+	return tokens, nil
+}
+
+func (ur *PgUserRepo) DeleteApiToken(ctx context.Context, userId int64, id int64) error {
+	deleted, err := ur.queries.DeleteApiToken(ctx, db.DeleteApiTokenParams{ID: id, UserID: userId})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (ur *PgUserRepo) CreateGrant(ctx context.Context, params devices.CreateGrantParams) (devices.Grant, error) {
+	g, err := ur.queries.CreateUserGrant(ctx, db.CreateUserGrantParams{
+		UserID:   params.UserID,
+		DeviceID: params.DeviceID,
+		GroupID:  params.GroupID,
+	})
+	if err != nil {
+		return devices.Grant{}, err
+	}
+	return grantToDomain(g), nil
+}
+
+func (ur *PgUserRepo) ListGrants(ctx context.Context, userId int64) ([]devices.Grant, error) {
+	rows, err := ur.queries.ListUserGrants(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	grants := []devices.Grant{}
+	for _, g := range rows {
+		grants = append(grants, grantToDomain(g))
+	}
+	return grants, nil
+}
+
+func (ur *PgUserRepo) DeleteGrant(ctx context.Context, userId int64, id int64) error {
+	deleted, err := ur.queries.DeleteUserGrant(ctx, db.DeleteUserGrantParams{ID: id, UserID: userId})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (ur *PgUserRepo) ListGrantedDeviceIds(ctx context.Context, userId int64) ([]int64, error) {
+	return ur.queries.ListGrantedDeviceIds(ctx, userId)
+}
+
+func userToDomain(u db.User) devices.User {
+	return devices.User{
+		ID:           u.ID,
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    u.CreatedAt,
+		Role:         u.Role,
+	}
+}
+
+func sessionToDomain(s db.UserSession) devices.Session {
+	return devices.Session{
+		TokenHash: s.TokenHash,
+		UserID:    s.UserID,
+		ExpiresAt: s.ExpiresAt,
+		CreatedAt: s.CreatedAt,
+	}
+}
+
+func tokenToDomain(t db.ApiToken) devices.ApiToken {
+	return devices.ApiToken{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Name:      t.Name,
+		TokenHash: t.TokenHash,
+		Scopes:    t.Scopes,
+		ExpiresAt: fromEpoch(t.ExpiresAt),
+		CreatedAt: t.CreatedAt,
+	}
+}
+
+func grantToDomain(g db.UserGrant) devices.Grant {
+	return devices.Grant{
+		ID:        g.ID,
+		UserID:    g.UserID,
+		DeviceID:  g.DeviceID,
+		GroupID:   g.GroupID,
+		CreatedAt: g.CreatedAt,
+	}
+}
@@ -0,0 +1,127 @@
+package repos
+
+import (
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/postgres"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsers(t *testing.T) {
+	a := assert.New(t)
+	appDb, dbErr := postgres.NewTestAppDb()
+	a.NoError(dbErr)
+	defer appDb.Db.Close()
+	repo := NewPgUserRepo(appDb.GetQueries())
+	ctx := t.Context()
+
+	u, err := repo.CreateUser(ctx, devices.CreateUserParams{Username: "test" + generateRandomString(10), PasswordHash: "hash", Role: devices.RoleViewer})
+	a.NoError(err)
+	defer func() {
+		_, _ = appDb.Db.Exec(ctx, "DELETE FROM users WHERE id = $1", u.ID)
+	}()
+	_, err = repo.CreateUser(ctx, devices.CreateUserParams{Username: u.Username, PasswordHash: "hash", Role: devices.RoleViewer})
+	a.Error(err, "usernames are unique")
+	got, err := repo.GetUserByUsername(ctx, u.Username)
+	a.NoError(err)
+	a.Equal(u.ID, got.ID)
+	a.Equal("hash", got.PasswordHash)
+
+	// Sessions
+	hash := generateRandomString(64)
+	_, err = repo.CreateSession(ctx, devices.CreateSessionParams{TokenHash: hash, UserID: u.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	a.NoError(err)
+	s, err := repo.GetSession(ctx, hash)
+	a.NoError(err)
+	a.Equal(u.ID, s.UserID)
+	expired := generateRandomString(64)
+	_, err = repo.CreateSession(ctx, devices.CreateSessionParams{TokenHash: expired, UserID: u.ID, ExpiresAt: time.Now().Add(-time.Hour)})
+	a.NoError(err)
+	_, err = repo.GetSession(ctx, expired)
+	a.Error(err, "expired sessions aren't returned")
+	deleted, err := repo.DeleteExpiredSessions(ctx, time.Now())
+	a.NoError(err)
+	a.GreaterOrEqual(deleted, int64(1))
+	a.NoError(repo.DeleteSession(ctx, hash))
+	_, err = repo.GetSession(ctx, hash)
+	a.Error(err)
+
+	// API tokens
+	tokenHash := generateRandomString(64)
+	tok, err := repo.CreateApiToken(ctx, devices.CreateApiTokenParams{
+		UserID:    u.ID,
+		Name:      "home-assistant",
+		TokenHash: tokenHash,
+		Scopes:    []string{devices.ScopeRead},
+	})
+	a.NoError(err)
+	a.True(tok.ExpiresAt.IsZero(), "tokens without an expiry don't expire")
+	got2, err := repo.GetApiToken(ctx, tokenHash)
+	a.NoError(err)
+	a.Equal([]string{devices.ScopeRead}, got2.Scopes)
+	expiredHash := generateRandomString(64)
+	_, err = repo.CreateApiToken(ctx, devices.CreateApiTokenParams{
+		UserID:    u.ID,
+		Name:      "old",
+		TokenHash: expiredHash,
+		Scopes:    []string{devices.ScopeRead},
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	a.NoError(err)
+	_, err = repo.GetApiToken(ctx, expiredHash)
+	a.Error(err, "expired tokens aren't returned")
+	tokens, err := repo.ListApiTokens(ctx, u.ID)
+	a.NoError(err)
+	a.Len(tokens, 2)
+	a.Error(repo.DeleteApiToken(ctx, u.ID+1, tok.ID), "users can only delete their own tokens")
+	a.NoError(repo.DeleteApiToken(ctx, u.ID, tok.ID))
+	_, err = repo.GetApiToken(ctx, tokenHash)
+	a.Error(err)
+
+	// Roles & grants
+	admin, err := repo.UpdateUserRole(ctx, u.ID, devices.RoleAdmin)
+	a.NoError(err)
+	a.Equal(devices.RoleAdmin, admin.Role)
+	deviceRepo := NewPgDeviceRepo(appDb.GetQueries())
+	var deviceIds []int64
+	for range 2 {
+		d, err := deviceRepo.CreateDevice(ctx, devices.CreateDeviceParams{
+			Name:      "test" + generateRandomString(10),
+			DeviceUrl: "http://test" + generateRandomString(10) + ":1234",
+		})
+		a.NoError(err)
+		deviceIds = append(deviceIds, d.ID)
+		defer func() {
+			_ = deviceRepo.DeleteDevice(ctx, d.ID)
+		}()
+	}
+	g, err := deviceRepo.CreateGroup(ctx, devices.CreateGroupParams{Name: "test" + generateRandomString(10)})
+	a.NoError(err)
+	defer func() {
+		_ = deviceRepo.DeleteGroup(ctx, g.ID)
+	}()
+	a.NoError(deviceRepo.AddGroupDevice(ctx, g.ID, deviceIds[0]))
+	a.NoError(deviceRepo.AddGroupDevice(ctx, g.ID, deviceIds[1]))
+
+	deviceGrant, err := repo.CreateGrant(ctx, devices.CreateGrantParams{UserID: u.ID, DeviceID: &deviceIds[0]})
+	a.NoError(err)
+	_, err = repo.CreateGrant(ctx, devices.CreateGrantParams{UserID: u.ID, DeviceID: &deviceIds[0]})
+	a.Error(err, "devices are only granted once")
+	_, err = repo.CreateGrant(ctx, devices.CreateGrantParams{UserID: u.ID, DeviceID: &deviceIds[0], GroupID: &g.ID})
+	a.Error(err, "a grant is for a device or a group")
+	ids, err := repo.ListGrantedDeviceIds(ctx, u.ID)
+	a.NoError(err)
+	a.Equal([]int64{deviceIds[0]}, ids)
+	_, err = repo.CreateGrant(ctx, devices.CreateGrantParams{UserID: u.ID, GroupID: &g.ID})
+	a.NoError(err)
+	ids, err = repo.ListGrantedDeviceIds(ctx, u.ID)
+	a.NoError(err)
+	a.ElementsMatch(deviceIds, ids, "group grants include the group's devices, without duplicates")
+	grants, err := repo.ListGrants(ctx, u.ID)
+	a.NoError(err)
+	a.Len(grants, 2)
+	a.NoError(repo.DeleteGrant(ctx, u.ID, deviceGrant.ID))
+	a.Error(repo.DeleteGrant(ctx, u.ID, deviceGrant.ID))
+}
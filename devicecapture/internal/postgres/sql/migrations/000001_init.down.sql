@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS detections;
+DROP TABLE IF EXISTS device_images;
+DROP TABLE IF EXISTS device_heartbeats;
+DROP TABLE IF EXISTS devices;
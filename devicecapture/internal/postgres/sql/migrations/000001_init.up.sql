@@ -1,5 +1,7 @@
+-- Baseline schema. Uses IF NOT EXISTS so databases created from the old schema.sql can be adopted
+
 -- Devices (Cameras)
-CREATE TABLE devices
+CREATE TABLE IF NOT EXISTS devices
 (
     id         bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     name       varchar(250) NOT NULL,
@@ -8,7 +10,7 @@ CREATE TABLE devices
 );
 
 -- Heartbeats
-CREATE TABLE device_heartbeats
+CREATE TABLE IF NOT EXISTS device_heartbeats
 (
     id         bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     device_id  bigint                                 NOT NULL
@@ -18,14 +20,14 @@ CREATE TABLE device_heartbeats
     created_at timestamp with time zone DEFAULT NOW() NOT NULL
 );
 
-CREATE INDEX device_heartbeats__created_at__index
+CREATE INDEX IF NOT EXISTS device_heartbeats__created_at__index
     ON device_heartbeats (created_at);
 
-CREATE INDEX device_heartbeats__device_id__idx
+CREATE INDEX IF NOT EXISTS device_heartbeats__device_id__idx
     ON device_heartbeats (device_id);
 
 -- Images
-CREATE TABLE device_images
+CREATE TABLE IF NOT EXISTS device_images
 (
     id         bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     device_id  bigint                                 NOT NULL
@@ -33,15 +35,16 @@ CREATE TABLE device_images
             REFERENCES devices
             ON DELETE CASCADE,
     created_at timestamp with time zone DEFAULT NOW() NOT NULL,
+    -- Blob store key, ex: videos/1-123/output-1-456.jpeg
     image_path varchar(250)                           NOT NULL,
     UNIQUE (image_path)
 );
 
-CREATE INDEX device_images__created_at_idx
+CREATE INDEX IF NOT EXISTS device_images__created_at_idx
     ON device_images (created_at);
 
 -- Detections
-CREATE TABLE detections
+CREATE TABLE IF NOT EXISTS detections
 (
     id         bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
     device_id  bigint       NOT NULL
@@ -58,10 +61,8 @@ CREATE TABLE detections
     bbox       float[][2]
 );
 
-CREATE INDEX detections__created_at__index
+CREATE INDEX IF NOT EXISTS detections__created_at__index
     ON detections (created_at);
 
-CREATE INDEX detections__device_id__idx
+CREATE INDEX IF NOT EXISTS detections__device_id__idx
     ON detections (device_id);
-
-
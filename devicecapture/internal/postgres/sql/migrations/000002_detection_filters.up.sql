@@ -0,0 +1,17 @@
+-- Detection filters
+-- device_id NULL = global settings, otherwise per-device overrides
+CREATE TABLE IF NOT EXISTS detection_filters
+(
+    id               bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    device_id        bigint
+        CONSTRAINT detection_filters_device__fk
+            REFERENCES devices
+            ON DELETE CASCADE,
+    min_confidence   float                                  NOT NULL DEFAULT 0.0,
+    label_confidence jsonb                                  NOT NULL DEFAULT '{}',
+    allow_labels     text[]                                 NOT NULL DEFAULT '{}',
+    deny_labels      text[]                                 NOT NULL DEFAULT '{}',
+    aliases          jsonb                                  NOT NULL DEFAULT '{}',
+    updated_at       timestamp with time zone DEFAULT NOW() NOT NULL,
+    UNIQUE NULLS NOT DISTINCT (device_id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE device_images
+    DROP COLUMN IF EXISTS annotated_path;
@@ -0,0 +1,3 @@
+-- Key of the copy with detections drawn on it, empty until it's rendered
+ALTER TABLE device_images
+    ADD COLUMN IF NOT EXISTS annotated_path varchar(250) NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS enabled,
+    DROP COLUMN IF EXISTS username,
+    DROP COLUMN IF EXISTS password,
+    DROP COLUMN IF EXISTS firmware_version,
+    DROP COLUMN IF EXISTS resolution,
+    DROP COLUMN IF EXISTS capabilities;
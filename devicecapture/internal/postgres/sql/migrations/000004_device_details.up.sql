@@ -0,0 +1,12 @@
+-- Device details, credentials & capabilities
+-- password is sent to the camera as HTTP basic auth, so it can't be hashed
+ALTER TABLE devices
+    ADD COLUMN location         varchar(250) NOT NULL DEFAULT '',
+    ADD COLUMN tags             text[]       NOT NULL DEFAULT '{}',
+    ADD COLUMN timezone         varchar(64)  NOT NULL DEFAULT 'UTC',
+    ADD COLUMN enabled          boolean      NOT NULL DEFAULT true,
+    ADD COLUMN username         varchar(250) NOT NULL DEFAULT '',
+    ADD COLUMN password         varchar(250) NOT NULL DEFAULT '',
+    ADD COLUMN firmware_version varchar(64)  NOT NULL DEFAULT '',
+    ADD COLUMN resolution       varchar(32)  NOT NULL DEFAULT '',
+    ADD COLUMN capabilities     text[]       NOT NULL DEFAULT '{snapshot,stream}';
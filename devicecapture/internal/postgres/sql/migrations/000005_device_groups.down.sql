@@ -0,0 +1,4 @@
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS muted_until;
+DROP TABLE IF EXISTS device_group_members;
+DROP TABLE IF EXISTS device_groups;
@@ -0,0 +1,29 @@
+-- Device groups, ex: a floor, building or "outdoor"
+CREATE TABLE device_groups
+(
+    id          bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    name        varchar(250)                           NOT NULL,
+    description varchar(1000)                          NOT NULL DEFAULT '',
+    created_at  timestamp with time zone DEFAULT NOW() NOT NULL,
+    UNIQUE (name)
+);
+
+CREATE TABLE device_group_members
+(
+    group_id  bigint NOT NULL
+        CONSTRAINT device_group_members_group__fk
+            REFERENCES device_groups
+            ON DELETE CASCADE,
+    device_id bigint NOT NULL
+        CONSTRAINT device_group_members_device__fk
+            REFERENCES devices
+            ON DELETE CASCADE,
+    PRIMARY KEY (group_id, device_id)
+);
+
+CREATE INDEX device_group_members__device_id__idx
+    ON device_group_members (device_id);
+
+-- Detections are still stored while a device is muted, they just aren't published
+ALTER TABLE devices
+    ADD COLUMN muted_until timestamp with time zone NOT NULL DEFAULT 'epoch';
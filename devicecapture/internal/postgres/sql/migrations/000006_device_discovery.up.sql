@@ -0,0 +1,24 @@
+-- Devices that announced themselves on announce/<mac>. Rows are kept once approved or rejected,
+-- so a device that announces again (ex: after a reboot) gets the same answer
+CREATE TABLE discovered_devices
+(
+    id               bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    mac              varchar(17)                            NOT NULL,
+    name             varchar(250)                           NOT NULL DEFAULT '',
+    device_url       varchar(250)                           NOT NULL,
+    firmware_version varchar(100)                           NOT NULL DEFAULT '',
+    resolution       varchar(20)                            NOT NULL DEFAULT '',
+    capabilities     text[]                                 NOT NULL DEFAULT '{}',
+    -- pending, approved or rejected
+    status           varchar(20)                            NOT NULL DEFAULT 'pending',
+    device_id        bigint
+        CONSTRAINT discovered_devices_device__fk
+            REFERENCES devices
+            ON DELETE SET NULL,
+    first_seen_at    timestamp with time zone DEFAULT NOW() NOT NULL,
+    last_seen_at     timestamp with time zone DEFAULT NOW() NOT NULL,
+    UNIQUE (mac)
+);
+
+CREATE INDEX discovered_devices__status__idx
+    ON discovered_devices (status);
@@ -0,0 +1,18 @@
+-- Camera settings pushed to devices on config/<device_id>. desired is what we want, reported is what the
+-- device said it applied when it acknowledged acked_version on config/<device_id>/ack
+CREATE TABLE device_configs
+(
+    device_id       bigint PRIMARY KEY
+        CONSTRAINT device_configs_device__fk
+            REFERENCES devices
+            ON DELETE CASCADE,
+    desired         jsonb                                  NOT NULL DEFAULT '{}',
+    desired_version bigint                                 NOT NULL DEFAULT 1,
+    reported        jsonb                                  NOT NULL DEFAULT '{}',
+    acked_version   bigint                                 NOT NULL DEFAULT 0,
+    last_error      varchar(1000)                          NOT NULL DEFAULT '',
+    push_attempts   integer                                NOT NULL DEFAULT 0,
+    pushed_at       timestamp with time zone DEFAULT 'epoch' NOT NULL,
+    acked_at        timestamp with time zone DEFAULT 'epoch' NOT NULL,
+    updated_at      timestamp with time zone DEFAULT NOW() NOT NULL
+);
@@ -0,0 +1,21 @@
+-- Messages written in the same transaction as the rows they describe, ex: detections, then published by
+-- outbox.Relay. Delivery is at least once, consumers deduplicate on message_id. Relays claim messages until
+-- claimed_until, so several can run without publishing the same message at the same time
+CREATE TABLE outbox_messages
+(
+    id            bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    message_id    varchar(100)                           NOT NULL,
+    topic         varchar(250)                           NOT NULL,
+    payload       bytea                                  NOT NULL,
+    attempts      integer                                NOT NULL DEFAULT 0,
+    last_error    varchar(1000)                          NOT NULL DEFAULT '',
+    claimed_until timestamp with time zone DEFAULT 'epoch' NOT NULL,
+    sent_at       timestamp with time zone DEFAULT 'epoch' NOT NULL,
+    created_at    timestamp with time zone DEFAULT NOW() NOT NULL,
+    UNIQUE (message_id)
+);
+
+-- Pending messages, oldest first
+CREATE INDEX outbox_messages__pending__idx
+    ON outbox_messages (id)
+    WHERE sent_at = 'epoch';
@@ -0,0 +1,2 @@
+ALTER TABLE detections
+    ALTER COLUMN id SET GENERATED ALWAYS;
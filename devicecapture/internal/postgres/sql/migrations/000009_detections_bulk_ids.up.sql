@@ -0,0 +1,4 @@
+-- CreateDetections reserves IDs with ReserveDetectionIds then copies the rows in with them, so it can return
+-- the rows it created. COPY can't override a GENERATED ALWAYS column
+ALTER TABLE detections
+    ALTER COLUMN id SET GENERATED BY DEFAULT;
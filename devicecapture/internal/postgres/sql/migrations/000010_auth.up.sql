@@ -0,0 +1,38 @@
+-- Dashboard & API users, passwords are bcrypt hashes
+CREATE TABLE users
+(
+    id            bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    username      varchar(100)             NOT NULL UNIQUE,
+    password_hash varchar(255)             NOT NULL,
+    created_at    timestamp with time zone NOT NULL DEFAULT NOW()
+);
+
+-- Login sessions, keyed by the SHA-256 of the session cookie so a leaked table can't be replayed
+CREATE TABLE user_sessions
+(
+    token_hash varchar(64) PRIMARY KEY,
+    user_id    bigint                   NOT NULL
+        CONSTRAINT user_sessions_user__fk
+            REFERENCES users
+            ON DELETE CASCADE,
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX user_sessions__expires_at__idx
+    ON user_sessions (expires_at);
+
+-- Scoped tokens for machine clients, also stored as SHA-256s. An expires_at of 'epoch' never expires
+CREATE TABLE api_tokens
+(
+    id         bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id    bigint                   NOT NULL
+        CONSTRAINT api_tokens_user__fk
+            REFERENCES users
+            ON DELETE CASCADE,
+    name       varchar(100)             NOT NULL,
+    token_hash varchar(64)              NOT NULL UNIQUE,
+    scopes     varchar(20)[]            NOT NULL DEFAULT '{}',
+    expires_at timestamp with time zone NOT NULL DEFAULT 'epoch',
+    created_at timestamp with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_grants;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,29 @@
+-- Viewers watch the devices they're granted, operators can also stream, snapshot & change their settings,
+-- admins can see every device & manage devices, groups & users
+ALTER TABLE users
+    ADD COLUMN role varchar(20) NOT NULL DEFAULT 'viewer';
+
+-- Everyone could do everything before roles
+UPDATE users
+SET role = 'admin';
+
+-- The devices a viewer or operator can access, granted one at a time or for every device in a group
+CREATE TABLE user_grants
+(
+    id         bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id    bigint                   NOT NULL
+        CONSTRAINT user_grants_user__fk
+            REFERENCES users
+            ON DELETE CASCADE,
+    device_id  bigint
+        CONSTRAINT user_grants_device__fk
+            REFERENCES devices
+            ON DELETE CASCADE,
+    group_id   bigint
+        CONSTRAINT user_grants_group__fk
+            REFERENCES device_groups
+            ON DELETE CASCADE,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    CONSTRAINT user_grants__device_or_group CHECK ((device_id IS NULL) <> (group_id IS NULL)),
+    UNIQUE NULLS NOT DISTINCT (user_id, device_id, group_id)
+);
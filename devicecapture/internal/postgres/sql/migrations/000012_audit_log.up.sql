@@ -0,0 +1,40 @@
+-- Who did what to which device, config or rule & when. actor_id isn't a foreign key so entries outlive
+-- their users, actor keeps the username. diff holds the target's "before" & "after" changed fields
+CREATE TABLE audit_log
+(
+    id          bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    actor       varchar(100)                           NOT NULL,
+    actor_id    bigint,
+    action      varchar(50)                            NOT NULL,
+    target_type varchar(50)                            NOT NULL,
+    target_id   varchar(100)                           NOT NULL DEFAULT '',
+    diff        jsonb                                  NOT NULL DEFAULT '{}',
+    source_ip   varchar(64)                            NOT NULL DEFAULT '',
+    created_at  timestamp with time zone DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX audit_log__created_at__idx
+    ON audit_log (created_at);
+
+CREATE INDEX audit_log__target__idx
+    ON audit_log (target_type, target_id);
+
+-- The audit log is append-only
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log__append_only
+    BEFORE UPDATE OR DELETE
+    ON audit_log
+    FOR EACH ROW
+EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log__no_truncate
+    BEFORE TRUNCATE
+    ON audit_log
+    FOR EACH STATEMENT
+EXECUTE FUNCTION audit_log_append_only();
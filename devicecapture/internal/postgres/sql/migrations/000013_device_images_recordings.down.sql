@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS device_images__device_id__idx;
+
+DROP INDEX IF EXISTS device_images__image_path_pattern__idx;
@@ -0,0 +1,7 @@
+-- A recording is a capture session's frames, looked up by their key prefix, ex: videos/1-123/
+CREATE INDEX device_images__image_path_pattern__idx
+    ON device_images (image_path text_pattern_ops);
+
+-- Live playlists start from a device's latest frame
+CREATE INDEX device_images__device_id__idx
+    ON device_images (device_id, id);
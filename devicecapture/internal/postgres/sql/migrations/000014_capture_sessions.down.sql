@@ -0,0 +1,4 @@
+ALTER TABLE device_images
+    DROP COLUMN IF EXISTS session_id;
+
+DROP TABLE IF EXISTS capture_sessions;
@@ -0,0 +1,45 @@
+-- A capture session is a stream's or snapshot's directory of frames, ex: videos/1-123. ended_at is the epoch
+-- while it's capturing, frame_count how many frames were stored when it ended
+CREATE TABLE capture_sessions
+(
+    id           bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    device_id    bigint                   NOT NULL
+        CONSTRAINT capture_sessions_device__fk
+            REFERENCES devices
+            ON DELETE CASCADE,
+    session_path varchar(250)             NOT NULL,
+    started_at   timestamp with time zone NOT NULL,
+    ended_at     timestamp with time zone NOT NULL DEFAULT 'epoch',
+    frame_count  integer                  NOT NULL DEFAULT 0,
+    UNIQUE (session_path)
+);
+
+CREATE INDEX capture_sessions__started_at__idx
+    ON capture_sessions (started_at);
+
+ALTER TABLE device_images
+    ADD COLUMN session_id bigint
+        CONSTRAINT device_images_session__fk
+            REFERENCES capture_sessions
+            ON DELETE SET NULL;
+
+CREATE INDEX device_images__session_id__idx
+    ON device_images (session_id, id);
+
+-- Index the frames captured before sessions were recorded, by their directory
+INSERT INTO capture_sessions (device_id, session_path, started_at, ended_at, frame_count)
+SELECT device_id,
+       regexp_replace(image_path, '/[^/]*$', ''),
+       min(created_at),
+       max(created_at),
+       count(*)
+FROM device_images
+WHERE image_path LIKE '%/%'
+GROUP BY device_id, regexp_replace(image_path, '/[^/]*$', '')
+ON CONFLICT (session_path) DO NOTHING;
+
+UPDATE device_images i
+SET session_id = s.id
+FROM capture_sessions s
+WHERE s.session_path = regexp_replace(i.image_path, '/[^/]*$', '')
+  AND s.device_id = i.device_id;
@@ -33,16 +33,90 @@ FROM devices
 WHERE id = $1;
 
 -- name: CreateDevice :one
-INSERT INTO devices (id, name, device_url)
-VALUES (DEFAULT, $1, $2)
+INSERT INTO devices (id, name, device_url, location, tags, timezone, enabled, username, password,
+                     firmware_version, resolution, capabilities)
+VALUES (DEFAULT, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING *;
+
+-- name: UpdateDevice :one
+-- The password is only replaced when set_password is true, a null enabled or capabilities keeps the existing value
+UPDATE devices
+SET name             = @name,
+    device_url       = @device_url,
+    location         = @location,
+    tags             = @tags,
+    timezone         = @timezone,
+    enabled          = COALESCE(sqlc.narg('enabled')::boolean, enabled),
+    username         = @username,
+    password         = CASE WHEN @set_password::boolean THEN @password::varchar ELSE password END,
+    firmware_version = @firmware_version,
+    resolution       = @resolution,
+    capabilities     = COALESCE(sqlc.narg('capabilities')::text[], capabilities)
+WHERE id = @id
 RETURNING *;
 
--- name: UpdateDevice :exec
+
+-- name: MuteDevice :one
+-- Detections from a muted device are stored, but not published until muted_until
 UPDATE devices
-SET name       = $2,
-    device_url = $3
+SET muted_until = $1
+WHERE id = $2
+RETURNING *;
+
+
+-----------------
+-- Device Groups
+
+-- name: CreateDeviceGroup :one
+INSERT INTO device_groups (name, description)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetDeviceGroup :one
+SELECT *
+FROM device_groups
+WHERE id = $1
+LIMIT 1;
+
+-- name: ListDeviceGroups :many
+SELECT *
+FROM device_groups
+ORDER BY name;
+
+-- name: UpdateDeviceGroup :one
+UPDATE device_groups
+SET name        = $1,
+    description = $2
+WHERE id = $3
+RETURNING *;
+
+-- name: DeleteDeviceGroup :exec
+DELETE
+FROM device_groups
 WHERE id = $1;
 
+-- name: AddDeviceGroupMember :exec
+INSERT INTO device_group_members (group_id, device_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveDeviceGroupMember :exec
+DELETE
+FROM device_group_members
+WHERE group_id = $1
+  AND device_id = $2;
+
+-- name: ListDeviceGroupMembers :many
+SELECT *
+FROM device_group_members
+ORDER BY group_id, device_id;
+
+-- name: GetDeviceGroupDevices :many
+SELECT *
+FROM devices
+WHERE id IN (SELECT device_id FROM device_group_members WHERE group_id = $1)
+ORDER BY name;
+
 
 -----------------
 -- HeartBeats
@@ -88,8 +162,18 @@ VALUES (DEFAULT, $1, $2, $3, $4, $5)
 RETURNING *;
 
 -- name: CreateDetections :copyfrom
-INSERT INTO detections (device_id, label, confidence, image_id, bbox)
-VALUES ($1, $2, $3, $4, $5);
+INSERT INTO detections (id, device_id, label, confidence, image_id, bbox)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: ReserveDetectionIds :many
+SELECT nextval(pg_get_serial_sequence('detections', 'id'))::bigint AS id
+FROM generate_series(1, @count::integer);
+
+-- name: GetDetectionsByIds :many
+SELECT *
+FROM detections
+WHERE id = ANY (@ids::bigint[])
+ORDER BY id;
 
 -- name: GetDetectionsAfter :many
 SELECT *
@@ -97,6 +181,13 @@ FROM detections
 WHERE created_at >= $1
 ORDER BY created_at DESC;
 
+-- name: GetDetectionsAfterId :many
+SELECT *
+FROM detections
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
 -- name: GetDeviceDetectionsAfter :many
 SELECT *
 FROM detections
@@ -114,11 +205,375 @@ WHERE device_id = $1;
 ------------ Images
 
 -- name: CreateImage :one
-INSERT INTO device_images (id, device_id, created_at, image_path)
-VALUES (DEFAULT, @device_id, DEFAULT, @image_path)
+INSERT INTO device_images (id, device_id, created_at, image_path, annotated_path, session_id)
+VALUES (DEFAULT, @device_id, DEFAULT, @image_path, @annotated_path, @session_id)
 RETURNING *;
 
 -- name: GetDeviceImages :many
 SELECT *
 FROM device_images
-WHERE device_id = @device_id;
\ No newline at end of file
+WHERE device_id = @device_id;
+
+-- name: GetImage :one
+SELECT *
+FROM device_images
+WHERE id = @id
+LIMIT 1;
+
+-- name: GetImagesByPattern :many
+SELECT *
+FROM device_images
+WHERE image_path LIKE @pattern
+ORDER BY id;
+
+-- name: GetLatestDeviceImage :one
+SELECT *
+FROM device_images
+WHERE device_id = @device_id
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: DeleteImage :exec
+DELETE
+FROM device_images
+WHERE id = @id;
+
+-- name: SetImageAnnotatedPath :one
+UPDATE device_images
+SET annotated_path = @annotated_path
+WHERE id = @id
+RETURNING *;
+
+-- name: GetSessionImages :many
+SELECT *
+FROM device_images
+WHERE session_id = @session_id
+ORDER BY id;
+
+
+------------ Capture sessions
+
+-- name: CreateCaptureSession :one
+INSERT INTO capture_sessions (device_id, session_path, started_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: EndCaptureSession :one
+-- The frame count is the session's stored frames
+UPDATE capture_sessions
+SET ended_at    = @ended_at,
+    frame_count = (SELECT count(*) FROM device_images WHERE session_id = @id)
+WHERE id = @id
+RETURNING *;
+
+-- name: GetCaptureSession :one
+SELECT *
+FROM capture_sessions
+WHERE id = @id
+LIMIT 1;
+
+-- name: ListCaptureSessions :many
+-- An 'epoch' started_before has no upper bound. Newest first
+SELECT *
+FROM capture_sessions
+WHERE device_id = ANY (@device_ids::bigint[])
+  AND started_at >= @started_after
+  AND (@started_before::timestamptz = 'epoch' OR started_at < @started_before)
+ORDER BY started_at DESC, id DESC
+LIMIT @row_limit;
+
+-----------------
+-- Detection filters
+-----------------
+-- name: GetDetectionFilters :many
+SELECT *
+FROM detection_filters
+WHERE device_id IS NULL
+   OR device_id = @device_id
+ORDER BY device_id NULLS FIRST;
+
+-- name: ListDetectionFilters :many
+SELECT *
+FROM detection_filters
+ORDER BY device_id NULLS FIRST;
+
+-- name: UpsertDetectionFilter :one
+INSERT INTO detection_filters (device_id, min_confidence, label_confidence, allow_labels, deny_labels, aliases)
+VALUES (@device_id, @min_confidence, @label_confidence, @allow_labels, @deny_labels, @aliases)
+ON CONFLICT (device_id) DO UPDATE
+    SET min_confidence   = EXCLUDED.min_confidence,
+        label_confidence = EXCLUDED.label_confidence,
+        allow_labels     = EXCLUDED.allow_labels,
+        deny_labels      = EXCLUDED.deny_labels,
+        aliases          = EXCLUDED.aliases,
+        updated_at       = NOW()
+RETURNING *;
+
+-- name: DeleteDetectionFilter :exec
+DELETE
+FROM detection_filters
+WHERE device_id IS NOT DISTINCT FROM @device_id;
+
+
+-----------------
+-- Discovered Devices
+
+-- name: UpsertDiscoveredDevice :one
+-- Announcing again refreshes the details, the status is left alone
+INSERT INTO discovered_devices (mac, name, device_url, firmware_version, resolution, capabilities)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (mac) DO UPDATE
+    SET name             = EXCLUDED.name,
+        device_url       = EXCLUDED.device_url,
+        firmware_version = EXCLUDED.firmware_version,
+        resolution       = EXCLUDED.resolution,
+        capabilities     = EXCLUDED.capabilities,
+        last_seen_at     = NOW()
+RETURNING *;
+
+-- name: GetDiscoveredDevice :one
+SELECT *
+FROM discovered_devices
+WHERE id = $1
+LIMIT 1;
+
+-- name: ListDiscoveredDevices :many
+-- An empty status lists every discovered device
+SELECT *
+FROM discovered_devices
+WHERE @status::varchar = ''
+   OR status = @status
+ORDER BY last_seen_at DESC;
+
+-- name: SetDiscoveredDeviceStatus :one
+UPDATE discovered_devices
+SET status    = $1,
+    device_id = $2
+WHERE id = $3
+RETURNING *;
+
+
+-----------------
+-- Device Configs
+
+-- name: GetDeviceConfig :one
+SELECT *
+FROM device_configs
+WHERE device_id = $1
+LIMIT 1;
+
+-- name: ListDeviceConfigs :many
+SELECT *
+FROM device_configs
+ORDER BY device_id;
+
+-- name: SetDesiredDeviceConfig :one
+-- Each change bumps desired_version & restarts the push attempts
+INSERT INTO device_configs (device_id, desired)
+VALUES ($1, $2)
+ON CONFLICT (device_id) DO UPDATE
+    SET desired         = EXCLUDED.desired,
+        desired_version = device_configs.desired_version + 1,
+        push_attempts   = 0,
+        last_error      = '',
+        updated_at      = NOW()
+RETURNING *;
+
+-- name: ListUnackedDeviceConfigs :many
+-- Configs due for another push
+SELECT *
+FROM device_configs
+WHERE acked_version < desired_version
+  AND pushed_at < @pushed_before
+  AND push_attempts < @max_attempts
+ORDER BY device_id;
+
+-- name: RecordDeviceConfigPush :exec
+UPDATE device_configs
+SET pushed_at     = NOW(),
+    push_attempts = push_attempts + 1
+WHERE device_id = $1;
+
+-- name: RecordDeviceConfigAck :one
+-- acked_version is whatever the device says it's running, so a device that reboots & reports version 0 is pushed
+-- its config again. Failed acks keep the previous version
+UPDATE device_configs
+SET reported      = @reported,
+    acked_version = CASE WHEN @last_error::varchar = '' THEN @acked_version ELSE acked_version END,
+    last_error    = @last_error,
+    push_attempts = CASE WHEN @last_error::varchar = '' THEN 0 ELSE push_attempts END,
+    acked_at      = NOW()
+WHERE device_id = @device_id
+RETURNING *;
+
+
+-----------------
+-- Outbox
+
+-- name: CreateOutboxMessage :one
+INSERT INTO outbox_messages (message_id, topic, payload)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: CreateOutboxMessages :copyfrom
+INSERT INTO outbox_messages (message_id, topic, payload)
+VALUES ($1, $2, $3);
+
+-- name: ClaimOutboxMessages :many
+-- Claims up to max_messages pending messages until claimed_until, skipping messages other relays have claimed
+UPDATE outbox_messages
+SET claimed_until = @claimed_until
+WHERE id IN (SELECT id
+             FROM outbox_messages
+             WHERE sent_at = 'epoch'
+               AND claimed_until < NOW()
+             ORDER BY id
+             LIMIT @max_messages FOR UPDATE SKIP LOCKED)
+RETURNING *;
+
+-- name: MarkOutboxMessageSent :exec
+UPDATE outbox_messages
+SET sent_at = NOW()
+WHERE id = $1;
+
+-- name: RecordOutboxMessageFailure :exec
+-- Releases the claim, so the message is retried
+UPDATE outbox_messages
+SET attempts      = attempts + 1,
+    last_error    = @last_error,
+    claimed_until = 'epoch'
+WHERE id = @id;
+
+-- name: DeleteSentOutboxMessages :execrows
+DELETE
+FROM outbox_messages
+WHERE sent_at <> 'epoch'
+  AND sent_at < $1;
+
+
+-----------------
+-- Users & auth
+
+-- name: CreateUser :one
+INSERT INTO users (username, password_hash, role)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetUser :one
+SELECT *
+FROM users
+WHERE id = $1
+LIMIT 1;
+
+-- name: GetUserByUsername :one
+SELECT *
+FROM users
+WHERE username = $1
+LIMIT 1;
+
+-- name: ListUsers :many
+SELECT *
+FROM users
+ORDER BY id;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateSession :one
+INSERT INTO user_sessions (token_hash, user_id, expires_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT *
+FROM user_sessions
+WHERE token_hash = $1
+  AND expires_at > NOW()
+LIMIT 1;
+
+-- name: DeleteSession :exec
+DELETE
+FROM user_sessions
+WHERE token_hash = $1;
+
+-- name: DeleteExpiredSessions :execrows
+DELETE
+FROM user_sessions
+WHERE expires_at < $1;
+
+-- name: CreateApiToken :one
+INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetApiTokenByHash :one
+SELECT *
+FROM api_tokens
+WHERE token_hash = $1
+  AND (expires_at = 'epoch' OR expires_at > NOW())
+LIMIT 1;
+
+-- name: ListApiTokens :many
+SELECT *
+FROM api_tokens
+WHERE user_id = $1
+ORDER BY id;
+
+-- name: DeleteApiToken :execrows
+DELETE
+FROM api_tokens
+WHERE id = @id
+  AND user_id = @user_id;
+
+-- name: CreateUserGrant :one
+INSERT INTO user_grants (user_id, device_id, group_id)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: ListUserGrants :many
+SELECT *
+FROM user_grants
+WHERE user_id = $1
+ORDER BY id;
+
+-- name: DeleteUserGrant :execrows
+DELETE
+FROM user_grants
+WHERE id = @id
+  AND user_id = @user_id;
+
+-- name: ListGrantedDeviceIds :many
+SELECT device_id::bigint AS device_id
+FROM user_grants
+WHERE user_id = $1
+  AND device_id IS NOT NULL
+UNION
+SELECT m.device_id
+FROM user_grants g
+         JOIN device_group_members m ON m.group_id = g.group_id
+WHERE g.user_id = $1;
+
+
+-----------------
+-- Audit log
+
+-- name: CreateAuditEntry :one
+INSERT INTO audit_log (actor, actor_id, action, target_type, target_id, diff, source_ip)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: ListAuditEntries :many
+-- Empty filters match every entry, an 'epoch' created_before has no upper bound. Newest first
+SELECT *
+FROM audit_log
+WHERE (@actor::varchar = '' OR actor = @actor)
+  AND (@action::varchar = '' OR action = @action)
+  AND (@target_type::varchar = '' OR target_type = @target_type)
+  AND (@target_id::varchar = '' OR target_id = @target_id)
+  AND created_at >= @created_after
+  AND (@created_before::timestamptz = 'epoch' OR created_at < @created_before)
+ORDER BY id DESC
+LIMIT @row_limit;
@@ -0,0 +1,67 @@
+package pubsub
+
+import (
+	"devicecapture/internal/config"
+	"devicecapture/internal/logger"
+	"log/slog"
+	"net"
+	"os"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// Broker an in-process MQTT broker, see config.BrokerConfig. MqttClients connect to it like any other broker
+type Broker struct {
+	server   *mochi.Server
+	listener *listeners.TCP
+}
+
+// StartBroker starts an embedded broker listening on conf.Addr. When user is set clients must
+// connect with user & password, otherwise anyone can connect
+func StartBroker(conf config.BrokerConfig, user, password string) (*Broker, error) {
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	})
+	var err error
+	if user == "" {
+		err = server.AddHook(new(auth.AllowHook), nil)
+	} else {
+		err = server.AddHook(new(auth.Hook), &auth.Options{
+			Ledger: &auth.Ledger{
+				Auth: auth.AuthRules{{Username: auth.RString(user), Password: auth.RString(password), Allow: true}},
+			},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: conf.Addr})
+	if err := server.AddListener(tcp); err != nil {
+		return nil, err
+	}
+	if err := server.Serve(); err != nil {
+		_ = server.Close()
+		return nil, err
+	}
+	logger.Info().Msgf("embedded MQTT broker listening on %s", tcp.Address())
+	return &Broker{server: server, listener: tcp}, nil
+}
+
+// Url the broker URL clients should connect to, ex: tcp://127.0.0.1:1883
+func (b *Broker) Url() string {
+	host, port, err := net.SplitHostPort(b.listener.Address())
+	if err != nil {
+		return "tcp://" + b.listener.Address()
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "tcp://" + net.JoinHostPort(host, port)
+}
+
+func (b *Broker) Close() error {
+	return b.server.Close()
+}
@@ -0,0 +1,152 @@
+package pubsub
+
+import (
+	"devicecapture/internal/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// newTestBroker starts an embedded broker on a free port, closed when the test ends
+func newTestBroker(t testing.TB, user, password string) *Broker {
+	broker, err := StartBroker(config.BrokerConfig{Embedded: true, Addr: "127.0.0.1:0"}, user, password)
+	if err != nil {
+		t.Fatalf("StartBroker failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = broker.Close()
+	})
+	return broker
+}
+
+// newTestClient connects to broker, disconnected when the test ends
+func newTestClient(t testing.TB, broker *Broker, clientId string) *MqttClient {
+	client, err := NewMqttClient(clientId, broker.Url(), "", "")
+	if err != nil {
+		t.Fatalf("NewMqttClient failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return &client
+}
+
+// subscribeChan subscribes to topic on bus, passing messages to the returned channel
+func subscribeChan(t testing.TB, bus Bus, topic string) <-chan Message {
+	messages := make(chan Message, 16)
+	_, err := bus.Subscribe(topic, func(msg Message) {
+		messages <- msg
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	return messages
+}
+
+func TestBroker_PublishSubscribe(t *testing.T) {
+	a := assert.New(t)
+	broker := newTestBroker(t, "", "")
+	a.Regexp(`^tcp://127\.0\.0\.1:\d+$`, broker.Url())
+	sub := newTestClient(t, broker, "sub")
+	pub := newTestClient(t, broker, "pub")
+
+	messages := subscribeChan(t, sub, "image/+")
+	a.NoError(pub.Publish("image/1", []byte("frame")))
+	select {
+	case msg := <-messages:
+		a.Equal("image/1", msg.Topic)
+		a.Equal("frame", string(msg.Payload))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+	}
+}
+
+func TestBroker_Auth(t *testing.T) {
+	a := assert.New(t)
+	broker := newTestBroker(t, "openblink", "secret")
+	_, err := NewMqttClient("anonymous", broker.Url(), "", "")
+	a.Error(err, "clients must log in when a user is configured")
+	_, err = NewMqttClient("wrong", broker.Url(), "openblink", "guess")
+	a.Error(err)
+	client, err := NewMqttClient("valid", broker.Url(), "openblink", "secret")
+	if a.NoError(err) {
+		_ = client.Close()
+	}
+}
+
+func TestMqttClient_PublishRetained(t *testing.T) {
+	a := assert.New(t)
+	broker := newTestBroker(t, "", "")
+	pub := newTestClient(t, broker, "pub")
+	a.NoError(pub.PublishRetained("status/1", "online"))
+
+	// Subscribers that connect later still receive it
+	sub := newTestClient(t, broker, "sub")
+	messages := subscribeChan(t, sub, "status/+")
+	select {
+	case msg := <-messages:
+		a.Equal("status/1", msg.Topic)
+		a.Equal("online", string(msg.Payload))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the retained message")
+	}
+}
+
+func TestBrokerAddr(t *testing.T) {
+	tests := []struct {
+		broker string
+		secure bool
+		want   string
+	}{
+		{"localhost", false, "localhost:1883"},
+		{"mosquitto", false, "mosquitto:1883"},
+		{"tcp://mosquitto", false, "tcp://mosquitto:1883"},
+		{"tcp://127.0.0.1:40123", false, "tcp://127.0.0.1:40123"},
+		{"10.0.0.5:1884", false, "10.0.0.5:1884"},
+		{"ssl://mosquitto", false, "ssl://mosquitto:8883"},
+		{"mqtts://mosquitto", false, "mqtts://mosquitto:8883"},
+		{"ssl://mosquitto:8884", false, "ssl://mosquitto:8884"},
+		{"ws://mosquitto/mqtt", false, "ws://mosquitto/mqtt"},
+		{"wss://broker.example.com/mqtt", false, "wss://broker.example.com/mqtt"},
+		{"wss://broker.example.com:9443/mqtt", false, "wss://broker.example.com:9443/mqtt"},
+		{"mosquitto", true, "ssl://mosquitto:8883"},
+		{"mosquitto:8884", true, "ssl://mosquitto:8884"},
+		{"tcp://mosquitto", true, "tcp://mosquitto:1883"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.broker, func(t *testing.T) {
+			assert.Equal(t, tt.want, brokerAddr(tt.broker, tt.secure))
+		})
+	}
+}
+
+func TestMqttClient_SharedSubscriptions(t *testing.T) {
+	a := assert.New(t)
+	broker := newTestBroker(t, "", "")
+	sub := newTestClient(t, broker, "sub")
+	pub := newTestClient(t, broker, "pub")
+
+	first := subscribeChan(t, sub, "detection/#")
+	secondSub, err := sub.Subscribe("detection/#", func(Message) {})
+	a.NoError(err)
+	second := subscribeChan(t, sub, "detection/#")
+	a.NoError(pub.Publish("detection/1", "person"))
+	for _, messages := range []<-chan Message{first, second} {
+		select {
+		case msg := <-messages:
+			a.Equal("detection/1", msg.Topic)
+		case <-time.After(5 * time.Second):
+			t.Fatal("every handler subscribed to a filter receives its messages")
+		}
+	}
+
+	// Unsubscribing one handler leaves the others subscribed
+	a.NoError(secondSub.Unsubscribe())
+	a.NoError(pub.Publish("detection/2", "dog"))
+	select {
+	case msg := <-first:
+		a.Equal("detection/2", msg.Topic)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+	}
+}
@@ -0,0 +1,151 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"devicecapture/internal/config"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrBusClosed     = errors.New("bus closed")
+	ErrInvalidTopic  = errors.New("invalid topic")
+	ErrInvalidFilter = errors.New("invalid topic filter")
+)
+
+// Message a message delivered to a subscriber
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Handler processes messages delivered to a Subscription
+type Handler func(msg Message)
+
+// Subscription a handler subscribed to a topic filter
+type Subscription interface {
+	// Unsubscribe stops delivering messages to the handler
+	Unsubscribe() error
+}
+
+// Bus publishes messages to topics & delivers them to subscribers. Topics follow MQTT syntax:
+// levels are separated by "/", in filters "+" matches a single level & a trailing "#" matches the rest,
+// ex: "image/+" matches "image/1", "detection/#" matches "detection/1" & "detection/1/person"
+type Bus interface {
+	// Publish payload to topic. Payloads are []byte or string
+	Publish(topic string, payload interface{}) error
+	// Subscribe calls handler for messages published to topics matching filter
+	Subscribe(filter string, handler Handler) (Subscription, error)
+	Close() error
+}
+
+// RetainPublisher is implemented by buses that keep the last message published to a topic & deliver it to
+// later subscribers, ex: MQTT. Publishing an empty payload clears the topic's retained message
+type RetainPublisher interface {
+	PublishRetained(topic string, payload interface{}) error
+}
+
+// DurableSubscriber is implemented by buses that store messages for named subscribers while they're down,
+// ex: NatsBus with JetStream
+type DurableSubscriber interface {
+	// SubscribeDurable calls handler for messages published to topics matching filter, starting from the first
+	// message durable hasn't handled
+	SubscribeDurable(durable, filter string, handler Handler) (Subscription, error)
+}
+
+// SubscribeDurable subscribes as durable when bus stores filter's messages, so messages published while the
+// subscriber was down are delivered when it comes back. Otherwise it falls back to Subscribe & only sees live messages
+func SubscribeDurable(bus Bus, durable, filter string, handler Handler) (Subscription, error) {
+	if ds, ok := bus.(DurableSubscriber); ok {
+		sub, err := ds.SubscribeDurable(durable, filter, handler)
+		if !errors.Is(err, ErrNoJetStream) && !errors.Is(err, ErrNotPersisted) {
+			return sub, err
+		}
+	}
+	return bus.Subscribe(filter, handler)
+}
+
+// TopicMatches whether topic matches filter, per MQTT's rules. Wildcards at the first level don't match
+// topics starting with "$", ex: $SYS/broker/uptime
+func TopicMatches(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, f := range filterLevels {
+		if f == "#" {
+			// "a/#" matches "a" too
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if f != "+" && f != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// ValidateTopic topics are non-empty & can't contain wildcards
+func ValidateTopic(topic string) error {
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("%w: %q", ErrInvalidTopic, topic)
+	}
+	return nil
+}
+
+// ValidateFilter filters are non-empty, wildcards must fill a whole level & "#" must be the last level
+func ValidateFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidFilter, filter)
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if level == "+" || (level == "#" && i == len(levels)-1) {
+			continue
+		}
+		if strings.ContainsAny(level, "+#") {
+			return fmt.Errorf("%w: %q", ErrInvalidFilter, filter)
+		}
+	}
+	return nil
+}
+
+// payloadBytes the payload types MQTT accepts, as bytes
+func payloadBytes(payload interface{}) ([]byte, error) {
+	switch p := payload.(type) {
+	case []byte:
+		return p, nil
+	case string:
+		return []byte(p), nil
+	case bytes.Buffer:
+		return p.Bytes(), nil
+	case *bytes.Buffer:
+		return p.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown payload type %T", payload)
+	}
+}
+
+// NewBusFromConfig connects to conf.Transport as clientId: MQTT (see BrokerHelper) unless it's "nats"
+func NewBusFromConfig(ctx context.Context, clientId string, conf *config.Config) (Bus, error) {
+	if conf.Transport == config.TransportNats {
+		return NewNatsBus(ctx, conf.Nats, clientId)
+	}
+	tlsConf, err := NewTLSConfig(conf.MqttTLS)
+	if err != nil {
+		return nil, err
+	}
+	client, err := BrokerHelper(clientId, conf.MqttHost, conf.MqttUser, conf.MqttPassword, tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	if !client.Valid() {
+		return nil, errors.New("failed to connect to an MQTT broker")
+	}
+	return &client, nil
+}
@@ -0,0 +1,119 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"image/1", "image/1", true},
+		{"image/1", "image/2", false},
+		{"image/+", "image/1", true},
+		{"image/+", "image/1/thumb", false},
+		{"image/+", "image", false},
+		{"+/1", "detection/1", true},
+		{"config/+/ack", "config/7/ack", true},
+		{"config/+/ack", "config/7", false},
+		{"detection/#", "detection/1", true},
+		{"detection/#", "detection/1/person", true},
+		{"detection/#", "detection", true},
+		{"detection/#", "image/1", false},
+		{"#", "image/1", true},
+		{"#", "$SYS/broker/uptime", false},
+		{"+/broker/uptime", "$SYS/broker/uptime", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+		{"image/+", "image/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter+" "+tt.topic, func(t *testing.T) {
+			assert.Equal(t, tt.want, TopicMatches(tt.filter, tt.topic))
+		})
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	a := assert.New(t)
+	for _, valid := range []string{"image/1", "image/+", "detection/#", "#", "+/+/ack", "config/+/ack"} {
+		a.NoError(ValidateFilter(valid), valid)
+	}
+	for _, invalid := range []string{"", "detection/#/x", "image/1+", "image/#1", "de#"} {
+		a.ErrorIs(ValidateFilter(invalid), ErrInvalidFilter, invalid)
+	}
+	a.NoError(ValidateTopic("image/1"))
+	a.ErrorIs(ValidateTopic("image/+"), ErrInvalidTopic)
+	a.ErrorIs(ValidateTopic(""), ErrInvalidTopic)
+}
+
+func TestMemoryBus(t *testing.T) {
+	a := assert.New(t)
+	bus := NewMemoryBus()
+	var images, all []Message
+	imageSub, err := bus.Subscribe("image/+", func(msg Message) {
+		images = append(images, msg)
+	})
+	a.NoError(err)
+	_, err = bus.Subscribe("#", func(msg Message) {
+		all = append(all, msg)
+	})
+	a.NoError(err)
+	_, err = bus.Subscribe("image/#/x", func(Message) {})
+	a.ErrorIs(err, ErrInvalidFilter)
+
+	a.NoError(bus.Publish("image/1", []byte("frame")))
+	a.NoError(bus.Publish("detection/1", `{"label": "person"}`))
+	a.Error(bus.Publish("image/1", 42), "payloads are bytes or strings")
+	a.ErrorIs(bus.Publish("image/+", "frame"), ErrInvalidTopic)
+	a.Equal([]Message{{Topic: "image/1", Payload: []byte("frame")}}, images)
+	a.Len(all, 2)
+
+	a.NoError(imageSub.Unsubscribe())
+	a.NoError(bus.Publish("image/2", "frame"))
+	a.Len(images, 1, "unsubscribed handlers aren't called")
+	a.Len(all, 3)
+
+	// Handlers can publish without deadlocking
+	_, err = bus.Subscribe("ping", func(Message) {
+		a.NoError(bus.Publish("pong", "pong"))
+	})
+	a.NoError(err)
+	a.NoError(bus.Publish("ping", "ping"))
+	a.Equal("pong", all[len(all)-1].Topic)
+
+	a.NoError(bus.Close())
+	a.ErrorIs(bus.Publish("image/1", "frame"), ErrBusClosed)
+	_, err = bus.Subscribe("image/+", func(Message) {})
+	a.ErrorIs(err, ErrBusClosed)
+}
+
+func TestMemoryBus_Retained(t *testing.T) {
+	a := assert.New(t)
+	bus := NewMemoryBus()
+	a.NoError(bus.PublishRetained("status/2", "offline"))
+	a.NoError(bus.PublishRetained("status/1", "online"))
+	a.NoError(bus.Publish("status/3", "online"), "only retained messages are kept")
+
+	var received []Message
+	_, err := bus.Subscribe("status/+", func(msg Message) {
+		received = append(received, msg)
+	})
+	a.NoError(err)
+	a.Equal([]Message{
+		{Topic: "status/1", Payload: []byte("online")},
+		{Topic: "status/2", Payload: []byte("offline")},
+	}, received, "retained messages are delivered on subscribe")
+
+	// An empty payload clears the topic, subscribers still receive it
+	a.NoError(bus.PublishRetained("status/1", ""))
+	_, ok := bus.Retained("status/1")
+	a.False(ok)
+	a.Equal(Message{Topic: "status/1", Payload: []byte{}}, received[len(received)-1])
+	buf, ok := bus.Retained("status/2")
+	a.True(ok)
+	a.Equal("offline", string(buf))
+}
@@ -0,0 +1,125 @@
+package pubsub
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MemoryBus an in-process Bus, ex: for tests. Publish calls matching handlers synchronously, in the order
+// they subscribed, so a message has been handled by the time Publish returns. Retained messages are
+// delivered to new subscribers before Subscribe returns
+type MemoryBus struct {
+	subs     []*memorySubscription
+	retained map[string][]byte
+	closed   bool
+	mu       sync.RWMutex
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{retained: map[string][]byte{}}
+}
+
+type memorySubscription struct {
+	bus     *MemoryBus
+	filter  string
+	handler Handler
+}
+
+func (s *memorySubscription) Unsubscribe() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	for i, sub := range s.bus.subs {
+		if sub == s {
+			s.bus.subs = append(s.bus.subs[:i:i], s.bus.subs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBus) Publish(topic string, payload interface{}) error {
+	return b.publish(topic, payload, false)
+}
+
+// PublishRetained see RetainPublisher
+func (b *MemoryBus) PublishRetained(topic string, payload interface{}) error {
+	return b.publish(topic, payload, true)
+}
+
+// Retained the message retained for topic, if there is one
+func (b *MemoryBus) Retained(topic string) ([]byte, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	buf, ok := b.retained[topic]
+	return buf, ok
+}
+
+func (b *MemoryBus) publish(topic string, payload interface{}, retain bool) error {
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+	buf, err := payloadBytes(payload)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBusClosed
+	}
+	if retain && len(buf) == 0 {
+		delete(b.retained, topic)
+	} else if retain {
+		b.retained[topic] = buf
+	}
+	var handlers []Handler
+	for _, sub := range b.subs {
+		if TopicMatches(sub.filter, topic) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.Unlock()
+	// Handlers are called without the lock, so they can publish & subscribe
+	for _, h := range handlers {
+		h(Message{Topic: topic, Payload: buf})
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(filter string, handler Handler) (Subscription, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrBusClosed
+	}
+	sub := &memorySubscription{bus: b, filter: filter, handler: handler}
+	b.subs = append(b.subs, sub)
+	var retained []Message
+	for topic, buf := range b.retained {
+		if TopicMatches(filter, topic) {
+			retained = append(retained, Message{Topic: topic, Payload: buf})
+		}
+	}
+	b.mu.Unlock()
+	slices.SortFunc(retained, func(x, y Message) int {
+		return strings.Compare(x.Topic, y.Topic)
+	})
+	for _, msg := range retained {
+		handler(msg)
+	}
+	return sub, nil
+}
+
+// Close drops every subscription, later publishes & subscribes return ErrBusClosed
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.subs = nil
+	b.retained = nil
+	return nil
+}
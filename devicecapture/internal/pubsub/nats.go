@@ -0,0 +1,240 @@
+package pubsub
+
+import (
+	"context"
+	"devicecapture/internal/config"
+	"devicecapture/internal/logger"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsTimeout how long we wait on JetStream, ex: for a publish to be stored
+const natsTimeout = 5 * time.Second
+
+var (
+	ErrNotPersisted = errors.New("topic filter isn't stored in the JetStream stream")
+	ErrNoJetStream  = errors.New("durable subscriptions need JetStream")
+)
+
+// NatsBus implements Bus on NATS. Topics map onto subjects the same way NATS's MQTT support does, so devices
+// can keep publishing over MQTT to a NATS server: "image/1" is the subject "image.1", "+" is "*" & "#" is ">".
+//
+// With JetStream enabled, messages published to config.NatsConfig StreamTopics (detection/# by default)
+// are stored in a stream. Subscribe only sees live messages, SubscribeDurable picks up where it left off
+type NatsBus struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	stream jetstream.Stream
+	conf   config.NatsConfig
+}
+
+// NewNatsBus connects to conf.Url as name, creating or updating the JetStream stream when it's enabled
+func NewNatsBus(ctx context.Context, conf config.NatsConfig, name string) (*NatsBus, error) {
+	conn, err := nats.Connect(conf.Url, nats.Name(name), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NATS at %s: %w", conf.Url, err)
+	}
+	b := &NatsBus{conn: conn, conf: conf}
+	if !conf.JetStream {
+		return b, nil
+	}
+	b.js, err = jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var subjects []string
+	for _, filter := range conf.StreamTopics {
+		s, err := natsSubjects(filter)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		subjects = append(subjects, s...)
+	}
+	b.stream, err = b.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     conf.Stream,
+		Subjects: subjects,
+		MaxAge:   conf.MaxAge,
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error creating JetStream stream %s: %w", conf.Stream, err)
+	}
+	logger.Debug().Msgf("NatsBus: storing %v in JetStream stream %s", subjects, conf.Stream)
+	return b, nil
+}
+
+// NatsSubject the NATS subject for an MQTT-style topic or filter, ex: "detection/+" -> "detection.*"
+func NatsSubject(topic string) (string, error) {
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		switch {
+		case level == "+":
+			levels[i] = "*"
+		case level == "#":
+			levels[i] = ">"
+		case level == "" || strings.ContainsAny(level, ".*> \t\r\n"):
+			return "", fmt.Errorf("%w: %q can't be mapped to a NATS subject", ErrInvalidTopic, topic)
+		}
+	}
+	return strings.Join(levels, "."), nil
+}
+
+// NatsTopic the MQTT-style topic for a NATS subject, ex: "image.1" -> "image/1"
+func NatsTopic(subject string) string {
+	return strings.ReplaceAll(subject, ".", "/")
+}
+
+// natsSubjects the subjects filter covers. In MQTT "detection/#" matches "detection" too,
+// in NATS "detection.>" needs at least one more token, so that's 2 subjects
+func natsSubjects(filter string) ([]string, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	subject, err := NatsSubject(filter)
+	if err != nil {
+		return nil, err
+	}
+	if parent, ok := strings.CutSuffix(subject, ".>"); ok {
+		return []string{subject, parent}, nil
+	}
+	return []string{subject}, nil
+}
+
+func (b *NatsBus) Publish(topic string, payload interface{}) error {
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+	subject, err := NatsSubject(topic)
+	if err != nil {
+		return err
+	}
+	buf, err := payloadBytes(payload)
+	if err != nil {
+		return err
+	}
+	if b.js != nil && b.persisted(topic) {
+		// Wait for JetStream to store it, so a publish that succeeds survives consumer downtime
+		ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+		defer cancel()
+		_, err = b.js.Publish(ctx, subject, buf)
+		return err
+	}
+	return b.conn.Publish(subject, buf)
+}
+
+// Subscribe calls handler for live messages published to topics matching filter
+func (b *NatsBus) Subscribe(filter string, handler Handler) (Subscription, error) {
+	subjects, err := natsSubjects(filter)
+	if err != nil {
+		return nil, err
+	}
+	sub := &natsSubscription{}
+	for _, subject := range subjects {
+		s, err := b.conn.Subscribe(subject, func(msg *nats.Msg) {
+			handler(Message{Topic: NatsTopic(msg.Subject), Payload: msg.Data})
+		})
+		if err != nil {
+			_ = sub.Unsubscribe()
+			return nil, err
+		}
+		sub.subs = append(sub.subs, s)
+	}
+	return sub, nil
+}
+
+// SubscribeDurable calls handler for messages published to topics matching filter, starting from the
+// first message durable hasn't acknowledged. Messages are acknowledged once handler returns, so a
+// message can be delivered more than once if the subscriber stops while handling it.
+// filter must be within one of the StreamTopics, durable names the consumer, ex: "deviceserver"
+func (b *NatsBus) SubscribeDurable(durable, filter string, handler Handler) (Subscription, error) {
+	if b.js == nil {
+		return nil, ErrNoJetStream
+	}
+	subjects, err := natsSubjects(filter)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(b.conf.StreamTopics, func(streamTopic string) bool {
+		return filterWithin(filter, streamTopic)
+	}) {
+		return nil, fmt.Errorf("%w: %s", ErrNotPersisted, filter)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	consumer, err := b.stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:        durable,
+		FilterSubjects: subjects,
+		AckPolicy:      jetstream.AckExplicitPolicy,
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating JetStream consumer %s: %w", durable, err)
+	}
+	consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
+		handler(Message{Topic: NatsTopic(msg.Subject()), Payload: msg.Data()})
+		if err := msg.Ack(); err != nil {
+			logger.Error().Msgf("NatsBus: error acknowledging %s for %s: %v", msg.Subject(), durable, err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &natsSubscription{consumeCtx: consumeCtx}, nil
+}
+
+// persisted whether topic is stored in the JetStream stream
+func (b *NatsBus) persisted(topic string) bool {
+	return slices.ContainsFunc(b.conf.StreamTopics, func(filter string) bool {
+		return TopicMatches(filter, topic)
+	})
+}
+
+func (b *NatsBus) Close() error {
+	b.conn.Close()
+	return nil
+}
+
+// natsSubscription core subscriptions or a JetStream consumer. Unsubscribing from a durable consumer
+// stops delivery, the consumer keeps its place on the server
+type natsSubscription struct {
+	subs       []*nats.Subscription
+	consumeCtx jetstream.ConsumeContext
+}
+
+func (s *natsSubscription) Unsubscribe() error {
+	var errs []error
+	for _, sub := range s.subs {
+		errs = append(errs, sub.Unsubscribe())
+	}
+	if s.consumeCtx != nil {
+		s.consumeCtx.Stop()
+	}
+	return errors.Join(errs...)
+}
+
+// filterWithin whether every topic filter matches is also matched by outer
+func filterWithin(filter, outer string) bool {
+	levels := strings.Split(filter, "/")
+	outerLevels := strings.Split(outer, "/")
+	for i, o := range outerLevels {
+		if o == "#" {
+			return true
+		}
+		if i >= len(levels) || levels[i] == "#" {
+			return false
+		}
+		if o != "+" && o != levels[i] {
+			return false
+		}
+	}
+	return len(levels) == len(outerLevels)
+}
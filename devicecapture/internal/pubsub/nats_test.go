@@ -0,0 +1,208 @@
+package pubsub
+
+import (
+	"devicecapture/internal/blob"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain/receiver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestNatsServer starts an embedded NATS server with JetStream on a free port, shut down when the test ends
+func newTestNatsServer(t *testing.T) string {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server didn't start")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns.ClientURL()
+}
+
+func newTestNatsBus(t *testing.T, url string, jetStream bool) *NatsBus {
+	bus, err := NewNatsBus(t.Context(), config.NatsConfig{
+		Url:          url,
+		JetStream:    jetStream,
+		Stream:       "OPENBLINK_TEST",
+		StreamTopics: []string{"detection/#"},
+		MaxAge:       time.Hour,
+	}, "test")
+	if err != nil {
+		t.Fatalf("NewNatsBus failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = bus.Close()
+	})
+	return bus
+}
+
+// receive waits for a message from messages
+func receive(t *testing.T, messages <-chan Message) Message {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return Message{}
+	}
+}
+
+func TestNatsSubject(t *testing.T) {
+	tests := []struct {
+		topic   string
+		want    string
+		wantErr bool
+	}{
+		{topic: "image/1", want: "image.1"},
+		{topic: "end-stream/1", want: "end-stream.1"},
+		{topic: "detection/+", want: "detection.*"},
+		{topic: "detection/#", want: "detection.>"},
+		{topic: "announce/de:ad:be:ef:00:01", want: "announce.de:ad:be:ef:00:01"},
+		{topic: "image/1.5", wantErr: true},
+		{topic: "image//1", wantErr: true},
+		{topic: "image/a b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			got, err := NatsSubject(tt.topic)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidTopic)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			if ValidateTopic(tt.topic) == nil {
+				assert.Equal(t, tt.topic, NatsTopic(got))
+			}
+		})
+	}
+}
+
+func TestFilterWithin(t *testing.T) {
+	a := assert.New(t)
+	a.True(filterWithin("detection/#", "detection/#"))
+	a.True(filterWithin("detection/+", "detection/#"))
+	a.True(filterWithin("detection/1", "detection/+"))
+	a.False(filterWithin("detection/#", "detection/+"))
+	a.False(filterWithin("#", "detection/#"))
+	a.False(filterWithin("image/1", "detection/#"))
+}
+
+func TestNatsBus_PublishSubscribe(t *testing.T) {
+	a := assert.New(t)
+	bus := newTestNatsBus(t, newTestNatsServer(t), false)
+	images := subscribeChan(t, bus, "image/+")
+	detections := subscribeChan(t, bus, "detection/#")
+
+	a.NoError(bus.Publish("image/1", []byte("frame")))
+	a.Equal(Message{Topic: "image/1", Payload: []byte("frame")}, receive(t, images))
+	a.NoError(bus.Publish("detection/1/person", `{"label": "person"}`))
+	a.Equal("detection/1/person", receive(t, detections).Topic)
+	a.NoError(bus.Publish("detection", "bare"))
+	a.Equal("detection", receive(t, detections).Topic, `"#" matches the parent level like MQTT`)
+	a.ErrorIs(bus.Publish("image/+", "frame"), ErrInvalidTopic)
+	_, err := bus.SubscribeDurable("deviceserver", "detection/#", func(Message) {})
+	a.Error(err, "durable subscriptions need JetStream")
+}
+
+func TestNatsBus_Receiver(t *testing.T) {
+	a := assert.New(t)
+	bus := newTestNatsBus(t, newTestNatsServer(t), false)
+	endStreams := subscribeChan(t, bus, "end-stream/+")
+	rec := NewMqttReceiver(bus, getTestConfig("/videos"), blob.NewMockStore())
+	a.NoError(rec.EndSession(receiver.NewCaptureSession("1")))
+	msg := receive(t, endStreams)
+	a.Equal("end-stream/1", msg.Topic)
+	a.Contains(string(msg.Payload), "/videos/1-")
+}
+
+func TestSubscribeDurable(t *testing.T) {
+	a := assert.New(t)
+	url := newTestNatsServer(t)
+	persisted := newTestNatsBus(t, url, true)
+	tests := []struct {
+		name   string
+		bus    Bus
+		filter string
+	}{
+		{name: "memory buses fall back to live messages", bus: NewMemoryBus(), filter: "detection/+"},
+		{name: "NATS without JetStream falls back to live messages", bus: newTestNatsBus(t, url, false), filter: "detection/+"},
+		{name: "topics outside the stream fall back to live messages", bus: persisted, filter: "image/+"},
+		{name: "durable", bus: persisted, filter: "detection/+"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan Message, 1)
+			sub, err := SubscribeDurable(tt.bus, "test", tt.filter, func(msg Message) {
+				received <- msg
+			})
+			if !a.NoError(err) {
+				return
+			}
+			defer func() {
+				_ = sub.Unsubscribe()
+			}()
+			topic := strings.Replace(tt.filter, "+", "1", 1)
+			a.NoError(tt.bus.Publish(topic, "payload"))
+			a.Equal(topic, receive(t, received).Topic)
+		})
+	}
+}
+
+func TestNatsBus_JetStream(t *testing.T) {
+	a := assert.New(t)
+	url := newTestNatsServer(t)
+	bus := newTestNatsBus(t, url, true)
+
+	_, err := bus.SubscribeDurable("deviceserver", "image/+", func(Message) {})
+	a.ErrorIs(err, ErrNotPersisted)
+
+	received := make(chan Message, 16)
+	sub, err := bus.SubscribeDurable("deviceserver", "detection/#", func(msg Message) {
+		received <- msg
+	})
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(bus.Publish("detection/1", "first"))
+	a.Equal("first", string(receive(t, received).Payload))
+
+	// Detections published while the subscriber is down are delivered when it comes back
+	a.NoError(sub.Unsubscribe())
+	a.NoError(bus.Publish("detection/1", "second"))
+	a.NoError(bus.Publish("detection/2", "third"))
+	restarted := newTestNatsBus(t, url, true)
+	sub, err = restarted.SubscribeDurable("deviceserver", "detection/#", func(msg Message) {
+		received <- msg
+	})
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+	a.Equal("second", string(receive(t, received).Payload))
+	third := receive(t, received)
+	a.Equal("detection/2", third.Topic)
+	a.Equal("third", string(third.Payload))
+
+	// Live subscribers see persisted topics too
+	live := subscribeChan(t, restarted, "detection/+")
+	a.NoError(restarted.Publish("detection/3", "fourth"))
+	a.Equal("fourth", string(receive(t, live).Payload))
+}
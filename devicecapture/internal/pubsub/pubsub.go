@@ -1,17 +1,34 @@
 package pubsub
 
 import (
+	"crypto/tls"
 	"devicecapture/internal/logger"
 	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
-func BrokerHelper(cId, broker, user, password string) (MqttClient, error) {
-	urls := []string{broker, "localhost", "0.0.0.0", "mosquitto", "host.docker.internal"}
-	//brokers := []string{broker, "0.0.0.0:1883", "host.docker.internal:1883"}
-	for _, url := range urls {
-		b := fmt.Sprintf("%s:1883", url)
-		c, err := NewMqttClient(cId, b, user, password)
+// BrokerHelper connects to broker, falling back to common hosts for plain TCP brokers.
+// tlsConf is used for ssl:// & wss:// brokers, when it's set brokers without a scheme use ssl://
+func BrokerHelper(cId, broker, user, password string, tlsConf *tls.Config) (MqttClient, error) {
+	urls := []string{broker}
+	if tlsConf == nil && !secureScheme(broker) {
+		// Fallback hosts can't match a certificate, so they're only tried without TLS
+		urls = append(urls, "localhost", "0.0.0.0", "mosquitto", "host.docker.internal")
+	}
+	for i, url := range urls {
+		b := brokerAddr(url, tlsConf != nil)
+		c, err := NewMqttClientWithOptions(ClientOptions{
+			Broker:   b,
+			ClientID: cId,
+			User:     user,
+			Password: password,
+			TLS:      tlsConf,
+		})
 		if err == nil {
 			return c, nil
 		}
@@ -19,7 +36,7 @@ func BrokerHelper(cId, broker, user, password string) (MqttClient, error) {
 		logger.Debug().Msgf("Error connecting to broker: %s", b)
 		logger.Debug().Msgf("Error: %v", err)
 		// Return the error if this is the last broker
-		if b == urls[len(urls)-1] {
+		if i == len(urls)-1 {
 			return c, err
 		}
 	}
@@ -29,15 +46,62 @@ func BrokerHelper(cId, broker, user, password string) (MqttClient, error) {
 	}, nil
 }
 
+// defaultPorts the MQTT port for each scheme paho supports. Websocket brokers are reached through
+// an HTTP(S) server, ex: wss://example.com/mqtt, so no port is added for them
+var defaultPorts = map[string]string{
+	"tcp":   "1883",
+	"mqtt":  "1883",
+	"ssl":   "8883",
+	"tls":   "8883",
+	"mqtts": "8883",
+	"ws":    "",
+	"wss":   "",
+}
+
+// secureScheme whether broker's scheme uses TLS
+func secureScheme(broker string) bool {
+	scheme, _, ok := strings.Cut(broker, "://")
+	if !ok {
+		return false
+	}
+	return defaultPorts[scheme] == "8883" || scheme == "wss"
+}
+
+// brokerAddr adds the default port for broker's scheme unless it already has one, ex: an embedded Broker's Url.
+// Brokers without a scheme use ssl:// when secure, paho's default tcp:// otherwise
+func brokerAddr(broker string, secure bool) string {
+	scheme, hostPort, ok := strings.Cut(broker, "://")
+	if !ok {
+		scheme, hostPort = "tcp", broker
+		if secure {
+			scheme = "ssl"
+			broker = scheme + "://" + broker
+		}
+	}
+	port, known := defaultPorts[scheme]
+	if !known || port == "" {
+		return broker
+	}
+	host, _, _ := strings.Cut(hostPort, "/")
+	if _, p, err := net.SplitHostPort(host); err == nil && p != "" {
+		return broker
+	}
+	return broker + ":" + port
+}
+
 func NewMqttClient(cId, broker, user, password string) (MqttClient, error) {
-	opt := ClientOptions{
+	return NewMqttClientWithOptions(ClientOptions{
 		ClientID: cId,
 		Broker:   broker,
 		User:     user,
 		Password: password,
-	}
+	})
+}
+
+// NewMqttClientWithOptions connects to opts.Broker, ex: over TLS
+func NewMqttClientWithOptions(opts ClientOptions) (MqttClient, error) {
 	c := MqttClient{
-		opts: &opt,
+		opts: &opts,
 	}
 	err := c.Connect()
 	if err != nil {
@@ -51,12 +115,32 @@ type ClientOptions struct {
 	ClientID string
 	User     string
 	Password string
+	// TLS for ssl:// & wss:// brokers, nil uses the system's roots
+	TLS *tls.Config
 }
 
+// MqttClient implements Bus
 type MqttClient struct {
 	Client mqtt.Client
 	opts   *ClientOptions
-	topics []string
+	subs   *mqttSubscriptions
+}
+
+// mqttSubscriptions the handlers subscribed to each filter. Paho only keeps one handler per filter,
+// so we subscribe to a filter once & fan its messages out to every handler
+type mqttSubscriptions struct {
+	byFilter map[string][]*mqttSubscription
+	mu       sync.Mutex
+}
+
+type mqttSubscription struct {
+	client  *MqttClient
+	filter  string
+	handler Handler
+}
+
+func (s *mqttSubscription) Unsubscribe() error {
+	return s.client.unsubscribe(s)
 }
 
 func (m *MqttClient) Valid() bool {
@@ -69,6 +153,7 @@ func (m *MqttClient) CopyWithClientId(clientId string) MqttClient {
 		Broker:   m.opts.Broker,
 		User:     m.opts.User,
 		Password: m.opts.Password,
+		TLS:      m.opts.TLS,
 	}
 	return MqttClient{
 		opts: &opts,
@@ -103,6 +188,9 @@ func (m *MqttClient) Connect() error {
 	if m.opts.Password != "" {
 		mqOptions.SetPassword(m.opts.Password)
 	}
+	if m.opts.TLS != nil {
+		mqOptions.SetTLSConfig(m.opts.TLS)
+	}
 	mqOptions.OnConnectionLost = func(c mqtt.Client, err error) {
 		panic(err)
 	}
@@ -116,6 +204,7 @@ func (m *MqttClient) Connect() error {
 		return err
 	}
 	logger.Debug().Msgf("MqttClient: Connected to broker: %s", m.opts.Broker)
+	m.subs = &mqttSubscriptions{byFilter: map[string][]*mqttSubscription{}}
 	m.Client = mClient
 	return nil
 }
@@ -131,24 +220,85 @@ func (m *MqttClient) Publish(topic string, payload interface{}) error {
 	return nil
 }
 
-// Subscribe creates a subscription for the passed topic. The callBack function is used to process any messages that the client receives on that topic. The subscription created will have a QOS of 1.
-func (m *MqttClient) Subscribe(topic string, f mqtt.MessageHandler) error {
-	if token := m.Client.Subscribe(topic, 2, f); token.Wait() && token.Error() != nil {
+// PublishRetained publishes a retained message with a QOS of 1, see RetainPublisher
+func (m *MqttClient) PublishRetained(topic string, payload interface{}) error {
+	if m.Client == nil {
+		return fmt.Errorf("client not connected")
+	}
+	if token := m.Client.Publish(topic, 1, true, payload); token.Wait() && token.Error() != nil {
 		return token.Error()
 	}
-	m.topics = append(m.topics, topic)
 	return nil
 }
 
+// Subscribe calls handler for messages published to topics matching filter. Messages are received with a QOS of 2
+func (m *MqttClient) Subscribe(filter string, handler Handler) (Subscription, error) {
+	if m.Client == nil {
+		return nil, fmt.Errorf("client not connected")
+	}
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	sub := &mqttSubscription{client: m, filter: filter, handler: handler}
+	m.subs.mu.Lock()
+	defer m.subs.mu.Unlock()
+	if len(m.subs.byFilter[filter]) == 0 {
+		token := m.Client.Subscribe(filter, 2, func(_ mqtt.Client, msg mqtt.Message) {
+			m.dispatch(filter, Message{Topic: msg.Topic(), Payload: msg.Payload()})
+		})
+		if token.Wait() && token.Error() != nil {
+			return nil, token.Error()
+		}
+	}
+	m.subs.byFilter[filter] = append(m.subs.byFilter[filter], sub)
+	return sub, nil
+}
+
+// dispatch passes msg to every handler subscribed to filter
+func (m *MqttClient) dispatch(filter string, msg Message) {
+	m.subs.mu.Lock()
+	subs := slices.Clone(m.subs.byFilter[filter])
+	m.subs.mu.Unlock()
+	for _, sub := range subs {
+		sub.handler(msg)
+	}
+}
+
+// unsubscribe removes sub, unsubscribing from its filter once nothing else is subscribed to it
+func (m *MqttClient) unsubscribe(sub *mqttSubscription) error {
+	m.subs.mu.Lock()
+	defer m.subs.mu.Unlock()
+	subs := m.subs.byFilter[sub.filter]
+	i := slices.Index(subs, sub)
+	if i < 0 {
+		return nil
+	}
+	subs = slices.Delete(slices.Clone(subs), i, i+1)
+	if len(subs) > 0 {
+		m.subs.byFilter[sub.filter] = subs
+		return nil
+	}
+	delete(m.subs.byFilter, sub.filter)
+	token := m.Client.Unsubscribe(sub.filter)
+	token.Wait()
+	return token.Error()
+}
+
 func (m *MqttClient) Close() error {
+	if m.Client == nil {
+		return nil
+	}
 	errorTokens := make([]error, 0)
-	for _, t := range m.topics {
-		token := m.Client.Unsubscribe(t)
+	m.subs.mu.Lock()
+	for filter := range m.subs.byFilter {
+		token := m.Client.Unsubscribe(filter)
 		token.Wait()
 		if token.Error() != nil {
 			errorTokens = append(errorTokens, token.Error())
 		}
 	}
+	m.subs.byFilter = map[string][]*mqttSubscription{}
+	m.subs.mu.Unlock()
 	m.Client.Disconnect(250)
 	if len(errorTokens) > 0 {
 		return fmt.Errorf("error unsubscribing from topics: %v", errorTokens)
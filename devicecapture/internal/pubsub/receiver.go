@@ -3,57 +3,43 @@ package pubsub
 
 import (
 	"context"
+	"devicecapture/internal/blob"
 	"devicecapture/internal/config"
 	"devicecapture/internal/domain/receiver"
 	"devicecapture/internal/logger"
+	"devicecapture/internal/signedurl"
 	"fmt"
-	"image/jpeg"
-	"os"
 )
 
-// MqttReceiver implements receiver.FrameRepository
+// MqttReceiver implements receiver.FrameRepository. Frames are written to a blob.Store & announced on a Bus,
+// usually an MqttClient. It doesn't keep any session state, so it's shared by every device's sessions
 type MqttReceiver struct {
-	client    *MqttClient
+	bus       Bus
+	store     blob.Store
 	videoPath string
 	serverIp  string
-	Session   *receiver.CaptureSession
+	signer    *signedurl.Signer
 }
 
-func NewMqttReceiver(client *MqttClient, conf *config.Config) *MqttReceiver {
+func NewMqttReceiver(bus Bus, conf *config.Config, store blob.Store) *MqttReceiver {
 	return &MqttReceiver{
-		client:    client,
+		bus:       bus,
+		store:     store,
 		videoPath: conf.VideoPath,
 		serverIp:  conf.ThisIp,
+		signer:    signedurl.New(conf.Auth.UrlSigningKey, conf.Blob.SignedUrlTTL),
 	}
 }
 
 // StartSession Start a receiver.CaptureSession
 func (r *MqttReceiver) StartSession(deviceId string) (*receiver.CaptureSession, error) {
-	s := receiver.NewCaptureSession(deviceId)
-	r.Session = s
-	err := r.checkSessionDir()
-	if err != nil {
-		return nil, err
-	}
-	return s, nil
-}
-
-func (r *MqttReceiver) checkSessionDir() error {
-	dir := fmt.Sprintf("%s/%s-%v", r.videoPath, r.Session.DeviceID, r.Session.StartedAt)
-	_, err := os.Stat(dir)
-	if os.IsNotExist(err) {
-		err = os.MkdirAll(dir, 0755)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return receiver.NewCaptureSession(deviceId), nil
 }
 
-func (r *MqttReceiver) EndSession() error {
-	topic := fmt.Sprintf("end-stream/%s", r.Session.DeviceID)
-	payload := fmt.Sprintf("%s/%s-%v", r.videoPath, r.Session.DeviceID, r.Session.StartedAt)
-	err := r.client.Publish(topic, payload)
+// EndSession publishes the session's path to "end-stream/<deviceID>"
+func (r *MqttReceiver) EndSession(session *receiver.CaptureSession) error {
+	topic := fmt.Sprintf("end-stream/%s", session.DeviceID)
+	err := r.bus.Publish(topic, receiver.SessionPath(r.videoPath, session))
 	if err != nil {
 		return err
 	}
@@ -61,39 +47,34 @@ func (r *MqttReceiver) EndSession() error {
 }
 
 // ReceiveFrame publishes Frames (JSON) to "image/<deviceID>"
-func (r *MqttReceiver) ReceiveFrame(frame receiver.Frame, framePath string) error {
+func (r *MqttReceiver) ReceiveFrame(session *receiver.CaptureSession, frame receiver.Frame, framePath string) error {
 	logger.Debug().Msgf("mqttreceiver.ReceiveFrame")
 	var fp = framePath
 	if framePath == "" {
-		fp = receiver.FramePath(r.videoPath, r.Session, frame)
+		fp = receiver.FramePath(r.videoPath, session, frame)
 	}
-	logger.Debug().Msgf("Writing frame to file: %v at %s", frame.Timestamp, fp)
-	f, err := os.Create(fp)
-	defer f.Close()
+	logger.Debug().Msgf("Writing frame to blob store: %v at %s", frame.Timestamp, fp)
+	// Frames are already JPEGs, write the original bytes rather than re-encoding them
+	err := r.store.Put(context.Background(), fp, frame.Buf, "image/jpeg")
 	if err != nil {
-		logger.Error().Msgf("error writing frame to file %v @ %s", frame.Timestamp, fp)
+		logger.Error().Msgf("error writing frame %v to blob store @ %s", frame.Timestamp, fp)
 		return err
 	}
-	err2 := jpeg.Encode(f, frame.Image, nil)
-	if err2 != nil {
-		logger.Error().Msgf("error encoding frame to JPEG for %s", fp)
-		return err2
-	}
-	payload, err3 := r.FrameToJson(r.serverIp, frame)
+	payload, err3 := r.FrameToJson(r.serverIp, session, frame)
 	if err3 != nil {
 		logger.Error().Msgf("error from FrameToJson for %s", fp)
 		return err3
 	}
-	topic := fmt.Sprintf("image/%s", r.Session.DeviceID)
-	err = r.client.Publish(topic, payload)
-	logger.Debug().Msgf("Writing device %s frame to topic: %v ", r.Session.DeviceID, topic)
+	topic := fmt.Sprintf("image/%s", session.DeviceID)
+	err = r.bus.Publish(topic, payload)
+	logger.Debug().Msgf("Writing device %s frame to topic: %v ", session.DeviceID, topic)
 	if err != nil {
-		logger.Error().Msgf("error publishing device %s frame to topic %v", r.Session.DeviceID, topic)
+		logger.Error().Msgf("error publishing device %s frame to topic %v", session.DeviceID, topic)
 	}
 	return nil
 }
 
-func (r *MqttReceiver) ReceiveFrameStream(ctx context.Context, imgChan <-chan receiver.Frame) error {
+func (r *MqttReceiver) ReceiveFrameStream(ctx context.Context, session *receiver.CaptureSession, imgChan <-chan receiver.Frame) error {
 	outChan := make(chan receiver.Frame, 64)
 	defer close(outChan)
 
@@ -120,7 +101,7 @@ func (r *MqttReceiver) ReceiveFrameStream(ctx context.Context, imgChan <-chan re
 				if !ok {
 					return
 				}
-				err := r.ReceiveFrame(img, receiver.FramePath(r.videoPath, r.Session, img))
+				err := r.ReceiveFrame(session, img, receiver.FramePath(r.videoPath, session, img))
 				if err != nil {
 					return
 				}
@@ -133,9 +114,10 @@ func (r *MqttReceiver) ReceiveFrameStream(ctx context.Context, imgChan <-chan re
 	return nil
 }
 
-func (r *MqttReceiver) FrameToJson(thisIp string, frame receiver.Frame) (string, error) {
-	fp := receiver.FramePath(r.videoPath, r.Session, frame)
-	payload, err := receiver.FrameJson(thisIp, r.Session.DeviceID, fp, frame)
+// FrameToJson the frame's message, its URL signed when a URL signing key is configured
+func (r *MqttReceiver) FrameToJson(thisIp string, session *receiver.CaptureSession, frame receiver.Frame) (string, error) {
+	fp := receiver.FramePath(r.videoPath, session, frame)
+	payload, err := receiver.FrameJson(thisIp, r.signer, session.DeviceID, fp, frame)
 	if err != nil {
 		return "", err
 	}
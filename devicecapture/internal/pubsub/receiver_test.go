@@ -1,11 +1,16 @@
 package pubsub
 
 import (
+	"bytes"
+	"devicecapture/internal/blob"
 	"devicecapture/internal/config"
 	"devicecapture/internal/domain/receiver"
+	"encoding/json"
+	"fmt"
 	"image"
 	"image/color"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -13,7 +18,7 @@ import (
 
 func getTestConfig(videoPath string) *config.Config {
 	if videoPath == "" {
-		videoPath = "/tmp/videos"
+		videoPath = "videos"
 	}
 	return &config.Config{
 		MqttHost:            "",
@@ -37,11 +42,11 @@ func createTestImage() image.Image {
 
 // createTestFrame creates a test frame with the given timestamp
 func createTestFrame(timestamp int64) receiver.Frame {
-	return receiver.Frame{
-		Buf:       []byte("test-frame-data"),
-		Image:     createTestImage(),
-		Timestamp: timestamp,
+	frame, err := receiver.NewFrameFromImage(createTestImage(), timestamp)
+	if err != nil {
+		panic(err)
 	}
+	return frame
 }
 
 // setupTestDir creates a temporary directory for testing and returns cleanup function
@@ -63,29 +68,29 @@ func setupTestDir(t *testing.T) (string, func()) {
 
 func TestNewMqttReceiver(t *testing.T) {
 	tests := []struct {
-		name   string
-		client *MqttClient
+		name string
+		bus  Bus
 	}{
 		{
-			name:   "creates receiver with valid client",
-			client: &MqttClient{},
+			name: "creates receiver with a bus",
+			bus:  NewMemoryBus(),
 		},
 		{
-			name:   "creates receiver with nil client",
-			client: nil,
+			name: "creates receiver with nil bus",
+			bus:  nil,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rec := NewMqttReceiver(tt.client, getTestConfig(""))
+			rec := NewMqttReceiver(tt.bus, getTestConfig(""), blob.NewMockStore())
 
 			if rec == nil {
 				t.Fatal("NewMqttReceiver returned nil")
 			}
 
-			if rec.client != tt.client {
-				t.Errorf("Expected client %v, got %v", tt.client, rec.client)
+			if rec.bus != tt.bus {
+				t.Errorf("Expected bus %v, got %v", tt.bus, rec.bus)
 			}
 		})
 	}
@@ -95,9 +100,8 @@ func TestMqttReceiver_StartSession(t *testing.T) {
 	tempDir, cleanup := setupTestDir(t)
 	defer cleanup()
 
-	// Create a test client (doesn't need to be connected for this test)
-	client := &MqttClient{}
-	rec := NewMqttReceiver(client, getTestConfig(tempDir))
+	bus := NewMemoryBus()
+	rec := NewMqttReceiver(bus, getTestConfig(""), blob.NewLocalStore(tempDir))
 
 	deviceId := "test-domain-123"
 
@@ -121,24 +125,20 @@ func TestMqttReceiver_StartSession(t *testing.T) {
 	if session.StartedAt == 0 {
 		t.Error("StartedAt should not be zero")
 	}
-
-	if rec.Session.DeviceID != deviceId {
-		t.Errorf("Expected receiver session domain ID %s, got %s", deviceId, rec.Session.DeviceID)
-	}
 }
 
 func TestMqttReceiver_FrameToJson(t *testing.T) {
-	client := &MqttClient{}
+	bus := NewMemoryBus()
 	vp := "test-path"
 	conf := getTestConfig(vp)
-	rec := NewMqttReceiver(client, conf)
+	rec := NewMqttReceiver(bus, conf, blob.NewMockStore())
 
 	// Set up a test session
-	rec.Session = receiver.NewCaptureSession("test-domain")
+	session := receiver.NewCaptureSession("test-domain")
 
 	frame := createTestFrame(9876543210)
 
-	jsonStr, err := rec.FrameToJson(conf.ThisIp, frame)
+	jsonStr, err := rec.FrameToJson(conf.ThisIp, session, frame)
 	if err != nil {
 		t.Fatalf("FrameToJson failed: %v", err)
 	}
@@ -167,7 +167,7 @@ func TestFrameJson(t *testing.T) {
 	fileName := "/path/to/test.jpg"
 	frame := createTestFrame(1234567890)
 
-	jsonStr, err := receiver.FrameJson("", deviceId, fileName, frame)
+	jsonStr, err := receiver.FrameJson("", nil, deviceId, fileName, frame)
 	if err != nil {
 		t.Fatalf("FrameJson failed: %v", err)
 	}
@@ -189,33 +189,106 @@ func TestFrameJson(t *testing.T) {
 	}
 }
 
-func TestMqttReceiver_EndSession(t *testing.T) {
-	// Create a test client that captures publish calls
-	publishCalls := make([]struct {
-		topic   string
-		payload interface{}
-	}, 0)
+// lastMessage subscribes to filter on bus, returns the last message it received
+func lastMessage(t *testing.T, bus Bus, filter string) func() (Message, bool) {
+	var last *Message
+	_, err := bus.Subscribe(filter, func(msg Message) {
+		last = &msg
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	return func() (Message, bool) {
+		if last == nil {
+			return Message{}, false
+		}
+		return *last, true
+	}
+}
 
-	client := &MqttClient{
-		// Mock the Publish method to capture calls
+func TestMqttReceiver_EndSession(t *testing.T) {
+	closed := NewMemoryBus()
+	_ = closed.Close()
+	rec := NewMqttReceiver(closed, getTestConfig(""), blob.NewMockStore())
+	if err := rec.EndSession(receiver.NewCaptureSession("test-domain")); err == nil {
+		t.Error("Expected error when publishing to a closed bus")
 	}
 
-	rec := NewMqttReceiver(client, getTestConfig("/tmp"))
-	rec.Session = receiver.NewCaptureSession("test-domain")
-	// This test will fail in the actual publish call since we don't have a real MQTT client
-	// but we can test that the method constructs the correct topic and payload
-	err := rec.EndSession()
+	bus := NewMemoryBus()
+	received := lastMessage(t, bus, "end-stream/+")
+	rec = NewMqttReceiver(bus, getTestConfig("/videos"), blob.NewMockStore())
+	session := receiver.NewCaptureSession("test-domain")
+	if err := rec.EndSession(session); err != nil {
+		t.Fatalf("EndSession failed: %v", err)
+	}
+	msg, ok := received()
+	if !ok {
+		t.Fatal("Expected an end-stream message")
+	}
+	if msg.Topic != "end-stream/test-domain" {
+		t.Errorf("Expected topic end-stream/test-domain, got %s", msg.Topic)
+	}
+	want := fmt.Sprintf("/videos/test-domain-%d", session.StartedAt)
+	if string(msg.Payload) != want {
+		t.Errorf("Expected payload %s, got %s", want, msg.Payload)
+	}
+}
 
-	// We expect an error because the client isn't actually connected
-	if err == nil {
-		t.Error("Expected error when publishing without connected client")
+func TestMqttReceiver_ReceiveFrame_Publishes(t *testing.T) {
+	bus := NewMemoryBus()
+	received := lastMessage(t, bus, "image/+")
+	store := blob.NewMockStore()
+	rec := NewMqttReceiver(bus, getTestConfig(""), store)
+	session, err := rec.StartSession("test-domain")
+	if err != nil {
+		t.Fatalf("StartSession failed: %v", err)
+	}
+	frame := createTestFrame(time.Now().UnixMilli())
+	key := receiver.FramePath(rec.videoPath, session, frame)
+	if err := rec.ReceiveFrame(session, frame, key); err != nil {
+		t.Fatalf("ReceiveFrame failed: %v", err)
+	}
+	msg, ok := received()
+	if !ok {
+		t.Fatal("Expected an image message")
+	}
+	if msg.Topic != "image/test-domain" {
+		t.Errorf("Expected topic image/test-domain, got %s", msg.Topic)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		t.Fatalf("Expected a JSON frame message: %v", err)
+	}
+	if !strings.Contains(string(msg.Payload), key) {
+		t.Errorf("Expected the message to reference %s: %s", key, msg.Payload)
 	}
+	if _, err := store.Stat(t.Context(), key); err != nil {
+		t.Errorf("Expected the frame to be stored at %s: %v", key, err)
+	}
+}
+
+func TestMqttReceiver_ReceiveFrame_WritesOriginalBytes(t *testing.T) {
+	tempDir, cleanup := setupTestDir(t)
+	defer cleanup()
 
-	// In a real test with a connected client, we'd verify:
-	// - Topic should be "end-stream/test-domain"
-	// - Payload should be "/videos/test-domain-1234567890"
+	rec := NewMqttReceiver(NewMemoryBus(), getTestConfig(""), blob.NewLocalStore(tempDir))
+	session, err := rec.StartSession("test-domain")
+	if err != nil {
+		t.Fatalf("StartSession failed: %v", err)
+	}
+	frame := createTestFrame(time.Now().UnixMilli())
+	key := receiver.FramePath(rec.videoPath, session, frame)
 
-	_ = publishCalls // Used to capture calls in a more complete test setup
+	if err := rec.ReceiveFrame(session, frame, key); err != nil {
+		t.Fatalf("ReceiveFrame failed: %v", err)
+	}
+	written, err := os.ReadFile(filepath.Join(tempDir, key))
+	if err != nil {
+		t.Fatalf("frame was not written: %v", err)
+	}
+	if !bytes.Equal(written, frame.Buf) {
+		t.Error("Expected the frame's JPEG bytes to be written without re-encoding")
+	}
 }
 
 // Integration test that tests multiple components working together
@@ -223,8 +296,8 @@ func TestMqttReceiver_Integration(t *testing.T) {
 	tempDir, cleanup := setupTestDir(t)
 	defer cleanup()
 
-	client := &MqttClient{}
-	rec := NewMqttReceiver(client, getTestConfig(tempDir))
+	bus := NewMemoryBus()
+	rec := NewMqttReceiver(bus, getTestConfig(""), blob.NewLocalStore(tempDir))
 
 	deviceId := "integration-test-domain"
 
@@ -243,7 +316,7 @@ func TestMqttReceiver_Integration(t *testing.T) {
 
 	// Test JSON generation
 	frame := createTestFrame(time.Now().UnixMilli())
-	jsonStr, err := rec.FrameToJson(tempDir, frame)
+	jsonStr, err := rec.FrameToJson(tempDir, session, frame)
 	if err != nil {
 		t.Fatalf("FrameToJson failed: %v", err)
 	}
@@ -253,7 +326,7 @@ func TestMqttReceiver_Integration(t *testing.T) {
 	}
 
 	// Test frame path generation
-	path := receiver.FramePath(rec.videoPath, rec.Session, frame)
+	path := receiver.FramePath(rec.videoPath, session, frame)
 	expectedPrefix := rec.videoPath + "/" + deviceId + "-"
 	if !strings.HasPrefix(path, expectedPrefix) {
 		t.Errorf("Path should start with %s, got: %s", expectedPrefix, path)
@@ -268,7 +341,7 @@ func BenchmarkFrameJson(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := receiver.FrameJson("", deviceId, fileName, frame)
+		_, err := receiver.FrameJson("", nil, deviceId, fileName, frame)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -276,15 +349,15 @@ func BenchmarkFrameJson(b *testing.B) {
 }
 
 func BenchmarkMqttReceiver_FrameToJson(b *testing.B) {
-	client := &MqttClient{}
-	rec := NewMqttReceiver(client, getTestConfig("/tmp/videos"))
-	rec.Session = receiver.NewCaptureSession("bench-domain")
+	bus := NewMemoryBus()
+	rec := NewMqttReceiver(bus, getTestConfig(""), blob.NewMockStore())
+	session := receiver.NewCaptureSession("bench-domain")
 
 	frame := createTestFrame(9876543210)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := rec.FrameToJson("/tmp", frame)
+		_, err := rec.FrameToJson("/tmp", session, frame)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"devicecapture/internal/config"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// NewTLSConfig the tls.Config for conf, nil when conf isn't Enabled so the system defaults apply
+func NewTLSConfig(conf config.TLSConfig) (*tls.Config, error) {
+	if !conf.Enabled() {
+		return nil, nil
+	}
+	tlsConf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", conf.CAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+	if (conf.CertFile == "") != (conf.KeyFile == "") {
+		return nil, errors.New("client certificates need both a cert & key file")
+	}
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConf, nil
+}
@@ -0,0 +1,279 @@
+package pubsub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"devicecapture/internal/config"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCA a certificate authority generated for a test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	// file the CA certificate as PEM
+	file string
+}
+
+var serialNumber int64
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialNumber++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serialNumber),
+		Subject:               pkix.Name{CommonName: "openblink test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	ca := &testCA{cert: cert, key: key, pool: pool, file: filepath.Join(t.TempDir(), "ca.pem")}
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue a certificate for names (DNS names or IPs), returning the PEM cert & key files
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage, names ...string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialNumber++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	for _, n := range names {
+		if ip := net.ParseIP(n); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, n)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// freePort a port nothing is listening on, for listeners that can't report the port they're given
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = l.Close()
+	}()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// newTLSBroker starts a broker with an ssl:// listener & a wss:// listener, both requiring client
+// certificates signed by ca. Returns their URLs
+func newTLSBroker(t *testing.T, ca *testCA) (sslUrl, wssUrl string) {
+	certFile, keyFile := ca.issue(t, "broker", x509.ExtKeyUsageServerAuth, "127.0.0.1", "broker.test")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	ssl := listeners.NewTCP(listeners.Config{ID: "ssl", Address: "127.0.0.1:0", TLSConfig: tlsConf})
+	if err := server.AddListener(ssl); err != nil {
+		t.Fatal(err)
+	}
+	wssAddr := "127.0.0.1:" + freePort(t)
+	wss := listeners.NewWebsocket(listeners.Config{ID: "wss", Address: wssAddr, TLSConfig: tlsConf})
+	if err := server.AddListener(wss); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	return "ssl://" + ssl.Address(), "wss://" + wssAddr + "/"
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	a := assert.New(t)
+	tlsConf, err := NewTLSConfig(config.TLSConfig{})
+	a.NoError(err)
+	a.Nil(tlsConf, "TLS isn't used unless it's configured")
+
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "client", x509.ExtKeyUsageClientAuth, "client")
+	tlsConf, err = NewTLSConfig(config.TLSConfig{
+		CAFile:     ca.file,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "broker.test",
+	})
+	if a.NoError(err) {
+		a.NotNil(tlsConf.RootCAs)
+		a.Len(tlsConf.Certificates, 1)
+		a.Equal("broker.test", tlsConf.ServerName)
+		a.False(tlsConf.InsecureSkipVerify)
+	}
+
+	_, err = NewTLSConfig(config.TLSConfig{CertFile: certFile})
+	a.Error(err, "a client cert needs its key")
+	_, err = NewTLSConfig(config.TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	a.Error(err)
+	_, err = NewTLSConfig(config.TLSConfig{CAFile: keyFile})
+	a.Error(err, "a CA bundle without certificates is rejected")
+}
+
+func TestMqttClient_TLS(t *testing.T) {
+	ca := newTestCA(t)
+	sslUrl, wssUrl := newTLSBroker(t, ca)
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth, "client")
+	otherCA := newTestCA(t)
+	otherCert, otherKey := otherCA.issue(t, "other", x509.ExtKeyUsageClientAuth, "other")
+	_, sslPort, _ := net.SplitHostPort(sslUrl[len("ssl://"):])
+
+	tests := []struct {
+		name    string
+		broker  string
+		conf    config.TLSConfig
+		wantErr bool
+	}{
+		{
+			name:   "mutual TLS",
+			broker: sslUrl,
+			conf:   config.TLSConfig{CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey},
+		},
+		{
+			name:   "mutual TLS over websockets",
+			broker: wssUrl,
+			conf:   config.TLSConfig{CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey},
+		},
+		{
+			name:   "server name override",
+			broker: "ssl://localhost:" + sslPort,
+			conf:   config.TLSConfig{CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey, ServerName: "broker.test"},
+		},
+		{
+			name:    "host not in the server's certificate",
+			broker:  "ssl://localhost:" + sslPort,
+			conf:    config.TLSConfig{CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey},
+			wantErr: true,
+		},
+		{
+			name:   "insecure skip verify",
+			broker: sslUrl,
+			conf:   config.TLSConfig{CertFile: clientCert, KeyFile: clientKey, InsecureSkipVerify: true},
+		},
+		{
+			name:    "missing client certificate",
+			broker:  sslUrl,
+			conf:    config.TLSConfig{CAFile: ca.file},
+			wantErr: true,
+		},
+		{
+			name:    "client certificate from another CA",
+			broker:  sslUrl,
+			conf:    config.TLSConfig{CAFile: ca.file, CertFile: otherCert, KeyFile: otherKey},
+			wantErr: true,
+		},
+		{
+			name:    "server signed by an unknown CA",
+			broker:  sslUrl,
+			conf:    config.TLSConfig{CAFile: otherCA.file, CertFile: clientCert, KeyFile: clientKey},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			tlsConf, err := NewTLSConfig(tt.conf)
+			if !a.NoError(err) {
+				return
+			}
+			client, err := BrokerHelper("tls-test", tt.broker, "", "", tlsConf)
+			if tt.wantErr {
+				a.Error(err)
+				return
+			}
+			if !a.NoError(err) {
+				return
+			}
+			defer func() {
+				_ = client.Close()
+			}()
+			messages := subscribeChan(t, &client, "detection/+")
+			a.NoError(client.Publish("detection/1", "person"))
+			select {
+			case msg := <-messages:
+				a.Equal("person", string(msg.Payload))
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for a message over TLS")
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// auditCsvHeader the columns of AuditListHandler's CSV export
+var auditCsvHeader = []string{"id", "created_at", "actor", "actor_id", "action", "target_type", "target_id", "source_ip", "diff"}
+
+// AuditListHandler GET /api/audit?actor=&action=&target_type=&target_id=&after=&before=&limit=&format=csv - the
+// audit log, newest first. after & before are RFC 3339 times. limit defaults to devices.DefaultAuditLimit,
+// or devices.MaxAuditLimit for format=csv
+func AuditListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowed(w, r, auth.ActionManage) {
+			return
+		}
+		asCsv := r.URL.Query().Get("format") == "csv"
+		q, err := auditQuery(r.URL.Query(), asCsv)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, err := a.AppDeps.AuditRepo.ListAuditEntries(r.Context(), q)
+		if err != nil {
+			logger.Error().Msgf("AuditListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if asCsv {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+			if err := writeAuditCsv(w, entries); err != nil {
+				logger.Error().Msgf("AuditListHandler -> csvErr %v", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+func auditQuery(values url.Values, export bool) (devices.AuditQuery, error) {
+	q := devices.AuditQuery{
+		Actor:      values.Get("actor"),
+		Action:     values.Get("action"),
+		TargetType: values.Get("target_type"),
+		TargetID:   values.Get("target_id"),
+		Limit:      devices.DefaultAuditLimit,
+	}
+	if export {
+		q.Limit = devices.MaxAuditLimit
+	}
+	var err error
+	if after := values.Get("after"); after != "" {
+		if q.After, err = time.Parse(time.RFC3339, after); err != nil {
+			return q, errors.New("after must be an RFC 3339 time")
+		}
+	}
+	if before := values.Get("before"); before != "" {
+		if q.Before, err = time.Parse(time.RFC3339, before); err != nil {
+			return q, errors.New("before must be an RFC 3339 time")
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil || l < 1 || l > devices.MaxAuditLimit {
+			return q, fmt.Errorf("limit must be between 1 & %d", devices.MaxAuditLimit)
+		}
+		q.Limit = int32(l)
+	}
+	return q, nil
+}
+
+func writeAuditCsv(w http.ResponseWriter, entries []devices.AuditEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(auditCsvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		actorId := ""
+		if e.ActorID != nil {
+			actorId = strconv.FormatInt(*e.ActorID, 10)
+		}
+		err := cw.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			e.Actor,
+			actorId,
+			e.Action,
+			e.TargetType,
+			e.TargetID,
+			e.SourceIP,
+			string(e.Diff),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/audit"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditListHandler(t *testing.T) {
+	a := assert.New(t)
+	deps := domain.NewMockDeps()
+	deps.DeviceRepo = audit.NewDeviceRepo(deps.DeviceRepo, deps.AuditRepo)
+	testApp := app.NewApp(&config.Config{}, nil, nil, deps)
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/devices/{id}", DeviceUpdateHandler(testApp))
+	mux.HandleFunc("PUT /api/filters/{scope}", DetectionFilterUpdateHandler(testApp))
+	mux.HandleFunc("DELETE /api/filters/{scope}", DetectionFilterDeleteHandler(testApp))
+	mux.HandleFunc("GET /api/audit", AuditListHandler(testApp))
+	handler := audit.Middleware(mux)
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.RemoteAddr = "192.0.2.10:51234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	a.Equal(http.StatusOK, do("PUT", "/api/devices/1", `{"name": "porch", "device_url": "http://10.0.0.9:80"}`).Code)
+	a.Equal(http.StatusOK, do("PUT", "/api/filters/global", `{"min_confidence": 0.5}`).Code)
+	a.Equal(http.StatusNoContent, do("DELETE", "/api/filters/global", "").Code)
+	a.Equal(http.StatusNoContent, do("DELETE", "/api/filters/global", "").Code)
+
+	tests := []struct {
+		name    string
+		query   string
+		status  int
+		actions []string
+	}{
+		{name: "everything, newest first", query: "", status: http.StatusOK, actions: []string{devices.AuditFilterDelete, devices.AuditFilterUpdate, devices.AuditDeviceUpdate}},
+		{name: "by action", query: "?action=device.update", status: http.StatusOK, actions: []string{devices.AuditDeviceUpdate}},
+		{name: "by target", query: "?target_type=filter&target_id=global", status: http.StatusOK, actions: []string{devices.AuditFilterDelete, devices.AuditFilterUpdate}},
+		{name: "by actor", query: "?actor=anonymous&limit=1", status: http.StatusOK, actions: []string{devices.AuditFilterDelete}},
+		{name: "unknown actor", query: "?actor=mallory", status: http.StatusOK, actions: []string{}},
+		{name: "before", query: "?before=2000-01-01T00:00:00Z", status: http.StatusOK, actions: []string{}},
+		{name: "invalid time", query: "?after=yesterday", status: http.StatusBadRequest},
+		{name: "invalid limit", query: "?limit=0", status: http.StatusBadRequest},
+		{name: "limit too big", query: "?limit=10001", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do("GET", "/api/audit"+tt.query, "")
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status != http.StatusOK {
+				return
+			}
+			var entries []devices.AuditEntry
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&entries))
+			actions := []string{}
+			for _, e := range entries {
+				actions = append(actions, e.Action)
+			}
+			assert.Equal(t, tt.actions, actions)
+		})
+	}
+
+	w := do("GET", "/api/audit?action=device.update&format=csv", "")
+	a.Equal(http.StatusOK, w.Code)
+	a.Equal("text/csv", w.Header().Get("Content-Type"))
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	a.NoError(err)
+	if !a.Len(rows, 2) {
+		return
+	}
+	a.Equal(auditCsvHeader, rows[0])
+	a.Equal([]string{"anonymous", "", devices.AuditDeviceUpdate, devices.AuditTargetDevice, "1", "192.0.2.10"}, rows[1][2:8])
+	a.Contains(rows[1][8], `"device_url":"http://10.0.0.9:80"`)
+}
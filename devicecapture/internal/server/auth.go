@@ -0,0 +1,432 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+type LoginParams struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type CreateUserParams struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Role optional, defaults to devices.RoleViewer
+	Role string `json:"role"`
+}
+
+type UpdateRoleParams struct {
+	Role string `json:"role"`
+}
+
+type CreateTokenParams struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn optional, ex: "720h". Tokens without it don't expire
+	ExpiresIn string `json:"expires_in"`
+}
+
+// CreatedToken the token is only shown when it's created
+type CreatedToken struct {
+	devices.ApiToken
+	Token string `json:"token"`
+}
+
+// Me the logged-in user & what they can do
+type Me struct {
+	User   devices.User `json:"user"`
+	Scopes []string     `json:"scopes"`
+}
+
+// HealthHandler GET /healthz - 200 when deviceserver can reach the database. Doesn't need a login
+func HealthHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.Db != nil && a.Db.Db != nil {
+			if err := a.Db.Db.Ping(r.Context()); err != nil {
+				logger.Error().Msgf("HealthHandler -> dbErr %v", err)
+				http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+	}
+}
+
+// LoginPageHandler GET /login - the dashboard's login form
+func LoginPageHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filePath := "/usr/src/app/static/login.html"
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, filePath)
+	}
+}
+
+// LoginHandler POST /api/auth/login - checks a LoginParams & sets the session cookie
+func LoginHandler(a *app.App, svc *auth.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var params LoginParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		token, session, err := svc.Login(r.Context(), params.Username, params.Password)
+		if errors.Is(err, auth.ErrInvalidLogin) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			logger.Error().Msgf("LoginHandler -> %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		svc.SetSessionCookie(w, token, session)
+		user, err := a.AppDeps.UserRepo.GetUser(r.Context(), session.UserID)
+		if err != nil {
+			logger.Error().Msgf("LoginHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(user); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// LogoutHandler POST /api/auth/logout - ends the session & clears the cookie
+func LogoutHandler(svc *auth.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(auth.SessionCookie); err == nil && cookie.Value != "" {
+			if err := svc.Logout(r.Context(), cookie.Value); err != nil {
+				logger.Error().Msgf("LogoutHandler -> dbErr %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		svc.ClearSessionCookie(w)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// MeHandler GET /api/auth/me
+func MeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		p, ok := principalFrom(w, r)
+		if !ok {
+			return
+		}
+		me := Me{User: p.User, Scopes: devices.Scopes}
+		if p.Token != nil {
+			me.Scopes = p.Token.Scopes
+		}
+		if err := json.NewEncoder(w).Encode(me); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// UserListHandler GET /api/users
+func UserListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !allowed(w, r, auth.ActionManage) {
+			return
+		}
+		users, err := a.AppDeps.UserRepo.ListUsers(r.Context())
+		if err != nil {
+			logger.Error().Msgf("UserListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(users); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// UserCreateHandler POST /api/users - the body is a CreateUserParams
+func UserCreateHandler(svc *auth.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !allowed(w, r, auth.ActionManage) {
+			return
+		}
+		var params CreateUserParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if params.Role == "" {
+			params.Role = devices.RoleViewer
+		}
+		user, err := svc.CreateUser(r.Context(), params.Username, params.Password, params.Role)
+		if errors.Is(err, devices.ErrInvalidUser) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error().Msgf("UserCreateHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(user); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// UserRoleUpdateHandler PUT /api/users/{id}/role - the body is an UpdateRoleParams, ex: {"role": "operator"}.
+// Admins can't change their own role, so there's always one left
+func UserRoleUpdateHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		user, ok := userFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		var params UpdateRoleParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := devices.ValidateRole(params.Role); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if p, ok := auth.PrincipalFrom(r.Context()); ok && p.User.ID == user.ID {
+			http.Error(w, "You can't change your own role", http.StatusBadRequest)
+			return
+		}
+		updated, err := a.AppDeps.UserRepo.UpdateUserRole(r.Context(), user.ID, params.Role)
+		if err != nil {
+			logger.Error().Msgf("UserRoleUpdateHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(updated); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// GrantListHandler GET /api/users/{id}/grants - the devices & groups a viewer or operator can access
+func GrantListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		user, ok := userFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		grants, err := a.AppDeps.UserRepo.ListGrants(r.Context(), user.ID)
+		if err != nil {
+			logger.Error().Msgf("GrantListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(grants); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// GrantCreateHandler POST /api/users/{id}/grants - the body is a devices.CreateGrantParams,
+// ex: {"device_id": 1} or {"group_id": 2}
+func GrantCreateHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		user, ok := userFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		var params devices.CreateGrantParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		params.UserID = user.ID
+		if err := devices.ValidateGrant(params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if params.DeviceID != nil {
+			if _, err := a.AppDeps.DeviceRepo.GetDevice(r.Context(), *params.DeviceID); err != nil {
+				http.Error(w, "Device not found", http.StatusBadRequest)
+				return
+			}
+		} else if _, err := a.AppDeps.DeviceRepo.GetGroup(r.Context(), *params.GroupID); err != nil {
+			http.Error(w, "Group not found", http.StatusBadRequest)
+			return
+		}
+		grant, err := a.AppDeps.UserRepo.CreateGrant(r.Context(), params)
+		if err != nil {
+			logger.Error().Msgf("GrantCreateHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(grant); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// GrantDeleteHandler DELETE /api/users/{id}/grants/{grantId}
+func GrantDeleteHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		grantId, err := strconv.ParseInt(r.PathValue("grantId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid grant ID", http.StatusBadRequest)
+			return
+		}
+		if err := a.AppDeps.UserRepo.DeleteGrant(r.Context(), user.ID, grantId); err != nil {
+			http.Error(w, "Grant not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// TokenListHandler GET /api/tokens - the logged-in user's API tokens
+func TokenListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		p, ok := principalFrom(w, r)
+		if !ok {
+			return
+		}
+		tokens, err := a.AppDeps.UserRepo.ListApiTokens(r.Context(), p.User.ID)
+		if err != nil {
+			logger.Error().Msgf("TokenListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(tokens); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// TokenCreateHandler POST /api/tokens - the body is a CreateTokenParams, ex: {"name": "home-assistant", "scopes": ["read"]}.
+// The response is the only time the token is shown
+func TokenCreateHandler(svc *auth.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		p, ok := principalFrom(w, r)
+		if !ok {
+			return
+		}
+		var params CreateTokenParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		var expiresAt time.Time
+		if params.ExpiresIn != "" {
+			ttl, err := time.ParseDuration(params.ExpiresIn)
+			if err != nil || ttl <= 0 {
+				http.Error(w, "expires_in must be a positive duration, ex: 720h", http.StatusBadRequest)
+				return
+			}
+			expiresAt = time.Now().Add(ttl)
+		}
+		token, t, err := svc.CreateToken(r.Context(), p.User.ID, params.Name, params.Scopes, expiresAt)
+		if errors.Is(err, devices.ErrInvalidToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error().Msgf("TokenCreateHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(CreatedToken{ApiToken: t, Token: token}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// TokenDeleteHandler DELETE /api/tokens/{id} - revokes one of the logged-in user's tokens
+func TokenDeleteHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFrom(w, r)
+		if !ok {
+			return
+		}
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid token ID", http.StatusBadRequest)
+			return
+		}
+		if err := a.AppDeps.UserRepo.DeleteApiToken(r.Context(), p.User.ID, id); err != nil {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// principalFrom the request's principal, routes that need a user 404 when auth is disabled
+func principalFrom(w http.ResponseWriter, r *http.Request) (auth.Principal, bool) {
+	p, ok := auth.PrincipalFrom(r.Context())
+	if !ok {
+		http.Error(w, "Auth is disabled", http.StatusNotFound)
+	}
+	return p, ok
+}
+
+// allowed 403s unless the request's principal can take the action, see auth.Allowed
+func allowed(w http.ResponseWriter, r *http.Request, action string) bool {
+	if !auth.Allowed(r.Context(), action) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// allowedDevice 403s unless the request's principal can take the action on the device, see auth.AllowedDevice
+func allowedDevice(w http.ResponseWriter, r *http.Request, action string, deviceId int64) bool {
+	if !auth.AllowedDevice(r.Context(), action, deviceId) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// userFromPath the {id} user, only admins can manage users
+func userFromPath(a *app.App, w http.ResponseWriter, r *http.Request) (devices.User, bool) {
+	if !allowed(w, r, auth.ActionManage) {
+		return devices.User{}, false
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return devices.User{}, false
+	}
+	user, err := a.AppDeps.UserRepo.GetUser(r.Context(), id)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return devices.User{}, false
+	}
+	return user, true
+}
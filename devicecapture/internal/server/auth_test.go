@@ -0,0 +1,89 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newAuthTestServer the auth routes behind the auth middleware, with an "admin" user
+func newAuthTestServer(t *testing.T) http.Handler {
+	conf := &config.Config{Auth: config.AuthConfig{Enabled: true, SessionTTL: time.Hour}}
+	deps := domain.NewMockDeps()
+	a := app.NewApp(conf, nil, nil, deps)
+	svc := auth.NewService(conf, deps)
+	if _, err := svc.CreateUser(t.Context(), "admin", "correct horse", devices.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", HealthHandler(a))
+	mux.HandleFunc("POST /api/auth/login", LoginHandler(a, svc))
+	mux.HandleFunc("POST /api/auth/logout", LogoutHandler(svc))
+	mux.HandleFunc("GET /api/auth/me", MeHandler())
+	mux.HandleFunc("GET /api/tokens", TokenListHandler(a))
+	mux.HandleFunc("POST /api/tokens", TokenCreateHandler(svc))
+	mux.HandleFunc("DELETE /api/tokens/{id}", TokenDeleteHandler(a))
+	return svc.Middleware(mux)
+}
+
+func TestLoginHandler(t *testing.T) {
+	a := assert.New(t)
+	handler := newAuthTestServer(t)
+	do := func(method string, path string, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	a.Equal(http.StatusOK, do("GET", "/healthz", "", nil).Code)
+	a.Equal(http.StatusUnauthorized, do("POST", "/api/auth/login", `{"username": "admin", "password": "wrong horse"}`, nil).Code)
+	w := do("POST", "/api/auth/login", `{"username": "admin", "password": "correct horse"}`, nil)
+	a.Equal(http.StatusOK, w.Code)
+	a.NotContains(w.Body.String(), "password", "password hashes aren't returned")
+	cookies := w.Result().Cookies()
+	if !a.Len(cookies, 1) {
+		return
+	}
+	cookie := cookies[0]
+	a.Equal(auth.SessionCookie, cookie.Name)
+	a.True(cookie.HttpOnly)
+	a.Equal(http.SameSiteLaxMode, cookie.SameSite)
+
+	var me Me
+	w = do("GET", "/api/auth/me", "", cookie)
+	a.Equal(http.StatusOK, w.Code)
+	a.NoError(json.NewDecoder(w.Body).Decode(&me))
+	a.Equal("admin", me.User.Username)
+
+	w = do("POST", "/api/tokens", `{"name": "home-assistant", "scopes": ["read"], "expires_in": "720h"}`, cookie)
+	a.Equal(http.StatusCreated, w.Code)
+	var created CreatedToken
+	a.NoError(json.NewDecoder(w.Body).Decode(&created))
+	a.True(strings.HasPrefix(created.Token, auth.TokenPrefix))
+	a.Equal(http.StatusBadRequest, do("POST", "/api/tokens", `{"name": "bad", "scopes": ["root"]}`, cookie).Code)
+
+	r := httptest.NewRequest("GET", "/api/auth/me", nil)
+	r.Header.Set("Authorization", "Bearer "+created.Token)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	a.Equal(http.StatusOK, w.Code)
+	a.NoError(json.NewDecoder(w.Body).Decode(&me))
+	a.Equal([]string{"read"}, me.Scopes, "tokens only have their own scopes")
+
+	a.Equal(http.StatusNoContent, do("POST", "/api/auth/logout", "", cookie).Code)
+	a.Equal(http.StatusUnauthorized, do("GET", "/api/auth/me", "", cookie).Code, "the session ended")
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/deviceconfig"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// DeviceConfigListHandler GET /api/configs?drift=true - every device's config status, drift=true limits
+// it to devices that haven't acknowledged their desired config or report a different one
+func DeviceConfigListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		driftOnly := r.URL.Query().Get("drift") == "true"
+		configs, err := a.AppDeps.ConfigRepo.ListDeviceConfigs(r.Context())
+		if err != nil {
+			logger.Error().Msgf("DeviceConfigListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		visible := auth.DeviceFilter(r.Context(), auth.ActionView)
+		statuses := []deviceconfig.Status{}
+		for _, c := range configs {
+			if !visible(c.DeviceID) {
+				continue
+			}
+			status := deviceconfig.NewStatus(c)
+			if !driftOnly || status.Drifted() {
+				statuses = append(statuses, status)
+			}
+		}
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DeviceConfigHandler GET /api/devices/{id}/config - the desired & reported config
+func DeviceConfigHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		device, ok := deviceFromPath(a, w, r, auth.ActionView)
+		if !ok {
+			return
+		}
+		c, err := a.AppDeps.ConfigRepo.GetDeviceConfig(r.Context(), device.ID)
+		if err != nil {
+			http.Error(w, "Device config not found", http.StatusNotFound)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(deviceconfig.NewStatus(c)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DeviceConfigUpdateHandler PUT /api/devices/{id}/config - sets the desired config & pushes it to the device.
+// The body is a devices.CameraConfig, ex: {"framesize": "VGA", "jpeg_quality": 12, "flash_led": false, "stream_fps": 5}
+func DeviceConfigUpdateHandler(a *app.App, svc *deviceconfig.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		device, ok := deviceFromPath(a, w, r, auth.ActionOperate)
+		if !ok {
+			return
+		}
+		var config devices.CameraConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		c, err := svc.SetDesired(r.Context(), device.ID, config)
+		if errors.Is(err, devices.ErrInvalidConfig) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			logger.Error().Msgf("DeviceConfigUpdateHandler -> %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(deviceconfig.NewStatus(c)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/config"
+	"devicecapture/internal/deviceconfig"
+	"devicecapture/internal/domain"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceConfigHandlers(t *testing.T) {
+	a := assert.New(t)
+	deps := domain.NewMockDeps()
+	testApp := app.NewApp(&config.Config{}, nil, nil, deps)
+	svc := deviceconfig.NewService(deps, nopPublisher{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/configs", DeviceConfigListHandler(testApp))
+	mux.HandleFunc("GET /api/devices/{id}/config", DeviceConfigHandler(testApp))
+	mux.HandleFunc("PUT /api/devices/{id}/config", DeviceConfigUpdateHandler(testApp, svc))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"not set yet", http.MethodGet, "/api/devices/1/config", "", http.StatusNotFound},
+		{"unknown device", http.MethodPut, "/api/devices/999/config", `{"framesize": "VGA", "stream_fps": 5}`, http.StatusNotFound},
+		{"invalid json", http.MethodPut, "/api/devices/1/config", `{"framesize": `, http.StatusBadRequest},
+		{"invalid frame size", http.MethodPut, "/api/devices/1/config", `{"framesize": "8K", "stream_fps": 5}`, http.StatusBadRequest},
+		{"invalid fps", http.MethodPut, "/api/devices/1/config", `{"framesize": "VGA", "stream_fps": 60}`, http.StatusBadRequest},
+		{"set", http.MethodPut, "/api/devices/1/config", `{"framesize": "VGA", "jpeg_quality": 12, "stream_fps": 5}`, http.StatusOK},
+		{"get", http.MethodGet, "/api/devices/1/config", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+
+	// The push hasn't been acknowledged, so the device is drifting
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/configs?drift=true", nil))
+	var drifting []deviceconfig.Status
+	a.NoError(json.NewDecoder(rec.Body).Decode(&drifting))
+	if a.Len(drifting, 1) {
+		a.Equal(int64(1), drifting[0].DeviceID)
+		a.False(drifting[0].Acked)
+	}
+
+	_, err := svc.HandleAck(t.Context(), "config/1/ack", []byte(`{"version": 1, "config": {"framesize": "VGA", "jpeg_quality": 12, "stream_fps": 5}}`))
+	a.NoError(err)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/configs?drift=true", nil))
+	drifting = nil
+	a.NoError(json.NewDecoder(rec.Body).Decode(&drifting))
+	a.Empty(drifting)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/configs", nil))
+	var all []deviceconfig.Status
+	a.NoError(json.NewDecoder(rec.Body).Decode(&all))
+	a.Len(all, 1)
+}
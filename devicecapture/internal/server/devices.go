@@ -0,0 +1,137 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// DeviceApiListHandler GET /api/devices - the devices the caller can view
+func DeviceApiListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ds, err := a.AppDeps.DeviceRepo.ListDevices(r.Context())
+		if err != nil {
+			logger.Error().Msgf("DeviceApiListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ds = auth.VisibleDevices(r.Context(), ds)
+		if err := json.NewEncoder(w).Encode(ds); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DeviceHandler GET /api/devices/{id}
+func DeviceHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		device, ok := deviceFromPath(a, w, r, auth.ActionView)
+		if !ok {
+			return
+		}
+		if err := json.NewEncoder(w).Encode(device); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DeviceCreateHandler POST /api/devices
+func DeviceCreateHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !allowed(w, r, auth.ActionManage) {
+			return
+		}
+		var params devices.CreateDeviceParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := devices.ValidateDevice(params.Name, params.DeviceUrl, params.Timezone, params.Resolution, params.Capabilities); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		device, err := a.AppDeps.DeviceRepo.CreateDevice(r.Context(), params)
+		if err != nil {
+			logger.Error().Msgf("DeviceCreateHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(device); err != nil {
+			logger.Error().Msgf("DeviceCreateHandler -> encodeErr %v", err)
+		}
+	}
+}
+
+// DeviceUpdateHandler PUT /api/devices/{id} - replaces the device. Omit "password", "enabled" or "capabilities" to keep
+// the existing ones
+func DeviceUpdateHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		existing, ok := deviceFromPath(a, w, r, auth.ActionManage)
+		if !ok {
+			return
+		}
+		var params devices.UpdateDeviceParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		params.ID = existing.ID
+		params = params.Merge(existing)
+		if err := devices.ValidateDevice(params.Name, params.DeviceUrl, params.Timezone, params.Resolution, params.Capabilities); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		device, err := a.AppDeps.DeviceRepo.UpdateDevice(r.Context(), params)
+		if err != nil {
+			logger.Error().Msgf("DeviceUpdateHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(device); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DeviceDeleteHandler DELETE /api/devices/{id}
+func DeviceDeleteHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, ok := deviceFromPath(a, w, r, auth.ActionManage)
+		if !ok {
+			return
+		}
+		if err := a.AppDeps.DeviceRepo.DeleteDevice(r.Context(), device.ID); err != nil {
+			logger.Error().Msgf("DeviceDeleteHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deviceFromPath the {id} device if the request's principal can take the action on it
+func deviceFromPath(a *app.App, w http.ResponseWriter, r *http.Request, action string) (devices.Device, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return devices.Device{}, false
+	}
+	device, err := a.AppDeps.DeviceRepo.GetDevice(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return devices.Device{}, false
+	}
+	if !allowedDevice(w, r, action, device.ID) {
+		return devices.Device{}, false
+	}
+	return device, true
+}
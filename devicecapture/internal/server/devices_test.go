@@ -0,0 +1,44 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceUpdateHandler(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	testApp := app.NewApp(&config.Config{}, nil, nil, deps)
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/devices/{id}", DeviceUpdateHandler(testApp))
+	do := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("PUT", "/api/devices/1", strings.NewReader(body)))
+		return w
+	}
+
+	a.Equal(http.StatusOK, do(`{"name": "porch", "device_url": "http://10.0.0.9:80", "enabled": false, "capabilities": ["snapshot", "flash"]}`).Code)
+	w := do(`{"name": "front porch", "device_url": "http://10.0.0.9:80"}`)
+	a.Equal(http.StatusOK, w.Code, w.Body.String())
+	d, err := deps.DeviceRepo.GetDevice(ctx, 1)
+	a.NoError(err)
+	a.Equal("front porch", d.Name)
+	a.False(d.Enabled, "an omitted enabled flag is kept")
+	a.Equal([]string{devices.CapabilitySnapshot, devices.CapabilityFlash}, d.Capabilities, "omitted capabilities are kept")
+
+	a.Equal(http.StatusOK, do(`{"name": "porch", "device_url": "http://10.0.0.9:80", "enabled": true, "capabilities": []}`).Code)
+	d, err = deps.DeviceRepo.GetDevice(ctx, 1)
+	a.NoError(err)
+	a.True(d.Enabled)
+	a.Empty(d.Capabilities)
+	a.Equal(http.StatusBadRequest, do(`{"name": "porch", "device_url": "http://10.0.0.9:80", "capabilities": ["zoom"]}`).Code)
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/discovery"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// DiscoveryListHandler GET /api/discovery?status=pending|approved|rejected - devices that announced themselves.
+// Discovery is for admins, announced devices aren't granted to anyone yet
+func DiscoveryListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !allowed(w, r, auth.ActionManage) {
+			return
+		}
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", devices.DiscoveryPending, devices.DiscoveryApproved, devices.DiscoveryRejected:
+		default:
+			http.Error(w, "status must be pending, approved or rejected", http.StatusBadRequest)
+			return
+		}
+		ds, err := a.AppDeps.DiscoveryRepo.ListDiscoveredDevices(r.Context(), status)
+		if err != nil {
+			logger.Error().Msgf("DiscoveryListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if ds == nil {
+			ds = []devices.DiscoveredDevice{}
+		}
+		if err := json.NewEncoder(w).Encode(ds); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DiscoveryApproveHandler POST /api/discovery/{id}/approve - creates the device & provisions it.
+// The body is a discovery.ApproveParams, ex: {"name": "porch", "location": "front"}
+func DiscoveryApproveHandler(a *app.App, svc *discovery.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		id, ok := discoveredIdFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		var params discovery.ApproveParams
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+		}
+		device, err := svc.Approve(r.Context(), id, params)
+		if err != nil {
+			discoveryError(w, "DiscoveryApproveHandler", err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(device); err != nil {
+			logger.Error().Msgf("DiscoveryApproveHandler -> encodeErr %v", err)
+		}
+	}
+}
+
+// DiscoveryRejectHandler POST /api/discovery/{id}/reject
+func DiscoveryRejectHandler(a *app.App, svc *discovery.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		id, ok := discoveredIdFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		dd, err := svc.Reject(r.Context(), id)
+		if err != nil {
+			discoveryError(w, "DiscoveryRejectHandler", err)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(dd); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+func discoveredIdFromPath(a *app.App, w http.ResponseWriter, r *http.Request) (int64, bool) {
+	if !allowed(w, r, auth.ActionManage) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid discovered device ID", http.StatusBadRequest)
+		return 0, false
+	}
+	if _, err := a.AppDeps.DiscoveryRepo.GetDiscoveredDevice(r.Context(), id); err != nil {
+		http.Error(w, "Discovered device not found", http.StatusNotFound)
+		return 0, false
+	}
+	return id, true
+}
+
+func discoveryError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, discovery.ErrNotPending), errors.Is(err, discovery.ErrAlreadyApproved):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, devices.ErrInvalidDevice):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logger.Error().Msgf("%s -> %v", handler, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
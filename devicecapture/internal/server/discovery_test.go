@@ -0,0 +1,66 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/config"
+	"devicecapture/internal/discovery"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(string, interface{}) error {
+	return nil
+}
+
+func TestDiscoveryHandlers(t *testing.T) {
+	a := assert.New(t)
+	deps := domain.NewMockDeps()
+	testApp := app.NewApp(&config.Config{}, nil, nil, deps)
+	svc := discovery.NewService(deps, nopPublisher{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/discovery", DiscoveryListHandler(testApp))
+	mux.HandleFunc("POST /api/discovery/{id}/approve", DiscoveryApproveHandler(testApp, svc))
+	mux.HandleFunc("POST /api/discovery/{id}/reject", DiscoveryRejectHandler(testApp, svc))
+
+	dd, err := svc.Announce(t.Context(), "announce/de:ad:be:ef:00:01", []byte(`{"device_url": "http://10.0.0.20"}`))
+	a.NoError(err)
+	path := "/api/discovery/" + strconv.FormatInt(dd.ID, 10)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/discovery?status=pending", nil))
+	a.Equal(http.StatusOK, rec.Code)
+	var pending []devices.DiscoveredDevice
+	a.NoError(json.NewDecoder(rec.Body).Decode(&pending))
+	a.Len(pending, 1)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/discovery?status=lost", nil))
+	a.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path+"/approve", strings.NewReader(`{"name": "porch"}`)))
+	a.Equal(http.StatusCreated, rec.Code, rec.Body.String())
+	var d devices.Device
+	a.NoError(json.NewDecoder(rec.Body).Decode(&d))
+	a.Equal("porch", d.Name)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path+"/approve", nil))
+	a.Equal(http.StatusConflict, rec.Code)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path+"/reject", nil))
+	a.Equal(http.StatusConflict, rec.Code)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/discovery/99/approve", nil))
+	a.Equal(http.StatusNotFound, rec.Code)
+}
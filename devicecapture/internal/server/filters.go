@@ -0,0 +1,201 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/audit"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// globalFilterScope path value used for the global detection filter, ex: /api/filters/global
+const globalFilterScope = "global"
+
+// DetectionFilterListHandler GET /api/filters - the global filter & the filters of devices the caller can view
+func DetectionFilterListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		filters, err := a.AppDeps.FilterRepo.ListDetectionFilters(r.Context())
+		if err != nil {
+			logger.Error().Msgf("DetectionFilterListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		visible := auth.DeviceFilter(r.Context(), auth.ActionView)
+		result := []devices.DetectionFilter{}
+		for _, f := range filters {
+			if f.DeviceID == nil || visible(*f.DeviceID) {
+				result = append(result, f)
+			}
+		}
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DetectionFilterHandler GET /api/filters/{scope} - scope is "global" or a device ID
+func DetectionFilterHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deviceId, err := filterScope(a, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !allowedFilter(w, r, deviceId, auth.ActionView) {
+			return
+		}
+		f, dbErr := scopeFilter(a, r, deviceId)
+		if dbErr != nil {
+			logger.Error().Msgf("DetectionFilterHandler -> dbErr %v", dbErr)
+			http.Error(w, dbErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		if f == nil {
+			http.Error(w, "Filter not found", http.StatusNotFound)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(f); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DetectionFilterUpdateHandler PUT /api/filters/{scope}
+func DetectionFilterUpdateHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		deviceId, err := filterScope(a, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !allowedFilter(w, r, deviceId, auth.ActionOperate) {
+			return
+		}
+		var params devices.UpsertDetectionFilterParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		params.DeviceID = deviceId
+		if err := validateFilter(params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		before, dbErr := scopeFilter(a, r, deviceId)
+		if dbErr != nil {
+			logger.Error().Msgf("DetectionFilterUpdateHandler -> dbErr %v", dbErr)
+			http.Error(w, dbErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		record, dbErr := a.AppDeps.FilterRepo.UpsertDetectionFilter(r.Context(), params)
+		if dbErr != nil {
+			logger.Error().Msgf("DetectionFilterUpdateHandler -> dbErr %v", dbErr)
+			http.Error(w, dbErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		audit.Record(r.Context(), a.AppDeps.AuditRepo, devices.AuditFilterUpdate, devices.AuditTargetFilter, r.PathValue("scope"), before, record)
+		if err := json.NewEncoder(w).Encode(record); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// DetectionFilterDeleteHandler DELETE /api/filters/{scope}
+func DetectionFilterDeleteHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceId, err := filterScope(a, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !allowedFilter(w, r, deviceId, auth.ActionOperate) {
+			return
+		}
+		before, dbErr := scopeFilter(a, r, deviceId)
+		if dbErr != nil {
+			logger.Error().Msgf("DetectionFilterDeleteHandler -> dbErr %v", dbErr)
+			http.Error(w, dbErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		if dbErr := a.AppDeps.FilterRepo.DeleteDetectionFilter(r.Context(), deviceId); dbErr != nil {
+			logger.Error().Msgf("DetectionFilterDeleteHandler -> dbErr %v", dbErr)
+			http.Error(w, dbErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		if before != nil {
+			audit.Record(r.Context(), a.AppDeps.AuditRepo, devices.AuditFilterDelete, devices.AuditTargetFilter, r.PathValue("scope"), before, nil)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// filterScope nil for the global filter, otherwise the (valid) device ID
+func filterScope(a *app.App, r *http.Request) (*int64, error) {
+	scope := r.PathValue("scope")
+	if scope == globalFilterScope {
+		return nil, nil
+	}
+	deviceId, err := strconv.ParseInt(scope, 10, 64)
+	if err != nil {
+		return nil, errors.New("scope must be \"global\" or a device ID")
+	}
+	if _, err := a.AppDeps.DeviceRepo.GetDevice(r.Context(), deviceId); err != nil {
+		return nil, errors.New("invalid device ID")
+	}
+	return &deviceId, nil
+}
+
+// scopeFilter the scope's filter, nil if it doesn't have one. GetDetectionFilters returns the global filter with the
+// device's, device IDs start at 1 so 0 only gets the global one
+func scopeFilter(a *app.App, r *http.Request, deviceId *int64) (*devices.DetectionFilter, error) {
+	var id int64
+	if deviceId != nil {
+		id = *deviceId
+	}
+	filters, err := a.AppDeps.FilterRepo.GetDetectionFilters(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range filters {
+		if (f.DeviceID == nil) == (deviceId == nil) {
+			return &f, nil
+		}
+	}
+	return nil, nil
+}
+
+// allowedFilter a device's filter is up to its operators, the global filter applies to every device so only admins
+// can change it. Anyone can view it
+func allowedFilter(w http.ResponseWriter, r *http.Request, deviceId *int64, action string) bool {
+	if deviceId != nil {
+		return allowedDevice(w, r, action, *deviceId)
+	}
+	if action != auth.ActionView {
+		action = auth.ActionManage
+	}
+	return allowed(w, r, action)
+}
+
+func validateFilter(params devices.UpsertDetectionFilterParams) error {
+	if params.MinConfidence < 0 || params.MinConfidence > 1 {
+		return errors.New("min_confidence must be between 0 and 1")
+	}
+	for _, c := range params.LabelConfidence {
+		if c < 0 || c > 1 {
+			return errors.New("label_confidence values must be between 0 and 1")
+		}
+	}
+	for label, alias := range params.Aliases {
+		if label == "" || alias == "" {
+			return errors.New("aliases cannot be empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectionFilterHandler(t *testing.T) {
+	a := assert.New(t)
+	testApp := app.NewApp(&config.Config{}, nil, nil, domain.NewMockDeps())
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/filters/{scope}", DetectionFilterHandler(testApp))
+	mux.HandleFunc("PUT /api/filters/{scope}", DetectionFilterUpdateHandler(testApp))
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	a.Equal(http.StatusNotFound, do("GET", "/api/filters/global", "").Code)
+	a.Equal(http.StatusOK, do("PUT", "/api/filters/global", `{"min_confidence": 0.5}`).Code)
+	a.Equal(http.StatusOK, do("PUT", "/api/filters/1", `{"min_confidence": 0.8}`).Code)
+
+	tests := []struct {
+		scope      string
+		wantStatus int
+		want       float64
+	}{
+		{scope: "global", wantStatus: http.StatusOK, want: 0.5},
+		{scope: "1", wantStatus: http.StatusOK, want: 0.8},
+		{scope: "2", wantStatus: http.StatusNotFound},
+		{scope: "porch", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			w := do("GET", "/api/filters/"+tt.scope, "")
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var f devices.DetectionFilter
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&f))
+			assert.Equal(t, tt.want, f.MinConfidence)
+			assert.Equal(t, tt.scope == "global", f.DeviceID == nil)
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package server
+
+import (
+	"context"
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Group actions, POST /api/groups/{id}/actions/{action}
+const (
+	GroupActionSnapshot = "snapshot"
+	GroupActionStream   = "stream"
+	GroupActionSettings = "settings"
+	GroupActionMute     = "mute"
+	GroupActionUnmute   = "unmute"
+)
+
+// groupActionConcurrency how many devices a group action works on at once
+const groupActionConcurrency = 8
+
+// groupSnapshotTimeout per-device timeout for GroupActionSnapshot
+const groupSnapshotTimeout = 30 * time.Second
+
+// GroupCamera the camera.CameraService methods group actions fan out to
+type GroupCamera interface {
+	Snapshot(ctx context.Context, d devices.Device) error
+	TryStartStream(ctx context.Context, d devices.Device) error
+}
+
+// GroupActionResult the outcome of a group action for one device. Device is set for actions that change it
+type GroupActionResult struct {
+	DeviceID   int64           `json:"device_id"`
+	DeviceName string          `json:"device_name"`
+	Ok         bool            `json:"ok"`
+	Error      string          `json:"error,omitempty"`
+	Device     *devices.Device `json:"device,omitempty"`
+}
+
+type GroupActionResponse struct {
+	GroupID int64               `json:"group_id"`
+	Action  string              `json:"action"`
+	Results []GroupActionResult `json:"results"`
+}
+
+// GroupMuteParams the body for GroupActionMute, ex: {"duration": "1h30m"}
+type GroupMuteParams struct {
+	Duration string `json:"duration"`
+}
+
+// GroupListHandler GET /api/groups - viewers & operators only get groups with devices they can access
+func GroupListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		groups, err := a.AppDeps.DeviceRepo.ListGroups(r.Context())
+		if err != nil {
+			logger.Error().Msgf("GroupListHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		visible := []devices.Group{}
+		for _, g := range groups {
+			if g, ok := auth.VisibleGroup(r.Context(), g); ok {
+				visible = append(visible, g)
+			}
+		}
+		if err := json.NewEncoder(w).Encode(visible); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// GroupHandler GET /api/groups/{id}
+func GroupHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		group, ok := groupFromPath(a, w, r, auth.ActionView)
+		if !ok {
+			return
+		}
+		if err := json.NewEncoder(w).Encode(group); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// GroupCreateHandler POST /api/groups
+func GroupCreateHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !allowed(w, r, auth.ActionManage) {
+			return
+		}
+		var params devices.CreateGroupParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := devices.ValidateGroup(params.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		group, err := a.AppDeps.DeviceRepo.CreateGroup(r.Context(), params)
+		if err != nil {
+			logger.Error().Msgf("GroupCreateHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(group); err != nil {
+			logger.Error().Msgf("GroupCreateHandler -> encodeErr %v", err)
+		}
+	}
+}
+
+// GroupUpdateHandler PUT /api/groups/{id}
+func GroupUpdateHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		existing, ok := groupFromPath(a, w, r, auth.ActionManage)
+		if !ok {
+			return
+		}
+		var params devices.UpdateGroupParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		params.ID = existing.ID
+		if err := devices.ValidateGroup(params.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		group, err := a.AppDeps.DeviceRepo.UpdateGroup(r.Context(), params)
+		if err != nil {
+			logger.Error().Msgf("GroupUpdateHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(group); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// GroupDeleteHandler DELETE /api/groups/{id} - the group's devices are kept
+func GroupDeleteHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, ok := groupFromPath(a, w, r, auth.ActionManage)
+		if !ok {
+			return
+		}
+		if err := a.AppDeps.DeviceRepo.DeleteGroup(r.Context(), group.ID); err != nil {
+			logger.Error().Msgf("GroupDeleteHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GroupDevicesHandler GET /api/groups/{id}/devices
+func GroupDevicesHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		group, ok := groupFromPath(a, w, r, auth.ActionView)
+		if !ok {
+			return
+		}
+		ds, err := a.AppDeps.DeviceRepo.ListGroupDevices(r.Context(), group.ID)
+		if err != nil {
+			logger.Error().Msgf("GroupDevicesHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ds = auth.VisibleDevices(r.Context(), ds)
+		if err := json.NewEncoder(w).Encode(ds); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// GroupDeviceAddHandler PUT /api/groups/{id}/devices/{deviceId}
+func GroupDeviceAddHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, device, ok := groupDeviceFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		if err := a.AppDeps.DeviceRepo.AddGroupDevice(r.Context(), group.ID, device.ID); err != nil {
+			logger.Error().Msgf("GroupDeviceAddHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GroupDeviceRemoveHandler DELETE /api/groups/{id}/devices/{deviceId}
+func GroupDeviceRemoveHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, device, ok := groupDeviceFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		if err := a.AppDeps.DeviceRepo.RemoveGroupDevice(r.Context(), group.ID, device.ID); err != nil {
+			logger.Error().Msgf("GroupDeviceRemoveHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GroupActionHandler POST /api/groups/{id}/actions/{action} - runs the action on every device in the group
+// the caller can operate & returns a GroupActionResponse with a result per device. Bodies:
+// snapshot, stream & unmute: none
+// settings: devices.GroupSettings, ex: {"enabled": false, "add_tags": ["outdoor"]}
+// mute: GroupMuteParams, ex: {"duration": "1h"}
+// Streams run in the background, so "ok" means the stream was reserved & started, see camera.TryStartStream
+func GroupActionHandler(a *app.App, cam GroupCamera) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		group, ok := groupFromPath(a, w, r, auth.ActionOperate)
+		if !ok {
+			return
+		}
+		action := r.PathValue("action")
+		repo := a.AppDeps.DeviceRepo
+		var fn func(ctx context.Context, d devices.Device) (*devices.Device, error)
+		switch action {
+		case GroupActionSnapshot:
+			fn = func(ctx context.Context, d devices.Device) (*devices.Device, error) {
+				snapCtx, cancel := context.WithTimeout(ctx, groupSnapshotTimeout)
+				defer cancel()
+				return nil, cam.Snapshot(snapCtx, d)
+			}
+		case GroupActionStream:
+			fn = func(ctx context.Context, d devices.Device) (*devices.Device, error) {
+				return nil, cam.TryStartStream(ctx, d)
+			}
+		case GroupActionSettings:
+			var settings devices.GroupSettings
+			if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			fn = func(ctx context.Context, d devices.Device) (*devices.Device, error) {
+				params := settings.Apply(d)
+				if err := devices.ValidateDevice(params.Name, params.DeviceUrl, params.Timezone, params.Resolution, params.Capabilities); err != nil {
+					return nil, err
+				}
+				updated, err := repo.UpdateDevice(ctx, params)
+				return &updated, err
+			}
+		case GroupActionMute, GroupActionUnmute:
+			var until time.Time
+			if action == GroupActionMute {
+				var params GroupMuteParams
+				if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+					http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+					return
+				}
+				duration, err := time.ParseDuration(params.Duration)
+				if err != nil || duration <= 0 {
+					http.Error(w, "duration must be a positive duration, ex: 1h30m", http.StatusBadRequest)
+					return
+				}
+				until = time.Now().Add(duration)
+			}
+			fn = func(ctx context.Context, d devices.Device) (*devices.Device, error) {
+				updated, err := repo.MuteDevice(ctx, d.ID, until)
+				return &updated, err
+			}
+		default:
+			http.Error(w, fmt.Sprintf("Unknown group action %s", action), http.StatusNotFound)
+			return
+		}
+
+		ds, err := repo.ListGroupDevices(r.Context(), group.ID)
+		if err != nil {
+			logger.Error().Msgf("GroupActionHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ds = slices.DeleteFunc(ds, func(d devices.Device) bool {
+			return !auth.AllowedDevice(r.Context(), auth.ActionOperate, d.ID)
+		})
+		res := GroupActionResponse{
+			GroupID: group.ID,
+			Action:  action,
+			Results: fanOut(r.Context(), ds, fn),
+		}
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			logger.Error().Msgf("GroupActionHandler -> encodeErr %v", err)
+		}
+	}
+}
+
+// fanOut runs fn for each device, groupActionConcurrency at a time. Results are in the same order as ds
+func fanOut(ctx context.Context, ds []devices.Device, fn func(ctx context.Context, d devices.Device) (*devices.Device, error)) []GroupActionResult {
+	results := make([]GroupActionResult, len(ds))
+	sem := make(chan struct{}, groupActionConcurrency)
+	var wg sync.WaitGroup
+	for i, d := range ds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result := GroupActionResult{DeviceID: d.ID, DeviceName: d.Name, Ok: true}
+			updated, err := fn(ctx, d)
+			if err != nil {
+				result.Ok = false
+				result.Error = err.Error()
+			} else {
+				result.Device = updated
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// groupFromPath the {id} group if the request's principal can take the action on it. Viewers & operators can only
+// see groups with devices they can access, & only those devices
+func groupFromPath(a *app.App, w http.ResponseWriter, r *http.Request, action string) (devices.Group, bool) {
+	if !allowed(w, r, action) {
+		return devices.Group{}, false
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return devices.Group{}, false
+	}
+	group, err := a.AppDeps.DeviceRepo.GetGroup(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return devices.Group{}, false
+	}
+	group, ok := auth.VisibleGroup(r.Context(), group)
+	if !ok {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return devices.Group{}, false
+	}
+	return group, true
+}
+
+func groupDeviceFromPath(a *app.App, w http.ResponseWriter, r *http.Request) (devices.Group, devices.Device, bool) {
+	group, ok := groupFromPath(a, w, r, auth.ActionManage)
+	if !ok {
+		return devices.Group{}, devices.Device{}, false
+	}
+	deviceId, err := strconv.ParseInt(r.PathValue("deviceId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return devices.Group{}, devices.Device{}, false
+	}
+	device, err := a.AppDeps.DeviceRepo.GetDevice(r.Context(), deviceId)
+	if err != nil {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return devices.Group{}, devices.Device{}, false
+	}
+	return group, device, true
+}
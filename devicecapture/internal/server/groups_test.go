@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"devicecapture/internal/app"
+	"devicecapture/internal/camera"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/detection"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCamera snapshots fail for devices named "fail"
+type fakeCamera struct{}
+
+func (fakeCamera) Snapshot(_ context.Context, d devices.Device) error {
+	if d.Name == "fail" {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (fakeCamera) TryStartStream(context.Context, devices.Device) error {
+	return nil
+}
+
+// newGroupTestApp an App on mock deps, with both mock devices in group 1
+func newGroupTestApp(t *testing.T) (*app.App, *http.ServeMux) {
+	deps := domain.NewMockDeps()
+	a := app.NewApp(&config.Config{}, nil, nil, deps)
+	g, err := deps.DeviceRepo.CreateGroup(t.Context(), devices.CreateGroupParams{Name: "outdoor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []devices.Device{devices.GetMockDevice(), devices.GetTestFailDevice()} {
+		if err := deps.DeviceRepo.AddGroupDevice(t.Context(), g.ID, d.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/groups/{id}/actions/{action}", GroupActionHandler(a, fakeCamera{}))
+	return a, mux
+}
+
+func TestGroupActionHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantOk     map[string]bool
+	}{
+		{name: "snapshot", path: "/api/groups/1/actions/snapshot", wantStatus: http.StatusOK, wantOk: map[string]bool{"fail": false, "mockdevice": true}},
+		{name: "stream", path: "/api/groups/1/actions/stream", wantStatus: http.StatusOK, wantOk: map[string]bool{"fail": true, "mockdevice": true}},
+		{name: "settings", path: "/api/groups/1/actions/settings", body: `{"resolution": "UXGA", "add_tags": ["outdoor"]}`, wantStatus: http.StatusOK, wantOk: map[string]bool{"fail": true, "mockdevice": true}},
+		{name: "invalid settings", path: "/api/groups/1/actions/settings", body: `{"resolution": "big"}`, wantStatus: http.StatusOK, wantOk: map[string]bool{"fail": false, "mockdevice": false}},
+		{name: "mute", path: "/api/groups/1/actions/mute", body: `{"duration": "1h"}`, wantStatus: http.StatusOK, wantOk: map[string]bool{"fail": true, "mockdevice": true}},
+		{name: "mute without duration", path: "/api/groups/1/actions/mute", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown action", path: "/api/groups/1/actions/reboot", wantStatus: http.StatusNotFound},
+		{name: "unknown group", path: "/api/groups/99/actions/snapshot", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			_, mux := newGroupTestApp(t)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			a.Equal(tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.wantOk == nil {
+				return
+			}
+			var res GroupActionResponse
+			a.NoError(json.NewDecoder(rec.Body).Decode(&res))
+			ok := map[string]bool{}
+			for _, result := range res.Results {
+				ok[result.DeviceName] = result.Ok
+				a.Equal(result.Ok, result.Error == "")
+			}
+			a.Equal(tt.wantOk, ok)
+		})
+	}
+}
+
+func TestGroupActionHandler_Updates(t *testing.T) {
+	a := assert.New(t)
+	testApp, mux := newGroupTestApp(t)
+	ctx := t.Context()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/groups/1/actions/settings",
+		strings.NewReader(`{"enabled": false, "add_tags": ["outdoor"]}`)))
+	a.Equal(http.StatusOK, rec.Code)
+	d, err := testApp.AppDeps.DeviceRepo.GetDevice(ctx, devices.GetMockDevice().ID)
+	a.NoError(err)
+	a.False(d.Enabled)
+	a.Equal([]string{"outdoor"}, d.Tags)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/groups/1/actions/mute", strings.NewReader(`{"duration": "1h"}`)))
+	a.Equal(http.StatusOK, rec.Code)
+	d, err = testApp.AppDeps.DeviceRepo.GetDevice(ctx, devices.GetMockDevice().ID)
+	a.NoError(err)
+	a.True(d.IsMuted(time.Now()))
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/groups/1/actions/unmute", nil))
+	a.Equal(http.StatusOK, rec.Code)
+	d, err = testApp.AppDeps.DeviceRepo.GetDevice(ctx, devices.GetMockDevice().ID)
+	a.NoError(err)
+	a.False(d.IsMuted(time.Now()))
+}
+
+func TestDetectionDeviceFilter(t *testing.T) {
+	a := assert.New(t)
+	testApp, _ := newGroupTestApp(t)
+	extra, err := testApp.AppDeps.DeviceRepo.CreateDevice(t.Context(), devices.CreateDeviceParams{Name: "garage", DeviceUrl: "http://10.0.0.9"})
+	a.NoError(err)
+
+	rec := httptest.NewRecorder()
+	include, ok := detectionDeviceFilter(testApp, rec, httptest.NewRequest(http.MethodGet, "/detection-stream", nil))
+	a.True(ok)
+	a.True(include(extra.ID), "no group streams every device")
+
+	include, ok = detectionDeviceFilter(testApp, rec, httptest.NewRequest(http.MethodGet, "/detection-stream?group=1", nil))
+	a.True(ok)
+	a.True(include(1))
+	a.True(include(2))
+	a.False(include(extra.ID))
+
+	rec = httptest.NewRecorder()
+	_, ok = detectionDeviceFilter(testApp, rec, httptest.NewRequest(http.MethodGet, "/detection-stream?group=99", nil))
+	a.False(ok)
+	a.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestGroupActionHandler_FanOut snapshots both devices at once through one shared MqttReceiver, each frame &
+// end-stream message has to name its own device. Run with -race
+func TestGroupActionHandler_FanOut(t *testing.T) {
+	a := assert.New(t)
+	testApp, _ := newGroupTestApp(t)
+	deps := testApp.AppDeps
+	var jpg bytes.Buffer
+	a.NoError(jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 2, 2)), nil))
+	for _, d := range []devices.Device{devices.GetMockDevice(), devices.GetTestFailDevice()} {
+		device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/jpeg")
+			_, _ = w.Write(jpg.Bytes())
+		}))
+		t.Cleanup(device.Close)
+		_, err := deps.DeviceRepo.UpdateDevice(t.Context(), devices.UpdateDeviceParams{ID: d.ID, Name: d.Name, DeviceUrl: device.URL})
+		a.NoError(err)
+	}
+
+	conf := &config.Config{VideoPath: "videos"}
+	bus := pubsub.NewMemoryBus()
+	var mu sync.Mutex
+	var messages []pubsub.Message
+	_, err := bus.Subscribe("#", func(msg pubsub.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, msg)
+	})
+	a.NoError(err)
+	deps.FrameRepo = pubsub.NewMqttReceiver(bus, conf, deps.BlobStore)
+	cam := camera.NewCameraService(conf, deps, detection.MockDetectionService{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/groups/{id}/actions/{action}", GroupActionHandler(testApp, cam))
+
+	for range 5 {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/groups/1/actions/snapshot", nil))
+		a.Equal(http.StatusOK, w.Code)
+		var res GroupActionResponse
+		a.NoError(json.NewDecoder(w.Body).Decode(&res))
+		for _, result := range res.Results {
+			a.True(result.Ok, result.Error)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	counts := map[string]int{}
+	for _, msg := range messages {
+		topic, deviceId, _ := strings.Cut(msg.Topic, "/")
+		counts[topic]++
+		switch topic {
+		case "image":
+			a.Contains(string(msg.Payload), "videos/"+deviceId+"-", "frames are published on their own device's topic")
+		case "end-stream":
+			a.True(strings.HasPrefix(string(msg.Payload), "videos/"+deviceId+"-"), "%s announced %s", msg.Topic, msg.Payload)
+		}
+	}
+	a.Equal(10, counts["image"])
+	a.Equal(10, counts["end-stream"])
+}
+
+// TestGroupActionHandler_ConcurrentStreams streams the group from several requests at once, each device's stream is
+// only started by one of them & the others report camera.ErrMultiplexing
+func TestGroupActionHandler_ConcurrentStreams(t *testing.T) {
+	a := assert.New(t)
+	testApp, _ := newGroupTestApp(t)
+	deps := testApp.AppDeps
+	for _, d := range []devices.Device{devices.GetMockDevice(), devices.GetTestFailDevice()} {
+		// Nothing listens, the streams end after their timeout
+		_, err := deps.DeviceRepo.UpdateDevice(t.Context(), devices.UpdateDeviceParams{ID: d.ID, Name: d.Name, DeviceUrl: "http://127.0.0.1:1"})
+		a.NoError(err)
+	}
+	cam := camera.NewCameraService(&config.Config{VideoPath: "videos"}, deps, detection.MockDetectionService{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/groups/{id}/actions/{action}", GroupActionHandler(testApp, cam))
+
+	var mu sync.Mutex
+	started := map[int64]int{}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/groups/1/actions/stream", nil))
+			var res GroupActionResponse
+			a.NoError(json.NewDecoder(w.Body).Decode(&res))
+			mu.Lock()
+			defer mu.Unlock()
+			for _, result := range res.Results {
+				if result.Ok {
+					started[result.DeviceID]++
+				} else {
+					a.Equal(camera.ErrMultiplexing.Error(), result.Error)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	a.Equal(map[int64]int{devices.GetMockDevice().ID: 1, devices.GetTestFailDevice().ID: 1}, started)
+}
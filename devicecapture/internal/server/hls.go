@@ -0,0 +1,104 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/hls"
+	"devicecapture/internal/logger"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LivePlaylistHandler GET /api/devices/{id}/live.m3u8 - HLS playlist of the device's latest segments while it's
+// streaming, 404 when it isn't
+func LivePlaylistHandler(a *app.App, svc *hls.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, ok := deviceFromPath(a, w, r, auth.ActionView)
+		if !ok {
+			return
+		}
+		playlist, err := svc.LivePlaylist(r.Context(), device.ID, time.Now())
+		if err != nil {
+			hlsError(w, "LivePlaylistHandler", err)
+			return
+		}
+		w.Header().Set("Content-Type", hls.ContentTypePlaylist)
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write(playlist)
+	}
+}
+
+// RecordingPlaylistHandler GET /api/recordings/{id}/index.m3u8 - HLS playlist of a capture session's frames,
+// ex: /api/recordings/1-123/index.m3u8 for videos/1-123/
+func RecordingPlaylistHandler(a *app.App, svc *hls.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := recordingFromPath(w, r)
+		if !ok {
+			return
+		}
+		playlist, err := svc.RecordingPlaylist(r.Context(), id, time.Now())
+		if err != nil {
+			hlsError(w, "RecordingPlaylistHandler", err)
+			return
+		}
+		w.Header().Set("Content-Type", hls.ContentTypePlaylist)
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write(playlist)
+	}
+}
+
+// RecordingSegmentHandler GET /api/recordings/{id}/segments/{segment} - a recording's MPEG-TS segment, ex: 0.ts
+func RecordingSegmentHandler(a *app.App, svc *hls.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := recordingFromPath(w, r)
+		if !ok {
+			return
+		}
+		name, ok := strings.CutSuffix(r.PathValue("segment"), ".ts")
+		sequence, err := strconv.Atoi(name)
+		if !ok || err != nil {
+			http.Error(w, "Segment not found", http.StatusNotFound)
+			return
+		}
+		segment, err := svc.Segment(r.Context(), id, sequence, time.Now())
+		if err != nil {
+			hlsError(w, "RecordingSegmentHandler", err)
+			return
+		}
+		w.Header().Set("Content-Type", hls.ContentTypeSegment)
+		// Deleting a frame can change the segments after it, see hls.SegmentKey
+		w.Header().Set("Cache-Control", "private, no-cache")
+		_, _ = w.Write(segment)
+	}
+}
+
+// recordingFromPath the {id} recording if the request's principal can view its device
+func recordingFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	deviceId, err := hls.ParseRecordingID(id)
+	if err != nil {
+		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+		return "", false
+	}
+	if !allowedDevice(w, r, auth.ActionView, deviceId) {
+		return "", false
+	}
+	return id, true
+}
+
+func hlsError(w http.ResponseWriter, handler string, err error) {
+	switch {
+	case errors.Is(err, hls.ErrNotLive):
+		http.Error(w, "Device isn't streaming", http.StatusNotFound)
+	case errors.Is(err, hls.ErrRecordingNotFound):
+		http.Error(w, "Recording not found", http.StatusNotFound)
+	case errors.Is(err, hls.ErrSegmentNotFound):
+		http.Error(w, "Segment not found", http.StatusNotFound)
+	default:
+		logger.Error().Msgf("%s -> %v", handler, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
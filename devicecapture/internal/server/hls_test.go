@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"devicecapture/internal/app"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/hls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingEncoder "encodes" a segment as its frame count, failing when err is set
+type countingEncoder struct {
+	err error
+}
+
+func (e countingEncoder) Encode(_ context.Context, frames [][]byte, _ []time.Duration, _ time.Duration) ([]byte, error) {
+	return []byte(fmt.Sprintf("%d frames", len(frames))), e.err
+}
+
+func TestHlsHandlers(t *testing.T) {
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	conf := &config.Config{VideoPath: "videos", Hls: config.HlsConfig{SegmentDuration: 10 * time.Millisecond, LiveSegments: 3}}
+	testApp := app.NewApp(conf, nil, nil, deps)
+	// Recordings 1-1000 & 2-1000, 2-1000 fails to encode
+	for _, key := range []string{"videos/1-1000/output-1-1000.jpeg", "videos/1-1000/output-1-1005.jpeg", "videos/2-1000/output-2-1000.jpeg"} {
+		if _, err := deps.ImageRepo.CreateImage(ctx, devices.CreateImageParams{DeviceID: int64(key[7] - '0'), ImagePath: key}); err != nil {
+			t.Fatal(err)
+		}
+		if err := deps.BlobStore.Put(ctx, key, []byte("jpeg"), "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// No longer recording
+	time.Sleep(2 * conf.Hls.SegmentDuration)
+	mux := http.NewServeMux()
+	recordings := hls.NewService(conf, deps, countingEncoder{})
+	mux.HandleFunc("GET /api/devices/{id}/live.m3u8", LivePlaylistHandler(testApp, recordings))
+	mux.HandleFunc("GET /api/recordings/{id}/index.m3u8", RecordingPlaylistHandler(testApp, recordings))
+	mux.HandleFunc("GET /api/recordings/{id}/segments/{segment}", RecordingSegmentHandler(testApp, recordings))
+	failing := hls.NewService(conf, deps, countingEncoder{err: errors.New("ffmpeg: exit status 1")})
+	mux.HandleFunc("GET /failing/{id}/segments/{segment}", RecordingSegmentHandler(testApp, failing))
+
+	tests := []struct {
+		name        string
+		path        string
+		want        int
+		wantType    string
+		wantCache   string
+		wantContain string
+	}{
+		{
+			name:        "recording playlist",
+			path:        "/api/recordings/1-1000/index.m3u8",
+			want:        http.StatusOK,
+			wantType:    hls.ContentTypePlaylist,
+			wantCache:   "no-cache",
+			wantContain: "#EXT-X-PLAYLIST-TYPE:VOD\n",
+		},
+		{
+			name:        "segment",
+			path:        "/api/recordings/1-1000/segments/0.ts",
+			want:        http.StatusOK,
+			wantType:    hls.ContentTypeSegment,
+			wantCache:   "private, no-cache",
+			wantContain: "2 frames",
+		},
+		{name: "not live", path: "/api/devices/1/live.m3u8", want: http.StatusNotFound, wantContain: "Device isn't streaming"},
+		{name: "unknown recording", path: "/api/recordings/1-2000/index.m3u8", want: http.StatusNotFound},
+		{name: "invalid recording", path: "/api/recordings/1-1000.jpeg/index.m3u8", want: http.StatusBadRequest},
+		{name: "unknown segment", path: "/api/recordings/1-1000/segments/1.ts", want: http.StatusNotFound},
+		{name: "invalid segment", path: "/api/recordings/1-1000/segments/-.ts", want: http.StatusNotFound},
+		{name: "encoding error", path: "/failing/2-1000/segments/0.ts", want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := assert.New(t)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			a.Equal(tt.want, w.Code, w.Body.String())
+			if tt.wantType != "" {
+				a.Equal(tt.wantType, w.Header().Get("Content-Type"))
+				a.Equal(tt.wantCache, w.Header().Get("Cache-Control"))
+			}
+			a.Contains(w.Body.String(), tt.wantContain)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/audit"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/logger"
+	"devicecapture/internal/variants"
+	"net/http"
+	"strconv"
+)
+
+// ImageHandler GET /api/images/{id}?size=thumb|medium|original&annotated=1
+func ImageHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		img, ok := imageFromPath(a, w, r, auth.ActionView)
+		if !ok {
+			return
+		}
+		key := img.ImagePath
+		if r.URL.Query().Get("annotated") == "1" {
+			if img.AnnotatedPath == "" {
+				http.Error(w, "Image has not been annotated", http.StatusNotFound)
+				return
+			}
+			key = img.AnnotatedPath
+		}
+		serveBlob(w, r, a.AppDeps.BlobStore, key, r.URL.Query().Get("size"), a.Conf.Blob.SignedUrlTTL)
+	}
+}
+
+// CameraSnapshotHandler GET /camera/{id}/snapshot?size=thumb|medium|original&annotated=1 - the device's latest stored
+// frame, ex: for Home Assistant's camera entity. 404 until it's sent one
+func CameraSnapshotHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, ok := deviceFromPath(a, w, r, auth.ActionView)
+		if !ok {
+			return
+		}
+		img, err := a.AppDeps.ImageRepo.GetLatestDeviceImage(r.Context(), device.ID)
+		if err != nil {
+			http.Error(w, "No frames stored yet", http.StatusNotFound)
+			return
+		}
+		key := img.ImagePath
+		if r.URL.Query().Get("annotated") == "1" && img.AnnotatedPath != "" {
+			key = img.AnnotatedPath
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		serveBlob(w, r, a.AppDeps.BlobStore, key, r.URL.Query().Get("size"), a.Conf.Blob.SignedUrlTTL)
+	}
+}
+
+// BlobHandler GET /blobs/{key...}?size=thumb|medium|original&annotated=1 - stored frames by blob key.
+// Only admins can get blobs that aren't frames, there's no device to check
+func BlobHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		if !allowedFrame(w, r, key) {
+			return
+		}
+		if r.URL.Query().Get("annotated") == "1" {
+			key = receiver.AnnotatedFramePath(key)
+		}
+		serveBlob(w, r, a.AppDeps.BlobStore, key, r.URL.Query().Get("size"), a.Conf.Blob.SignedUrlTTL)
+	}
+}
+
+// ImageDeleteHandler DELETE /api/images/{id} - deletes the record, the blob, its annotated copy & all variants
+func ImageDeleteHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		img, ok := imageFromPath(a, w, r, auth.ActionManage)
+		if !ok {
+			return
+		}
+		if err := a.AppDeps.ImageRepo.DeleteImage(r.Context(), img.ID); err != nil {
+			logger.Error().Msgf("ImageDeleteHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		audit.Record(r.Context(), a.AppDeps.AuditRepo, devices.AuditImageDelete, devices.AuditTargetImage, strconv.FormatInt(img.ID, 10), img, nil)
+		if err := variants.Remove(r.Context(), a.AppDeps.BlobStore, img.ImagePath, img.AnnotatedPath); err != nil {
+			logger.Error().Msgf("ImageDeleteHandler -> failed to remove files for image %d: %v", img.ID, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// imageFromPath the {id} image if the request's principal can take the action on its device
+func imageFromPath(a *app.App, w http.ResponseWriter, r *http.Request, action string) (devices.DeviceImage, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid image ID", http.StatusBadRequest)
+		return devices.DeviceImage{}, false
+	}
+	img, err := a.AppDeps.ImageRepo.GetImage(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return devices.DeviceImage{}, false
+	}
+	if !allowedDevice(w, r, action, img.DeviceID) {
+		return devices.DeviceImage{}, false
+	}
+	return img, true
+}
+
+// allowedFrame 403s unless the request's principal can view the device the frame is from, see receiver.FrameDeviceID.
+// Only admins can get other files
+func allowedFrame(w http.ResponseWriter, r *http.Request, key string) bool {
+	if deviceId, ok := receiver.FrameDeviceID(key); ok {
+		return allowedDevice(w, r, auth.ActionView, deviceId)
+	}
+	return allowed(w, r, auth.ActionManage)
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"context"
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/config"
+	"devicecapture/internal/deviceconfig"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/hls"
+	"devicecapture/internal/live"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// rbacTestServer every route behind the auth middleware & a session cookie per user:
+// admin, operator (granted device 1), viewer (granted group 1) & nobody (a viewer without grants).
+// Group 1 "outdoor" has device 2, group 2 "all" has devices 1 & 2. Image 1 & capture session 1 are from device 1
+type rbacTestServer struct {
+	handler  http.Handler
+	bus      *pubsub.MemoryBus
+	sessions map[string]string
+}
+
+func newRbacTestServer(t *testing.T) rbacTestServer {
+	ctx := t.Context()
+	conf := &config.Config{
+		VideoPath: "videos",
+		Auth:      config.AuthConfig{Enabled: true, SessionTTL: time.Hour},
+		Hls:       config.HlsConfig{SegmentDuration: time.Minute, LiveSegments: 3},
+	}
+	deps := domain.NewMockDeps()
+	bus := pubsub.NewMemoryBus()
+	a := app.NewApp(conf, bus, nil, deps)
+	svc := auth.NewService(conf, deps)
+	repo := deps.DeviceRepo
+
+	outdoor, _ := repo.CreateGroup(ctx, devices.CreateGroupParams{Name: "outdoor"})
+	all, _ := repo.CreateGroup(ctx, devices.CreateGroupParams{Name: "all"})
+	for _, m := range [][2]int64{{outdoor.ID, 2}, {all.ID, 1}, {all.ID, 2}} {
+		if err := repo.AddGroupDevice(ctx, m[0], m[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := deps.ImageRepo.CreateImage(ctx, devices.CreateImageParams{DeviceID: 1, ImagePath: "videos/1-1/output-1-1.jpeg"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := deps.BlobStore.Put(ctx, "videos/1-1/output-1-1.jpeg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deps.CaptureSessionRepo.CreateCaptureSession(ctx, devices.CreateCaptureSessionParams{DeviceID: 1, SessionPath: "videos/1-1", StartedAt: time.UnixMilli(1)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{1, 2} {
+		if _, err := deps.HeartbeatRepo.RecordBeat(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := rbacTestServer{bus: bus, sessions: map[string]string{}}
+	deviceId := int64(1)
+	for _, u := range []struct {
+		name  string
+		role  string
+		grant devices.CreateGrantParams
+	}{
+		{name: "admin", role: devices.RoleAdmin},
+		{name: "operator", role: devices.RoleOperator, grant: devices.CreateGrantParams{DeviceID: &deviceId}},
+		{name: "viewer", role: devices.RoleViewer, grant: devices.CreateGrantParams{GroupID: &outdoor.ID}},
+		{name: "nobody", role: devices.RoleViewer},
+	} {
+		user, err := deps.UserRepo.CreateUser(ctx, devices.CreateUserParams{Username: u.name, Role: u.role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.grant.DeviceID != nil || u.grant.GroupID != nil {
+			u.grant.UserID = user.ID
+			if _, err := deps.UserRepo.CreateGrant(ctx, u.grant); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.sessions[u.name] = "session-" + u.name
+		if _, err := deps.UserRepo.CreateSession(ctx, devices.CreateSessionParams{
+			TokenHash: auth.HashToken(s.sessions[u.name]),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs := deviceconfig.NewService(deps, nopPublisher{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", DeviceListHandler(a))
+	mux.HandleFunc("/heartbeat", HeartBeatListHandler(a))
+	mux.HandleFunc("/detection-stream", DetectionStreamHandler(a, live.NewHub(bus)))
+	mux.HandleFunc("GET /event-stream", EventStreamHandler(a, live.NewHub(bus)))
+	mux.HandleFunc("GET /api/devices", DeviceApiListHandler(a))
+	mux.HandleFunc("POST /api/devices", DeviceCreateHandler(a))
+	mux.HandleFunc("GET /api/devices/{id}", DeviceHandler(a))
+	mux.HandleFunc("PUT /api/devices/{id}", DeviceUpdateHandler(a))
+	mux.HandleFunc("DELETE /api/devices/{id}", DeviceDeleteHandler(a))
+	mux.HandleFunc("PUT /api/devices/{id}/config", DeviceConfigUpdateHandler(a, configs))
+	mux.HandleFunc("GET /api/groups", GroupListHandler(a))
+	mux.HandleFunc("POST /api/groups", GroupCreateHandler(a))
+	mux.HandleFunc("GET /api/groups/{id}", GroupHandler(a))
+	mux.HandleFunc("DELETE /api/groups/{id}", GroupDeleteHandler(a))
+	mux.HandleFunc("PUT /api/groups/{id}/devices/{deviceId}", GroupDeviceAddHandler(a))
+	mux.HandleFunc("POST /api/groups/{id}/actions/{action}", GroupActionHandler(a, fakeCamera{}))
+	mux.HandleFunc("GET /api/discovery", DiscoveryListHandler(a))
+	mux.HandleFunc("GET /api/filters/{scope}", DetectionFilterHandler(a))
+	mux.HandleFunc("PUT /api/filters/{scope}", DetectionFilterUpdateHandler(a))
+	mux.HandleFunc("GET /api/images/{id}", ImageHandler(a))
+	mux.HandleFunc("DELETE /api/images/{id}", ImageDeleteHandler(a))
+	mux.HandleFunc("GET /blobs/{key...}", BlobHandler(a))
+	recordings := hls.NewService(conf, deps, hls.NewFfmpegEncoder("ffmpeg"))
+	mux.HandleFunc("GET /api/devices/{id}/live.m3u8", LivePlaylistHandler(a, recordings))
+	mux.HandleFunc("GET /api/recordings/{id}/index.m3u8", RecordingPlaylistHandler(a, recordings))
+	mux.HandleFunc("GET /api/recordings/{id}/segments/{segment}", RecordingSegmentHandler(a, recordings))
+	mux.HandleFunc("GET /api/sessions", CaptureSessionListHandler(a))
+	mux.HandleFunc("GET /api/sessions/{id}/frames", CaptureSessionFramesHandler(a))
+	mux.HandleFunc("GET /api/sessions/{id}/mjpeg", CaptureSessionMjpegHandler(a))
+	mux.HandleFunc("GET /api/users", UserListHandler(a))
+	mux.HandleFunc("PUT /api/users/{id}/role", UserRoleUpdateHandler(a))
+	mux.HandleFunc("POST /api/users/{id}/grants", GrantCreateHandler(a))
+	mux.HandleFunc("GET /api/audit", AuditListHandler(a))
+	s.handler = svc.Middleware(mux)
+	return s
+}
+
+func (s rbacTestServer) do(user string, method string, path string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: s.sessions[user]})
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthorization(t *testing.T) {
+	device := `{"name": "porch", "device_url": "http://porch:8080"}`
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		// Devices
+		{name: "admin views any device", user: "admin", method: "GET", path: "/api/devices/2", want: http.StatusOK},
+		{name: "operator views a granted device", user: "operator", method: "GET", path: "/api/devices/1", want: http.StatusOK},
+		{name: "operator can't view other devices", user: "operator", method: "GET", path: "/api/devices/2", want: http.StatusForbidden},
+		{name: "viewer views a device through a group", user: "viewer", method: "GET", path: "/api/devices/2", want: http.StatusOK},
+		{name: "viewer can't view other devices", user: "viewer", method: "GET", path: "/api/devices/1", want: http.StatusForbidden},
+		{name: "no grants, no devices", user: "nobody", method: "GET", path: "/api/devices/1", want: http.StatusForbidden},
+		{name: "admin creates devices", user: "admin", method: "POST", path: "/api/devices", body: device, want: http.StatusCreated},
+		{name: "operator can't create devices", user: "operator", method: "POST", path: "/api/devices", body: device, want: http.StatusForbidden},
+		{name: "admin updates devices", user: "admin", method: "PUT", path: "/api/devices/1", body: device, want: http.StatusOK},
+		{name: "operator can't update devices", user: "operator", method: "PUT", path: "/api/devices/1", body: device, want: http.StatusForbidden},
+		{name: "admin deletes devices", user: "admin", method: "DELETE", path: "/api/devices/1", want: http.StatusNoContent},
+		{name: "operator can't delete devices", user: "operator", method: "DELETE", path: "/api/devices/1", want: http.StatusForbidden},
+		// Settings
+		{name: "operator configures a granted device", user: "operator", method: "PUT", path: "/api/devices/1/config", body: `{"framesize": "VGA", "stream_fps": 5}`, want: http.StatusOK},
+		{name: "operator can't configure other devices", user: "operator", method: "PUT", path: "/api/devices/2/config", body: `{"framesize": "VGA", "stream_fps": 5}`, want: http.StatusForbidden},
+		{name: "viewer can't configure devices", user: "viewer", method: "PUT", path: "/api/devices/2/config", body: `{"framesize": "VGA", "stream_fps": 5}`, want: http.StatusForbidden},
+		{name: "operator changes a granted device's filter", user: "operator", method: "PUT", path: "/api/filters/1", body: `{"min_confidence": 0.5}`, want: http.StatusOK},
+		{name: "operator can't change other filters", user: "operator", method: "PUT", path: "/api/filters/2", body: `{"min_confidence": 0.5}`, want: http.StatusForbidden},
+		{name: "operator can't change the global filter", user: "operator", method: "PUT", path: "/api/filters/global", body: `{"min_confidence": 0.5}`, want: http.StatusForbidden},
+		{name: "admin changes the global filter", user: "admin", method: "PUT", path: "/api/filters/global", body: `{"min_confidence": 0.5}`, want: http.StatusOK},
+		{name: "viewer views the global filter", user: "viewer", method: "GET", path: "/api/filters/global", want: http.StatusNotFound},
+		// Groups
+		{name: "viewer views a group with a granted device", user: "viewer", method: "GET", path: "/api/groups/1", want: http.StatusOK},
+		{name: "operator can't view a group without granted devices", user: "operator", method: "GET", path: "/api/groups/1", want: http.StatusForbidden},
+		{name: "operator can't create groups", user: "operator", method: "POST", path: "/api/groups", body: `{"name": "indoor"}`, want: http.StatusForbidden},
+		{name: "operator can't delete groups", user: "operator", method: "DELETE", path: "/api/groups/2", want: http.StatusForbidden},
+		{name: "operator can't change group members", user: "operator", method: "PUT", path: "/api/groups/2/devices/1", want: http.StatusForbidden},
+		{name: "admin changes group members", user: "admin", method: "PUT", path: "/api/groups/1/devices/1", want: http.StatusNoContent},
+		{name: "operator runs actions on granted devices", user: "operator", method: "POST", path: "/api/groups/2/actions/stream", want: http.StatusOK},
+		{name: "operator can't run actions on groups without granted devices", user: "operator", method: "POST", path: "/api/groups/1/actions/stream", want: http.StatusForbidden},
+		{name: "viewer can't run actions", user: "viewer", method: "POST", path: "/api/groups/1/actions/stream", want: http.StatusForbidden},
+		// Images
+		{name: "operator views a granted device's image", user: "operator", method: "GET", path: "/api/images/1", want: http.StatusOK},
+		{name: "viewer can't view other images", user: "viewer", method: "GET", path: "/api/images/1", want: http.StatusForbidden},
+		{name: "operator gets a granted device's frame", user: "operator", method: "GET", path: "/blobs/videos/1-1/output-1-1.jpeg", want: http.StatusOK},
+		{name: "viewer can't get other frames", user: "viewer", method: "GET", path: "/blobs/videos/1-1/output-1-1.jpeg", want: http.StatusForbidden},
+		{name: "only admins get blobs that aren't frames", user: "operator", method: "GET", path: "/blobs/exports/all.zip", want: http.StatusForbidden},
+		{name: "operator can't delete images", user: "operator", method: "DELETE", path: "/api/images/1", want: http.StatusForbidden},
+		{name: "admin deletes images", user: "admin", method: "DELETE", path: "/api/images/1", want: http.StatusNoContent},
+		// HLS, recording 1-1 is device 1's & still recording
+		{name: "operator gets a granted device's live playlist", user: "operator", method: "GET", path: "/api/devices/1/live.m3u8", want: http.StatusOK},
+		{name: "viewer can't get other live playlists", user: "viewer", method: "GET", path: "/api/devices/1/live.m3u8", want: http.StatusForbidden},
+		{name: "device without frames isn't live", user: "viewer", method: "GET", path: "/api/devices/2/live.m3u8", want: http.StatusNotFound},
+		{name: "operator gets a granted device's recording", user: "operator", method: "GET", path: "/api/recordings/1-1/index.m3u8", want: http.StatusOK},
+		{name: "viewer can't get other recordings", user: "viewer", method: "GET", path: "/api/recordings/1-1/index.m3u8", want: http.StatusForbidden},
+		{name: "viewer can't get other segments", user: "viewer", method: "GET", path: "/api/recordings/1-1/segments/0.ts", want: http.StatusForbidden},
+		{name: "unknown recording", user: "viewer", method: "GET", path: "/api/recordings/2-1/index.m3u8", want: http.StatusNotFound},
+		{name: "invalid recording ID", user: "admin", method: "GET", path: "/api/recordings/porch/index.m3u8", want: http.StatusBadRequest},
+		{name: "unlisted segment", user: "operator", method: "GET", path: "/api/recordings/1-1/segments/0.ts", want: http.StatusNotFound},
+		{name: "invalid segment", user: "operator", method: "GET", path: "/api/recordings/1-1/segments/0.jpeg", want: http.StatusNotFound},
+		// Capture sessions
+		{name: "operator lists a granted device's sessions", user: "operator", method: "GET", path: "/api/sessions?device_id=1", want: http.StatusOK},
+		{name: "viewer can't list other devices' sessions", user: "viewer", method: "GET", path: "/api/sessions?device_id=1", want: http.StatusForbidden},
+		{name: "operator gets a granted device's session frames", user: "operator", method: "GET", path: "/api/sessions/1/frames", want: http.StatusOK},
+		{name: "viewer can't get other sessions' frames", user: "viewer", method: "GET", path: "/api/sessions/1/frames", want: http.StatusForbidden},
+		{name: "operator replays a granted device's session", user: "operator", method: "GET", path: "/api/sessions/1/mjpeg", want: http.StatusOK},
+		{name: "viewer can't replay other sessions", user: "viewer", method: "GET", path: "/api/sessions/1/mjpeg", want: http.StatusForbidden},
+		// Event stream, only the errors, a successful stream doesn't end
+		{name: "viewer can't stream other devices' events", user: "viewer", method: "GET", path: "/event-stream?devices=1", want: http.StatusNotFound},
+		{name: "event stream needs auth", user: "stranger", method: "GET", path: "/event-stream", want: http.StatusUnauthorized},
+		// Discovery & users
+		{name: "operator can't list discovered devices", user: "operator", method: "GET", path: "/api/discovery", want: http.StatusForbidden},
+		{name: "admin lists discovered devices", user: "admin", method: "GET", path: "/api/discovery", want: http.StatusOK},
+		{name: "operator can't list users", user: "operator", method: "GET", path: "/api/users", want: http.StatusForbidden},
+		{name: "admin lists users", user: "admin", method: "GET", path: "/api/users", want: http.StatusOK},
+		{name: "operator can't read the audit log", user: "operator", method: "GET", path: "/api/audit", want: http.StatusForbidden},
+		{name: "admin reads the audit log", user: "admin", method: "GET", path: "/api/audit", want: http.StatusOK},
+		{name: "viewer can't grant themselves devices", user: "viewer", method: "POST", path: "/api/users/3/grants", body: `{"device_id": 1}`, want: http.StatusForbidden},
+		{name: "admin grants devices", user: "admin", method: "POST", path: "/api/users/3/grants", body: `{"device_id": 1}`, want: http.StatusCreated},
+		{name: "grants need a device or a group", user: "admin", method: "POST", path: "/api/users/3/grants", body: `{}`, want: http.StatusBadRequest},
+		{name: "operator can't promote themselves", user: "operator", method: "PUT", path: "/api/users/2/role", body: `{"role": "admin"}`, want: http.StatusForbidden},
+		{name: "admin changes roles", user: "admin", method: "PUT", path: "/api/users/2/role", body: `{"role": "viewer"}`, want: http.StatusOK},
+		{name: "admins can't demote themselves", user: "admin", method: "PUT", path: "/api/users/1/role", body: `{"role": "viewer"}`, want: http.StatusBadRequest},
+		{name: "unknown role", user: "admin", method: "PUT", path: "/api/users/2/role", body: `{"role": "root"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRbacTestServer(t)
+			rec := s.do(tt.user, tt.method, tt.path, tt.body)
+			assert.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestAuthorization_Lists(t *testing.T) {
+	type idRow struct {
+		ID       int64 `json:"id"`
+		DeviceID int64 `json:"device_id"`
+	}
+	ids := func(t *testing.T, rec *httptest.ResponseRecorder, field func(idRow) int64) []int64 {
+		var rows []idRow
+		if !assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rows)) {
+			return nil
+		}
+		result := []int64{}
+		for _, row := range rows {
+			result = append(result, field(row))
+		}
+		return result
+	}
+	deviceId := func(row idRow) int64 { return row.ID }
+	rowDeviceId := func(row idRow) int64 { return row.DeviceID }
+	tests := []struct {
+		name  string
+		user  string
+		path  string
+		field func(idRow) int64
+		want  []int64
+	}{
+		{name: "admin devices", user: "admin", path: "/api/devices", field: deviceId, want: []int64{1, 2}},
+		{name: "operator devices", user: "operator", path: "/api/devices", field: deviceId, want: []int64{1}},
+		{name: "viewer devices", user: "viewer", path: "/api/devices", field: deviceId, want: []int64{2}},
+		{name: "nobody's devices", user: "nobody", path: "/api/devices", field: deviceId, want: []int64{}},
+		{name: "dashboard devices", user: "operator", path: "/device", field: deviceId, want: []int64{1}},
+		{name: "heartbeats", user: "viewer", path: "/heartbeat", field: rowDeviceId, want: []int64{2}},
+		{name: "admin groups", user: "admin", path: "/api/groups", field: deviceId, want: []int64{1, 2}},
+		{name: "operator groups", user: "operator", path: "/api/groups", field: deviceId, want: []int64{2}},
+		{name: "nobody's groups", user: "nobody", path: "/api/groups", field: deviceId, want: []int64{}},
+		{name: "operator sessions", user: "operator", path: "/api/sessions", field: rowDeviceId, want: []int64{1}},
+		{name: "viewer sessions", user: "viewer", path: "/api/sessions", field: rowDeviceId, want: []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRbacTestServer(t)
+			rec := s.do(tt.user, "GET", tt.path, "")
+			if assert.Equal(t, http.StatusOK, rec.Code) {
+				assert.ElementsMatch(t, tt.want, ids(t, rec, tt.field))
+			}
+		})
+	}
+
+	t.Run("group devices are filtered", func(t *testing.T) {
+		s := newRbacTestServer(t)
+		var g devices.Group
+		assert.NoError(t, json.NewDecoder(s.do("operator", "GET", "/api/groups/2", "").Body).Decode(&g))
+		assert.Equal(t, []int64{1}, g.DeviceIDs)
+	})
+
+	t.Run("group actions only run on granted devices", func(t *testing.T) {
+		s := newRbacTestServer(t)
+		var res GroupActionResponse
+		assert.NoError(t, json.NewDecoder(s.do("operator", "POST", "/api/groups/2/actions/stream", "").Body).Decode(&res))
+		if assert.Len(t, res.Results, 1) {
+			assert.Equal(t, int64(1), res.Results[0].DeviceID)
+		}
+	})
+}
+
+func TestAuthorization_DetectionStream(t *testing.T) {
+	a := assert.New(t)
+	s := newRbacTestServer(t)
+	server := httptest.NewServer(s.handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/detection-stream"
+	_, res, err := websocket.Dial(ctx, url, nil)
+	a.Error(err)
+	if a.NotNil(res) {
+		a.Equal(http.StatusUnauthorized, res.StatusCode)
+	}
+	c, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{
+		HTTPHeader: http.Header{"Cookie": []string{auth.SessionCookie + "=" + s.sessions["viewer"]}},
+	})
+	if !a.NoError(err) {
+		return
+	}
+	defer c.CloseNow()
+
+	// The viewer can only view device 2
+	msg := wsRoundTrip(ctx, t, c, `{"type": "subscribe", "id": "porch", "devices": [1]}`)
+	a.Equal(WsError, msg.Type, "subscribing to devices the viewer can't view")
+	a.Equal(WsSubscribed, wsRoundTrip(ctx, t, c, `{"type": "subscribe", "id": "all"}`).Type)
+	a.NoError(s.bus.Publish("detection/1", `{"id": 1, "device_id": 1}`))
+	a.NoError(s.bus.Publish("detection/2", `{"id": 2, "device_id": 2}`))
+	msg = wsRoundTrip(ctx, t, c, "")
+	if a.NotNil(msg.Detection) {
+		a.Equal(int64(2), msg.Detection.DeviceID)
+	}
+}
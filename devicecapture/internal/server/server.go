@@ -2,6 +2,7 @@ package server
 
 import (
 	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
 	"devicecapture/internal/camera"
 	"devicecapture/internal/domain/devices"
 	"devicecapture/internal/logger"
@@ -9,6 +10,7 @@ import (
 	"github.com/mattn/go-mjpeg"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
@@ -54,6 +56,9 @@ func StreamProxyHandler(a *app.App) http.HandlerFunc {
 		if intErr != nil {
 			return
 		}
+		if !allowedDevice(w, r, auth.ActionView, intId) {
+			return
+		}
 		device, deviceErr := a.AppDeps.DeviceRepo.GetDevice(ctx, intId)
 		if deviceErr != nil || device.DeviceUrl == "" {
 			return
@@ -65,7 +70,7 @@ func StreamProxyHandler(a *app.App) http.HandlerFunc {
 		}(stream)
 
 		// Camera proxy
-		api := camera.NewApi(deviceId, device.DeviceUrl)
+		api := camera.NewDeviceApi(device)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -79,6 +84,7 @@ func StreamProxyHandler(a *app.App) http.HandlerFunc {
 	}
 }
 
+// DeviceListHandler /device - the devices the caller can view
 func DeviceListHandler(a *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger.Debug().Msgf("DeviceListHandler -> start")
@@ -90,6 +96,7 @@ func DeviceListHandler(a *app.App) http.HandlerFunc {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
+		ds = auth.VisibleDevices(ctx, ds)
 		var deviceList []devices.Device
 		for _, d := range ds {
 			deviceList = append(deviceList, d)
@@ -104,6 +111,7 @@ func DeviceListHandler(a *app.App) http.HandlerFunc {
 	}
 }
 
+// HeartBeatListHandler /heartbeat - the latest heartbeat of each device the caller can view
 func HeartBeatListHandler(a *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -114,6 +122,10 @@ func HeartBeatListHandler(a *app.App) http.HandlerFunc {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
+		visible := auth.DeviceFilter(ctx, auth.ActionView)
+		latestBeats = slices.DeleteFunc(latestBeats, func(b devices.LatestBeatsRow) bool {
+			return !visible(b.DeviceID)
+		})
 		if err := json.NewEncoder(w).Encode(latestBeats); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
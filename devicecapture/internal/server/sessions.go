@@ -0,0 +1,266 @@
+package server
+
+import (
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/hls"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// mjpegBoundary separates the frames of a replayed session
+	mjpegBoundary = "frame"
+	// maxReplaySpeed how much faster than it was captured a session can be replayed
+	maxReplaySpeed = 16
+)
+
+// SessionFrame a capture session's stored frame, with when it was captured & its URLs
+type SessionFrame struct {
+	devices.DeviceImage
+	CapturedAt   time.Time `json:"captured_at"`
+	Url          string    `json:"url"`
+	AnnotatedUrl string    `json:"annotated_url,omitempty"`
+}
+
+// CaptureSessionResponse a capture session with its HLS recording, the same frames keyed by the session's path
+type CaptureSessionResponse struct {
+	devices.CaptureSession
+	RecordingID string `json:"recording_id"`
+	PlaylistUrl string `json:"playlist_url"`
+}
+
+func newCaptureSessionResponse(a *app.App, session devices.CaptureSession) CaptureSessionResponse {
+	id := hls.SessionRecordingID(session.SessionPath)
+	return CaptureSessionResponse{
+		CaptureSession: session,
+		RecordingID:    id,
+		PlaylistUrl:    a.Conf.ThisIp + "/api/recordings/" + id + "/index.m3u8",
+	}
+}
+
+// CaptureSessionListHandler GET /api/sessions?device_id=&after=&before=&limit= - the capture sessions of the
+// devices the caller can view, newest first, with their HLS recordings. after & before are RFC 3339 times bounding
+// when they started. limit defaults to devices.DefaultCaptureSessionLimit
+func CaptureSessionListHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := captureSessionQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if deviceParam := r.URL.Query().Get("device_id"); deviceParam != "" {
+			deviceId, err := strconv.ParseInt(deviceParam, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid device ID", http.StatusBadRequest)
+				return
+			}
+			if !allowedDevice(w, r, auth.ActionView, deviceId) {
+				return
+			}
+			q.DeviceIDs = []int64{deviceId}
+		} else {
+			ds, err := a.AppDeps.DeviceRepo.ListDevices(r.Context())
+			if err != nil {
+				logger.Error().Msgf("CaptureSessionListHandler -> dbErr %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, d := range auth.VisibleDevices(r.Context(), ds) {
+				q.DeviceIDs = append(q.DeviceIDs, d.ID)
+			}
+		}
+		sessions := []CaptureSessionResponse{}
+		if len(q.DeviceIDs) > 0 {
+			stored, err := a.AppDeps.CaptureSessionRepo.ListCaptureSessions(r.Context(), q)
+			if err != nil {
+				logger.Error().Msgf("CaptureSessionListHandler -> dbErr %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, session := range stored {
+				sessions = append(sessions, newCaptureSessionResponse(a, session))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(sessions); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// CaptureSessionFramesHandler GET /api/sessions/{id}/frames - the session's stored frames in the order they were
+// captured. Frames deleted since the session ended aren't listed
+func CaptureSessionFramesHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := captureSessionFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		frames, err := sessionFrames(a, r, session)
+		if err != nil {
+			logger.Error().Msgf("CaptureSessionFramesHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(frames); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// CaptureSessionMjpegHandler GET /api/sessions/{id}/mjpeg?speed= - replays the session's frames as an MJPEG stream,
+// each shown until the next one was captured. speed plays it faster (or slower) than it was captured, 1 by default.
+// Each frame is due at its offset from the first one divided by speed, so slow reads & writes don't add up.
+// Frames whose files were removed are skipped
+func CaptureSessionMjpegHandler(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := captureSessionFromPath(a, w, r)
+		if !ok {
+			return
+		}
+		speed := 1.0
+		if speedParam := r.URL.Query().Get("speed"); speedParam != "" {
+			var err error
+			speed, err = strconv.ParseFloat(speedParam, 64)
+			if err != nil || speed <= 0 || speed > maxReplaySpeed {
+				http.Error(w, fmt.Sprintf("speed must be greater than 0 & at most %d", maxReplaySpeed), http.StatusBadRequest)
+				return
+			}
+		}
+		frames, err := sessionFrames(a, r, session)
+		if err != nil {
+			logger.Error().Msgf("CaptureSessionMjpegHandler -> dbErr %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		mw := multipart.NewWriter(w)
+		if err := mw.SetBoundary(mjpegBoundary); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mjpegBoundary)
+		w.Header().Set("Cache-Control", "no-cache")
+		rc := http.NewResponseController(w)
+		start := time.Now()
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for _, f := range frames {
+			due := start.Add(time.Duration(float64(f.CapturedAt.Sub(frames[0].CapturedAt)) / speed))
+			timer.Reset(time.Until(due))
+			select {
+			case <-r.Context().Done():
+				return
+			case <-timer.C:
+			}
+			buf, err := readFrame(a, r, f.ImagePath)
+			if err != nil {
+				logger.Debug().Msgf("CaptureSessionMjpegHandler -> skipping %s: %v", f.ImagePath, err)
+				continue
+			}
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":   {"image/jpeg"},
+				"Content-Length": {strconv.Itoa(len(buf))},
+			})
+			if err == nil {
+				_, err = part.Write(buf)
+			}
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				logger.Debug().Msgf("CaptureSessionMjpegHandler -> write error: %v", err)
+				return
+			}
+		}
+		_ = mw.Close()
+	}
+}
+
+// captureSessionFromPath the {id} session if the request's principal can view its device
+func captureSessionFromPath(a *app.App, w http.ResponseWriter, r *http.Request) (devices.CaptureSession, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return devices.CaptureSession{}, false
+	}
+	session, err := a.AppDeps.CaptureSessionRepo.GetCaptureSession(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return devices.CaptureSession{}, false
+	}
+	if !allowedDevice(w, r, auth.ActionView, session.DeviceID) {
+		return devices.CaptureSession{}, false
+	}
+	return session, true
+}
+
+// sessionFrames the session's frames, oldest first by when they were captured
+func sessionFrames(a *app.App, r *http.Request, session devices.CaptureSession) ([]SessionFrame, error) {
+	imgs, err := a.AppDeps.ImageRepo.GetSessionImages(r.Context(), session.ID)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]SessionFrame, 0, len(imgs))
+	for _, img := range imgs {
+		f := SessionFrame{
+			DeviceImage: img,
+			CapturedAt:  receiver.CapturedAt(img),
+			Url:         receiver.BlobUrl(a.Conf.ThisIp, img.ImagePath),
+		}
+		if img.AnnotatedPath != "" {
+			f.AnnotatedUrl = receiver.BlobUrl(a.Conf.ThisIp, img.AnnotatedPath)
+		}
+		frames = append(frames, f)
+	}
+	slices.SortStableFunc(frames, func(x, y SessionFrame) int {
+		return x.CapturedAt.Compare(y.CapturedAt)
+	})
+	return frames, nil
+}
+
+func readFrame(a *app.App, r *http.Request, key string) ([]byte, error) {
+	body, _, err := a.AppDeps.BlobStore.Get(r.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func captureSessionQuery(values url.Values) (devices.CaptureSessionQuery, error) {
+	q := devices.CaptureSessionQuery{Limit: devices.DefaultCaptureSessionLimit}
+	var err error
+	if after := values.Get("after"); after != "" {
+		if q.After, err = time.Parse(time.RFC3339, after); err != nil {
+			return q, errors.New("after must be an RFC 3339 time")
+		}
+	}
+	if before := values.Get("before"); before != "" {
+		if q.Before, err = time.Parse(time.RFC3339, before); err != nil {
+			return q, errors.New("before must be an RFC 3339 time")
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil || l < 1 || l > devices.MaxCaptureSessionLimit {
+			return q, fmt.Errorf("limit must be between 1 & %d", devices.MaxCaptureSessionLimit)
+		}
+		q.Limit = int32(l)
+	}
+	return q, nil
+}
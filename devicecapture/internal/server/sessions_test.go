@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"devicecapture/internal/app"
+	"devicecapture/internal/blob"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureSessionHandlers(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	deps := domain.NewMockDeps()
+	testApp := app.NewApp(&config.Config{ThisIp: "http://localhost:4000"}, nil, nil, deps)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sessions", CaptureSessionListHandler(testApp))
+	mux.HandleFunc("GET /api/sessions/{id}/frames", CaptureSessionFramesHandler(testApp))
+	mux.HandleFunc("GET /api/sessions/{id}/mjpeg", CaptureSessionMjpegHandler(testApp))
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// Session 1 is device 1's, its frames captured 0, 100 & 300ms in & stored out of order. Session 2 is device 2's
+	t0 := time.UnixMilli(1700000000000).UTC()
+	first, err := deps.CaptureSessionRepo.CreateCaptureSession(ctx, devices.CreateCaptureSessionParams{DeviceID: 1, SessionPath: "videos/1-1700000000000", StartedAt: t0})
+	a.NoError(err)
+	_, err = deps.CaptureSessionRepo.CreateCaptureSession(ctx, devices.CreateCaptureSessionParams{DeviceID: 2, SessionPath: "videos/2-1700000060000", StartedAt: t0.Add(time.Minute)})
+	a.NoError(err)
+	for _, key := range []string{"videos/1-1700000000000/output-1-1700000000000.jpeg", "videos/1-1700000000000/output-1-1700000000300.jpeg", "videos/1-1700000000000/output-1-1700000000100.jpeg"} {
+		_, err := deps.ImageRepo.CreateImage(ctx, devices.CreateImageParams{DeviceID: 1, ImagePath: key, SessionID: &first.ID})
+		a.NoError(err)
+		a.NoError(deps.BlobStore.Put(ctx, key, []byte(key[len(key)-8:len(key)-5]), "image/jpeg"))
+	}
+	ended, err := deps.CaptureSessionRepo.EndCaptureSession(ctx, first.ID, t0.Add(time.Second))
+	a.NoError(err)
+	a.Equal(int32(3), ended.FrameCount)
+
+	t.Run("list", func(t *testing.T) {
+		var sessions []devices.CaptureSession
+		w := do("/api/sessions")
+		a.Equal(http.StatusOK, w.Code)
+		a.NoError(json.Unmarshal(w.Body.Bytes(), &sessions))
+		if a.Len(sessions, 2) {
+			a.Equal(int64(2), sessions[0].DeviceID, "newest first")
+			a.True(sessions[0].EndedAt.IsZero(), "still capturing")
+			a.Equal(ended, sessions[1])
+		}
+		a.NotContains(w.Body.String(), `"ended_at":"0001`, "capturing sessions don't have an end")
+
+		sessions = nil
+		a.NoError(json.Unmarshal(do("/api/sessions?device_id=1").Body.Bytes(), &sessions))
+		a.Equal([]devices.CaptureSession{ended}, sessions)
+		sessions = nil
+		a.NoError(json.Unmarshal(do("/api/sessions?after=2023-11-14T22:14:00Z").Body.Bytes(), &sessions))
+		a.Len(sessions, 1)
+		a.Equal("[]\n", do("/api/sessions?before=2023-11-14T22:13:00Z").Body.String())
+
+		var responses []CaptureSessionResponse
+		a.NoError(json.Unmarshal(do("/api/sessions?device_id=1").Body.Bytes(), &responses))
+		if a.Len(responses, 1) {
+			a.Equal("1-1700000000000", responses[0].RecordingID, "sessions link to their HLS recording")
+			a.Equal("http://localhost:4000/api/recordings/1-1700000000000/index.m3u8", responses[0].PlaylistUrl)
+		}
+	})
+
+	t.Run("frames", func(t *testing.T) {
+		var frames []SessionFrame
+		w := do("/api/sessions/1/frames")
+		a.Equal(http.StatusOK, w.Code)
+		a.NoError(json.Unmarshal(w.Body.Bytes(), &frames))
+		if a.Len(frames, 3) {
+			for i, ms := range []int64{0, 100, 300} {
+				a.Equal(t0.Add(time.Duration(ms)*time.Millisecond), frames[i].CapturedAt, "ordered by capture time")
+			}
+			a.Equal("http://localhost:4000/blobs/videos/1-1700000000000/output-1-1700000000100.jpeg", frames[1].Url)
+			a.Equal(&first.ID, frames[1].SessionID)
+		}
+		a.Equal("[]\n", do("/api/sessions/2/frames").Body.String())
+	})
+
+	t.Run("mjpeg replay", func(t *testing.T) {
+		// The 100ms frame's file was removed
+		a.NoError(deps.BlobStore.Delete(ctx, "videos/1-1700000000000/output-1-1700000000100.jpeg"))
+		start := time.Now()
+		w := do("/api/sessions/1/mjpeg?speed=2")
+		elapsed := time.Since(start)
+		a.Equal(http.StatusOK, w.Code)
+		a.GreaterOrEqual(elapsed, 150*time.Millisecond, "frames are replayed at twice the speed they were captured")
+
+		mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		a.NoError(err)
+		a.Equal("multipart/x-mixed-replace", mediaType)
+		mr := multipart.NewReader(w.Body, params["boundary"])
+		var parts []string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if !a.NoError(err) {
+				break
+			}
+			a.Equal("image/jpeg", part.Header.Get("Content-Type"))
+			buf, _ := io.ReadAll(part)
+			parts = append(parts, string(buf))
+		}
+		a.Equal([]string{"000", "300"}, parts, "frames without files are skipped")
+
+		// Reading each frame takes 100ms, as long as the gaps between them at twice the speed. Frames are due at
+		// 0, 50 & 150ms, so the reads shouldn't add up with the gaps (450ms)
+		testApp.AppDeps.BlobStore = slowStore{Store: deps.BlobStore, delay: 100 * time.Millisecond}
+		defer func() {
+			testApp.AppDeps.BlobStore = deps.BlobStore
+		}()
+		start = time.Now()
+		a.Equal(http.StatusOK, do("/api/sessions/1/mjpeg?speed=2").Code)
+		a.Less(time.Since(start), 400*time.Millisecond, "frames are scheduled by when they were captured")
+	})
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "invalid device", path: "/api/sessions?device_id=porch", want: http.StatusBadRequest},
+		{name: "invalid time", path: "/api/sessions?after=yesterday", want: http.StatusBadRequest},
+		{name: "invalid limit", path: "/api/sessions?limit=100000", want: http.StatusBadRequest},
+		{name: "invalid session", path: "/api/sessions/first/frames", want: http.StatusBadRequest},
+		{name: "unknown session", path: "/api/sessions/42/frames", want: http.StatusNotFound},
+		{name: "unknown session replay", path: "/api/sessions/42/mjpeg", want: http.StatusNotFound},
+		{name: "invalid speed", path: "/api/sessions/1/mjpeg?speed=0", want: http.StatusBadRequest},
+		{name: "too fast", path: "/api/sessions/1/mjpeg?speed=100", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.path)
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
+
+// slowStore a blob.Store whose reads take delay
+type slowStore struct {
+	blob.Store
+	delay time.Duration
+}
+
+func (s slowStore) Get(ctx context.Context, key string) (io.ReadCloser, blob.Info, error) {
+	time.Sleep(s.delay)
+	return s.Store.Get(ctx, key)
+}
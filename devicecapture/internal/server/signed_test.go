@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/homeassistant"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSignedUrls the frame URLs published in MQTT frame & detection messages & Home Assistant's camera attributes can
+// be fetched without a login, ex: by Home Assistant's last detection image
+func TestSignedUrls(t *testing.T) {
+	a := assert.New(t)
+	conf := &config.Config{
+		ThisIp:    "http://192.168.1.20:4000",
+		VideoPath: "videos",
+		Auth:      config.AuthConfig{Enabled: true, SessionTTL: time.Hour, UrlSigningKey: "secret"},
+		Blob:      config.BlobConfig{SignedUrlTTL: 15 * time.Minute},
+	}
+	deps := domain.NewMockDeps()
+	bus := pubsub.NewMemoryBus()
+	defer bus.Close()
+	deps.FrameRepo = pubsub.NewMqttReceiver(bus, conf, deps.BlobStore)
+	mux := http.NewServeMux()
+	testApp := app.NewApp(conf, nil, nil, deps)
+	mux.HandleFunc("GET /blobs/{key...}", BlobHandler(testApp))
+	mux.HandleFunc("GET /camera/{id}/snapshot", CameraSnapshotHandler(testApp))
+	mux.HandleFunc("GET /api/devices", func(w http.ResponseWriter, r *http.Request) {})
+	handler := auth.NewService(conf, deps).Middleware(mux)
+	get := func(rawUrl string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, rawUrl, nil))
+		return w.Code
+	}
+
+	var jpg bytes.Buffer
+	a.NoError(jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 2, 2)), nil))
+	published := make(chan []byte, 1)
+	_, err := bus.Subscribe("image/1", func(msg pubsub.Message) {
+		published <- msg.Payload
+	})
+	a.NoError(err)
+	session := receiver.NewCaptureSession("1")
+	frame := receiver.NewFrame(jpg.Bytes(), time.Now().UnixMilli())
+	a.NoError(deps.FrameRepo.ReceiveFrame(session, frame, ""))
+	// Only the URL, FrameMsg's own UnmarshalJSON recurses
+	var frameMsg struct {
+		Url string `json:"url"`
+	}
+	a.NoError(json.Unmarshal(<-published, &frameMsg))
+
+	framePath := receiver.FramePath(conf.VideoPath, session, frame)
+	a.NoError(deps.BlobStore.Put(t.Context(), receiver.AnnotatedFramePath(framePath), jpg.Bytes(), "image/jpeg"))
+	payload, err := receiver.DetectionToMsg(conf.ThisIp, auth.NewService(conf, deps).Signer, framePath, true, devices.Detection{ID: 1, DeviceID: 1, Label: "dog"})
+	a.NoError(err)
+	var detectionMsg receiver.DetectionMsg
+	a.NoError(json.Unmarshal([]byte(payload), &detectionMsg))
+
+	for _, u := range []string{frameMsg.Url, detectionMsg.Url, detectionMsg.AnnotatedUrl, detectionMsg.Url + "&size=thumb"} {
+		a.Equal(http.StatusOK, get(u), u)
+	}
+	a.Equal(http.StatusUnauthorized, get(receiver.BlobUrl(conf.ThisIp, framePath)), "unsigned URLs need a login")
+	a.Equal(http.StatusUnauthorized, get(strings.Replace(detectionMsg.Url, "sig=", "sig=x", 1)), "tampered URLs need a login")
+	other := strings.Replace(detectionMsg.Url, "/blobs/", "/api/devices?x=", 1)
+	a.Equal(http.StatusUnauthorized, get(other), "signatures only unlock the signed routes")
+
+	_, err = deps.ImageRepo.CreateImage(t.Context(), devices.CreateImageParams{DeviceID: 1, ImagePath: framePath})
+	a.NoError(err)
+	a.NoError(homeassistant.NewService(conf, deps, bus).PublishAttributes(devices.GetMockDevice()))
+	retained, ok := bus.Retained("openblink/1/camera/attributes")
+	a.True(ok)
+	var attributes homeassistant.CameraAttributes
+	a.NoError(json.Unmarshal(retained, &attributes))
+	a.Equal(http.StatusOK, get(attributes.SnapshotUrl), "Home Assistant's snapshot_url is the latest frame")
+	a.Equal(http.StatusUnauthorized, get(conf.ThisIp+"/camera/1/snapshot"), "unsigned snapshots need a login")
+
+	expired := auth.NewService(&config.Config{Auth: conf.Auth, Blob: config.BlobConfig{SignedUrlTTL: -time.Minute}}, deps).Signer
+	a.Equal(http.StatusUnauthorized, get(expired.Sign(receiver.BlobUrl(conf.ThisIp, framePath))), "expired URLs need a login")
+}
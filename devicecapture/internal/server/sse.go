@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"devicecapture/internal/app"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/live"
+	"devicecapture/internal/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sseKeepAlive how often an idle event stream gets a comment, so proxies don't close it
+	sseKeepAlive = 15 * time.Second
+	// sseWriteTimeout how long a write to a client can take before it's disconnected
+	sseWriteTimeout = 10 * time.Second
+	// sseRetry how long browsers wait before reconnecting, in milliseconds
+	sseRetry = 5000
+	// sseReplayPage how many stored detections are read at a time when a client resumes, at most sseMaxReplay
+	sseReplayPage = 500
+	sseMaxReplay  = 10000
+	// sseReplayOverlap how many IDs before Last-Event-ID are replayed too. IDs are reserved before their frame's rows
+	// commit, so a detection can commit after one with a higher ID was sent
+	sseReplayOverlap = 100
+	// sseSubscription an event stream's only live.Client subscription
+	sseSubscription = "sse"
+)
+
+// EventStreamHandler /event-stream?types=&devices=&labels=&min_confidence=&group=<int:GroupID> - streams
+// detections, device events & health changes as Server-Sent Events, for clients that can't use the detection
+// websocket. The params are a comma separated live.Filter, ex: ?types=detection&devices=1,2&labels=person.
+// Each event's name is its live.Event type & its data the detection, live.DeviceEvent or live.Health.
+// Detections' IDs are their event IDs, a client reconnecting with a Last-Event-ID header (or ?last_event_id=)
+// first gets the stored detections it missed, reading at most sseMaxReplay. Clients that fall behind are disconnected
+// & resume the same way. Muted devices' stored detections aren't replayed.
+// IDs don't commit in order, so the replay starts sseReplayOverlap IDs before Last-Event-ID & live detections are
+// only skipped if the replay wrote them. Clients drop the detections they've already seen by their message_id,
+// see receiver.DetectionMessageID
+func EventStreamHandler(a *app.App, hub *live.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		include, ok := detectionDeviceFilter(a, w, r)
+		if !ok {
+			return
+		}
+		filter, err := parseEventFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lastId, resume, err := lastEventId(r)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		// Join before replaying, so nothing published meanwhile is missed
+		client, err := hub.Join(include)
+		if err != nil {
+			logger.Error().Msgf("EventStreamHandler -> bus subscribe error: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		defer hub.Leave(client)
+		if err := client.Subscribe(sseSubscription, filter); err != nil {
+			if errors.Is(err, live.ErrForbiddenDevice) {
+				http.Error(w, "Device not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// Otherwise nginx buffers the stream
+		w.Header().Set("X-Accel-Buffering", "no")
+		s := &eventStream{w: w, rc: http.NewResponseController(w)}
+		defer func() {
+			// Keep-alive connections outlive the stream
+			_ = s.rc.SetWriteDeadline(time.Time{})
+		}()
+		if err := s.write(fmt.Sprintf("retry: %d\n\n", sseRetry)); err != nil {
+			return
+		}
+		var replayed map[int64]bool
+		if resume {
+			replayed, err = replayDetections(r.Context(), a, s, filter, include, lastId)
+			if err != nil {
+				logger.Error().Msgf("EventStreamHandler -> replay error: %v", err)
+				return
+			}
+		}
+
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-client.Dropped():
+				return
+			case <-keepAlive.C:
+				err = s.write(": keep-alive\n\n")
+			case m := <-client.Events():
+				// Already replayed
+				if m.Detection != nil && replayed[m.Detection.ID] {
+					delete(replayed, m.Detection.ID)
+					continue
+				}
+				err = s.event(m.Event)
+			}
+			if err != nil {
+				logger.Debug().Msgf("EventStreamHandler -> write error: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// eventStream writes Server-Sent Events, flushing each one
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *eventStream) write(data string) error {
+	// Not every ResponseWriter supports deadlines, ex: httptest.ResponseRecorder
+	if err := s.rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// event writes e, with its detection's ID as the event ID
+func (s *eventStream) event(e live.Event) error {
+	data, err := json.Marshal(e.Payload())
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if e.Detection != nil {
+		b.WriteString("id: " + strconv.FormatInt(e.Detection.ID, 10) + "\n")
+	}
+	b.WriteString("event: " + e.Type + "\ndata: " + string(data) + "\n\n")
+	return s.write(b.String())
+}
+
+// replayDetections writes the stored detections after lastId minus sseReplayOverlap that the client can see &
+// filter matches, returning the IDs it wrote
+func replayDetections(ctx context.Context, a *app.App, s *eventStream, filter live.Filter, include func(deviceId int64) bool, lastId int64) (map[int64]bool, error) {
+	replayed := map[int64]bool{}
+	ds, err := a.AppDeps.DeviceRepo.ListDevices(ctx)
+	if err != nil {
+		return replayed, err
+	}
+	now := time.Now()
+	muted := map[int64]bool{}
+	for _, d := range ds {
+		muted[d.ID] = d.IsMuted(now)
+	}
+	images := map[int64]devices.DeviceImage{}
+	lastId = max(0, lastId-sseReplayOverlap)
+	for read := 0; read < sseMaxReplay; {
+		page, err := a.AppDeps.DetectionRepo.GetDetectionsAfterId(ctx, lastId, sseReplayPage)
+		if err != nil {
+			return replayed, err
+		}
+		for _, d := range page {
+			lastId = d.ID
+			if !include(d.DeviceID) || muted[d.DeviceID] {
+				continue
+			}
+			e := live.DetectionEvent(storedDetectionMsg(ctx, a, images, d))
+			if !filter.Matches(e) {
+				continue
+			}
+			if err := s.event(e); err != nil {
+				return replayed, err
+			}
+			replayed[d.ID] = true
+		}
+		read += len(page)
+		if len(page) < sseReplayPage {
+			break
+		}
+	}
+	return replayed, nil
+}
+
+// storedDetectionMsg d's message as it was published, without URLs if its image was deleted. images caches the
+// detections' images
+func storedDetectionMsg(ctx context.Context, a *app.App, images map[int64]devices.DeviceImage, d devices.Detection) receiver.DetectionMsg {
+	if d.ImageID == nil {
+		return noUrls(receiver.NewDetectionMsg(a.Conf.ThisIp, "", false, d))
+	}
+	img, ok := images[*d.ImageID]
+	if !ok {
+		var err error
+		if img, err = a.AppDeps.ImageRepo.GetImage(ctx, *d.ImageID); err != nil {
+			return noUrls(receiver.NewDetectionMsg(a.Conf.ThisIp, "", false, d))
+		}
+		images[img.ID] = img
+	}
+	return receiver.NewDetectionMsg(a.Conf.ThisIp, img.ImagePath, img.AnnotatedPath != "", d)
+}
+
+func noUrls(msg receiver.DetectionMsg) receiver.DetectionMsg {
+	msg.Url = ""
+	msg.AnnotatedUrl = ""
+	return msg
+}
+
+// parseEventFilter ?types=detection,health&devices=1,2&labels=person,car&min_confidence=0.6
+func parseEventFilter(q url.Values) (live.Filter, error) {
+	f := live.Filter{
+		Types:  splitParam(q.Get("types")),
+		Labels: splitParam(q.Get("labels")),
+	}
+	for _, id := range splitParam(q.Get("devices")) {
+		deviceId, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("%w: invalid device ID %q", live.ErrInvalidFilter, id)
+		}
+		f.DeviceIDs = append(f.DeviceIDs, deviceId)
+	}
+	if minConfidence := q.Get("min_confidence"); minConfidence != "" {
+		var err error
+		if f.MinConfidence, err = strconv.ParseFloat(minConfidence, 64); err != nil {
+			return f, fmt.Errorf("%w: invalid min_confidence", live.ErrInvalidFilter)
+		}
+	}
+	return f, f.Validate()
+}
+
+func splitParam(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// lastEventId the Last-Event-ID header, or ?last_event_id= for clients that can't set headers, ex: EventSource's
+// first connection. resume is false when there's neither
+func lastEventId(r *http.Request) (id int64, resume bool, err error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+	id, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, errors.New("invalid Last-Event-ID")
+	}
+	return id, true, nil
+}
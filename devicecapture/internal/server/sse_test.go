@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"devicecapture/internal/app"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/domain/devices"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/live"
+	"devicecapture/internal/pubsub"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSseEvent the next event, skipping comments & retry fields
+func readSseEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		field, value, _ := strings.Cut(strings.TrimSuffix(line, "\n"), ": ")
+		switch field {
+		case "":
+			if e.event != "" {
+				return e
+			}
+		case "id":
+			e.id = value
+		case "event":
+			e.event = value
+		case "data":
+			e.data = value
+		}
+	}
+}
+
+func TestEventStreamHandler(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	bus := pubsub.NewMemoryBus()
+	hub := live.NewHub(bus)
+	deps := domain.NewMockDeps()
+	testApp := app.NewApp(&config.Config{ThisIp: "http://localhost:4000"}, bus, nil, deps)
+	server := httptest.NewServer(EventStreamHandler(testApp, hub))
+	// After the streams' bodies are closed, see stream
+	t.Cleanup(server.Close)
+
+	// Detections 1 & 2 on device 1's frame, 3 on device 2 without one
+	img, _, err := deps.DetectionRepo.CreateImageDetections(ctx, devices.CreateImageParams{DeviceID: 1, ImagePath: "videos/1-1/output-1-1.jpeg"}, []devices.CreateDetectionParams{
+		{DeviceID: 1, Label: "person", Confidence: 0.9},
+		{DeviceID: 1, Label: "cat", Confidence: 0.9},
+	}, nil)
+	a.NoError(err)
+	_, err = deps.DetectionRepo.CreateDetection(ctx, devices.CreateDetectionParams{DeviceID: 2, Label: "Person", Confidence: 0.7})
+	a.NoError(err)
+
+	stream := func(query string, lastEventId string) *bufio.Reader {
+		t.Helper()
+		r, err := http.NewRequestWithContext(ctx, "GET", server.URL+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastEventId != "" {
+			r.Header.Set("Last-Event-ID", lastEventId)
+		}
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = res.Body.Close()
+		})
+		a.Equal(http.StatusOK, res.StatusCode)
+		a.Equal("text/event-stream", res.Header.Get("Content-Type"))
+		return bufio.NewReader(res.Body)
+	}
+
+	t.Run("resumes from Last-Event-ID", func(t *testing.T) {
+		people := stream("?labels=person", "0")
+		e := readSseEvent(t, people)
+		a.Equal(sseEvent{id: "1", event: live.EventDetection}, sseEvent{id: e.id, event: e.event})
+		var d receiver.DetectionMsg
+		a.NoError(json.Unmarshal([]byte(e.data), &d))
+		a.Equal(receiver.BlobUrl("http://localhost:4000", img.ImagePath), d.Url, "replayed detections have their frame's URL")
+		e = readSseEvent(t, people)
+		a.Equal("3", e.id, "cats are filtered out")
+		d = receiver.DetectionMsg{}
+		a.NoError(json.Unmarshal([]byte(e.data), &d))
+		a.Empty(d.Url, "no frame, no URL")
+
+		a.NoError(bus.Publish("detection/2", `{"id": 3, "device_id": 2, "label": "person", "confidence": 0.7}`))
+		a.NoError(bus.Publish("detection/1", `{"id": 4, "device_id": 1, "label": "person", "confidence": 0.8}`))
+		hub.Publish(live.Event{Type: live.EventHealth, DeviceID: 1, Health: &live.Health{DeviceID: 1, Online: true}})
+		a.Equal("4", readSseEvent(t, people).id, "already replayed detections aren't sent again")
+		e = readSseEvent(t, people)
+		a.Equal(sseEvent{event: live.EventHealth, data: `{"device_id":1,"online":true,"changed_at":"0001-01-01T00:00:00Z"}`}, e,
+			"labels only filter detections")
+		// IDs are reserved before their rows commit, so a detection can be published after the replay read higher IDs
+		a.NoError(bus.Publish("detection/1", `{"id": 2, "device_id": 1, "label": "person", "confidence": 0.8}`))
+		a.Equal("2", readSseEvent(t, people).id, "detections that weren't replayed are sent, whatever their ID")
+
+		e = readSseEvent(t, stream("?types=detection&last_event_id=2", ""))
+		a.Equal("1", e.id, "resuming from the query string, with the overlap before it")
+
+		// The client saw 3, the cat (2) committed after it
+		cats := stream("?labels=cat", "3")
+		e = readSseEvent(t, cats)
+		a.Equal("2", e.id, "detections that committed after a later one was sent are replayed")
+		d = receiver.DetectionMsg{}
+		a.NoError(json.Unmarshal([]byte(e.data), &d))
+		a.Equal(receiver.DetectionMessageID(devices.Detection{ID: 2}), d.MessageID, "clients drop the ones they've seen by message_id")
+	})
+
+	t.Run("only the filter's types & devices", func(t *testing.T) {
+		health := stream("?types=health,event&devices=2", "")
+		a.NoError(bus.Publish("detection/2", `{"id": 5, "device_id": 2, "label": "person", "confidence": 0.8}`))
+		hub.Publish(live.Event{Type: live.EventHealth, DeviceID: 1, Health: &live.Health{DeviceID: 1}})
+		hub.Publish(live.Event{Type: live.EventDevice, DeviceID: 2, Device: &live.DeviceEvent{DeviceID: 2, Action: devices.AuditDeviceMute}})
+		e := readSseEvent(t, health)
+		a.Equal(live.EventDevice, e.event)
+		a.Empty(e.id, "only detections have IDs")
+		a.Contains(e.data, `"action":"device.mute"`)
+	})
+
+	tests := []struct {
+		name        string
+		query       string
+		lastEventId string
+		want        int
+	}{
+		{name: "unknown type", query: "?types=video", want: http.StatusBadRequest},
+		{name: "invalid device", query: "?devices=porch", want: http.StatusBadRequest},
+		{name: "invalid confidence", query: "?min_confidence=2", want: http.StatusBadRequest},
+		{name: "invalid Last-Event-ID", lastEventId: "detection-1", want: http.StatusBadRequest},
+		{name: "unknown group", query: "?group=42", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/event-stream"+tt.query, nil)
+			r.Header.Set("Last-Event-ID", tt.lastEventId)
+			w := httptest.NewRecorder()
+			EventStreamHandler(testApp, hub)(w, r)
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"devicecapture/internal/auth"
+	"devicecapture/internal/blob"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/variants"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// imageCacheControl stored frames & their variants never change once written. They're private, shared caches
+// mustn't hand them to users who haven't logged in
+const imageCacheControl = "private, max-age=31536000, immutable"
+
+// StaticHandler serves files from dir under /static/.
+// Frames can be requested with ?annotated=1 to get the copy with detections drawn on it,
+// and ?size=thumb|medium to get a resized variant. Frames are only served to users who can view their device
+func StaticHandler(dir string) http.Handler {
+	fs := http.StripPrefix("/static/", http.FileServer(http.Dir(dir)))
+	store := blob.NewLocalStore(dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deviceId, ok := receiver.FrameDeviceID(r.URL.Path); ok && !allowedDevice(w, r, auth.ActionView, deviceId) {
+			return
+		}
+		query := r.URL.Query()
+		sizeName := query.Get("size")
+		if query.Get("annotated") != "1" && (sizeName == "" || sizeName == "original") {
+			fs.ServeHTTP(w, r)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/static/")
+		if query.Get("annotated") == "1" {
+			key = receiver.AnnotatedFramePath(key)
+		}
+		serveBlob(w, r, store, key, sizeName, 0)
+	})
+}
+
+// serveBlob serves the blob at key, or a resized variant of it (generating it if needed) when sizeName is set.
+// Stores that sign URLs redirect the client to the store rather than proxying the bytes through deviceserver
+func serveBlob(w http.ResponseWriter, r *http.Request, store blob.Store, key string, sizeName string, signedUrlTTL time.Duration) {
+	ctx := r.Context()
+	if sizeName != "" && sizeName != "original" {
+		size, err := variants.SizeByName(sizeName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		key, err = variants.Get(ctx, store, key, size)
+		if err != nil {
+			blobError(w, err)
+			return
+		}
+	}
+	if signer, ok := store.(blob.Signer); ok && signedUrlTTL > 0 {
+		if _, err := store.Stat(ctx, key); err != nil {
+			blobError(w, err)
+			return
+		}
+		signed, err := signer.SignedUrl(ctx, key, signedUrlTTL)
+		if err != nil {
+			blobError(w, err)
+			return
+		}
+		http.Redirect(w, r, signed, http.StatusFound)
+		return
+	}
+	body, info, err := store.Get(ctx, key)
+	if err != nil {
+		blobError(w, err)
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Cache-Control", imageCacheControl)
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	// http.ServeContent takes care of If-None-Match / If-Modified-Since & ranges
+	if rs, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.ModTime, rs)
+		return
+	}
+	_, _ = io.Copy(w, body)
+}
+
+func blobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, blob.ErrNotFound):
+		http.Error(w, "Image not found", http.StatusNotFound)
+	case errors.Is(err, blob.ErrInvalidKey):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
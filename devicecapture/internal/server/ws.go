@@ -3,72 +3,209 @@ package server
 import (
 	"context"
 	"devicecapture/internal/app"
+	"devicecapture/internal/auth"
+	"devicecapture/internal/domain/receiver"
+	"devicecapture/internal/live"
 	"devicecapture/internal/logger"
-	"devicecapture/internal/pubsub"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
-	"github.com/google/uuid"
+	"encoding/json"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 )
 
-var wsOpts = websocket.AcceptOptions{InsecureSkipVerify: true}
+const (
+	// wsPingInterval how often detection stream clients are pinged, they're disconnected if they don't pong
+	// within wsPongTimeout
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = 10 * time.Second
+	// wsWriteTimeout how long a write to a client can take before it's disconnected
+	wsWriteTimeout = 10 * time.Second
+)
 
-func DetectionStreamHandler(a *app.App) http.HandlerFunc {
-	// See example: https://pkg.go.dev/github.com/coder/websocket#example-package-WriteOnly
-	return func(w http.ResponseWriter, r *http.Request) {
+// Detection stream message types
+const (
+	// WsSubscribe client -> server, adds or replaces subscription "id" with the message's live.Filter
+	WsSubscribe = "subscribe"
+	// WsUnsubscribe client -> server, removes subscription "id"
+	WsUnsubscribe = "unsubscribe"
+	// WsPing client -> server, answered with WsPong. Browsers can't send websocket pings
+	WsPing = "ping"
+	// WsSubscribed & WsUnsubscribed server -> client, acknowledge WsSubscribe & WsUnsubscribe
+	WsSubscribed   = "subscribed"
+	WsUnsubscribed = "unsubscribed"
+	// WsDetection, WsEvent & WsHealth server -> client, a live.Event matching "subscriptions"
+	WsDetection = live.EventDetection
+	WsEvent     = live.EventDevice
+	WsHealth    = live.EventHealth
+	WsPong      = "pong"
+	// WsError server -> client, a message that couldn't be handled
+	WsError = "error"
+)
 
-		logger.Debug().Msg("ws /detections")
-		// Setup websocket stuff
-		c, err := websocket.Accept(w, r, &wsOpts)
+// WsClientMsg a message from a detection stream client, ex: {"type": "subscribe", "id": "porch", "devices": [1],
+// "types": ["detection"], "labels": ["person"], "min_confidence": 0.6}
+type WsClientMsg struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	live.Filter
+}
+
+// WsServerMsg a message to a detection stream client, ex: {"type": "detection", "subscriptions": ["porch"],
+// "detection": {...}}, {"type": "health", "subscriptions": ["porch"], "health": {...}}
+type WsServerMsg struct {
+	Type          string                 `json:"type"`
+	ID            string                 `json:"id,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	Subscriptions []string               `json:"subscriptions,omitempty"`
+	Detection     *receiver.DetectionMsg `json:"detection,omitempty"`
+	Event         *live.DeviceEvent      `json:"event,omitempty"`
+	Health        *live.Health           `json:"health,omitempty"`
+}
+
+// wsOptions browsers can only open websockets from deviceserver's own pages or config.AuthConfig's AllowedOrigins,
+// otherwise any page could use a logged-in user's session cookie to read the stream
+func wsOptions(a *app.App) *websocket.AcceptOptions {
+	return &websocket.AcceptOptions{OriginPatterns: a.Conf.Auth.AllowedOrigins}
+}
+
+// DetectionStreamHandler /detection-stream?group=<int:GroupID> - streams detections, device events & health
+// changes to a websocket client. Clients get nothing until they send a WsSubscribe, see WsClientMsg & WsServerMsg.
+// Only events from devices the caller can view are streamed, with ?group only the group's devices.
+// Group membership & grants are read when the client connects. Clients that fall behind are disconnected
+// with websocket.StatusPolicyViolation, see live.Hub
+func DetectionStreamHandler(a *app.App, hub *live.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		include, ok := detectionDeviceFilter(a, w, r)
+		if !ok {
+			return
+		}
+		c, err := websocket.Accept(w, r, wsOptions(a))
 		if err != nil {
 			logger.Error().Err(err).Send()
 			return
 		}
 		defer c.CloseNow()
+		client, err := hub.Join(include)
+		if err != nil {
+			logger.Error().Msgf("DetectionStreamHandler -> bus subscribe error: %v", err)
+			_ = c.Close(websocket.StatusInternalError, "")
+			return
+		}
+		defer hub.Leave(client)
 
-		ctx, cancel := context.WithTimeout(r.Context(), time.Minute*10)
+		ctx, cancel := context.WithCancel(r.Context())
 		defer cancel()
+		replies := make(chan WsServerMsg, 8)
+		go readDetectionStream(ctx, cancel, c, client, replies)
+		go pingDetectionStream(ctx, cancel, c)
 
-		ctx = c.CloseRead(ctx)
+		for {
+			var msg WsServerMsg
+			select {
+			case <-ctx.Done():
+				_ = c.Close(websocket.StatusNormalClosure, "")
+				return
+			case <-client.Dropped():
+				_ = c.Close(websocket.StatusPolicyViolation, "too slow")
+				return
+			case msg = <-replies:
+			case m := <-client.Events():
+				msg = WsServerMsg{Type: m.Type, Subscriptions: m.Subscriptions, Detection: m.Detection, Event: m.Device, Health: m.Health}
+			}
+			writeCtx, cancelWrite := context.WithTimeout(ctx, wsWriteTimeout)
+			err := wsjson.Write(writeCtx, c, msg)
+			cancelWrite()
+			if err != nil {
+				logger.Debug().Msgf("DetectionStreamHandler -> write error: %v", err)
+				return
+			}
+		}
+	}
+}
 
-		// Subscribe to the "detection/*" topic & proxy
-		// incoming messages to the WS client
-		// MQTT
-		qtClient := a.MqttClient.CopyWithClientId("detection-proxy" + uuid.New().String())
-		qtErr := qtClient.Connect()
-		if qtErr != nil {
+// readDetectionStream answers the client's messages until it disconnects, then cancels the stream
+func readDetectionStream(ctx context.Context, cancel context.CancelFunc, c *websocket.Conn, client *live.Client, replies chan<- WsServerMsg) {
+	defer cancel()
+	for {
+		_, data, err := c.Read(ctx)
+		if err != nil {
+			if websocket.CloseStatus(err) == -1 && ctx.Err() == nil {
+				logger.Debug().Msgf("DetectionStreamHandler -> read error: %v", err)
+			}
 			return
 		}
-		defer func(qtClient *pubsub.MqttClient) {
-			_ = qtClient.Close()
-		}(&qtClient)
-		var wg sync.WaitGroup
+		select {
+		case replies <- handleWsClientMsg(client, data):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err = qtClient.Subscribe("detection/#", func(client mqtt.Client, msg mqtt.Message) {
-				logger.Error().Msgf("detection msg received, passing to websocket client")
-				wsErr := wsjson.Write(ctx, c, string(msg.Payload()))
-				if wsErr != nil {
-					logger.Error().Msgf("error writing to WS client: %v", wsErr)
-					return
-				}
-			})
+func handleWsClientMsg(client *live.Client, data []byte) WsServerMsg {
+	var msg WsClientMsg
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return WsServerMsg{Type: WsError, Error: "invalid JSON message"}
+	}
+	switch msg.Type {
+	case WsSubscribe:
+		if err := client.Subscribe(msg.ID, msg.Filter); err != nil {
+			return WsServerMsg{Type: WsError, ID: msg.ID, Error: err.Error()}
+		}
+		return WsServerMsg{Type: WsSubscribed, ID: msg.ID}
+	case WsUnsubscribe:
+		if !client.Unsubscribe(msg.ID) {
+			return WsServerMsg{Type: WsError, ID: msg.ID, Error: "subscription not found"}
+		}
+		return WsServerMsg{Type: WsUnsubscribed, ID: msg.ID}
+	case WsPing:
+		return WsServerMsg{Type: WsPong, ID: msg.ID}
+	default:
+		return WsServerMsg{Type: WsError, ID: msg.ID, Error: "unknown message type " + strconv.Quote(msg.Type)}
+	}
+}
+
+// pingDetectionStream pings the client every wsPingInterval, cancelling the stream if it doesn't pong
+func pingDetectionStream(ctx context.Context, cancel context.CancelFunc, c *websocket.Conn) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, cancelPing := context.WithTimeout(ctx, wsPongTimeout)
+			err := c.Ping(pingCtx)
+			cancelPing()
 			if err != nil {
-				logger.Error().Msgf("mqttClient subscribe error: %v", err)
+				logger.Debug().Msgf("DetectionStreamHandler -> ping error: %v", err)
+				cancel()
 				return
 			}
-			<-ctx.Done()
-		}()
-		wg.Wait()
-		closeErr := c.Close(websocket.StatusNormalClosure, "")
-		if closeErr != nil {
-			logger.Error().Msgf("ws close error: %v", closeErr)
 		}
 	}
 }
+
+// detectionDeviceFilter reports whether a device's events can be streamed, per the caller's access & the
+// ?group param
+func detectionDeviceFilter(a *app.App, w http.ResponseWriter, r *http.Request) (func(deviceId int64) bool, bool) {
+	visible := auth.DeviceFilter(r.Context(), auth.ActionView)
+	groupParam := r.URL.Query().Get("group")
+	if groupParam == "" {
+		return visible, true
+	}
+	groupId, err := strconv.ParseInt(groupParam, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return nil, false
+	}
+	group, err := a.AppDeps.DeviceRepo.GetGroup(r.Context(), groupId)
+	if err != nil {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return nil, false
+	}
+	return func(deviceId int64) bool { return visible(deviceId) && group.HasDevice(deviceId) }, true
+}
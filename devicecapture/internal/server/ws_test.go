@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"devicecapture/internal/app"
+	"devicecapture/internal/config"
+	"devicecapture/internal/domain"
+	"devicecapture/internal/live"
+	"devicecapture/internal/pubsub"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/stretchr/testify/assert"
+)
+
+// wsRoundTrip sends msg & returns the next message from the server
+func wsRoundTrip(ctx context.Context, t *testing.T, c *websocket.Conn, msg string) WsServerMsg {
+	t.Helper()
+	if msg != "" {
+		if err := c.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var reply WsServerMsg
+	if err := wsjson.Read(ctx, c, &reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestDetectionStreamHandler(t *testing.T) {
+	a := assert.New(t)
+	bus := pubsub.NewMemoryBus()
+	hub := live.NewHub(bus)
+	testApp := app.NewApp(&config.Config{}, bus, nil, domain.NewMockDeps())
+	server := httptest.NewServer(DetectionStreamHandler(testApp, hub))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	c, _, err := websocket.Dial(ctx, url, nil)
+	if !a.NoError(err) {
+		return
+	}
+	defer c.CloseNow()
+
+	tests := []struct {
+		name string
+		msg  string
+		want WsServerMsg
+	}{
+		{name: "ping", msg: `{"type": "ping", "id": "1"}`, want: WsServerMsg{Type: WsPong, ID: "1"}},
+		{name: "invalid json", msg: `{"type": `, want: WsServerMsg{Type: WsError, Error: "invalid JSON message"}},
+		{name: "unknown type", msg: `{"type": "publish"}`, want: WsServerMsg{Type: WsError, Error: `unknown message type "publish"`}},
+		{name: "invalid filter", msg: `{"type": "subscribe", "id": "bad", "min_confidence": 2}`, want: WsServerMsg{Type: WsError, ID: "bad", Error: "invalid filter: min_confidence must be between 0 and 1"}},
+		{name: "unknown subscription", msg: `{"type": "unsubscribe", "id": "nope"}`, want: WsServerMsg{Type: WsError, ID: "nope", Error: "subscription not found"}},
+		{name: "people", msg: `{"type": "subscribe", "id": "people", "labels": ["Person"], "min_confidence": 0.5}`, want: WsServerMsg{Type: WsSubscribed, ID: "people"}},
+		{name: "device 2", msg: `{"type": "subscribe", "id": "device-2", "devices": [2]}`, want: WsServerMsg{Type: WsSubscribed, ID: "device-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, wsRoundTrip(ctx, t, c, tt.msg))
+		})
+	}
+	a.Equal(1, hub.Clients(), "every client shares the hub's subscription")
+
+	// Published synchronously, so the detections are queued in order
+	a.NoError(bus.Publish("detection/1", `{"id": 1, "device_id": 1, "label": "person", "confidence": 0.4}`))
+	a.NoError(bus.Publish("detection/1", `{"id": 2, "device_id": 1, "label": "cat", "confidence": 0.9}`))
+	a.NoError(bus.Publish("detection/1", `{"id": 3, "device_id": 1, "label": "person", "confidence": 0.9}`))
+	a.NoError(bus.Publish("detection/2", `{"id": 4, "device_id": 2, "label": "person", "confidence": 0.9}`))
+	msg := wsRoundTrip(ctx, t, c, "")
+	a.Equal(WsDetection, msg.Type)
+	if a.NotNil(msg.Detection) {
+		a.Equal(int64(3), msg.Detection.ID, "low confidence people & cats on device 1 are filtered out")
+	}
+	a.Equal([]string{"people"}, msg.Subscriptions)
+	msg = wsRoundTrip(ctx, t, c, "")
+	if a.NotNil(msg.Detection) {
+		a.Equal(int64(4), msg.Detection.ID)
+	}
+	a.Equal([]string{"device-2", "people"}, msg.Subscriptions)
+
+	a.Equal(WsServerMsg{Type: WsUnsubscribed, ID: "people"}, wsRoundTrip(ctx, t, c, `{"type": "unsubscribe", "id": "people"}`))
+	a.Equal(WsServerMsg{Type: WsUnsubscribed, ID: "device-2"}, wsRoundTrip(ctx, t, c, `{"type": "unsubscribe", "id": "device-2"}`))
+	a.NoError(bus.Publish("detection/2", `{"id": 5, "device_id": 2, "label": "person", "confidence": 0.9}`))
+	a.Equal(WsServerMsg{Type: WsPong}, wsRoundTrip(ctx, t, c, `{"type": "ping"}`), "no subscriptions, no detections")
+}
@@ -0,0 +1,71 @@
+// Package signedurl signs deviceserver URLs so clients that can't log in, ex: Home Assistant fetching a detection's
+// frame, can GET them until they expire. devicecapture signs the URLs it publishes & deviceserver checks them, so both
+// need the same key, see config.AuthConfig
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Query parameters added to signed URLs
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "sig"
+)
+
+type Signer struct {
+	key []byte
+	// TTL how long signed URLs are valid for
+	TTL time.Duration
+	now func() time.Time
+}
+
+// New a Signer for key, nil when key is empty so URLs are published without signatures
+func New(key string, ttl time.Duration) *Signer {
+	if key == "" {
+		return nil
+	}
+	return &Signer{key: []byte(key), TTL: ttl, now: time.Now}
+}
+
+// Sign adds an expiry & a signature of the URL's path & expiry to its query. A nil Signer returns rawUrl as it is.
+// The rest of the query isn't signed, it only picks a variant of the same frame, ex: ?annotated=1 or ?size=thumb
+func (s *Signer) Sign(rawUrl string) string {
+	if s == nil {
+		return rawUrl
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	expires := s.now().Add(s.TTL).Unix()
+	q := u.Query()
+	q.Set(ExpiresParam, strconv.FormatInt(expires, 10))
+	q.Set(SignatureParam, s.signature(u.Path, expires))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Valid whether u carries a signature of its path that hasn't expired
+func (s *Signer) Valid(u *url.URL) bool {
+	if s == nil {
+		return false
+	}
+	q := u.Query()
+	expires, err := strconv.ParseInt(q.Get(ExpiresParam), 10, 64)
+	if err != nil || s.now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(q.Get(SignatureParam)), []byte(s.signature(u.Path, expires)))
+}
+
+func (s *Signer) signature(path string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,47 @@
+package signedurl
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	s := New("secret", 15*time.Minute)
+	s.now = func() time.Time { return now }
+	signed := s.Sign("http://192.168.1.20:4000/blobs/videos/1-1/output-1-1.jpeg?annotated=1")
+
+	tests := []struct {
+		name  string
+		url   string
+		after time.Duration
+		want  bool
+	}{
+		{name: "signed", url: signed, want: true},
+		{name: "other variants of the frame", url: signed + "&size=thumb", want: true},
+		{name: "expired", url: signed, after: 16 * time.Minute, want: false},
+		{name: "other frame", url: "http://192.168.1.20:4000/blobs/videos/1-1/output-1-2.jpeg?" + must(url.Parse(signed)).RawQuery, want: false},
+		{name: "unsigned", url: "http://192.168.1.20:4000/blobs/videos/1-1/output-1-1.jpeg", want: false},
+		{name: "other key", url: New("other", time.Minute).Sign("http://192.168.1.20:4000/blobs/videos/1-1/output-1-1.jpeg"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = time.UnixMilli(1700000000000).Add(tt.after)
+			assert.Equal(t, tt.want, s.Valid(must(url.Parse(tt.url))))
+		})
+	}
+
+	var unsigned *Signer
+	assert.Equal(t, "http://192.168.1.20:4000/image-stream/1", unsigned.Sign("http://192.168.1.20:4000/image-stream/1"), "nil signers leave URLs as they are")
+	assert.False(t, unsigned.Valid(must(url.Parse(signed))))
+}
+
+func must(u *url.URL, err error) *url.URL {
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
@@ -0,0 +1,140 @@
+// Package variants generates & caches resized copies of stored frames, ex: thumbnails for grid views.
+// Variants are stored alongside the original: videos/1-123/output-1-456.jpeg -> videos/1-123/output-1-456_thumb.jpeg
+package variants
+
+import (
+	"bytes"
+	"context"
+	"devicecapture/internal/blob"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// Size a named variant, scaled so its longest side is at most MaxDim
+type Size struct {
+	Name   string
+	MaxDim int
+}
+
+var (
+	Thumb  = Size{Name: "thumb", MaxDim: 160}
+	Medium = Size{Name: "medium", MaxDim: 640}
+	// Sizes every variant we generate, in order
+	Sizes = []Size{Thumb, Medium}
+)
+
+var ErrUnknownSize = errors.New("unknown image size")
+
+// SizeByName look up a Size, ex: from a ?size= query param
+func SizeByName(name string) (Size, error) {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return Size{}, fmt.Errorf("%w: %s", ErrUnknownSize, name)
+}
+
+// Key the blob key of an image's variant
+func Key(originalKey string, size Size) string {
+	ext := path.Ext(originalKey)
+	return strings.TrimSuffix(originalKey, ext) + "_" + size.Name + ext
+}
+
+// locks one lock per variant key, so concurrent requests only generate a variant once
+var locks sync.Map
+
+// Get returns the key of an image's variant, generating it from the original if it isn't stored yet
+func Get(ctx context.Context, store blob.Store, originalKey string, size Size) (string, error) {
+	vk := Key(originalKey, size)
+	if _, err := store.Stat(ctx, vk); err == nil {
+		return vk, nil
+	}
+	mu, _ := locks.LoadOrStore(vk, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer func() {
+		mu.(*sync.Mutex).Unlock()
+		locks.Delete(vk)
+	}()
+	// Someone else may have generated it while we waited
+	if _, err := store.Stat(ctx, vk); err == nil {
+		return vk, nil
+	}
+	r, _, err := store.Get(ctx, originalKey)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return "", err
+	}
+	return vk, write(ctx, store, vk, Resize(img, size))
+}
+
+// GenerateAll eagerly writes every variant for an already decoded image
+func GenerateAll(ctx context.Context, store blob.Store, img image.Image, originalKey string) error {
+	var errs []error
+	for _, size := range Sizes {
+		if err := write(ctx, store, Key(originalKey, size), Resize(img, size)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Remove deletes images along with every variant of them, ex: an original & its annotated copy.
+// Empty keys are skipped
+func Remove(ctx context.Context, store blob.Store, keys ...string) error {
+	var errs []error
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		toDelete := []string{k}
+		for _, size := range Sizes {
+			toDelete = append(toDelete, Key(k, size))
+		}
+		for _, dk := range toDelete {
+			if err := store.Delete(ctx, dk); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Resize scales img so its longest side is at most size.MaxDim. Smaller images are returned as-is
+func Resize(img image.Image, size Size) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size.MaxDim && h <= size.MaxDim {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*size.MaxDim/w)
+		w = size.MaxDim
+	} else {
+		w = max(1, w*size.MaxDim/h)
+		h = size.MaxDim
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// write encodes img as a JPEG & stores it
+func write(ctx context.Context, store blob.Store, key string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80}); err != nil {
+		return err
+	}
+	return store.Put(ctx, key, buf.Bytes(), "image/jpeg")
+}
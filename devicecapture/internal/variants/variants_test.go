@@ -0,0 +1,107 @@
+package variants
+
+import (
+	"bytes"
+	"devicecapture/internal/blob"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestJpeg(t *testing.T, fp string, w, h int) {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fp, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decodeSize(t *testing.T, fp string) image.Point {
+	f, err := os.Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := jpeg.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image.Pt(cfg.Width, cfg.Height)
+}
+
+func TestKey(t *testing.T) {
+	assert.Equal(t, "videos/1-123/output-1-456_thumb.jpeg", Key("videos/1-123/output-1-456.jpeg", Thumb))
+}
+
+func TestSizeByName(t *testing.T) {
+	a := assert.New(t)
+	size, err := SizeByName("medium")
+	a.NoError(err)
+	a.Equal(Medium, size)
+	_, err = SizeByName("huge")
+	a.ErrorIs(err, ErrUnknownSize)
+}
+
+func TestGet_GeneratesLazily(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	dir := t.TempDir()
+	store := blob.NewLocalStore(dir)
+	original := "videos/1-123/output-1-456.jpeg"
+	writeTestJpeg(t, filepath.Join(dir, original), 800, 400)
+
+	vk, err := Get(ctx, store, original, Thumb)
+	a.NoError(err)
+	a.Equal(Key(original, Thumb), vk)
+	a.Equal(image.Pt(160, 80), decodeSize(t, filepath.Join(dir, vk)), "aspect ratio is preserved")
+
+	info, err := store.Stat(ctx, vk)
+	a.NoError(err)
+	cached, err := Get(ctx, store, original, Thumb)
+	a.NoError(err)
+	cachedInfo, err := store.Stat(ctx, cached)
+	a.NoError(err)
+	a.Equal(info.ModTime, cachedInfo.ModTime, "cached variants are not regenerated")
+
+	_, err = Get(ctx, store, "videos/missing.jpeg", Thumb)
+	a.ErrorIs(err, blob.ErrNotFound)
+}
+
+func TestGenerateAll_And_Remove(t *testing.T) {
+	a := assert.New(t)
+	ctx := t.Context()
+	dir := t.TempDir()
+	store := blob.NewLocalStore(dir)
+	original := "output-1-456.jpeg"
+	annotated := "output-1-456_detection.jpeg"
+	writeTestJpeg(t, filepath.Join(dir, original), 300, 600)
+	writeTestJpeg(t, filepath.Join(dir, annotated), 300, 600)
+
+	img := image.NewRGBA(image.Rect(0, 0, 300, 600))
+	a.NoError(GenerateAll(ctx, store, img, original))
+	a.Equal(image.Pt(80, 160), decodeSize(t, filepath.Join(dir, Key(original, Thumb))))
+	a.Equal(image.Pt(300, 600), decodeSize(t, filepath.Join(dir, Key(original, Medium))), "small images are not upscaled")
+	_, err := Get(ctx, store, annotated, Thumb)
+	a.NoError(err)
+
+	a.NoError(Remove(ctx, store, original, annotated))
+	entries, err := os.ReadDir(dir)
+	a.NoError(err)
+	a.Empty(entries, "the original, annotated copy & all variants are removed")
+}